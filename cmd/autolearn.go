@@ -20,7 +20,7 @@ var autoLearnCmd = &cobra.Command{
 		prompt := args[0]
 		command := args[1]
 		category := args[2]
-		rag.LearnFromSuccess(cmd.Context(), prompt, command, category)
+		rag.LearnFromSuccess(cmd.Context(), rag.NewEmbedClient(), prompt, command, category)
 		return nil
 	},
 }
@@ -40,7 +40,34 @@ var feedbackCmd = &cobra.Command{
 	RunE: func(cmd *cobra.Command, args []string) error {
 		prompt := args[0]
 		success := args[1] == "success"
-		rag.RecordFeedback(cmd.Context(), prompt, success)
+		rag.RecordFeedback(cmd.Context(), rag.NewEmbedClient(), prompt, success)
+		return nil
+	},
+}
+
+// learnFixCmd is a hidden subcommand that records a failure→fix pair in a
+// detached subprocess. After a SmartRetry fix succeeds, run.go spawns
+// `xx _learn-fix <failed command> <error> <fix>` so the next retry on a
+// similar error can see what worked.
+var learnFixCmd = &cobra.Command{
+	Use:    "_learn-fix",
+	Hidden: true,
+	Args:   cobra.ExactArgs(3),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		rag.LearnFix(cmd.Context(), rag.NewEmbedClient(), args[0], args[1], args[2])
+		return nil
+	},
+}
+
+// learnCorrectionCmd is a hidden subcommand that adds a correction taught
+// with `xx learn` to the vector store in a detached subprocess, so RAG can
+// retrieve it right away instead of after the next `xx index`.
+var learnCorrectionCmd = &cobra.Command{
+	Use:    "_learn-correction",
+	Hidden: true,
+	Args:   cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		rag.LearnCorrection(cmd.Context(), rag.NewEmbedClient(), args[0], args[1])
 		return nil
 	},
 }
@@ -2,9 +2,14 @@ package cmd
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
 	"strings"
+	"time"
 
 	"github.com/arin/xx-cli/internal/ai"
 	"github.com/arin/xx-cli/internal/config"
@@ -13,63 +18,144 @@ import (
 	"github.com/spf13/cobra"
 )
 
+// defaultChatTimeout bounds each chat reply when --timeout isn't given.
+const defaultChatTimeout = 2 * time.Minute
+
+var chatTimeout time.Duration
+
 var chatCmd = &cobra.Command{
 	Use:   "chat",
 	Short: "Start an interactive chat session",
 	Long: `Start a conversational session with xx. Ask questions,
 get guided through tasks, and have context carry over between messages.
 
-Type 'exit' or 'quit' to end the session.`,
+Type 'exit' or 'quit' to end the session. Press Ctrl+C while xx is
+answering to cancel that reply and get the prompt back; a reply that takes
+longer than --timeout (0 for no limit) is cancelled the same way.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		cfg, err := config.Load()
 		if err != nil {
 			return fmt.Errorf("configuration error: %w", err)
 		}
 
-		client := ai.NewClient(cfg)
+		client := newClient(cfg)
 		cyan := color.New(color.FgCyan, color.Bold)
 		dim := color.New(color.FgHiBlack)
-		green := color.New(color.FgGreen)
 
 		fmt.Fprintln(os.Stderr)
 		cyan.Fprintln(os.Stderr, "  xx chat")
 		dim.Fprintln(os.Stderr, "  Your friendly terminal buddy. Ask me anything.")
 		dim.Fprintf(os.Stderr, "  Type 'exit' to quit.\n\n")
 
-		scanner := bufio.NewScanner(os.Stdin)
-		var history []ai.ChatMessage
+		chatLoop(cmd.Context(), os.Stdin, os.Stderr, nil, chatTimeout, client.ChatStream)
+		return nil
+	},
+}
 
-		for {
-			green.Fprint(os.Stderr, "  you → ")
-			if !scanner.Scan() {
-				break
-			}
+func init() {
+	chatCmd.Flags().DurationVar(&chatTimeout, "timeout", defaultChatTimeout, "Cancel a reply that takes longer than this (0 for no limit)")
+}
 
-			input := strings.TrimSpace(scanner.Text())
-			if input == "" {
-				continue
-			}
-			if input == "exit" || input == "quit" || input == "bye" {
-				dim.Fprintf(os.Stderr, "\n  Later! 👋\n\n")
-				break
-			}
+// chatLoop runs an interactive conversation: it reads the user's messages
+// from in, streams each reply to out, and carries the history between turns.
+// history seeds the conversation (nil for a fresh chat); send builds the
+// reply stream for the conversation so far.
+//
+// Each reply gets its own context, cancelled by Ctrl+C or after timeout
+// (0 for none). A cancelled reply is dropped, along with the message that
+// asked for it, and the loop goes back to the prompt.
+func chatLoop(ctx context.Context, in io.Reader, out io.Writer, history []ai.ChatMessage, timeout time.Duration, send func(context.Context, []ai.ChatMessage) <-chan ai.StreamDelta) {
+	cyan := color.New(color.FgCyan, color.Bold)
+	dim := color.New(color.FgHiBlack)
+	green := color.New(color.FgGreen)
 
-			history = append(history, ai.ChatMessage{Role: "user", Content: input})
+	scanner := bufio.NewScanner(in)
+	for {
+		green.Fprint(out, "  you → ")
+		if !scanner.Scan() {
+			break
+		}
+
+		input := strings.TrimSpace(scanner.Text())
+		if input == "" {
+			continue
+		}
+		if input == "exit" || input == "quit" || input == "bye" {
+			dim.Fprintf(out, "\n  Later! 👋\n\n")
+			break
+		}
 
-			// Stream the response token by token.
-			stream := client.ChatStream(cmd.Context(), history)
+		history = append(history, ai.ChatMessage{Role: "user", Content: input})
 
-			cyan.Fprintf(os.Stderr, "  xx → ")
-			reply, err := ui.RenderStream(os.Stderr, stream, "")
+		// Stream the response token by token.
+		cyan.Fprintf(out, "  xx → ")
+		msgCtx, cancel := chatMessageContext(ctx, timeout)
+		reply, err := ui.RenderStream(out, untilDone(msgCtx, send(msgCtx, history)), "")
+		cancelled := msgCtx.Err()
+		cancel()
 
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "  Error: %v\n\n", err)
-				continue
+		if cancelled != nil && ctx.Err() == nil {
+			history = history[:len(history)-1]
+			if errors.Is(cancelled, context.DeadlineExceeded) {
+				dim.Fprintf(out, "  (no reply after %s — cancelled)\n\n", timeout)
+			} else {
+				dim.Fprintf(out, "  (cancelled)\n\n")
 			}
-
-			history = append(history, ai.ChatMessage{Role: "assistant", Content: reply})
+			continue
+		}
+		if err != nil {
+			fmt.Fprintf(out, "  Error: %v\n\n", err)
+			continue
 		}
 
-		return nil
-	},
+		history = append(history, ai.ChatMessage{Role: "assistant", Content: reply})
+	}
+}
+
+// chatMessageContext derives the context for one chat reply: it's
+// cancelled by Ctrl+C, which would otherwise end the session, or once
+// timeout has passed if it's positive.
+func chatMessageContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	if timeout <= 0 {
+		return ctx, stop
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	return ctx, func() {
+		cancel()
+		stop()
+	}
+}
+
+// untilDone forwards ch until ctx is done, then reports ctx's error and
+// closes, so a provider that doesn't notice the cancellation can't hold up
+// the loop. Whatever ch still sends is drained in the background.
+func untilDone(ctx context.Context, ch <-chan ai.StreamDelta) <-chan ai.StreamDelta {
+	out := make(chan ai.StreamDelta, 1)
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case d, ok := <-ch:
+				if !ok {
+					return
+				}
+				select {
+				case out <- d:
+				case <-ctx.Done():
+				}
+			case <-ctx.Done():
+				select {
+				case out <- ai.StreamDelta{Err: ctx.Err()}:
+				default:
+				}
+				go func() {
+					for range ch {
+					}
+				}()
+				return
+			}
+		}
+	}()
+	return out
 }
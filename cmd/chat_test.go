@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arin/xx-cli/internal/ai"
+)
+
+// replyStream returns a stream that sends text and finishes.
+func replyStream(text string) <-chan ai.StreamDelta {
+	ch := make(chan ai.StreamDelta, 2)
+	ch <- ai.StreamDelta{Token: text}
+	ch <- ai.StreamDelta{Done: true}
+	close(ch)
+	return ch
+}
+
+func TestChatLoop_TimeoutCancelsReplyAndContinues(t *testing.T) {
+	in := strings.NewReader("hang please\nare you back?\nexit\n")
+	var out bytes.Buffer
+	var calls [][]ai.ChatMessage
+	chatLoop(context.Background(), in, &out, nil, 20*time.Millisecond, func(ctx context.Context, history []ai.ChatMessage) <-chan ai.StreamDelta {
+		calls = append(calls, history)
+		if len(calls) == 1 {
+			// A provider that never answers and never closes its stream.
+			return make(chan ai.StreamDelta)
+		}
+		return replyStream("yes")
+	})
+
+	if len(calls) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(calls))
+	}
+	if !strings.Contains(out.String(), "no reply after 20ms") {
+		t.Errorf("timeout should be reported, got %q", out.String())
+	}
+	if !strings.Contains(out.String(), "yes") {
+		t.Errorf("the loop should carry on after the timeout, got %q", out.String())
+	}
+	// The unanswered question is dropped from the conversation.
+	if got := calls[1]; len(got) != 1 || got[0].Content != "are you back?" {
+		t.Errorf("second request history = %+v", got)
+	}
+}
+
+func TestChatLoop_InterruptCancelsOnlyTheReply(t *testing.T) {
+	self, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Skip(err)
+	}
+	in := strings.NewReader("long answer\nshort one\nexit\n")
+	var out bytes.Buffer
+	var calls int
+	chatLoop(context.Background(), in, &out, nil, 0, func(ctx context.Context, history []ai.ChatMessage) <-chan ai.StreamDelta {
+		calls++
+		if calls == 1 {
+			if err := self.Signal(os.Interrupt); err != nil {
+				t.Skipf("can't send an interrupt here: %v", err)
+			}
+			// Honour the context, as the real providers do.
+			ch := make(chan ai.StreamDelta)
+			go func() {
+				<-ctx.Done()
+				ch <- ai.StreamDelta{Err: ctx.Err()}
+				close(ch)
+			}()
+			return ch
+		}
+		return replyStream("done")
+	})
+
+	if calls != 2 {
+		t.Fatalf("expected 2 requests, got %d", calls)
+	}
+	if !strings.Contains(out.String(), "(cancelled)") || !strings.Contains(out.String(), "done") {
+		t.Errorf("Ctrl+C should cancel the first reply and keep the session, got %q", out.String())
+	}
+}
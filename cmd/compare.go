@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/arin/xx-cli/internal/ai"
+	"github.com/arin/xx-cli/internal/config"
+	"github.com/arin/xx-cli/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+var compareModelsFlag []string
+
+var compareCmd = &cobra.Command{
+	Use:   "compare <prompt>",
+	Short: "Compare how different models translate the same prompt",
+	Long: `Translate one prompt with several Ollama models and show their commands,
+intents, and latencies side by side. Nothing is executed.
+
+Models run one after another so their latencies don't compete for the GPU.
+
+Examples:
+  xx compare "find large files" --models llama3.2:latest,qwen2.5-coder:7b`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(compareModelsFlag) < 2 {
+			return fmt.Errorf("need at least two models to compare, e.g. --models llama3.2:latest,qwen2.5:7b")
+		}
+
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("configuration error: %w", err)
+		}
+
+		prompt := strings.Join(args, " ")
+		models := make([]namedClient, len(compareModelsFlag))
+		for i, m := range compareModelsFlag {
+			p := ai.NewOllamaProvider(m)
+			p.SetTimeout(cfg.RequestTimeout())
+			models[i] = namedClient{model: m, client: ai.NewClientWithProvider(p)}
+		}
+
+		sp := ui.NewSpinner("Comparing models...")
+		sp.Start()
+		results := compareModels(cmd.Context(), prompt, models)
+		sp.Stop()
+
+		fmt.Fprintln(os.Stderr)
+		renderComparison(os.Stdout, results)
+		fmt.Fprintln(os.Stderr)
+		return nil
+	},
+}
+
+// namedClient pairs a model name with a client that talks to it.
+type namedClient struct {
+	model  string
+	client *ai.Client
+}
+
+// comparison is one model's translation of the prompt.
+type comparison struct {
+	model   string
+	result  *ai.Result
+	latency time.Duration
+	err     error
+}
+
+// compareModels translates prompt with each client in turn and records the
+// result (or error) and latency of each.
+func compareModels(ctx context.Context, prompt string, models []namedClient) []comparison {
+	out := make([]comparison, 0, len(models))
+	for _, m := range models {
+		start := time.Now()
+		result, err := m.client.Translate(ctx, prompt)
+		out = append(out, comparison{model: m.model, result: result, latency: time.Since(start), err: err})
+	}
+	return out
+}
+
+// renderComparison prints one row per model as an aligned table.
+func renderComparison(w io.Writer, results []comparison) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "  MODEL\tINTENT\tLATENCY\tCOMMAND")
+	for _, c := range results {
+		latency := c.latency.Round(time.Millisecond)
+		if c.err != nil {
+			fmt.Fprintf(tw, "  %s\t-\t%s\terror: %v\n", c.model, latency, c.err)
+			continue
+		}
+		command := c.result.Command
+		if c.result.Intent == ai.IntentWorkflow {
+			steps := make([]string, len(c.result.Steps))
+			for i, s := range c.result.Steps {
+				steps[i] = s.Command
+			}
+			command = strings.Join(steps, " → ")
+		}
+		fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\n", c.model, c.result.Intent, latency, command)
+	}
+	tw.Flush()
+}
+
+func init() {
+	compareCmd.Flags().StringSliceVar(&compareModelsFlag, "models", nil, "comma-separated Ollama models to compare (at least two)")
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/arin/xx-cli/internal/ai"
+)
+
+// fixedProvider returns the same canned response for every call.
+type fixedProvider struct {
+	response string
+	err      error
+}
+
+func (p *fixedProvider) Complete(context.Context, []ai.Message, ai.CompleteOptions) (string, error) {
+	return p.response, p.err
+}
+
+func TestCompareModels_TwoModels(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	models := []namedClient{
+		{model: "model-a", client: ai.NewClientWithProvider(&fixedProvider{response: `{"command": "du -sh * | sort -h", "intent": "display"}`})},
+		{model: "model-b", client: ai.NewClientWithProvider(&fixedProvider{response: `{"command": "find . -size +100M", "intent": "query"}`})},
+	}
+
+	results := compareModels(context.Background(), "find large files", models)
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+	if results[0].model != "model-a" || results[0].result.Command != "du -sh * | sort -h" {
+		t.Errorf("unexpected first result: %+v", results[0])
+	}
+	if results[1].model != "model-b" || results[1].result.Intent != ai.IntentQuery {
+		t.Errorf("unexpected second result: %+v", results[1])
+	}
+
+	var buf bytes.Buffer
+	renderComparison(&buf, results)
+	out := buf.String()
+	for _, want := range []string{"MODEL", "model-a", "du -sh * | sort -h", "model-b", "find . -size +100M", "query"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("comparison output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestCompareModels_ErrorDoesNotStopOthers(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	models := []namedClient{
+		{model: "broken", client: ai.NewClientWithProvider(&fixedProvider{err: errors.New("model not found")})},
+		{model: "working", client: ai.NewClientWithProvider(&fixedProvider{response: `{"command": "ls", "intent": "display"}`})},
+	}
+
+	results := compareModels(context.Background(), "list files", models)
+	if results[0].err == nil || results[1].err != nil || results[1].result.Command != "ls" {
+		t.Errorf("one model failing should not affect the other: %+v", results)
+	}
+
+	var buf bytes.Buffer
+	renderComparison(&buf, results)
+	if !strings.Contains(buf.String(), "error: model not found") {
+		t.Errorf("failed model should show its error:\n%s", buf.String())
+	}
+}
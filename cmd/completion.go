@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/arin/xx-cli/internal/ai"
+	"github.com/arin/xx-cli/internal/config"
+	"github.com/arin/xx-cli/internal/learn"
+	"github.com/spf13/cobra"
+)
+
+var completionCmd = &cobra.Command{
+	Use:   "completion [bash|zsh|fish|powershell]",
+	Short: "Generate a shell completion script",
+	Long: `Generate a tab-completion script for subcommands and flags.
+
+Load it from your shell config:
+  source <(xx completion zsh)          # ~/.zshrc
+  source <(xx completion bash)         # ~/.bashrc
+  xx completion fish | source          # ~/.config/fish/config.fish
+  xx completion powershell | Out-String | Invoke-Expression   # $PROFILE`,
+	Args:                  cobra.ExactArgs(1),
+	ValidArgs:             []string{"bash", "zsh", "fish", "powershell"},
+	DisableFlagsInUseLine: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return writeCompletion(os.Stdout, args[0])
+	},
+}
+
+// writeCompletion writes the completion script for shell to w.
+func writeCompletion(w io.Writer, shell string) error {
+	switch shell {
+	case "bash":
+		return rootCmd.GenBashCompletionV2(w, true)
+	case "zsh":
+		return rootCmd.GenZshCompletion(w)
+	case "fish":
+		return rootCmd.GenFishCompletion(w, true)
+	case "powershell":
+		return rootCmd.GenPowerShellCompletionWithDesc(w)
+	default:
+		return fmt.Errorf("unsupported shell: %s (supported: bash, zsh, fish, powershell)", shell)
+	}
+}
+
+// completeLearnedPrompts completes `xx learn --forget` with stored prompts.
+func completeLearnedPrompts(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	corrections, err := learn.LoadAll()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	var prompts []string
+	for _, c := range corrections {
+		if strings.HasPrefix(c.Prompt, toComplete) {
+			prompts = append(prompts, c.Prompt)
+		}
+	}
+	return prompts, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completionTimeout keeps tab completion snappy when the provider is slow or down.
+const completionTimeout = 2 * time.Second
+
+// listModels returns the installed models for completion. It's a variable
+// so tests don't need a running Ollama.
+var listModels = func(ctx context.Context) ([]string, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, err
+	}
+	lister, ok := ai.NewProvider(cfg).(ai.ModelLister)
+	if !ok {
+		return nil, fmt.Errorf("provider can't list models")
+	}
+	return lister.ListModels(ctx)
+}
+
+// completeModels completes `xx config set-model` with installed models.
+func completeModels(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), completionTimeout)
+	defer cancel()
+
+	models, err := listModels(ctx)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var matches []string
+	for _, m := range models {
+		if strings.HasPrefix(m, toComplete) {
+			matches = append(matches, m)
+		}
+	}
+	return matches, cobra.ShellCompDirectiveNoFileComp
+}
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/arin/xx-cli/internal/learn"
+	"github.com/spf13/cobra"
+)
+
+func TestWriteCompletion_AllShells(t *testing.T) {
+	for _, shell := range completionCmd.ValidArgs {
+		var buf bytes.Buffer
+		if err := writeCompletion(&buf, shell); err != nil {
+			t.Errorf("%s: unexpected error: %v", shell, err)
+			continue
+		}
+		if buf.Len() == 0 {
+			t.Errorf("%s: completion script is empty", shell)
+		}
+		if !strings.Contains(buf.String(), "xx") {
+			t.Errorf("%s: completion script doesn't mention the command", shell)
+		}
+	}
+}
+
+func TestWriteCompletion_UnknownShell(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeCompletion(&buf, "tcsh"); err == nil {
+		t.Error("expected an error for an unsupported shell")
+	}
+}
+
+func TestCompleteLearnedPrompts(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	for _, c := range []learn.Correction{
+		{Prompt: "deploy staging", Command: "./deploy.sh staging"},
+		{Prompt: "deploy prod", Command: "./deploy.sh prod"},
+		{Prompt: "run tests", Command: "make test"},
+	} {
+		if err := learn.Save(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, directive := completeLearnedPrompts(learnCmd, nil, "deploy")
+	if strings.Join(got, ",") != "deploy staging,deploy prod" {
+		t.Errorf("unexpected candidates: %v", got)
+	}
+	if directive != cobra.ShellCompDirectiveNoFileComp {
+		t.Errorf("unexpected directive: %v", directive)
+	}
+
+	got, _ = completeLearnedPrompts(learnCmd, nil, "")
+	if len(got) != 3 {
+		t.Errorf("empty prefix should list all prompts, got %v", got)
+	}
+}
+
+func TestCompleteModels(t *testing.T) {
+	orig := listModels
+	listModels = func(ctx context.Context) ([]string, error) {
+		return []string{"llama3.2:latest", "llama3.1:8b", "qwen2.5-coder:7b"}, nil
+	}
+	defer func() { listModels = orig }()
+
+	got, _ := completeModels(setModelCmd, nil, "llama")
+	if strings.Join(got, ",") != "llama3.2:latest,llama3.1:8b" {
+		t.Errorf("unexpected candidates: %v", got)
+	}
+
+	got, _ = completeModels(setModelCmd, []string{"llama3.2:latest"}, "")
+	if len(got) != 0 {
+		t.Errorf("only one model argument should be completed, got %v", got)
+	}
+}
+
+func TestCompleteModels_OllamaDown(t *testing.T) {
+	orig := listModels
+	listModels = func(ctx context.Context) ([]string, error) {
+		return nil, errors.New("connection refused")
+	}
+	defer func() { listModels = orig }()
+
+	got, directive := completeModels(setModelCmd, nil, "")
+	if len(got) != 0 || directive != cobra.ShellCompDirectiveNoFileComp {
+		t.Errorf("expected no candidates, got %v (%v)", got, directive)
+	}
+}
@@ -1,9 +1,13 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
+	"strings"
 
 	"github.com/arin/xx-cli/internal/config"
+	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 )
 
@@ -12,23 +16,51 @@ var configCmd = &cobra.Command{
 	Short: "Manage xx-cli configuration",
 }
 
+var showJSON bool
+
+var setCmd = &cobra.Command{
+	Use:   "set <key> <value>",
+	Short: "Set a configuration value",
+	Long: `Set any configuration value by key.
+
+Keys:
+  ` + strings.Join(config.Keys(), "\n  ") + `
+
+Examples:
+  xx config set model llama3.1:latest
+  xx config set api_key gsk_...`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := config.Set(args[0], args[1]); err != nil {
+			return err
+		}
+		if args[0] == "api_key" {
+			warnAPIKey(args[1])
+		}
+		fmt.Printf("Set %s.\n", args[0])
+		return nil
+	},
+}
+
 var setKeyCmd = &cobra.Command{
 	Use:   "set-key <api-key>",
-	Short: "Set your API key",
+	Short: "Set your OpenAI or Groq API key (alias for: config set api_key)",
 	Args:  cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if err := config.SetAPIKey(args[0]); err != nil {
 			return fmt.Errorf("failed to save API key: %w", err)
 		}
+		warnAPIKey(args[0])
 		fmt.Println("API key saved successfully.")
 		return nil
 	},
 }
 
 var setModelCmd = &cobra.Command{
-	Use:   "set-model <model-name>",
-	Short: "Set the Ollama model (default: llama3.2:latest)",
-	Args:  cobra.ExactArgs(1),
+	Use:               "set-model <model-name>",
+	Short:             "Set the model (alias for: config set model)",
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeModels,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if err := config.SetModel(args[0]); err != nil {
 			return fmt.Errorf("failed to save model: %w", err)
@@ -38,6 +70,51 @@ var setModelCmd = &cobra.Command{
 	},
 }
 
+var setTempCmd = &cobra.Command{
+	Use:   "set-temp <n>",
+	Short: "Set the sampling temperature for every request (alias for: config set temperature)",
+	Long: fmt.Sprintf(`Set the sampling temperature, from 0 to %g, for every request. Lower is
+more predictable, higher more varied.
+
+By default xx uses a low temperature for commands and a higher one for
+chat, explanations and recaps; a set temperature overrides both.
+
+Examples:
+  xx config set-temp 0.3
+
+Go back to the defaults with:
+  xx config set-temp default`, config.MaxTemperature),
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := config.SetTemperature(args[0]); err != nil {
+			return fmt.Errorf("failed to save temperature: %w", err)
+		}
+		fmt.Printf("Temperature set to %s.\n", args[0])
+		return nil
+	},
+}
+
+var setInstructionCmd = &cobra.Command{
+	Use:   "set-instruction <text>",
+	Short: "Add your own instructions to the AI prompt (alias for: config set extra_instructions)",
+	Long: fmt.Sprintf(`Add instructions that xx appends to the system prompt after its built-in
+rules, to tweak its behavior. Limited to %d characters.
+
+Examples:
+  xx config set-instruction "always prefer fd over find and rg over grep"
+
+Clear them with:
+  xx config set extra_instructions ""`, config.MaxExtraInstructions),
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := config.SetExtraInstructions(strings.Join(args, " ")); err != nil {
+			return fmt.Errorf("failed to save instructions: %w", err)
+		}
+		fmt.Println("Instructions saved.")
+		return nil
+	},
+}
+
 var showCmd = &cobra.Command{
 	Use:   "show",
 	Short: "Show current configuration",
@@ -46,19 +123,91 @@ var showCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
-		fmt.Printf("Model:      %s\n", cfg.Model)
+		if showJSON {
+			data, err := json.MarshalIndent(cfg.View(), "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(data))
+			return nil
+		}
+		printSetting("Provider", cfg.ActiveProvider())
+		printSetting("Model", cfg.Model)
+		if cfg.Temperature != nil {
+			printSetting("Temperature", fmt.Sprintf("%g", *cfg.Temperature))
+		}
+		if cfg.TimeoutSeconds != nil {
+			if *cfg.TimeoutSeconds == 0 {
+				printSetting("Timeout", "none")
+			} else {
+				printSetting("Timeout", fmt.Sprintf("%ds", *cfg.TimeoutSeconds))
+			}
+		}
+		if cfg.ExecTimeoutSeconds != nil {
+			if *cfg.ExecTimeoutSeconds == 0 {
+				printSetting("Exec timeout", "none")
+			} else {
+				printSetting("Exec timeout", fmt.Sprintf("%ds", *cfg.ExecTimeoutSeconds))
+			}
+		}
+		if cfg.MaxOutputBytes > 0 {
+			printSetting("Max output", fmt.Sprintf("%d bytes", cfg.MaxOutputBytes))
+		}
 		if cfg.APIKey != "" {
-			fmt.Printf("API Key:    %s...%s\n", cfg.APIKey[:4], cfg.APIKey[len(cfg.APIKey)-4:])
+			printSetting("API Key", config.MaskAPIKey(cfg.APIKey))
 		} else {
-			fmt.Println("API Key:    (not set — using Ollama local)")
+			printSetting("API Key", "(not set)")
+		}
+		if cfg.ExtraInstructions != "" {
+			printSetting("Instructions", cfg.ExtraInstructions)
+		}
+		if cfg.LearnDedupThreshold > 0 {
+			printSetting("Learn Dedup", fmt.Sprintf("%g", cfg.LearnDedupThreshold))
 		}
-		fmt.Printf("Config Dir: %s\n", config.Dir())
+		if cfg.FeedbackMinScore > 0 {
+			printSetting("Feedback Min", fmt.Sprintf("%g", cfg.FeedbackMinScore))
+		}
+		if cfg.FeedbackTopK > 0 {
+			printSetting("Feedback Top K", fmt.Sprintf("%d", cfg.FeedbackTopK))
+		}
+		if cfg.WeekStart != "" {
+			printSetting("Week Start", cfg.WeekStart)
+		}
+		if cfg.PostExecHook != "" {
+			printSetting("Post-exec hook", cfg.PostExecHook)
+		}
+		if cfg.PagerLines > 0 {
+			printSetting("Pager Lines", fmt.Sprintf("%d", cfg.PagerLines))
+		}
+		printSetting("Config Dir", config.Dir())
 		return nil
 	},
 }
 
 func init() {
+	showCmd.Flags().BoolVar(&showJSON, "json", false, "Print the configuration as JSON")
+
+	configCmd.AddCommand(setCmd)
 	configCmd.AddCommand(setKeyCmd)
 	configCmd.AddCommand(setModelCmd)
+	configCmd.AddCommand(setTempCmd)
+	configCmd.AddCommand(setInstructionCmd)
 	configCmd.AddCommand(showCmd)
 }
+
+// settingLabelWidth fits the longest label in `config show`, colon
+// included, so every value starts in the same column.
+const settingLabelWidth = len("Feedback Top K:") + 1
+
+// printSetting prints one `config show` line, its value aligned with the
+// others.
+func printSetting(label, value string) {
+	fmt.Printf("%-*s%s\n", settingLabelWidth, label+":", value)
+}
+
+// warnAPIKey prints a warning to stderr if a just-saved key looks malformed.
+func warnAPIKey(key string) {
+	if warning := config.APIKeyWarning(key); warning != "" {
+		color.New(color.FgYellow).Fprintf(os.Stderr, "Warning: %s\n", warning)
+	}
+}
@@ -6,14 +6,16 @@ import (
 	"os/exec"
 	"strings"
 
-	"github.com/arin/xx-cli/internal/ai"
 	"github.com/arin/xx-cli/internal/config"
 	"github.com/arin/xx-cli/internal/ui"
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 )
 
-var diffStaged bool
+var (
+	diffStaged bool
+	diffShow   bool
+)
 
 var diffExplainCmd = &cobra.Command{
 	Use:   "diff-explain",
@@ -22,8 +24,9 @@ var diffExplainCmd = &cobra.Command{
 Great for writing PR descriptions or commit messages.
 
 Examples:
-  xx diff-explain            # Explain unstaged changes
-  xx diff-explain --staged   # Explain staged changes`,
+  xx diff-explain              # Explain unstaged changes
+  xx diff-explain --staged     # Explain staged changes
+  xx diff-explain --show-diff  # Print the colored diff above the summary`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		cfg, err := config.Load()
 		if err != nil {
@@ -51,12 +54,17 @@ Examples:
 			return nil
 		}
 
+		if diffShow {
+			fmt.Println()
+			ui.RenderDiff(os.Stdout, diff, "  ")
+		}
+
 		// Cap diff size for the AI prompt.
 		if len(diff) > 6000 {
 			diff = diff[:6000] + "\n... (truncated)"
 		}
 
-		client := ai.NewClient(cfg)
+		client := newClient(cfg)
 
 		cyan := color.New(color.FgCyan, color.Bold)
 		cyan.Fprintf(os.Stderr, "\n  📝 Diff Summary\n\n")
@@ -73,4 +81,5 @@ Examples:
 
 func init() {
 	diffExplainCmd.Flags().BoolVar(&diffStaged, "staged", false, "Explain staged changes instead of unstaged")
+	diffExplainCmd.Flags().BoolVar(&diffShow, "show-diff", false, "Also print the diff, colored, above the summary")
 }
@@ -2,10 +2,12 @@ package cmd
 
 import (
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"runtime"
 	"strings"
 	"time"
@@ -15,12 +17,24 @@ import (
 	"github.com/spf13/cobra"
 )
 
+var (
+	doctorFix     bool
+	doctorVerbose bool
+)
+
 var doctorCmd = &cobra.Command{
 	Use:   "doctor",
 	Short: "Check system health and configuration",
 	Long: `Run a comprehensive health check on your xx setup.
 Verifies Ollama connectivity, model availability, shell wrapper,
-PATH configuration, and system resources.`,
+PATH configuration, and system resources.
+
+Use --fix to install the shell wrapper into your rc file. The wrapper is
+written between "# >>> xx-cli wrapper >>>" markers, so re-running --fix
+updates it in place.
+
+Use --verbose to see how long each check took and the raw output of the
+commands it ran, e.g. to find out why doctor is slow.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		green := color.New(color.FgGreen)
 		red := color.New(color.FgRed)
@@ -30,30 +44,22 @@ PATH configuration, and system resources.`,
 
 		cyan.Fprintf(os.Stderr, "\n  🩺 xx doctor\n\n")
 
-		pass, fail, warn := 0, 0, 0
-
-		check := func(name string, fn func() (string, error)) {
-			detail, err := fn()
-			if err != nil {
-				if strings.HasPrefix(err.Error(), "warn:") {
-					yellow.Fprintf(os.Stderr, "  ⚠ %s\n", name)
-					dim.Fprintf(os.Stderr, "    %s\n", strings.TrimPrefix(err.Error(), "warn:"))
-					warn++
-				} else {
-					red.Fprintf(os.Stderr, "  ✗ %s\n", name)
-					dim.Fprintf(os.Stderr, "    %s\n", err.Error())
-					fail++
-				}
-			} else {
-				green.Fprintf(os.Stderr, "  ✓ %s", name)
-				if detail != "" {
-					dim.Fprintf(os.Stderr, " — %s", detail)
-				}
-				fmt.Fprintln(os.Stderr)
-				pass++
+		if doctorFix {
+			rcFile, changed, err := fixShellWrapper(detectDoctorShell())
+			switch {
+			case err != nil:
+				red.Fprintf(os.Stderr, "  ✗ Could not install shell wrapper: %v\n\n", err)
+			case !changed:
+				green.Fprintf(os.Stderr, "  🔧 Shell wrapper already installed in %s\n\n", rcFile)
+			default:
+				green.Fprintf(os.Stderr, "  🔧 Installed shell wrapper in %s\n", rcFile)
+				dim.Fprintf(os.Stderr, "    Reload your shell: source %s\n\n", rcFile)
 			}
 		}
 
+		report := &doctorReport{w: os.Stderr, verbose: doctorVerbose}
+		check := report.check
+
 		// 1. Go binary
 		check("xx binary installed", func() (string, error) {
 			path, err := os.Executable()
@@ -81,6 +87,7 @@ PATH configuration, and system resources.`,
 		// 3. Ollama installed
 		check("Ollama installed", func() (string, error) {
 			out, err := exec.Command("ollama", "--version").CombinedOutput()
+			report.capture(out)
 			if err != nil {
 				return "", fmt.Errorf("ollama not found — install from https://ollama.com")
 			}
@@ -105,6 +112,7 @@ PATH configuration, and system resources.`,
 		cfg, _ := config.Load()
 		check(fmt.Sprintf("Model available (%s)", cfg.Model), func() (string, error) {
 			out, err := exec.Command("ollama", "list").CombinedOutput()
+			report.capture(out)
 			if err != nil {
 				return "", fmt.Errorf("could not list models")
 			}
@@ -117,6 +125,7 @@ PATH configuration, and system resources.`,
 		// 6. Embedding model (for RAG)
 		check("Embedding model (nomic-embed-text)", func() (string, error) {
 			out, err := exec.Command("ollama", "list").CombinedOutput()
+			report.capture(out)
 			if err != nil {
 				return "", fmt.Errorf("warn:could not list models")
 			}
@@ -129,29 +138,38 @@ PATH configuration, and system resources.`,
 		// 7. Shell wrapper
 		check("Shell wrapper configured", func() (string, error) {
 			shell := detectDoctorShell()
-			home, _ := os.UserHomeDir()
-			var rcFile string
-			switch shell {
-			case "zsh":
-				rcFile = filepath.Join(home, ".zshrc")
-			case "bash":
-				rcFile = filepath.Join(home, ".bashrc")
-			case "fish":
-				rcFile = filepath.Join(home, ".config", "fish", "config.fish")
-			default:
+			rcFile := shellRCFile(shell)
+			if rcFile == "" {
 				return "", fmt.Errorf("warn:unknown shell %q — add eval \"$(xx init <shell>)\" to your config", shell)
 			}
 			data, err := os.ReadFile(rcFile)
 			if err != nil {
-				return "", fmt.Errorf("warn:could not read %s", rcFile)
+				return "", fmt.Errorf("warn:could not read %s — run: xx doctor --fix", rcFile)
 			}
-			if strings.Contains(string(data), "xx init") {
+			if hasWrapper(string(data)) {
 				return shell, nil
 			}
-			return "", fmt.Errorf("warn:add to %s: eval \"$(xx init %s)\"", rcFile, shell)
+			return "", fmt.Errorf("warn:add to %s: eval \"$(xx init %s)\" (or run: xx doctor --fix)", rcFile, shell)
+		})
+
+		// 8. Conflicting xx alias/function
+		check("No conflicting xx alias", func() (string, error) {
+			rcFile := shellRCFile(detectDoctorShell())
+			if rcFile == "" {
+				return "", nil
+			}
+			data, err := os.ReadFile(rcFile)
+			if err != nil {
+				return "", nil // Already reported by the wrapper check.
+			}
+			conflicts := findConflictingDefs(string(data))
+			if len(conflicts) == 0 {
+				return "", nil
+			}
+			return "", fmt.Errorf("warn:%s defines its own xx, which overrides the wrapper: %s", rcFile, strings.Join(conflicts, "; "))
 		})
 
-		// 8. Config directory
+		// 9. Config directory
 		check("Config directory", func() (string, error) {
 			dir := config.Dir()
 			info, err := os.Stat(dir)
@@ -164,13 +182,14 @@ PATH configuration, and system resources.`,
 			return dir, nil
 		})
 
-		// 9. OS and arch
+		// 10. OS and arch
 		check("System info", func() (string, error) {
 			return fmt.Sprintf("%s/%s", runtime.GOOS, runtime.GOARCH), nil
 		})
 
 		// Summary
 		fmt.Fprintln(os.Stderr)
+		pass, fail, warn := report.pass, report.fail, report.warn
 		total := pass + fail + warn
 		if fail == 0 && warn == 0 {
 			green.Fprintf(os.Stderr, "  All %d checks passed. You're good to go.\n\n", total)
@@ -184,6 +203,76 @@ PATH configuration, and system resources.`,
 	},
 }
 
+// doctorReport prints the result of each doctor check and tallies them.
+type doctorReport struct {
+	w       io.Writer
+	verbose bool
+
+	pass, fail, warn int
+
+	// raw is output captured by the running check, shown with --verbose.
+	raw string
+}
+
+// capture records a check's raw command output for --verbose.
+func (r *doctorReport) capture(out []byte) {
+	r.raw = strings.TrimSpace(string(out))
+}
+
+// check runs fn and prints its result. fn returns a detail shown on
+// success, or an error; errors prefixed with "warn:" count as warnings
+// rather than failures. With verbose, it also prints how long fn took and
+// any output fn captured, to find the slow or misbehaving check.
+func (r *doctorReport) check(name string, fn func() (string, error)) {
+	green := color.New(color.FgGreen)
+	red := color.New(color.FgRed)
+	yellow := color.New(color.FgYellow)
+	dim := color.New(color.FgHiBlack)
+
+	r.raw = ""
+	start := time.Now()
+	detail, err := fn()
+	elapsed := time.Since(start)
+
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "warn:") {
+			yellow.Fprintf(r.w, "  ⚠ %s\n", name)
+			dim.Fprintf(r.w, "    %s\n", strings.TrimPrefix(err.Error(), "warn:"))
+			r.warn++
+		} else {
+			red.Fprintf(r.w, "  ✗ %s\n", name)
+			dim.Fprintf(r.w, "    %s\n", err.Error())
+			r.fail++
+		}
+	} else {
+		green.Fprintf(r.w, "  ✓ %s", name)
+		if detail != "" {
+			dim.Fprintf(r.w, " — %s", detail)
+		}
+		fmt.Fprintln(r.w)
+		r.pass++
+	}
+
+	if !r.verbose {
+		return
+	}
+	dim.Fprintf(r.w, "    took %s\n", formatCheckDuration(elapsed))
+	if r.raw != "" {
+		for _, line := range strings.Split(r.raw, "\n") {
+			dim.Fprintf(r.w, "    │ %s\n", line)
+		}
+	}
+}
+
+// formatCheckDuration rounds d to the millisecond; checks faster than that
+// show as "<1ms" rather than "0s".
+func formatCheckDuration(d time.Duration) string {
+	if d < time.Millisecond {
+		return "<1ms"
+	}
+	return d.Round(time.Millisecond).String()
+}
+
 func detectDoctorShell() string {
 	if runtime.GOOS == "windows" {
 		return "powershell"
@@ -194,3 +283,99 @@ func detectDoctorShell() string {
 	}
 	return "sh"
 }
+
+// shellRCFile returns the config file that the shell wrapper should live in,
+// or an empty string for shells we don't know how to configure.
+func shellRCFile(shell string) string {
+	home, _ := os.UserHomeDir()
+	switch shell {
+	case "zsh":
+		return filepath.Join(home, ".zshrc")
+	case "bash":
+		return filepath.Join(home, ".bashrc")
+	case "fish":
+		return filepath.Join(home, ".config", "fish", "config.fish")
+	default:
+		return ""
+	}
+}
+
+// xxDefRe matches lines that define an xx alias or function in sh-like
+// shells and fish: "alias xx=...", "alias xx ...", "xx() {", "function xx".
+var xxDefRe = regexp.MustCompile(`^(alias\s+xx[=\s]|xx\s*\(\s*\)|function\s+xx\b)`)
+
+// findConflictingDefs scans rc file contents for xx aliases or functions
+// that aren't part of the xx shell wrapper. The wrapper is usually loaded
+// via eval "$(xx init ...)", but users sometimes paste it in verbatim, so
+// definitions inside the marker-fenced wrapper block are ignored.
+//
+// Returns each conflict as "line N: <text>".
+func findConflictingDefs(rc string) []string {
+	var conflicts []string
+	inWrapper := false
+	for i, line := range strings.Split(rc, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == wrapperBeginMarker:
+			inWrapper = true
+			continue
+		case trimmed == wrapperEndMarker:
+			inWrapper = false
+			continue
+		case inWrapper:
+			continue
+		}
+		if !xxDefRe.MatchString(trimmed) {
+			continue
+		}
+		conflicts = append(conflicts, fmt.Sprintf("line %d: %s", i+1, trimmed))
+	}
+	return conflicts
+}
+
+// hasWrapper reports whether rc loads the xx wrapper: either the
+// marker-fenced block, or a hand-written, uncommented `xx init` eval line
+// from before the markers existed. Comments and docs mentioning
+// "xx init" don't count.
+func hasWrapper(rc string) bool {
+	if _, _, ok := findWrapperBlock(rc); ok {
+		return true
+	}
+	for _, line := range strings.Split(rc, "\n") {
+		if isLegacyWrapperLine(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// fixShellWrapper writes (or rewrites) the marker-fenced wrapper block in
+// the rc file for shell, replacing a legacy unmarked `xx init` line if
+// there is one. It's idempotent: re-running replaces the block in place
+// instead of appending a second copy. Returns the rc file path, and whether
+// the file changed.
+func fixShellWrapper(shell string) (string, bool, error) {
+	rcFile := shellRCFile(shell)
+	if rcFile == "" {
+		return "", false, fmt.Errorf("unsupported shell %q (supported: zsh, bash, fish)", shell)
+	}
+
+	data, err := os.ReadFile(rcFile)
+	if err != nil && !os.IsNotExist(err) {
+		return "", false, err
+	}
+	updated := upsertWrapperBlock(string(data), rcBlock(shell))
+	if updated == string(data) {
+		return rcFile, false, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(rcFile), 0o755); err != nil {
+		return "", false, err
+	}
+	return rcFile, true, os.WriteFile(rcFile, []byte(updated), 0o644)
+}
+
+func init() {
+	doctorCmd.Flags().BoolVar(&doctorFix, "fix", false, "Install or repair the shell wrapper block in your rc file")
+	doctorCmd.Flags().BoolVarP(&doctorVerbose, "verbose", "v", false, "Show how long each check took and the raw output it captured")
+}
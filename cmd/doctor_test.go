@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestFindConflictingDefs_None(t *testing.T) {
+	rc := `export PATH="$HOME/go/bin:$PATH"
+eval "$(xx init zsh)"
+alias ll='ls -la'
+`
+	if got := findConflictingDefs(rc); len(got) != 0 {
+		t.Errorf("expected no conflicts, got %v", got)
+	}
+}
+
+func TestFindConflictingDefs_Alias(t *testing.T) {
+	rc := `alias ll='ls -la'
+alias xx='exit'
+eval "$(xx init zsh)"
+`
+	got := findConflictingDefs(rc)
+	if len(got) != 1 {
+		t.Fatalf("expected 1 conflict, got %v", got)
+	}
+	if !strings.HasPrefix(got[0], "line 2:") || !strings.Contains(got[0], "alias xx='exit'") {
+		t.Errorf("unexpected conflict description: %q", got[0])
+	}
+}
+
+func TestFindConflictingDefs_Function(t *testing.T) {
+	rc := `xx() {
+  echo "my own xx"
+}
+function xx {
+  echo other
+}
+`
+	if got := findConflictingDefs(rc); len(got) != 2 {
+		t.Errorf("expected 2 conflicts, got %v", got)
+	}
+}
+
+func TestFindConflictingDefs_FishAlias(t *testing.T) {
+	rc := "alias xx 'exa -la'\n"
+	if got := findConflictingDefs(rc); len(got) != 1 {
+		t.Errorf("expected fish alias to conflict, got %v", got)
+	}
+}
+
+func TestFindConflictingDefs_PastedWrappersIgnored(t *testing.T) {
+	for name, wrapper := range map[string]string{
+		"zsh":  zshWrapper(),
+		"bash": bashWrapper(),
+		"fish": fishWrapper(),
+	} {
+		rc := "alias ll='ls -la'\n" + wrapper
+		if got := findConflictingDefs(rc); len(got) != 0 {
+			t.Errorf("%s: pasted wrapper should not be a conflict, got %v", name, got)
+		}
+	}
+}
+
+func TestFindConflictingDefs_AfterPastedWrapper(t *testing.T) {
+	rc := bashWrapper() + "\nalias xx='cd ..'\n"
+	if got := findConflictingDefs(rc); len(got) != 1 {
+		t.Errorf("alias defined after the wrapper should conflict, got %v", got)
+	}
+}
+
+func TestFindConflictingDefs_IgnoresSimilarNames(t *testing.T) {
+	rc := `alias xxd='hexdump'
+xxh() { ssh "$@"; }
+`
+	if got := findConflictingDefs(rc); len(got) != 0 {
+		t.Errorf("similar names should not conflict, got %v", got)
+	}
+}
+
+func TestDoctorReport_VerboseShowsTiming(t *testing.T) {
+	var buf bytes.Buffer
+	r := &doctorReport{w: &buf, verbose: true}
+	r.check("Fast check", func() (string, error) {
+		r.capture([]byte("ollama version 0.5.1\n"))
+		return "ok", nil
+	})
+	r.check("Failing check", func() (string, error) {
+		return "", errors.New("warn:not great")
+	})
+
+	out := buf.String()
+	if strings.Count(out, "took ") != 2 {
+		t.Errorf("verbose output should time every check, got:\n%s", out)
+	}
+	if !strings.Contains(out, "took <1ms") {
+		t.Errorf("a fast check should show as <1ms, got:\n%s", out)
+	}
+	if !strings.Contains(out, "│ ollama version 0.5.1") {
+		t.Errorf("verbose output should include captured output, got:\n%s", out)
+	}
+	if r.pass != 1 || r.warn != 1 || r.fail != 0 {
+		t.Errorf("tally = %d pass, %d warn, %d fail; want 1, 1, 0", r.pass, r.warn, r.fail)
+	}
+}
+
+func TestDoctorReport_QuietByDefault(t *testing.T) {
+	var buf bytes.Buffer
+	r := &doctorReport{w: &buf}
+	r.check("Fast check", func() (string, error) {
+		r.capture([]byte("raw output"))
+		return "ok", nil
+	})
+	if out := buf.String(); strings.Contains(out, "took") || strings.Contains(out, "raw output") {
+		t.Errorf("non-verbose output should have no timing or raw output, got:\n%s", out)
+	}
+}
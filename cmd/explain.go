@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"strings"
@@ -12,6 +13,11 @@ import (
 	"github.com/spf13/cobra"
 )
 
+var (
+	explainInteractive bool
+	explainDiff        bool
+)
+
 var explainCmd = &cobra.Command{
 	Use:   "explain <command>",
 	Short: "Explain a shell command in plain English",
@@ -20,16 +26,34 @@ var explainCmd = &cobra.Command{
 Examples:
   xx explain "tar -xzf archive.tar.gz"
   xx explain "find / -name '*.log' -size +100M"
-  xx explain "awk '{print $1}' file.txt"`,
+  xx explain "awk '{print $1}' file.txt"
+
+Use --interactive to ask follow-up questions about the command afterwards:
+  xx explain -i "tar -xzf archive.tar.gz"
+
+Use --diff to compare two commands — how they differ, the trade-offs, and
+when to use each. Quote each command:
+  xx explain --diff "find . -name '*.go'" "fd -e go"`,
 	Args: cobra.MinimumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if explainDiff && len(args) != 2 {
+			return fmt.Errorf("--diff needs exactly two commands, each in quotes, e.g. xx explain --diff \"find . -name '*.go'\" \"fd -e go\"")
+		}
+		if explainDiff && explainInteractive {
+			return fmt.Errorf("--diff and --interactive can't be used together")
+		}
+
 		cfg, err := config.Load()
 		if err != nil {
 			return fmt.Errorf("configuration error: %w", err)
 		}
+		client := newClient(cfg)
+
+		if explainDiff {
+			return explainCompare(cmd.Context(), client, args[0], args[1])
+		}
 
 		command := strings.Join(args, " ")
-		client := ai.NewClient(cfg)
 
 		sp := ui.NewSpinner("Thinking...")
 		sp.Start()
@@ -41,15 +65,51 @@ Examples:
 		cyan.Fprintf(os.Stderr, "\n  %s\n\n", command)
 
 		sp.Stop()
-		_, err = ui.RenderStream(os.Stdout, stream, "  ")
+		explanation, err := ui.RenderStream(os.Stdout, stream, "  ")
 		if err != nil {
 			return fmt.Errorf("explanation failed: %w", err)
 		}
 
+		if explainInteractive {
+			dim := color.New(color.FgHiBlack)
+			dim.Fprintf(os.Stderr, "\n  Ask follow-up questions about this command. Type 'exit' to quit.\n\n")
+			chatLoop(cmd.Context(), os.Stdin, os.Stderr, explainHistory(command, explanation), defaultChatTimeout, func(ctx context.Context, history []ai.ChatMessage) <-chan ai.StreamDelta {
+				return client.ExplainChatStream(ctx, command, history)
+			})
+		}
+
 		return nil
 	},
 }
 
 func init() {
 	// registered in root.go
+	explainCmd.Flags().BoolVarP(&explainInteractive, "interactive", "i", false, "Ask follow-up questions about the command after the explanation")
+	explainCmd.Flags().BoolVar(&explainDiff, "diff", false, "Compare two commands: differences, trade-offs, and when to use each")
+}
+
+// explainCompare streams a comparison of two commands.
+func explainCompare(ctx context.Context, client *ai.Client, a, b string) error {
+	sp := ui.NewSpinner("Comparing...")
+	sp.Start()
+	stream := client.CompareStream(ctx, a, b)
+
+	cyan := color.New(color.FgCyan, color.Bold)
+	cyan.Fprintf(os.Stderr, "\n  A: %s\n", a)
+	cyan.Fprintf(os.Stderr, "  B: %s\n\n", b)
+
+	sp.Stop()
+	if _, err := ui.RenderStream(os.Stdout, stream, "  "); err != nil {
+		return fmt.Errorf("comparison failed: %w", err)
+	}
+	return nil
+}
+
+// explainHistory seeds a follow-up chat with the explanation already given,
+// so the model doesn't repeat itself and can refer back to it.
+func explainHistory(command, explanation string) []ai.ChatMessage {
+	return []ai.ChatMessage{
+		{Role: "user", Content: "Explain this command: " + command},
+		{Role: "assistant", Content: strings.TrimSpace(explanation)},
+	}
 }
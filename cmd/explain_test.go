@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/arin/xx-cli/internal/ai"
+)
+
+func TestExplainInteractive_FollowUpsIncludeCommand(t *testing.T) {
+	mock := &mockStreamProvider{tokens: []string{"-z means gzip."}}
+	client := ai.NewClientWithProvider(mock)
+	command := "tar -xzf archive.tar.gz"
+
+	var calls [][]ai.Message
+	in := strings.NewReader("what does -z do?\nand -f?\nexit\n")
+	var out bytes.Buffer
+	chatLoop(context.Background(), in, &out, explainHistory(command, "Extracts a gzipped archive.\n"), 0, func(ctx context.Context, history []ai.ChatMessage) <-chan ai.StreamDelta {
+		stream := client.ExplainChatStream(ctx, command, history)
+		// The mock records messages as the stream starts; drain a copy first.
+		var tokens []ai.StreamDelta
+		for d := range stream {
+			tokens = append(tokens, d)
+		}
+		calls = append(calls, mock.lastMsgs)
+		ch := make(chan ai.StreamDelta, len(tokens))
+		for _, d := range tokens {
+			ch <- d
+		}
+		close(ch)
+		return ch
+	})
+
+	if len(calls) != 2 {
+		t.Fatalf("expected 2 follow-up requests, got %d", len(calls))
+	}
+	for i, msgs := range calls {
+		if msgs[0].Role != "system" || !strings.Contains(msgs[0].Content, command) {
+			t.Errorf("request %d: system prompt should carry the command, got %q", i, msgs[0].Content)
+		}
+		if !strings.Contains(msgs[2].Content, "Extracts a gzipped archive.") {
+			t.Errorf("request %d: the original explanation should be in the history, got %+v", i, msgs)
+		}
+	}
+
+	last := calls[1]
+	if got := last[len(last)-1]; got.Role != "user" || got.Content != "and -f?" {
+		t.Errorf("last message should be the new question, got %+v", got)
+	}
+	if got := last[len(last)-2]; got.Role != "assistant" || got.Content != "-z means gzip." {
+		t.Errorf("previous reply should be carried over, got %+v", got)
+	}
+	if !strings.Contains(out.String(), "-z means gzip.") {
+		t.Errorf("replies should be streamed to the output, got %q", out.String())
+	}
+}
@@ -2,6 +2,9 @@ package cmd
 
 import (
 	"fmt"
+	"io"
+	"os"
+	"time"
 
 	"github.com/arin/xx-cli/internal/history"
 	"github.com/fatih/color"
@@ -24,20 +27,8 @@ var historyCmd = &cobra.Command{
 			return nil
 		}
 
-		cyan := color.New(color.FgCyan)
-		dim := color.New(color.FgHiBlack)
-		red := color.New(color.FgRed)
-		green := color.New(color.FgGreen)
-
 		for i, e := range entries {
-			dim.Printf("[%s] ", e.Timestamp.Format("2006-01-02 15:04:05"))
-			fmt.Printf("%s ", e.Prompt)
-			cyan.Printf("→ %s ", e.Command)
-			if e.Success {
-				green.Println("✓")
-			} else {
-				red.Println("✗")
-			}
+			writeHistoryEntry(os.Stdout, e)
 			if i < len(entries)-1 {
 				fmt.Println()
 			}
@@ -49,3 +40,30 @@ var historyCmd = &cobra.Command{
 func init() {
 	historyCmd.Flags().IntVarP(&historyLimit, "limit", "n", 20, "Number of history entries to show")
 }
+
+// writeHistoryEntry prints the one-line summary of a history entry, with
+// the exit code of a failed command when it was recorded.
+func writeHistoryEntry(w io.Writer, e history.Entry) {
+	cyan := color.New(color.FgCyan)
+	dim := color.New(color.FgHiBlack)
+	red := color.New(color.FgRed)
+	green := color.New(color.FgGreen)
+
+	dim.Fprintf(w, "[%s] ", e.Timestamp.Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(w, "%s ", e.Prompt)
+	if e.StepLabel != "" {
+		dim.Fprintf(w, "(%s) ", e.StepLabel)
+	}
+	cyan.Fprintf(w, "→ %s ", e.Command)
+	if e.DurationMs > 0 {
+		dim.Fprintf(w, "%s ", time.Duration(e.DurationMs)*time.Millisecond)
+	}
+	switch {
+	case e.Success:
+		green.Fprintln(w, "✓")
+	case e.ExitCode != 0:
+		red.Fprintf(w, "✗ exit %d\n", e.ExitCode)
+	default:
+		red.Fprintln(w, "✗")
+	}
+}
@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/arin/xx-cli/internal/history"
+	"github.com/arin/xx-cli/internal/stats"
+)
+
+func TestWriteHistoryEntry_ShowsExitCode(t *testing.T) {
+	for _, tc := range []struct {
+		entry history.Entry
+		want  string
+	}{
+		{history.Entry{Prompt: "list files", Command: "ls", Success: true}, "✓"},
+		{history.Entry{Prompt: "find it", Command: "grep -r x .", ExitCode: 2}, "✗ exit 2"},
+		{history.Entry{Prompt: "old entry", Command: "false"}, "✗"},
+	} {
+		var buf bytes.Buffer
+		writeHistoryEntry(&buf, tc.entry)
+		out := strings.TrimSpace(buf.String())
+		if !strings.HasSuffix(out, tc.want) {
+			t.Errorf("%s: expected the line to end with %q, got %q", tc.entry.Prompt, tc.want, out)
+		}
+		if tc.want == "✗" && strings.Contains(out, "exit") {
+			t.Errorf("%s: no exit code was recorded, got %q", tc.entry.Prompt, out)
+		}
+	}
+}
+
+func TestRun_RecordsExitCode(t *testing.T) {
+	runOffline(t, map[string]string{"fail with 3": "exit 3"})
+
+	_ = run(rootCmd, []string{"fail", "with", "3"})
+
+	entries, _ := history.Load(0)
+	if len(entries) != 1 || entries[0].Success || entries[0].ExitCode != 3 {
+		t.Errorf("expected one failed history entry with exit code 3, got %+v", entries)
+	}
+	records, _ := stats.LoadAll()
+	if len(records) != 1 || records[0].Success || records[0].ExitCode != 3 {
+		t.Errorf("expected one failed stats record with exit code 3, got %+v", records)
+	}
+}
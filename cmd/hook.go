@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+
+	"github.com/arin/xx-cli/internal/config"
+	"github.com/arin/xx-cli/internal/executor"
+)
+
+// runPostExecHook starts the post_exec_hook, if one is configured, for a
+// command xx just ran. The hook gets the prompt, command, intent and exit
+// code both as arguments and as XX_PROMPT, XX_COMMAND, XX_INTENT and
+// XX_EXIT_CODE in its environment, and xx doesn't wait for it. Like
+// history and stats, it's skipped in incognito mode.
+func runPostExecHook(prompt, command, intent string, execErr error) {
+	if !persistEnabled() {
+		return
+	}
+	cfg, err := config.Load()
+	if err != nil || cfg.PostExecHook == "" {
+		return
+	}
+	code := strconv.Itoa(executor.ExitCode(execErr))
+	spawnHook(cfg.PostExecHook, []string{prompt, command, intent, code}, []string{
+		"XX_PROMPT=" + prompt,
+		"XX_COMMAND=" + command,
+		"XX_INTENT=" + intent,
+		"XX_EXIT_CODE=" + code,
+	})
+}
+
+// spawnHook starts the hook at path with args, adding env to xx's own
+// environment, and doesn't wait for it; its output is discarded. It's a
+// variable so tests can check the call without running anything.
+var spawnHook = func(path string, args, env []string) {
+	cmd := exec.Command(path, args...)
+	cmd.Env = append(os.Environ(), env...)
+	_ = cmd.Start()
+}
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/arin/xx-cli/internal/config"
+)
+
+func TestRun_InvokesPostExecHook(t *testing.T) {
+	home := runOffline(t, map[string]string{"fail with 3": "exit 3"})
+	hook := filepath.Join(home, "hook.sh")
+	if err := os.WriteFile(hook, []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	origHook := spawnHook
+	defer func() { spawnHook = origHook }()
+	type call struct {
+		path      string
+		args, env []string
+	}
+	var calls []call
+	spawnHook = func(path string, args, env []string) {
+		calls = append(calls, call{path, args, env})
+	}
+
+	// Off by default.
+	_ = run(rootCmd, []string{"fail", "with", "3"})
+	if len(calls) != 0 {
+		t.Fatalf("no hook is configured, but it was spawned: %+v", calls)
+	}
+
+	if err := config.Set("post_exec_hook", hook); err != nil {
+		t.Fatalf("set hook: %v", err)
+	}
+	_ = run(rootCmd, []string{"fail", "with", "3"})
+	if len(calls) != 1 {
+		t.Fatalf("expected the hook spawned once, got %d calls", len(calls))
+	}
+	c := calls[0]
+	if c.path != hook {
+		t.Errorf("expected %s to be spawned, got %s", hook, c.path)
+	}
+	want := []string{"XX_PROMPT=fail with 3", "XX_COMMAND=exit 3", "XX_INTENT=display", "XX_EXIT_CODE=3"}
+	if len(c.env) != len(want) {
+		t.Fatalf("expected env %v, got %v", want, c.env)
+	}
+	for i := range want {
+		if c.env[i] != want[i] {
+			t.Errorf("env[%d]: expected %q, got %q", i, want[i], c.env[i])
+		}
+	}
+	if len(c.args) != 4 || c.args[1] != "exit 3" || c.args[3] != "3" {
+		t.Errorf("expected prompt, command, intent and exit code as args, got %v", c.args)
+	}
+
+	// Incognito runs leave no trace, the hook included.
+	incognito = true
+	defer func() { incognito = false }()
+	_ = run(rootCmd, []string{"fail", "with", "3"})
+	if len(calls) != 1 {
+		t.Errorf("the hook shouldn't run in incognito mode, got %d calls", len(calls))
+	}
+}
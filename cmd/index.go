@@ -3,14 +3,27 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"os"
 	"time"
 
+	projctx "github.com/arin/xx-cli/internal/context"
 	"github.com/arin/xx-cli/internal/rag"
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 )
 
-var flushIndex bool
+var (
+	flushIndex    bool
+	indexProject  string
+	indexSince    time.Duration
+	pruneSource   string
+	pruneIndex    bool
+	exportIndex   string
+	importIndex   string
+	importReplace bool
+
+	indexHistoryLimit int
+)
 
 var indexCmd = &cobra.Command{
 	Use:   "index",
@@ -22,8 +35,36 @@ so xx picks the right command more often.
 Run this once after install, and again whenever you want to refresh the index
 (e.g. after teaching xx new corrections with 'xx learn').
 
+Documents already in the index aren't embedded again, and progress is
+saved as it goes: if indexing is interrupted, the partial index still
+works, and re-running 'xx index' picks up where it stopped.
+
 Use --flush to wipe the existing index before rebuilding. This is the fix for
 a poisoned index where bad auto-learned commands are dominating good results.
+To drop only the auto-learned documents and keep the rest, use
+--prune-source history (or fix, for learned failure fixes) instead: it
+removes every document from that source and exits without re-indexing.
+
+Use --prune for routine cleanup of auto-learned history: it drops history
+documents that have failed twice without ever succeeding, and ones that
+near-duplicate a better-scoring document, then exits. Builtin, learned and
+note documents are never pruned.
+
+Use --export file.json to write the whole index, vectors and success and
+failure counts included, to a JSON file, and --import file.json on another
+machine to load it. An import merges into the existing index, skipping
+near-duplicates of what's already there; add --replace to swap the index for
+the file instead. Both exit without re-indexing, and an import built with a
+different embedding model is refused.
+
+Use --project to index only the history recorded in one project (e.g.
+--project .), and --since to skip history older than a duration (e.g.
+--since 168h for the last week). History learned in one project is never
+suggested in another, whichever flags were used.
+
+Use --history-limit to change how many recent history entries get indexed
+(default 200), or --history-limit 0 to leave history out entirely if it's
+too noisy to help.
 
 Requires the nomic-embed-text model:
   ollama pull nomic-embed-text`,
@@ -33,6 +74,51 @@ Requires the nomic-embed-text model:
 		green := color.New(color.FgGreen)
 		yellow := color.New(color.FgYellow)
 
+		if exportIndex != "" || importIndex != "" {
+			if exportIndex != "" && importIndex != "" {
+				return fmt.Errorf("--export and --import can't be used together")
+			}
+			if flushIndex || pruneIndex || pruneSource != "" {
+				return fmt.Errorf("--export and --import can't be combined with --flush or --prune")
+			}
+			if exportIndex != "" {
+				return runIndexExport(exportIndex)
+			}
+			return runIndexImport(importIndex, importReplace)
+		}
+		if importReplace {
+			return fmt.Errorf("--replace only applies to --import")
+		}
+
+		if pruneIndex {
+			if flushIndex || pruneSource != "" {
+				return fmt.Errorf("--prune can't be combined with --flush or --prune-source")
+			}
+			removed, reclaimed, err := rag.Prune()
+			if err != nil {
+				return fmt.Errorf("prune failed: %w", err)
+			}
+			if removed == 0 {
+				green.Println("✓ Nothing to prune")
+				return nil
+			}
+			green.Printf("✓ Pruned %d stale history documents (%s reclaimed)\n", removed, formatBytes(reclaimed))
+			return nil
+		}
+
+		if pruneSource != "" {
+			if flushIndex {
+				return fmt.Errorf("--prune-source and --flush can't be used together")
+			}
+			removed, left, err := rag.PruneSource(pruneSource)
+			if err != nil {
+				return fmt.Errorf("prune failed: %w", err)
+			}
+			yellow.Printf("🗑  Removed %d %s documents\n", removed, pruneSource)
+			green.Printf("✓ %d documents left in the index\n", left)
+			return nil
+		}
+
 		if flushIndex {
 			store := rag.NewStore()
 			if err := store.Flush(); err != nil {
@@ -45,8 +131,24 @@ Requires the nomic-embed-text model:
 		cyan.Println("🔍 Building knowledge index...")
 		fmt.Println()
 
+		var opts rag.IndexOptions
+		if indexProject != "" {
+			opts.Project = projctx.ProjectRoot(indexProject)
+			cyan.Printf("  Project: %s\n", opts.Project)
+		}
+		if indexSince > 0 {
+			opts.Since = time.Now().Add(-indexSince)
+			cyan.Printf("  Since:   %s\n", opts.Since.Format("2006-01-02 15:04"))
+		}
+
+		if indexHistoryLimit < 0 {
+			return fmt.Errorf("--history-limit must be 0 or more")
+		}
+		opts.HistoryLimit = indexHistoryLimit
+		opts.SkipHistory = indexHistoryLimit == 0
+
 		embedder := rag.NewEmbedClient()
-		indexer := rag.NewIndexer(embedder)
+		indexer := rag.NewIndexerWithOptions(embedder, opts)
 
 		err := indexer.IndexAll(context.Background(), func(msg string) {
 			fmt.Println("  " + msg)
@@ -63,4 +165,62 @@ Requires the nomic-embed-text model:
 
 func init() {
 	indexCmd.Flags().BoolVar(&flushIndex, "flush", false, "wipe the existing index before rebuilding (fixes poisoned indexes)")
+	indexCmd.Flags().StringVar(&indexProject, "project", "", "only index history recorded in this project directory (e.g. .)")
+	indexCmd.Flags().DurationVar(&indexSince, "since", 0, "only index history newer than this (e.g. 168h)")
+	indexCmd.Flags().StringVar(&exportIndex, "export", "", "write the index, with vectors and scores, to this JSON file and exit")
+	indexCmd.Flags().StringVar(&importIndex, "import", "", "merge an index exported with --export into this one and exit")
+	indexCmd.Flags().BoolVar(&importReplace, "replace", false, "with --import, replace the index instead of merging into it")
+	indexCmd.Flags().BoolVar(&pruneIndex, "prune", false, "remove stale and duplicate auto-learned history documents and exit")
+	indexCmd.Flags().StringVar(&pruneSource, "prune-source", "", "remove every document from this source (history, fix, learned, note, builtin) and exit")
+	indexCmd.Flags().IntVar(&indexHistoryLimit, "history-limit", rag.DefaultHistoryLimit, "how many recent history entries to index (0 skips history)")
+}
+
+// runIndexExport writes the index to path as JSON.
+func runIndexExport(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("export failed: %w", err)
+	}
+	n, err := rag.ExportIndex(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+		return fmt.Errorf("export failed: %w", err)
+	}
+	color.New(color.FgGreen).Printf("✓ Exported %d documents to %s\n", n, path)
+	return nil
+}
+
+// runIndexImport loads an exported index from path, merging it into the
+// current one unless replace is set.
+func runIndexImport(path string, replace bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("import failed: %w", err)
+	}
+	defer f.Close()
+	added, total, err := rag.ImportIndex(f, replace)
+	if err != nil {
+		return fmt.Errorf("import failed: %w", err)
+	}
+	if replace {
+		color.New(color.FgGreen).Printf("✓ Replaced the index with %d documents from %s\n", total, path)
+	} else {
+		color.New(color.FgGreen).Printf("✓ Imported %d documents (%d in the index)\n", added, total)
+	}
+	return nil
+}
+
+// formatBytes renders a byte count for humans, e.g. 12.4 KB.
+func formatBytes(n int64) string {
+	switch {
+	case n < 1024:
+		return fmt.Sprintf("%d B", n)
+	case n < 1024*1024:
+		return fmt.Sprintf("%.1f KB", float64(n)/1024)
+	default:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1024*1024))
+	}
 }
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/spf13/cobra"
 )
@@ -14,7 +15,9 @@ var initCmd = &cobra.Command{
 Add this to your shell config:
   eval "$(xx init zsh)"    # for ~/.zshrc
   eval "$(xx init bash)"   # for ~/.bashrc
-  eval "$(xx init fish)"   # for ~/.config/fish/config.fish`,
+  eval "$(xx init fish)"   # for ~/.config/fish/config.fish
+
+For tab completion of subcommands and flags, see 'xx completion --help'.`,
 	Args: cobra.MaximumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		shell := "zsh"
@@ -36,6 +39,92 @@ Add this to your shell config:
 	},
 }
 
+// Marker lines that fence the xx wrapper, both in `xx init` output and in
+// the block `xx doctor --fix` writes to the rc file. Everything between them
+// belongs to xx, so the block can be found, replaced, or removed reliably
+// (the same convention conda and rbenv use).
+const (
+	wrapperBeginMarker = "# >>> xx-cli wrapper >>>"
+	wrapperEndMarker   = "# <<< xx-cli wrapper <<<"
+)
+
+// rcBlock returns the marker-fenced snippet that loads the wrapper from a
+// shell's rc file.
+func rcBlock(shell string) string {
+	return wrapperBeginMarker + "\n" +
+		"eval \"$(xx init " + shell + ")\"\n" +
+		wrapperEndMarker + "\n"
+}
+
+// findWrapperBlock returns the byte range of the marker-fenced block in rc,
+// including the end marker's trailing newline. ok is false if either marker
+// is missing or they're out of order.
+func findWrapperBlock(rc string) (start, end int, ok bool) {
+	start = strings.Index(rc, wrapperBeginMarker)
+	if start < 0 {
+		return 0, 0, false
+	}
+	rel := strings.Index(rc[start:], wrapperEndMarker)
+	if rel < 0 {
+		return 0, 0, false
+	}
+	end = start + rel + len(wrapperEndMarker)
+	if end < len(rc) && rc[end] == '\n' {
+		end++
+	}
+	return start, end, true
+}
+
+// upsertWrapperBlock replaces an existing wrapper block in rc with block,
+// or appends block if there is none. A hand-written `xx init` line from
+// before the markers existed is replaced by the block too, so the wrapper
+// isn't defined twice. Running it twice is a no-op.
+func upsertWrapperBlock(rc, block string) string {
+	if start, end, ok := findWrapperBlock(rc); ok {
+		return rc[:start] + block + rc[end:]
+	}
+	if replaced, ok := replaceLegacyWrapper(rc, block); ok {
+		return replaced
+	}
+	if rc != "" && !strings.HasSuffix(rc, "\n") {
+		rc += "\n"
+	}
+	if rc != "" {
+		rc += "\n"
+	}
+	return rc + block
+}
+
+// replaceLegacyWrapper puts block in place of the first legacy wrapper
+// line in rc and drops any others. ok is false if rc has none.
+func replaceLegacyWrapper(rc, block string) (string, bool) {
+	lines := strings.SplitAfter(rc, "\n")
+	var b strings.Builder
+	found := false
+	for _, line := range lines {
+		if !isLegacyWrapperLine(line) {
+			b.WriteString(line)
+			continue
+		}
+		if !found {
+			b.WriteString(block)
+			found = true
+		}
+	}
+	return b.String(), found
+}
+
+// isLegacyWrapperLine reports whether line is an uncommented `xx init`
+// eval or source line, the way the wrapper was loaded before the markers.
+// Comments and docs mentioning "xx init" don't count.
+func isLegacyWrapperLine(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	if strings.HasPrefix(trimmed, "#") {
+		return false
+	}
+	return strings.Contains(trimmed, "xx init") && (strings.Contains(trimmed, "eval") || strings.Contains(trimmed, "source"))
+}
+
 func shellCoreWrapper() string {
 	return `    local xx_bin
     xx_bin="$(command which xx-cli 2>/dev/null || command which xx 2>/dev/null)"
@@ -71,7 +160,8 @@ func shellCoreWrapper() string {
 }
 
 func zshWrapper() string {
-	return `# xx shell wrapper — enables directory navigation and special character handling
+	return wrapperBeginMarker + `
+# xx shell wrapper — enables directory navigation and special character handling
 xx() {
 ` + shellCoreWrapper() + `
 }
@@ -79,11 +169,12 @@ xx() {
 # Disable glob expansion for xx so ?, *, [] etc. are passed as-is.
 # This lets you type: xx is slack running?  (without quoting)
 alias xx='noglob xx'
-`
+` + wrapperEndMarker + "\n"
 }
 
 func bashWrapper() string {
-	return `# xx shell wrapper — enables directory navigation and special character handling
+	return wrapperBeginMarker + `
+# xx shell wrapper — enables directory navigation and special character handling
 xx() {
     # Disable glob expansion so ?, *, [] etc. are passed as-is
     local _old_opts="$(shopt -po noglob 2>/dev/null)"
@@ -91,11 +182,12 @@ xx() {
     trap 'eval "$_old_opts"' RETURN 2>/dev/null || true
 ` + shellCoreWrapper() + `
 }
-`
+` + wrapperEndMarker + "\n"
 }
 
 func fishWrapper() string {
-	return `# xx shell wrapper — enables directory navigation
+	return wrapperBeginMarker + `
+# xx shell wrapper — enables directory navigation
 function xx
     set xx_bin (command which xx-cli 2>/dev/null; or command which xx 2>/dev/null)
     if test -z "$xx_bin"
@@ -122,5 +214,5 @@ function xx
 
     return $exit_code
 end
-`
+` + wrapperEndMarker + "\n"
 }
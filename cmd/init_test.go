@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWrappers_HaveMarkers(t *testing.T) {
+	for name, wrapper := range map[string]string{
+		"zsh":  zshWrapper(),
+		"bash": bashWrapper(),
+		"fish": fishWrapper(),
+	} {
+		if !strings.HasPrefix(wrapper, wrapperBeginMarker+"\n") {
+			t.Errorf("%s wrapper should start with the begin marker", name)
+		}
+		if !strings.HasSuffix(wrapper, wrapperEndMarker+"\n") {
+			t.Errorf("%s wrapper should end with the end marker", name)
+		}
+	}
+}
+
+func TestUpsertWrapperBlock_AppendsToEmpty(t *testing.T) {
+	got := upsertWrapperBlock("", rcBlock("zsh"))
+	if got != rcBlock("zsh") {
+		t.Errorf("expected just the block, got %q", got)
+	}
+}
+
+func TestUpsertWrapperBlock_PreservesContent(t *testing.T) {
+	rc := "export PATH=\"$HOME/go/bin:$PATH\"\nalias ll='ls -la'"
+	got := upsertWrapperBlock(rc, rcBlock("bash"))
+	if !strings.HasPrefix(got, rc+"\n\n") {
+		t.Errorf("existing content should be kept before the block, got %q", got)
+	}
+	if !strings.HasSuffix(got, rcBlock("bash")) {
+		t.Errorf("block should be appended, got %q", got)
+	}
+}
+
+func TestUpsertWrapperBlock_ReplacesInPlace(t *testing.T) {
+	rc := "before\n" + wrapperBeginMarker + "\nold stuff\n" + wrapperEndMarker + "\nafter\n"
+	got := upsertWrapperBlock(rc, rcBlock("zsh"))
+	want := "before\n" + rcBlock("zsh") + "after\n"
+	if got != want {
+		t.Errorf("expected block replaced in place:\nwant %q\ngot  %q", want, got)
+	}
+}
+
+func TestFixShellWrapper_Idempotent(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	rcFile := filepath.Join(home, ".zshrc")
+	if err := os.WriteFile(rcFile, []byte("alias ll='ls -la'\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		_, changed, err := fixShellWrapper("zsh")
+		if err != nil {
+			t.Fatalf("fix run %d failed: %v", i+1, err)
+		}
+		if changed != (i == 0) {
+			t.Errorf("fix run %d: changed = %v, want %v", i+1, changed, i == 0)
+		}
+	}
+
+	data, _ := os.ReadFile(rcFile)
+	rc := string(data)
+	if n := strings.Count(rc, wrapperBeginMarker); n != 1 {
+		t.Errorf("expected exactly 1 wrapper block after repeated fixes, got %d:\n%s", n, rc)
+	}
+	if !strings.Contains(rc, "alias ll='ls -la'") {
+		t.Error("existing rc content should be preserved")
+	}
+	if !hasWrapper(rc) {
+		t.Error("rc should be detected as having the wrapper")
+	}
+}
+
+func TestFixShellWrapper_ReplacesLegacyLine(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	rcFile := filepath.Join(home, ".zshrc")
+	legacy := "alias ll='ls -la'\neval \"$(xx init zsh)\"\nexport EDITOR=vim\n"
+	if err := os.WriteFile(rcFile, []byte(legacy), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, changed, err := fixShellWrapper("zsh"); err != nil || !changed {
+		t.Fatalf("fix should replace the legacy line, got changed=%v, %v", changed, err)
+	}
+	data, _ := os.ReadFile(rcFile)
+	want := "alias ll='ls -la'\n" + rcBlock("zsh") + "export EDITOR=vim\n"
+	if string(data) != want {
+		t.Errorf("legacy line should become the marker block in place:\nwant %q\ngot  %q", want, data)
+	}
+	if n := strings.Count(string(data), "xx init zsh"); n != 1 {
+		t.Errorf("the wrapper should be loaded once, found %d eval lines", n)
+	}
+
+	if _, changed, err := fixShellWrapper("zsh"); err != nil || changed {
+		t.Errorf("a second fix should change nothing, got changed=%v, %v", changed, err)
+	}
+}
+
+func TestFixShellWrapper_CreatesFishConfig(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	rcFile, _, err := fixShellWrapper("fish")
+	if err != nil {
+		t.Fatalf("fix failed: %v", err)
+	}
+	data, err := os.ReadFile(rcFile)
+	if err != nil {
+		t.Fatalf("fish config should have been created: %v", err)
+	}
+	if string(data) != rcBlock("fish") {
+		t.Errorf("unexpected fish config: %q", data)
+	}
+}
+
+func TestFixShellWrapper_UnsupportedShell(t *testing.T) {
+	if _, _, err := fixShellWrapper("tcsh"); err == nil {
+		t.Error("expected error for unsupported shell")
+	}
+}
+
+func TestHasWrapper(t *testing.T) {
+	tests := []struct {
+		name string
+		rc   string
+		want bool
+	}{
+		{"marker block", rcBlock("zsh"), true},
+		{"legacy eval line", "eval \"$(xx init zsh)\"\n", true},
+		{"commented out", "# eval \"$(xx init zsh)\"\n", false},
+		{"mentioned in a comment", "# TODO: try xx init someday\n", false},
+		{"empty", "", false},
+	}
+	for _, tt := range tests {
+		if got := hasWrapper(tt.rc); got != tt.want {
+			t.Errorf("%s: hasWrapper = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
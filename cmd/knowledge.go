@@ -0,0 +1,197 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/arin/xx-cli/internal/rag"
+	"github.com/arin/xx-cli/internal/ui"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var (
+	knowledgeLimit    int
+	knowledgeTop      int
+	knowledgeCategory string
+)
+
+var knowledgeCmd = &cobra.Command{
+	Use:   "knowledge",
+	Short: "Inspect what xx has learned in its knowledge index",
+}
+
+var knowledgeTopCmd = &cobra.Command{
+	Use:   "top",
+	Short: "Show the best and worst performing learned knowledge",
+	Long: `Ranks learned corrections and command history in the knowledge index by
+feedback (successes minus failures). The best performers are what xx leans on
+most; the worst are candidates to forget with 'xx index --flush'.
+
+Only entries that have received feedback are shown. Builtin knowledge is
+curated, so it isn't ranked here.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store := rag.NewStore()
+		if err := store.Load(); err != nil {
+			return fmt.Errorf("failed to load knowledge index: %w", err)
+		}
+
+		cyan := color.New(color.FgCyan, color.Bold)
+		dim := color.New(color.FgHiBlack)
+
+		cyan.Fprintf(os.Stderr, "\n  🧠 xx knowledge\n\n")
+
+		if store.Len() == 0 {
+			dim.Fprintln(os.Stderr, "  The index is empty. Run 'xx index' to build it.")
+			fmt.Fprintln(os.Stderr)
+			return nil
+		}
+
+		ranked := store.RankByFeedback("learned", "history")
+		var best, worst []rag.Document
+		for _, d := range ranked {
+			if d.NetScore() > 0 && len(best) < knowledgeLimit {
+				best = append(best, d)
+			}
+		}
+		for i := len(ranked) - 1; i >= 0 && len(worst) < knowledgeLimit; i-- {
+			if ranked[i].NetScore() < 0 {
+				worst = append(worst, ranked[i])
+			}
+		}
+
+		if len(best) == 0 && len(worst) == 0 {
+			dim.Fprintln(os.Stderr, "  No feedback recorded yet. Use xx for a while and come back.")
+			fmt.Fprintln(os.Stderr)
+			return nil
+		}
+
+		if len(best) > 0 {
+			color.New(color.FgGreen, color.Bold).Fprintln(os.Stderr, "  Top performers")
+			printKnowledgeDocs(best, color.New(color.FgGreen))
+		}
+		if len(worst) > 0 {
+			color.New(color.FgRed, color.Bold).Fprintln(os.Stderr, "  Worst performers (candidates to forget)")
+			printKnowledgeDocs(worst, color.New(color.FgRed))
+		}
+		return nil
+	},
+}
+
+var knowledgeAuditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Find builtin knowledge that keeps failing on this machine",
+	Long: fmt.Sprintf(`Lists builtin OS command docs that are frequently followed by failed
+commands here: at least %d failures, making up at least %.0f%% of their
+feedback. These usually point at knowledge that's wrong for your environment,
+such as a tool that isn't installed or flags your version doesn't support.
+
+Feedback is recorded locally after every command and never leaves your
+machine. Teach xx the right command with 'xx learn' to override a bad doc.`,
+		rag.SuspectMinFailures, rag.SuspectFailureRatio*100),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store := rag.NewStore()
+		if err := store.Load(); err != nil {
+			return fmt.Errorf("failed to load knowledge index: %w", err)
+		}
+
+		cyan := color.New(color.FgCyan, color.Bold)
+		green := color.New(color.FgGreen)
+		dim := color.New(color.FgHiBlack)
+
+		cyan.Fprintf(os.Stderr, "\n  🧠 xx knowledge audit\n\n")
+
+		suspects := store.SuspectBuiltins()
+		if len(suspects) == 0 {
+			green.Fprintln(os.Stderr, "  ✓ No builtin knowledge is failing repeatedly on this machine.")
+			fmt.Fprintln(os.Stderr)
+			return nil
+		}
+
+		color.New(color.FgRed, color.Bold).Fprintln(os.Stderr, "  Builtins that keep failing here")
+		printKnowledgeDocs(suspects, color.New(color.FgRed))
+		dim.Fprintln(os.Stderr, "  Override one with: xx learn \"<prompt>\" \"<command that works here>\"")
+		fmt.Fprintln(os.Stderr)
+		return nil
+	},
+}
+
+var knowledgeSearchCmd = &cobra.Command{
+	Use:   "search <query>",
+	Short: "Show what the knowledge index retrieves for a query",
+	Long: fmt.Sprintf(`Embeds the query and prints the top documents the knowledge index returns
+for it, the same search xx runs before every translation, so you can see why
+it picked a command. Each hit shows its source, category and final score,
+broken down into cosine similarity × feedback multiplier × source boost.
+
+Results scoring below %.2f are marked: they're dropped before the prompt.
+Use --category to search one category only, e.g. memory, network or git.`, rag.MinScore),
+	Example: `  xx knowledge search "how much ram do i have"
+  xx knowledge search --top 10 --category network "open ports"`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if knowledgeTop < 1 {
+			return fmt.Errorf("--top must be at least 1")
+		}
+		query := strings.Join(args, " ")
+		sp := ui.NewSpinner("Searching knowledge...")
+		sp.Start()
+		results, err := rag.Search(cmd.Context(), nil, query, knowledgeTop, knowledgeCategory)
+		sp.Stop()
+		if err != nil {
+			return err
+		}
+
+		color.New(color.FgCyan, color.Bold).Fprintf(os.Stderr, "\n  🧠 xx knowledge search: %s\n\n", query)
+		writeSearchResults(os.Stderr, results)
+		return nil
+	},
+}
+
+// writeSearchResults prints ranked search hits with their score breakdown.
+func writeSearchResults(w io.Writer, results []rag.SearchResult) {
+	dim := color.New(color.FgHiBlack)
+	if len(results) == 0 {
+		dim.Fprintln(w, "  No documents matched. Run 'xx index' to build the index, or try another --category.")
+		fmt.Fprintln(w)
+		return
+	}
+	for i, r := range results {
+		scoreColor := color.New(color.FgGreen)
+		if r.Score < rag.MinScore {
+			scoreColor = color.New(color.FgHiBlack)
+		}
+		scoreColor.Fprintf(w, "  %2d. %.3f ", i+1, r.Score)
+		dim.Fprintf(w, "[%s] (%s) ", r.Doc.Source, r.Doc.Category)
+		fmt.Fprintln(w, r.Doc.Text)
+		dim.Fprintf(w, "      cosine %.3f × feedback %.2f (✓%d ✗%d) × source %.2f",
+			r.Cosine, r.Feedback, r.Doc.SuccessCount, r.Doc.FailureCount, r.Boost)
+		if r.Score < rag.MinScore {
+			dim.Fprintf(w, ", below %.2f: not used", rag.MinScore)
+		}
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintln(w)
+}
+
+// printKnowledgeDocs prints one ranked document per line with its score.
+func printKnowledgeDocs(docs []rag.Document, scoreColor *color.Color) {
+	dim := color.New(color.FgHiBlack)
+	for _, d := range docs {
+		scoreColor.Fprintf(os.Stderr, "  %+4d ", d.NetScore())
+		dim.Fprintf(os.Stderr, "(✓%d ✗%d) [%s] ", d.SuccessCount, d.FailureCount, d.Source)
+		fmt.Fprintln(os.Stderr, d.Text)
+	}
+	fmt.Fprintln(os.Stderr)
+}
+
+func init() {
+	knowledgeTopCmd.Flags().IntVarP(&knowledgeLimit, "limit", "n", 10, "number of entries to show in each list")
+	knowledgeCmd.AddCommand(knowledgeTopCmd)
+	knowledgeCmd.AddCommand(knowledgeAuditCmd)
+	knowledgeSearchCmd.Flags().IntVarP(&knowledgeTop, "top", "k", rag.DefaultTopK, "number of documents to show")
+	knowledgeSearchCmd.Flags().StringVarP(&knowledgeCategory, "category", "c", "", "only search documents in this category")
+	knowledgeCmd.AddCommand(knowledgeSearchCmd)
+}
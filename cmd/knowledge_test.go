@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/arin/xx-cli/internal/rag"
+)
+
+func TestWriteSearchResults_ShowsBreakdownAndFloor(t *testing.T) {
+	var buf bytes.Buffer
+	writeSearchResults(&buf, []rag.SearchResult{
+		{Doc: rag.Document{Text: "check memory: free -h", Source: "builtin", Category: "memory"}, Score: 0.96, Cosine: 0.8, Feedback: 1, Boost: 1.2},
+		{Doc: rag.Document{Text: "current branch: git branch", Source: "history", Category: "git", FailureCount: 2}, Score: 0.1, Cosine: 0.16, Feedback: 0.45, Boost: 1},
+	})
+	out := buf.String()
+	lines := strings.Split(out, "\n")
+
+	if !strings.Contains(lines[0], "[builtin] (memory) check memory: free -h") {
+		t.Errorf("expected the source, category and text of the first hit, got %q", lines[0])
+	}
+	if !strings.Contains(lines[1], "cosine 0.800 × feedback 1.00 (✓0 ✗0) × source 1.20") || strings.Contains(lines[1], "not used") {
+		t.Errorf("expected the score breakdown of the first hit, got %q", lines[1])
+	}
+	if !strings.Contains(lines[3], "✗2") || !strings.Contains(lines[3], "not used") {
+		t.Errorf("a hit below the relevance floor should be marked unused, got %q", lines[3])
+	}
+
+	buf.Reset()
+	writeSearchResults(&buf, nil)
+	if !strings.Contains(buf.String(), "No documents matched") {
+		t.Errorf("expected a hint when nothing matched, got %q", buf.String())
+	}
+}
@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/arin/xx-cli/internal/history"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var lastCount int
+
+// lastWrapWidth is the column at which long output lines are wrapped.
+const lastWrapWidth = 100
+
+var lastCmd = &cobra.Command{
+	Use:   "last",
+	Short: "Show the full details of the previous command",
+	Long: `Prints the most recent history entry in full: prompt, command, intent,
+exit status, output, and the RAG context the AI saw (when it was stored).
+
+Use -n to show the last few entries, oldest first.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if lastCount < 1 {
+			return fmt.Errorf("-n must be at least 1")
+		}
+		entries, err := history.Load(lastCount)
+		if err != nil {
+			return fmt.Errorf("failed to load history: %w", err)
+		}
+		if len(entries) == 0 {
+			fmt.Println("No history yet.")
+			return nil
+		}
+
+		for i, e := range entries {
+			if i > 0 {
+				fmt.Println()
+			}
+			writeLastEntry(os.Stdout, e)
+		}
+		return nil
+	},
+}
+
+func init() {
+	lastCmd.Flags().IntVarP(&lastCount, "count", "n", 1, "Number of recent entries to show")
+}
+
+// writeLastEntry prints every stored field of a history entry. Fields that
+// weren't recorded (older entries, non-workflow commands) are left out.
+func writeLastEntry(w io.Writer, e history.Entry) {
+	cyan := color.New(color.FgCyan, color.Bold)
+	dim := color.New(color.FgHiBlack)
+	green := color.New(color.FgGreen)
+	red := color.New(color.FgRed)
+
+	dim.Fprintf(w, "  [%s]", e.Timestamp.Format("2006-01-02 15:04:05"))
+	if e.Success {
+		green.Fprintf(w, "  ✓ success (exit %d)", e.ExitCode)
+	} else if e.ExitCode != 0 {
+		red.Fprintf(w, "  ✗ failed (exit %d)", e.ExitCode)
+	} else {
+		red.Fprint(w, "  ✗ failed")
+	}
+	if e.DurationMs > 0 {
+		dim.Fprintf(w, "  %s", time.Duration(e.DurationMs)*time.Millisecond)
+	}
+	fmt.Fprintln(w)
+
+	fmt.Fprintf(w, "  Prompt:   %s\n", e.Prompt)
+	fmt.Fprint(w, "  Command:  ")
+	cyan.Fprintln(w, e.Command)
+	if e.Intent != "" {
+		fmt.Fprintf(w, "  Intent:   %s\n", e.Intent)
+	}
+	if e.StepLabel != "" {
+		fmt.Fprintf(w, "  Step:     %s\n", e.StepLabel)
+	}
+	if e.Project != "" {
+		fmt.Fprintf(w, "  Project:  %s\n", e.Project)
+	}
+
+	if e.Interactive {
+		dim.Fprintln(w, "  Output:   (interactive, not captured)")
+	} else if out := strings.TrimRight(e.Output, "\n"); out != "" {
+		fmt.Fprintln(w, "  Output:")
+		for _, line := range wrapLines(out, lastWrapWidth) {
+			fmt.Fprintf(w, "    %s\n", line)
+		}
+	}
+	if rag := strings.TrimSpace(e.RAGContext); rag != "" {
+		fmt.Fprintln(w, "  RAG context:")
+		for _, line := range strings.Split(rag, "\n") {
+			dim.Fprintf(w, "    %s\n", line)
+		}
+	}
+}
+
+// wrapLines splits text into lines no wider than width runes, breaking
+// long lines hard so wide output (JSON, minified logs) stays readable.
+func wrapLines(text string, width int) []string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		runes := []rune(line)
+		for len(runes) > width {
+			lines = append(lines, string(runes[:width]))
+			runes = runes[width:]
+		}
+		lines = append(lines, string(runes))
+	}
+	return lines
+}
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arin/xx-cli/internal/history"
+)
+
+func TestWriteLastEntry_AllFields(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	longLine := strings.Repeat("x", lastWrapWidth+20)
+	if err := history.Save(history.Entry{Prompt: "older", Command: "true", Success: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := history.Save(history.Entry{
+		Prompt:     "is port 3000 in use",
+		Command:    "lsof -i :3000",
+		Output:     "COMMAND PID\nnode 4242\n" + longLine,
+		Success:    false,
+		Project:    "/work/app",
+		DurationMs: 1500,
+		Intent:     "query",
+		ExitCode:   1,
+		RAGContext: "\nRelevant knowledge:\n- [builtin] check ports: lsof -i\n",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := history.Load(1)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("load history: %v (%d entries)", err, len(entries))
+	}
+
+	var buf bytes.Buffer
+	writeLastEntry(&buf, entries[0])
+	out := buf.String()
+
+	for _, want := range []string{
+		entries[0].Timestamp.Format("2006-01-02 15:04:05"),
+		"✗ failed (exit 1)",
+		(1500 * time.Millisecond).String(),
+		"Prompt:   is port 3000 in use",
+		"Command:  lsof -i :3000",
+		"Intent:   query",
+		"Project:  /work/app",
+		"    node 4242",
+		"    " + strings.Repeat("x", lastWrapWidth) + "\n    xxxxxxxxxxxxxxxxxxxx\n",
+		"RAG context:",
+		"    - [builtin] check ports: lsof -i",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "older") {
+		t.Error("only the most recent entry should be shown")
+	}
+}
+
+func TestWriteLastEntry_OmitsUnrecordedFields(t *testing.T) {
+	var buf bytes.Buffer
+	writeLastEntry(&buf, history.Entry{Prompt: "list files", Command: "ls", Success: true})
+	out := buf.String()
+
+	if !strings.Contains(out, "✓ success (exit 0)") {
+		t.Errorf("expected success status, got:\n%s", out)
+	}
+	for _, absent := range []string{"Intent:", "Step:", "Output:", "RAG context:"} {
+		if strings.Contains(out, absent) {
+			t.Errorf("unrecorded field %q should be omitted:\n%s", absent, out)
+		}
+	}
+}
@@ -18,10 +18,31 @@ Examples:
   xx learn "deploy" "./scripts/deploy.sh"
   xx learn "lint" "golangci-lint run ./..."
 
+Use <name> placeholders to teach a template. Matching prompts fill in the
+value and run the command directly, without asking the AI:
+  xx learn "ssh to <host>" "ssh deploy@<host>.internal"
+
 View all learned corrections:
-  xx learn --list`,
+  xx learn --list
+
+Remove one:
+  xx learn --forget "deploy"`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		listFlag, _ := cmd.Flags().GetBool("list")
+		forget, _ := cmd.Flags().GetString("forget")
+
+		if forget != "" {
+			removed, err := learn.Forget(forget)
+			if err != nil {
+				return fmt.Errorf("failed to forget: %w", err)
+			}
+			if !removed {
+				return fmt.Errorf("no learned correction for %q (see: xx learn --list)", forget)
+			}
+			green := color.New(color.FgGreen)
+			green.Printf("\n  ✓ Forgot: \"%s\"\n\n", forget)
+			return nil
+		}
 
 		if listFlag {
 			corrections, err := learn.LoadAll()
@@ -55,6 +76,9 @@ View all learned corrections:
 		if err := learn.Save(correction); err != nil {
 			return fmt.Errorf("failed to save: %w", err)
 		}
+		// Embed it into the knowledge index in the background, so RAG
+		// picks it up without a manual 'xx index'.
+		spawnDetached("_learn-correction", correction.Prompt, correction.Command)
 
 		green := color.New(color.FgGreen)
 		green.Printf("\n  ✓ Learned: \"%s\" → %s\n\n", args[0], args[1])
@@ -64,4 +88,6 @@ View all learned corrections:
 
 func init() {
 	learnCmd.Flags().Bool("list", false, "Show all learned corrections")
+	learnCmd.Flags().String("forget", "", "Remove the learned correction for this prompt")
+	_ = learnCmd.RegisterFlagCompletionFunc("forget", completeLearnedPrompts)
 }
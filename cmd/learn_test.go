@@ -0,0 +1,24 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLearn_IndexesCorrectionInBackground(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	var spawned [][]string
+	origSpawn := spawnDetached
+	spawnDetached = func(args ...string) { spawned = append(spawned, args) }
+	defer func() { spawnDetached = origSpawn }()
+	defer rootCmd.SetArgs(nil)
+
+	rootCmd.SetArgs([]string{"learn", "run tests", "make test"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("xx learn failed: %v", err)
+	}
+	if len(spawned) != 1 || strings.Join(spawned[0], "|") != "_learn-correction|run tests|make test" {
+		t.Errorf("expected a background _learn-correction for the new correction, got %q", spawned)
+	}
+}
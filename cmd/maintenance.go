@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/arin/xx-cli/internal/history"
+	"github.com/arin/xx-cli/internal/learn"
+	"github.com/arin/xx-cli/internal/rag"
+	"github.com/arin/xx-cli/internal/stats"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var maintenanceDryRun bool
+
+// maintenanceTask is one cleanup step of `xx maintenance`. run returns how
+// many items it removed, or would remove with dryRun.
+type maintenanceTask struct {
+	what string // The kind of item removed, e.g. "history entries over the cap".
+	run  func(dryRun bool) (int, error)
+}
+
+// maintenanceTasks run in order. It's a variable so tests can stub out the
+// sub-operations.
+var maintenanceTasks = []maintenanceTask{
+	{"near-duplicate knowledge index entries", rag.Compact},
+	{"history entries over the cap", history.Trim},
+	{"stats records over the cap", stats.Trim},
+	{"duplicate learned corrections", learn.Dedup},
+}
+
+var maintenanceCmd = &cobra.Command{
+	Use:   "maintenance",
+	Short: "Run the recommended cleanup of xx's local data",
+	Long: `Runs every cleanup xx recommends, in one go:
+
+  - compacts the knowledge index, dropping near-duplicate entries
+    (builtins are always kept)
+  - trims history and stats files to their caps
+  - removes learned corrections whose prompts only differ in case,
+    spacing or punctuation, keeping the newest
+
+Use --dry-run to see what would be removed without changing anything.
+To rebuild the knowledge index from scratch instead, use 'xx index --flush'.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runMaintenance(os.Stderr, maintenanceDryRun)
+	},
+}
+
+func init() {
+	maintenanceCmd.Flags().BoolVar(&maintenanceDryRun, "dry-run", false, "Report what would be removed without changing anything")
+}
+
+// runMaintenance runs every maintenance task and reports what each did. A
+// failing task doesn't stop the others; the failures are reported at the end.
+func runMaintenance(w io.Writer, dryRun bool) error {
+	cyan := color.New(color.FgCyan, color.Bold)
+	green := color.New(color.FgGreen)
+	yellow := color.New(color.FgYellow)
+	dim := color.New(color.FgHiBlack)
+
+	if dryRun {
+		cyan.Fprintf(w, "\n  🧹 xx maintenance (dry run)\n\n")
+	} else {
+		cyan.Fprintf(w, "\n  🧹 xx maintenance\n\n")
+	}
+
+	failed, total := 0, 0
+	for _, task := range maintenanceTasks {
+		n, err := task.run(dryRun)
+		switch {
+		case err != nil:
+			failed++
+			yellow.Fprintf(w, "  ⚠ %s: %v\n", task.what, err)
+		case n == 0:
+			dim.Fprintf(w, "  ✓ no %s\n", task.what)
+		case dryRun:
+			total += n
+			fmt.Fprintf(w, "  • would remove %d %s\n", n, task.what)
+		default:
+			total += n
+			green.Fprintf(w, "  ✓ removed %d %s\n", n, task.what)
+		}
+	}
+
+	fmt.Fprintln(w)
+	if dryRun {
+		dim.Fprintf(w, "  %d items would be removed. Run without --dry-run to clean up.\n\n", total)
+	} else {
+		dim.Fprintf(w, "  %d items removed.\n\n", total)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d maintenance steps failed", failed, len(maintenanceTasks))
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRunMaintenance_RunsEveryTask(t *testing.T) {
+	orig := maintenanceTasks
+	defer func() { maintenanceTasks = orig }()
+
+	var calls []string
+	var dryRuns []bool
+	stub := func(name string, n int, err error) maintenanceTask {
+		return maintenanceTask{what: name, run: func(dryRun bool) (int, error) {
+			calls = append(calls, name)
+			dryRuns = append(dryRuns, dryRun)
+			return n, err
+		}}
+	}
+	maintenanceTasks = []maintenanceTask{
+		stub("index entries", 4, nil),
+		stub("history entries", 0, nil),
+		stub("stats records", 12, nil),
+		stub("corrections", 1, nil),
+	}
+
+	var out bytes.Buffer
+	if err := runMaintenance(&out, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(calls, ",") != "index entries,history entries,stats records,corrections" {
+		t.Errorf("every task should run in order, got %v", calls)
+	}
+	for _, want := range []string{"removed 4 index entries", "no history entries", "removed 12 stats records", "removed 1 corrections", "17 items removed"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("report should contain %q, got:\n%s", want, out.String())
+		}
+	}
+
+	calls, dryRuns = nil, nil
+	out.Reset()
+	if err := runMaintenance(&out, true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i, d := range dryRuns {
+		if !d {
+			t.Errorf("task %s should get dryRun=true", calls[i])
+		}
+	}
+	if !strings.Contains(out.String(), "would remove 4 index entries") || !strings.Contains(out.String(), "17 items would be removed") {
+		t.Errorf("dry run should report what would be removed, got:\n%s", out.String())
+	}
+}
+
+func TestRunMaintenance_ContinuesPastFailures(t *testing.T) {
+	orig := maintenanceTasks
+	defer func() { maintenanceTasks = orig }()
+
+	ran := 0
+	maintenanceTasks = []maintenanceTask{
+		{what: "index entries", run: func(bool) (int, error) { ran++; return 0, errors.New("store is locked") }},
+		{what: "history entries", run: func(bool) (int, error) { ran++; return 2, nil }},
+	}
+
+	var out bytes.Buffer
+	err := runMaintenance(&out, false)
+	if err == nil || !strings.Contains(err.Error(), "1 of 2") {
+		t.Errorf("expected a failure summary, got %v", err)
+	}
+	if ran != 2 {
+		t.Errorf("a failing task shouldn't stop the rest, ran %d", ran)
+	}
+	if !strings.Contains(out.String(), "index entries: store is locked") || !strings.Contains(out.String(), "removed 2 history entries") {
+		t.Errorf("unexpected report:\n%s", out.String())
+	}
+}
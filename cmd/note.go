@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/arin/xx-cli/internal/learn"
+	"github.com/arin/xx-cli/internal/rag"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var noteCmd = &cobra.Command{
+	Use:   "note <text>",
+	Short: "Teach xx a fact to use as context for future commands",
+	Long: `Store a note so xx knows facts about your setup, not just commands.
+
+Notes are embedded into the knowledge index and surface as context when a
+query is related, e.g. asking to "connect to the prod db" after:
+  xx note "our prod DB is in us-east-1"
+
+Notes are kept in ~/.xx-cli/notes.json and re-embedded by 'xx index', so
+they survive rebuilding the index.
+
+View all notes:
+  xx note --list`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		listFlag, _ := cmd.Flags().GetBool("list")
+
+		if listFlag {
+			notes, err := learn.LoadNotes()
+			if err != nil {
+				return fmt.Errorf("failed to load notes: %w", err)
+			}
+			if len(notes) == 0 {
+				fmt.Println("  No notes yet.")
+				return nil
+			}
+			dim := color.New(color.FgHiBlack)
+			fmt.Println()
+			for _, n := range notes {
+				dim.Printf("  %s  ", n.AddedAt.Format("2006-01-02"))
+				fmt.Printf("%s\n", n.Text)
+			}
+			fmt.Println()
+			return nil
+		}
+
+		text := strings.TrimSpace(strings.Join(args, " "))
+		if text == "" {
+			return fmt.Errorf("expected a note: xx note \"text\"\n\nExample: xx note \"our prod DB is in us-east-1\"")
+		}
+
+		note, err := learn.SaveNote(text)
+		if err != nil {
+			return fmt.Errorf("failed to save note: %w", err)
+		}
+
+		if err := rag.AddNote(cmd.Context(), rag.NewEmbedClient(), note.Text); err != nil {
+			yellow := color.New(color.FgYellow)
+			yellow.Printf("\n  ⚠ Saved, but not indexed yet: %v\n", err)
+			yellow.Printf("    It will be picked up by the next 'xx index'.\n\n")
+			return nil
+		}
+
+		green := color.New(color.FgGreen)
+		green.Printf("\n  ✓ Noted: \"%s\"\n\n", note.Text)
+		return nil
+	},
+}
+
+func init() {
+	noteCmd.Flags().Bool("list", false, "Show all notes")
+}
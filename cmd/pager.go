@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// noPager is --no-pager: print display output directly this time, however
+// long it is.
+var noPager bool
+
+// pagerCommand returns the shell command that long display output is piped
+// through: $PAGER, or less -R (more on Windows) so the command's colours
+// survive. Empty means there's no pager to use. It's a variable so tests
+// can inject their own.
+var pagerCommand = func() string {
+	if pager := os.Getenv("PAGER"); pager != "" {
+		return pager
+	}
+	if runtime.GOOS == "windows" {
+		return "more"
+	}
+	if _, err := exec.LookPath("less"); err != nil {
+		return ""
+	}
+	return "less -R"
+}
+
+// stdoutIsTerminal reports whether stdout is a terminal rather than a pipe
+// or a file. It's a variable so tests can pretend it is.
+var stdoutIsTerminal = func() bool {
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// printDisplayOutput prints a display command's output, through the pager
+// if it's longer than maxLines (the pager_lines setting, 0 meaning never)
+// and a person is reading stdout. Output piped elsewhere is never paged,
+// and if the pager can't be started the output is printed as usual.
+func printDisplayOutput(output string, maxLines int) {
+	if output == "" {
+		return
+	}
+	if maxLines > 0 && !noPager && stdoutIsTerminal() && countLines(output) > maxLines {
+		if pager := pagerCommand(); pager != "" && runPager(pager, output) == nil {
+			return
+		}
+	}
+	fmt.Print(output)
+}
+
+// runPager feeds output to pager, run by the shell with the terminal as its
+// stdout, and waits for the user to quit it. It only fails if the pager
+// couldn't be started; how the user leaves it doesn't matter.
+func runPager(pager, output string) error {
+	shell, flag := "/bin/sh", "-c"
+	if runtime.GOOS == "windows" {
+		shell, flag = "cmd", "/C"
+	}
+	c := exec.Command(shell, flag, pager)
+	c.Stdin = strings.NewReader(output)
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	if err := c.Start(); err != nil {
+		return err
+	}
+	_ = c.Wait()
+	return nil
+}
+
+// countLines returns how many lines output takes, counting a final line
+// without a newline.
+func countLines(output string) int {
+	return strings.Count(strings.TrimSuffix(output, "\n"), "\n") + 1
+}
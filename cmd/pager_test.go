@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/arin/xx-cli/internal/config"
+)
+
+func TestRun_PagesOnlyLongDisplayOutput(t *testing.T) {
+	home := runOffline(t, map[string]string{"count to 3": "seq 3", "count to 50": "seq 50"})
+	if err := config.Set("pager_lines", "10"); err != nil {
+		t.Fatalf("set pager_lines: %v", err)
+	}
+
+	paged := filepath.Join(home, "paged.txt")
+	origPager, origTTY := pagerCommand, stdoutIsTerminal
+	defer func() { pagerCommand, stdoutIsTerminal = origPager, origTTY }()
+	pagerCommand = func() string { return "cat > " + paged }
+	stdoutIsTerminal = func() bool { return true }
+
+	if err := run(rootCmd, []string{"count", "to", "3"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(paged); !os.IsNotExist(err) {
+		t.Fatalf("3 lines shouldn't be paged (err %v)", err)
+	}
+
+	if err := run(rootCmd, []string{"count", "to", "50"}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(paged)
+	if err != nil {
+		t.Fatalf("50 lines should go to the pager: %v", err)
+	}
+	if lines := strings.Split(strings.TrimSpace(string(data)), "\n"); len(lines) != 50 || lines[49] != "50" {
+		t.Errorf("the pager should get the whole output, got %d lines", len(lines))
+	}
+
+	// Not when stdout isn't a terminal.
+	os.Remove(paged)
+	stdoutIsTerminal = func() bool { return false }
+	if err := run(rootCmd, []string{"count", "to", "50"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(paged); !os.IsNotExist(err) {
+		t.Errorf("output that isn't going to a terminal shouldn't be paged")
+	}
+}
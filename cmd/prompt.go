@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/arin/xx-cli/internal/ai"
+	"github.com/arin/xx-cli/internal/config"
+	"github.com/spf13/cobra"
+)
+
+// promptCmd is a hidden debugging subcommand that prints the exact messages
+// a translation would send — system rules, RAG context, extra instructions,
+// and learned corrections — without calling the model. Handy for spotting
+// prompt bloat or ordering problems when a translation goes wrong:
+//
+//	xx _prompt show disk usage
+var promptCmd = &cobra.Command{
+	Use:    "_prompt <text>",
+	Hidden: true,
+	Args:   cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		client := newClient(cfg)
+		dumpPrompt(cmd.Context(), os.Stdout, client, strings.Join(args, " "))
+		return nil
+	},
+}
+
+// dumpPrompt writes each message with a role header and its size.
+func dumpPrompt(ctx context.Context, w io.Writer, client *ai.Client, prompt string) {
+	for i, m := range client.PromptMessages(ctx, prompt) {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "=== %s (%d chars) ===\n", m.Role, utf8.RuneCountInString(m.Content))
+		fmt.Fprintln(w, m.Content)
+	}
+}
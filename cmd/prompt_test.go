@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/arin/xx-cli/internal/ai"
+	"github.com/arin/xx-cli/internal/config"
+	"github.com/arin/xx-cli/internal/learn"
+)
+
+func TestDumpPrompt_IncludesRulesAndCorrections(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	if err := learn.Save(learn.Correction{Prompt: "run tests", Command: "make test"}); err != nil {
+		t.Fatal(err)
+	}
+
+	mock := &mockStreamProvider{}
+	client := ai.NewClientWithProvider(mock)
+
+	var buf bytes.Buffer
+	dumpPrompt(context.Background(), &buf, client, "show disk usage")
+	out := buf.String()
+
+	for _, want := range []string{"=== system (", "Rules:", "make test", "=== user (15 chars) ===\nshow disk usage"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("dump missing %q:\n%s", want, out)
+		}
+	}
+	if mock.lastMsgs != nil {
+		t.Error("dumping the prompt must not call the model")
+	}
+}
+
+func TestDumpPrompt_IncludesExtraInstructions(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	client := ai.NewClient(&config.Config{Model: "test", ExtraInstructions: "always prefer fd over find"})
+	var buf bytes.Buffer
+	dumpPrompt(context.Background(), &buf, client, "find go files")
+
+	if !strings.Contains(buf.String(), "always prefer fd over find") {
+		t.Errorf("dump should include extra instructions:\n%s", buf.String())
+	}
+}
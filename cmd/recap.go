@@ -6,9 +6,9 @@ import (
 	"strings"
 	"time"
 
-	"github.com/arin/xx-cli/internal/ai"
 	"github.com/arin/xx-cli/internal/config"
 	"github.com/arin/xx-cli/internal/history"
+	"github.com/arin/xx-cli/internal/stats"
 	"github.com/arin/xx-cli/internal/ui"
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
@@ -32,10 +32,10 @@ a concise recap powered by AI.`,
 			return fmt.Errorf("failed to load history: %w", err)
 		}
 
-		today := time.Now().Truncate(24 * time.Hour)
+		today := stats.StartOfDay(time.Now())
 		var todayEntries []history.Entry
 		for _, e := range entries {
-			if e.Timestamp.After(today) {
+			if !e.Timestamp.Before(today) {
 				todayEntries = append(todayEntries, e)
 			}
 		}
@@ -57,7 +57,7 @@ a concise recap powered by AI.`,
 				e.Prompt, e.Command, status))
 		}
 
-		client := ai.NewClient(cfg)
+		client := newClient(cfg)
 
 		cyan := color.New(color.FgCyan, color.Bold)
 		cyan.Fprintf(cmd.ErrOrStderr(), "\n  📋 Today's Recap\n\n")
@@ -1,15 +1,55 @@
 package cmd
 
 import (
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/arin/xx-cli/internal/config"
 	"github.com/spf13/cobra"
 )
 
 var (
-	dryRun  bool
-	yolo    bool
-	verbose bool
+	dryRun    bool
+	yolo      bool
+	force     bool
+	verbose   bool
+	agentic   bool
+	maxOutput int
+	incognito bool
+	parallel  bool
+	noContext bool
+
+	workflowSummary bool
+	configDir       string
+	suggestOnlyFlag bool
+	alternatives    int
+	repeat          int
+	repeatDelay     time.Duration
+	execTimeout     time.Duration
+	interactive     bool
 )
 
+// envIncognito turns on incognito mode for every invocation, like --incognito.
+const envIncognito = "XX_INCOGNITO"
+
+// suggestOnly reports whether xx may only print commands, never run them:
+// --suggest-only for this invocation, or safe_mode in the config.
+func suggestOnly(cfg *config.Config) bool {
+	return suggestOnlyFlag || cfg.SafeMode
+}
+
+// persistEnabled reports whether this invocation may record anything about
+// itself: history, stats, auto-learned knowledge, or feedback. It is false
+// in incognito mode (--incognito or XX_INCOGNITO=1).
+func persistEnabled() bool {
+	if incognito {
+		return false
+	}
+	on, _ := strconv.ParseBool(os.Getenv(envIncognito))
+	return !on
+}
+
 var rootCmd = &cobra.Command{
 	Use:   "xx [natural language command]",
 	Short: "A natural language CLI assistant",
@@ -24,6 +64,9 @@ Examples:
 
 Note: Avoid special shell characters like ? or * in your prompt.
       Use quotes if needed: xx "is slack running?"`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return config.SetDir(configDir)
+	},
 	RunE:                       run,
 	SilenceUsage:               true,
 	SilenceErrors:              true,
@@ -35,23 +78,50 @@ Note: Avoid special shell characters like ? or * in your prompt.
 func init() {
 	rootCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show the generated command without executing it")
 	rootCmd.Flags().BoolVar(&yolo, "yolo", false, "Execute without confirmation prompt")
+	rootCmd.Flags().BoolVar(&force, "force", false, "Allow commands the safety scanner rates high-risk (still asks for confirmation)")
 	rootCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Show the generated command for all intents")
+	rootCmd.Flags().IntVar(&maxOutput, "max-output", 0, "Maximum bytes of command output to capture per stream (default: max_output_bytes, or 64KB)")
+	rootCmd.Flags().BoolVar(&parallel, "parallel", false, "Run independent workflow steps concurrently")
+	rootCmd.Flags().BoolVar(&workflowSummary, "summary", false, "After a workflow succeeds, summarize what it accomplished")
+	rootCmd.Flags().IntVar(&alternatives, "n", 1, "Ask for this many candidate commands and pick one from a menu")
+	rootCmd.Flags().IntVar(&repeat, "repeat", 1, "Translate once, then run the command this many times")
+	rootCmd.Flags().DurationVar(&repeatDelay, "delay", time.Second, "Pause between --repeat runs")
+	rootCmd.Flags().DurationVar(&execTimeout, "timeout", 0, "Kill the command if it runs longer than this, e.g. 30s or 10m; 0 means never (default: exec_timeout_seconds, or 2m)")
+	rootCmd.Flags().BoolVar(&interactive, "interactive", false, "Run the command attached to your terminal instead of capturing its output (automatic for editors, pagers, ssh and REPLs)")
+	rootCmd.Flags().BoolVar(&noPager, "no-pager", false, "Print long display output directly instead of through $PAGER (see pager_lines in the config)")
+	rootCmd.Flags().BoolVar(&agentic, "agentic", false, "For piped input, let the AI run read-only commands on the full data")
+	rootCmd.PersistentFlags().StringVar(&configDir, "config", "", "Directory for config, history, stats and knowledge (default ~/.xx-cli)")
+	rootCmd.PersistentFlags().BoolVar(&suggestOnlyFlag, "suggest-only", false, "Only show generated commands, never run them (or set safe_mode in the config)")
+	rootCmd.PersistentFlags().BoolVar(&noContext, "no-context", false, "Don't send the project or git state to the model, or even look them up (or set no_project_context in the config)")
+	rootCmd.PersistentFlags().BoolVar(&incognito, "incognito", false, "Don't record history, stats, or learned knowledge for this run (or set "+envIncognito+"=1)")
 
 	rootCmd.AddCommand(configCmd)
 	rootCmd.AddCommand(historyCmd)
+	rootCmd.AddCommand(lastCmd)
 	rootCmd.AddCommand(explainCmd)
 	rootCmd.AddCommand(chatCmd)
 	rootCmd.AddCommand(initCmd)
+	rootCmd.AddCommand(completionCmd)
 	rootCmd.AddCommand(recapCmd)
 	rootCmd.AddCommand(wtfCmd)
 	rootCmd.AddCommand(watchCmd)
 	rootCmd.AddCommand(learnCmd)
+	rootCmd.AddCommand(noteCmd)
 	rootCmd.AddCommand(diffExplainCmd)
 	rootCmd.AddCommand(doctorCmd)
 	rootCmd.AddCommand(statsCmd)
+	rootCmd.AddCommand(undoCmd)
 	rootCmd.AddCommand(indexCmd)
 	rootCmd.AddCommand(autoLearnCmd)
 	rootCmd.AddCommand(feedbackCmd)
+	rootCmd.AddCommand(learnFixCmd)
+	rootCmd.AddCommand(learnCorrectionCmd)
+	rootCmd.AddCommand(promptCmd)
+	rootCmd.AddCommand(uninstallCmd)
+	rootCmd.AddCommand(knowledgeCmd)
+	rootCmd.AddCommand(maintenanceCmd)
+	rootCmd.AddCommand(compareCmd)
+	rootCmd.AddCommand(translateCmd)
 }
 
 // Execute is the entry point called from main.
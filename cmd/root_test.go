@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/arin/xx-cli/internal/config"
+)
+
+func TestConfigFlag_RedirectsWrites(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	dir := filepath.Join(t.TempDir(), "ci-config")
+
+	origSpawn := spawnDetached
+	spawnDetached = func(args ...string) {}
+	defer func() { spawnDetached = origSpawn }()
+
+	defer func() {
+		configDir = ""
+		_ = config.SetDir("")
+		rootCmd.SetArgs(nil)
+	}()
+
+	for _, args := range [][]string{
+		{"--config", dir, "config", "set", "model", "qwen2.5:7b"},
+		{"--config", dir, "learn", "run tests", "make test"},
+	} {
+		rootCmd.SetArgs(args)
+		if err := rootCmd.Execute(); err != nil {
+			t.Fatalf("xx %v failed: %v", args, err)
+		}
+	}
+
+	for _, name := range []string{"config.json", "learned.json"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("%s should be written to the --config dir: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(home, ".xx-cli")); !os.IsNotExist(err) {
+		t.Error("nothing should be written to the default config dir")
+	}
+}
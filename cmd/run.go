@@ -1,17 +1,29 @@
 package cmd
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/arin/xx-cli/internal/ai"
+	"github.com/arin/xx-cli/internal/audit"
 	"github.com/arin/xx-cli/internal/config"
+	projctx "github.com/arin/xx-cli/internal/context"
 	"github.com/arin/xx-cli/internal/executor"
 	"github.com/arin/xx-cli/internal/history"
+	"github.com/arin/xx-cli/internal/learn"
+	"github.com/arin/xx-cli/internal/rag"
+	"github.com/arin/xx-cli/internal/safety"
 	"github.com/arin/xx-cli/internal/stats"
 	"github.com/arin/xx-cli/internal/ui"
 	"github.com/fatih/color"
@@ -28,30 +40,95 @@ func run(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("configuration error: %w", err)
 	}
 
+	if alternatives < 1 || alternatives > ai.MaxAlternatives {
+		return fmt.Errorf("--n must be between 1 and %d", ai.MaxAlternatives)
+	}
+	if repeat < 1 {
+		return fmt.Errorf("--repeat must be at least 1")
+	}
+	if repeatDelay < 0 {
+		return fmt.Errorf("--delay can't be negative")
+	}
+	if execTimeout < 0 {
+		return fmt.Errorf("--timeout can't be negative")
+	}
+	if !cmd.Flags().Changed("timeout") {
+		execTimeout = cfg.ExecTimeout()
+	}
+	if maxOutput < 0 {
+		return fmt.Errorf("--max-output can't be negative")
+	}
+	if !cmd.Flags().Changed("max-output") {
+		maxOutput = cfg.MaxOutput()
+	}
+
 	prompt := strings.Join(args, " ")
-	client := ai.NewClient(cfg)
+	client := newClient(cfg)
+	safe := suggestOnly(cfg)
 
 	// Check if there's piped input from stdin.
 	stdinData := readStdin()
 	if stdinData != "" {
 		// Piped input → analyze mode with streaming.
 		green := color.New(color.FgGreen)
-		green.Fprint(os.Stderr, "\n  ")
-		stream := client.AnalyzeStream(cmd.Context(), prompt, stdinData)
-		_, err := ui.RenderStream(os.Stdout, stream, "  ")
-		if err != nil {
-			return fmt.Errorf("analysis failed: %w", err)
+		if agentic && safe {
+			color.New(color.FgHiBlack).Fprintln(os.Stderr, "  (safe mode: --agentic disabled, analyzing without running commands)")
+		} else if agentic {
+			return analyzeAgentic(cmd, client, prompt, stdinData)
 		}
-		return nil
+		green.Fprint(os.Stderr, "\n  ")
+		return analyzePiped(cmd.Context(), os.Stdout, client, prompt, stdinData)
 	}
 
-	sp := ui.NewSpinner("Thinking...")
-	sp.Start()
+	// Templated corrections ("ssh to <host>") are the user's own commands —
+	// fill in the placeholders and run them without asking the AI.
+	var result *ai.Result
+	var aiLatency time.Duration
+	fromTemplate := false
+	if tmplCmd, ok := learn.MatchTemplate(prompt); ok {
+		result = &ai.Result{Command: tmplCmd, Explanation: "From a learned template", Intent: ai.IntentDisplay}
+		fromTemplate = true
+	} else if alternatives > 1 {
+		sp := ui.NewSpinner(fmt.Sprintf("Thinking of %d options...", alternatives))
+		sp.Start()
+		aiStart := time.Now()
+		var candidates []*ai.Result
+		candidates, err = client.TranslateN(cmd.Context(), prompt, alternatives)
+		aiLatency = time.Since(aiStart)
+		sp.Stop()
 
-	aiStart := time.Now()
-	result, err := client.Translate(cmd.Context(), prompt)
-	aiLatency := time.Since(aiStart)
-	sp.Stop()
+		if err == nil {
+			result, err = pickCandidate(os.Stdin, os.Stderr, candidates)
+			if err == nil && result == nil {
+				fmt.Fprintln(os.Stderr, "Aborted.")
+				return nil
+			}
+		}
+	} else {
+		sp := ui.NewSpinner("Thinking...")
+		sp.Start()
+
+		aiStart := time.Now()
+		result, err = client.TranslateStream(cmd.Context(), prompt, func(received int) {
+			sp.SetMessage(fmt.Sprintf("Thinking... (%d chars)", received))
+		})
+		aiLatency = time.Since(aiStart)
+		sp.Stop()
+
+		// The model couldn't produce a command — ask it to clarify rather than
+		// failing, and retry the translation with the clearer prompt.
+		if errors.Is(err, ai.ErrUnclearPrompt) {
+			var clarified string
+			clarified, result, err = clarifyAndTranslate(cmd.Context(), client, prompt)
+			if err == nil && result == nil {
+				fmt.Fprintln(os.Stderr, "Aborted.")
+				return nil
+			}
+			if clarified != "" {
+				prompt = clarified
+			}
+		}
+	}
 
 	if err != nil {
 		return fmt.Errorf("AI translation failed: %w", err)
@@ -70,13 +147,18 @@ func run(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	showCommand := verbose || dryRun || result.Intent == ai.IntentExecute
+	stateChanging := result.Intent == ai.IntentExecute || result.Intent == ai.IntentInstall
+	showCommand := verbose || dryRun || safe || stateChanging || fromTemplate
 	if result.Intent == ai.IntentWorkflow && len(result.Steps) > 0 {
 		// Show the full workflow plan.
 		yellow := color.New(color.FgYellow, color.Bold)
 		yellow.Fprintf(os.Stderr, "\n  📋 Workflow (%d steps):\n\n", len(result.Steps))
 		for i, step := range result.Steps {
-			cyan.Fprintf(os.Stderr, "  %d. %s\n", i+1, step.Command)
+			cyan.Fprintf(os.Stderr, "  %d. %s", i+1, step.Command)
+			if parallel && step.ParallelGroup != 0 {
+				dim.Fprintf(os.Stderr, "  [parallel group %d]", step.ParallelGroup)
+			}
+			fmt.Fprintln(os.Stderr)
 			if step.Explanation != "" {
 				dim.Fprintf(os.Stderr, "     %s\n", step.Explanation)
 			}
@@ -87,51 +169,95 @@ func run(cmd *cobra.Command, args []string) error {
 		if result.Explanation != "" {
 			dim.Fprintf(os.Stderr, "  %s\n", result.Explanation)
 		}
+		if result.Intent == ai.IntentInstall {
+			printInstallPreview(result.Packages)
+		}
 		fmt.Fprintln(os.Stderr)
 	}
 
 	if dryRun {
 		return nil
 	}
+	if safe {
+		dim.Fprintf(os.Stderr, "  (safe mode: not executed — copy the command to run it yourself)\n\n")
+		return nil
+	}
 
 	// Workflow intent — multi-step pipeline.
 	if result.Intent == ai.IntentWorkflow && len(result.Steps) > 0 {
+		if repeat > 1 {
+			return fmt.Errorf("--repeat only works with single commands, not workflows")
+		}
 		return runWorkflow(cmd, client, result, prompt)
 	}
+	if repeat > 1 {
+		if err := checkRepeatable(result.Command); err != nil {
+			return err
+		}
+	}
 
-	// Only confirm on execute (state-changing) commands.
-	if !yolo && result.Intent == ai.IntentExecute {
-		if !promptConfirmation() {
+	if err := checkPolicy(os.Stderr, result.Command); err != nil {
+		return err
+	}
+	risk, err := checkRisk(cmd.Context(), os.Stderr, client, result.Command)
+	if err != nil {
+		return err
+	}
+	mismatched := checkPlatform(os.Stderr, result.Command, runtime.GOOS)
+
+	// Confirm state-changing commands (execute and install), commands
+	// using another OS's tools, and anything the safety scanner flagged.
+	confirmed := false
+	if needsConfirmation(risk, stateChanging || mismatched) {
+		if !promptConfirmation(cmd.Context(), client, result.Command) {
 			fmt.Fprintln(os.Stderr, "Aborted.")
 			return nil
 		}
+		confirmed = true
 	}
 
+	if repeat > 1 {
+		return runRepeated(cmd.Context(), os.Stdout, os.Stderr, prompt, result, confirmed)
+	}
+
+	env := envSnapshot(result.Intent)
+	opts := commandOptions(result.Command)
 	sp2 := ui.NewSpinner("Running...")
-	sp2.Start()
+	if !opts.Interactive {
+		sp2.Start()
+	}
 	execStart := time.Now()
-	output, execErr := executor.Run(result.Command)
+	output, execErr := runCommand(result.Command, opts)
 	execLatency := time.Since(execStart)
 	sp2.Stop()
 	success := execErr == nil
+	auditExec(prompt, result.Command, result.Intent, confirmed, execErr)
+	runPostExecHook(prompt, result.Command, result.Intent, execErr)
 
-	_ = history.Save(history.Entry{
-		Prompt:  prompt,
-		Command: result.Command,
-		Output:  output,
-		Success: success,
+	saveHistory(history.Entry{
+		Prompt:      prompt,
+		Command:     result.Command,
+		Output:      output,
+		Success:     success,
+		DurationMs:  execLatency.Milliseconds(),
+		Intent:      result.Intent,
+		ExitCode:    executor.ExitCode(execErr),
+		Interactive: opts.Interactive,
+		RAGContext:  result.RAGContext,
+		Env:         env,
 	})
 
 	// Record stats.
-	_ = stats.Save(stats.Record{
+	saveStats(withUsage(stats.Record{
 		Prompt:      prompt,
 		Command:     result.Command,
 		Intent:      result.Intent,
 		AILatency:   aiLatency,
 		ExecLatency: execLatency,
 		Success:     success,
+		ExitCode:    executor.ExitCode(execErr),
 		Subcommand:  "run",
-	})
+	}, result.Usage))
 
 	// Auto-learn: if the command succeeded, spawn a detached subprocess that
 	// embeds the prompt+command and appends it to the vector store. The subprocess
@@ -147,6 +273,9 @@ func run(cmd *cobra.Command, args []string) error {
 
 	switch result.Intent {
 	case ai.IntentQuery:
+		if opts.Interactive {
+			break // The user saw it all in the terminal; there's nothing to summarize.
+		}
 		// Stream the summary in real-time.
 		stream := client.SummarizeStream(cmd.Context(), prompt, result.Command, output, success)
 		green := color.New(color.FgGreen)
@@ -157,7 +286,7 @@ func run(cmd *cobra.Command, args []string) error {
 			fmt.Print(output)
 		}
 
-	case ai.IntentExecute:
+	case ai.IntentExecute, ai.IntentInstall:
 		if success {
 			green := color.New(color.FgGreen)
 			green.Fprintf(os.Stderr, "\n  ✓ Done.\n\n")
@@ -172,22 +301,32 @@ func run(cmd *cobra.Command, args []string) error {
 			if retryErr == nil && retryCmd != "" {
 				cyan.Fprintf(os.Stderr, "\n  🔧 Suggested fix:\n")
 				cyan.Fprintf(os.Stderr, "  → %s\n\n", retryCmd)
-				if promptRetry() {
+				if checkPolicy(os.Stderr, retryCmd) == nil && retryAllowed(cmd.Context(), client, retryCmd) && promptRetry() {
+					retryOpts := commandOptions(retryCmd)
 					sp4 := ui.NewSpinner("Retrying...")
-					sp4.Start()
-					retryOutput, retryExecErr := executor.Run(retryCmd)
+					if !retryOpts.Interactive {
+						sp4.Start()
+					}
+					retryOutput, retryExecErr := runCommand(retryCmd, retryOpts)
 					sp4.Stop()
-					_ = history.Save(history.Entry{
-						Prompt:  prompt + " (retry)",
-						Command: retryCmd,
-						Output:  retryOutput,
-						Success: retryExecErr == nil,
+					auditExec(prompt+" (retry)", retryCmd, result.Intent, true, retryExecErr)
+					runPostExecHook(prompt+" (retry)", retryCmd, result.Intent, retryExecErr)
+					saveHistory(history.Entry{
+						Prompt:      prompt + " (retry)",
+						Command:     retryCmd,
+						Output:      retryOutput,
+						Success:     retryExecErr == nil,
+						Intent:      result.Intent,
+						ExitCode:    executor.ExitCode(retryExecErr),
+						Interactive: retryOpts.Interactive,
 					})
 					if retryExecErr == nil {
 						green := color.New(color.FgGreen)
 						green.Fprintf(os.Stderr, "\n  ✓ Done.\n\n")
-						// Auto-learn the successful retry.
+						// Auto-learn the successful retry, and remember the
+						// fix for the next SmartRetry on a similar error.
 						spawnAutoLearn(prompt, retryCmd, "general")
+						spawnLearnFix(result.Command, output, retryCmd)
 					} else {
 						red.Fprintf(os.Stderr, "\n  ✗ Retry also failed: %v\n\n", retryExecErr)
 					}
@@ -196,26 +335,388 @@ func run(cmd *cobra.Command, args []string) error {
 		}
 
 	default:
+		printDisplayOutput(output, cfg.PagerLines)
+	}
+
+	if execErr != nil && !stateChanging {
+		return fmt.Errorf("command failed: %w", execErr)
+	}
+
+	return nil
+}
+
+// runRepeated runs an already translated and confirmed command --repeat
+// times, --delay apart, printing each run's output to out as it comes. The
+// runs are recorded as one history entry that only counts as a success if
+// every run succeeded; the error reports how many failed.
+func runRepeated(ctx context.Context, out, w io.Writer, prompt string, result *ai.Result, confirmed bool) error {
+	dim := color.New(color.FgHiBlack)
+	red := color.New(color.FgRed)
+
+	env := envSnapshot(result.Intent)
+	var output string
+	var execErr error
+	failed := 0
+	start := time.Now()
+	for i := 1; i <= repeat; i++ {
+		if i > 1 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(repeatDelay):
+			}
+		}
+
+		dim.Fprintf(w, "\n  ── run %d/%d · %s ──\n", i, repeat, time.Now().Format("15:04:05"))
+		output, execErr = runCommand(result.Command, commandOptions(result.Command))
+		auditExec(prompt, result.Command, result.Intent, confirmed, execErr)
+		runPostExecHook(prompt, result.Command, result.Intent, execErr)
 		if output != "" {
-			fmt.Print(output)
+			fmt.Fprint(out, output)
+			if !strings.HasSuffix(output, "\n") {
+				fmt.Fprintln(out)
+			}
+		}
+		if execErr != nil {
+			failed++
+			red.Fprintf(w, "  ✗ %v\n", execErr)
 		}
 	}
+	duration := time.Since(start)
+	success := failed == 0
 
-	if execErr != nil && result.Intent != ai.IntentExecute {
-		return fmt.Errorf("command failed: %w", execErr)
+	saveHistory(history.Entry{
+		Prompt:     prompt,
+		Command:    result.Command,
+		Output:     output,
+		Success:    success,
+		DurationMs: duration.Milliseconds(),
+		Intent:     result.Intent,
+		ExitCode:   executor.ExitCode(execErr),
+		Env:        env,
+	})
+	saveStats(withUsage(stats.Record{
+		Prompt:      prompt,
+		Command:     result.Command,
+		Intent:      result.Intent,
+		ExecLatency: duration,
+		Success:     success,
+		ExitCode:    executor.ExitCode(execErr),
+		Subcommand:  "run",
+	}, result.Usage))
+	if success {
+		spawnAutoLearn(prompt, result.Command, "general")
 	}
+	spawnFeedback(prompt, success)
+
+	if !success {
+		red.Fprintf(w, "\n  ✗ %d of %d runs failed.\n\n", failed, repeat)
+		return fmt.Errorf("%d of %d runs failed", failed, repeat)
+	}
+	color.New(color.FgGreen).Fprintf(w, "\n  ✓ All %d runs succeeded.\n\n", repeat)
+	return nil
+}
 
+// checkRepeatable rejects --repeat for commands that can't run unattended
+// in a loop: an interactive one would take over the terminal each time,
+// and a bare cd only changes the shell's directory once.
+func checkRepeatable(command string) error {
+	if interactive || executor.IsInteractive(command) {
+		return fmt.Errorf("--repeat doesn't work with interactive commands (%s)", command)
+	}
+	if _, ok := executor.CdTarget(command); ok {
+		return fmt.Errorf("--repeat doesn't work with cd")
+	}
 	return nil
 }
 
-func promptConfirmation() bool {
+// printInstallPreview lists the packages an install command will add, so the
+// user sees exactly what lands on their machine before confirming.
+func printInstallPreview(packages []string) {
 	yellow := color.New(color.FgYellow)
-	yellow.Fprint(os.Stderr, "Execute? [y/N] ")
+	if len(packages) == 0 {
+		yellow.Fprintf(os.Stderr, "  📦 Installs packages (see command above)\n")
+		return
+	}
+	yellow.Fprintf(os.Stderr, "  📦 Will install: %s\n", strings.Join(packages, ", "))
+}
 
-	var response string
-	fmt.Scanln(&response)
-	response = strings.TrimSpace(strings.ToLower(response))
-	return response == "y" || response == "yes"
+// pickCandidate shows candidate translations as a numbered menu and returns
+// the one the user picks. It returns nil, nil when the user enters nothing.
+func pickCandidate(in io.Reader, w io.Writer, candidates []*ai.Result) (*ai.Result, error) {
+	if len(candidates) == 1 {
+		color.New(color.FgHiBlack).Fprintln(w, "\n  (the model only came up with one option)")
+		return candidates[0], nil
+	}
+
+	cyan := color.New(color.FgCyan, color.Bold)
+	dim := color.New(color.FgHiBlack)
+	fmt.Fprintln(w)
+	for i, c := range candidates {
+		if c.Intent == ai.IntentWorkflow {
+			cmds := make([]string, len(c.Steps))
+			for j, step := range c.Steps {
+				cmds[j] = step.Command
+			}
+			cyan.Fprintf(w, "  %d. %s\n", i+1, strings.Join(cmds, " → "))
+		} else {
+			cyan.Fprintf(w, "  %d. %s\n", i+1, c.Command)
+		}
+		if c.Explanation != "" {
+			dim.Fprintf(w, "     %s\n", c.Explanation)
+		}
+	}
+
+	color.New(color.FgYellow).Fprintf(w, "\n  Pick one [1-%d, Enter to cancel]: ", len(candidates))
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+	answer = strings.TrimSpace(answer)
+	if answer == "" {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(answer)
+	if err != nil || n < 1 || n > len(candidates) {
+		return nil, fmt.Errorf("invalid choice %q: enter a number from 1 to %d", answer, len(candidates))
+	}
+	return candidates[n-1], nil
+}
+
+// clarifyAndTranslate asks the model to rephrase an unclear prompt (or ask
+// the user a question), then translates the clarified request. It returns a
+// nil result and nil error when the user declines the suggestion.
+func clarifyAndTranslate(ctx context.Context, client *ai.Client, prompt string) (string, *ai.Result, error) {
+	sp := ui.NewSpinner("Clarifying...")
+	sp.Start()
+	cl, err := client.Clarify(ctx, prompt)
+	sp.Stop()
+	if err != nil {
+		return "", nil, ai.ErrUnclearPrompt
+	}
+
+	yellow := color.New(color.FgYellow)
+	var clarified string
+	if cl.Rephrased != "" {
+		yellow.Fprintf(os.Stderr, "\n  Did you mean: %s? [y/N] ", cl.Rephrased)
+		var response string
+		fmt.Scanln(&response)
+		response = strings.TrimSpace(strings.ToLower(response))
+		if response != "y" && response != "yes" {
+			return "", nil, nil
+		}
+		clarified = cl.Rephrased
+	} else {
+		yellow.Fprintf(os.Stderr, "\n  %s\n  > ", cl.Question)
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		answer = strings.TrimSpace(answer)
+		if answer == "" {
+			return "", nil, nil
+		}
+		clarified = prompt + " (" + answer + ")"
+	}
+
+	sp = ui.NewSpinner("Thinking...")
+	sp.Start()
+	result, err := client.Translate(ctx, clarified)
+	sp.Stop()
+	return clarified, result, err
+}
+
+// saveHistory records a history entry unless running incognito.
+func saveHistory(e history.Entry) {
+	if persistEnabled() {
+		_ = history.Save(e)
+	}
+}
+
+// envSnapshot captures the environment an execute or workflow command is
+// about to run in, for its history entry. It's nil for other intents and
+// unless env_snapshot is enabled in the config.
+func envSnapshot(intent string) *projctx.Snapshot {
+	if intent != ai.IntentExecute && intent != ai.IntentWorkflow {
+		return nil
+	}
+	cfg, _ := config.Load()
+	if !cfg.EnvSnapshot {
+		return nil
+	}
+	return projctx.TakeSnapshot()
+}
+
+// saveStats records a stats entry unless running incognito.
+func saveStats(r stats.Record) {
+	if persistEnabled() {
+		_ = stats.Save(r)
+	}
+}
+
+// withUsage adds the token usage of the AI call behind r, if the provider
+// reported any, so `xx stats` can compare models by speed.
+func withUsage(r stats.Record, u *ai.Usage) stats.Record {
+	if u != nil {
+		r.PromptTokens = u.PromptTokens
+		r.TokensPerSec = u.TokensPerSecond()
+	}
+	return r
+}
+
+// auditExec appends an executed command to the audit log. It's a no-op
+// unless audit_log is enabled in the config.
+func auditExec(prompt, command, intent string, confirmed bool, execErr error) {
+	_ = audit.Record(audit.Entry{
+		Prompt:    prompt,
+		Command:   command,
+		Intent:    intent,
+		ExitCode:  executor.ExitCode(execErr),
+		Confirmed: confirmed,
+		Yolo:      yolo,
+	})
+}
+
+// checkRisk runs the safety scanner, with the user's risk rules, over
+// command before it executes. A high-risk command is refused unless
+// --force was given. Anything rated medium or above gets an AI preview of
+// its effect, written to w, so the user understands the risk before the
+// confirmation prompt.
+func checkRisk(ctx context.Context, w io.Writer, client *ai.Client, command string) (safety.Level, error) {
+	rules, err := safety.LoadRules(riskRulesFile())
+	if err != nil {
+		return safety.High, fmt.Errorf("can't read your risk rules, so refusing to run anything: %w", err)
+	}
+	risk := rules.Assess(command)
+	if risk.Level == safety.Low {
+		return risk.Level, nil
+	}
+
+	red := color.New(color.FgRed, color.Bold)
+	yellow := color.New(color.FgYellow, color.Bold)
+	if risk.Level == safety.High {
+		red.Fprintf(w, "  ⛔ High risk: %s %s\n", command, risk.Reason)
+		if !force {
+			fmt.Fprintln(w)
+			return risk.Level, fmt.Errorf("refusing to run a high-risk command (re-run with --force if you're sure)")
+		}
+	} else {
+		yellow.Fprintf(w, "  ⚠ Caution: %s %s\n", command, risk.Reason)
+	}
+
+	if client != nil {
+		stream := client.PreviewEffectStream(ctx, command, risk.Reason)
+		if _, err := ui.RenderStream(w, stream, "  "); err != nil {
+			dim := color.New(color.FgHiBlack)
+			dim.Fprintf(w, "(explanation unavailable: %v)\n", err)
+		}
+	}
+	fmt.Fprintln(w)
+	return risk.Level, nil
+}
+
+// riskRulesFile returns the file of the user's own risk rules, checked
+// before the builtin ones (see safety.LoadRules). It's a variable so tests
+// can point it elsewhere.
+var riskRulesFile = func() string {
+	return filepath.Join(config.Dir(), "risk-rules")
+}
+
+// policyFiles returns the .xxignore-style command policies to enforce: an
+// admin-managed one for the whole machine and the user's own. It's a
+// variable so tests can point it elsewhere.
+var policyFiles = func() []string {
+	return []string{"/etc/xx-cli/xxignore", filepath.Join(config.Dir(), "xxignore")}
+}
+
+// checkPolicy refuses command, explaining why on w, if a command policy
+// forbids it. Unlike checkRisk, no flag gets past it, and a policy that
+// can't be read refuses everything rather than nothing.
+func checkPolicy(w io.Writer, command string) error {
+	policy, err := safety.LoadPolicy(policyFiles()...)
+	if err != nil {
+		return fmt.Errorf("can't read the command policy, so refusing to run anything: %w", err)
+	}
+	if err := policy.Check(command); err != nil {
+		color.New(color.FgRed, color.Bold).Fprintf(w, "  ⛔ Blocked by policy: %s %v\n\n", command, err)
+		return fmt.Errorf("refusing to run a command the policy forbids")
+	}
+	return nil
+}
+
+// checkPlatform warns on w about programs in command that don't exist on
+// goos, e.g. `free` on macOS, and reports whether it found any. The
+// builtin docs steer the model away from these, but it doesn't always
+// listen.
+func checkPlatform(w io.Writer, command, goos string) bool {
+	mismatches := safety.CheckPlatform(command, goos)
+	if len(mismatches) == 0 {
+		return false
+	}
+	yellow := color.New(color.FgYellow, color.Bold)
+	for _, m := range mismatches {
+		yellow.Fprintf(w, "  ⚠ '%s' isn't available on %s — try %s instead\n", m.Program, osName(goos), m.Suggestion)
+	}
+	fmt.Fprintln(w)
+	return true
+}
+
+// osName returns the name users know goos by.
+func osName(goos string) string {
+	switch goos {
+	case "darwin":
+		return "macOS"
+	case "linux":
+		return "Linux"
+	default:
+		return goos
+	}
+}
+
+// needsConfirmation reports whether to ask before running a command of the
+// given risk. Flagged commands are confirmed even when their intent
+// normally isn't, and --yolo never skips confirming a high-risk one: running
+// one at all already takes --force, and a single flag meant for convenience
+// shouldn't turn that into running it unseen.
+func needsConfirmation(risk safety.Level, stateChanging bool) bool {
+	if risk == safety.High {
+		return true
+	}
+	return !yolo && (stateChanging || risk == safety.Medium)
+}
+
+// promptConfirmation asks on the terminal whether to run command.
+func promptConfirmation(ctx context.Context, client *ai.Client, command string) bool {
+	return confirmExecution(ctx, os.Stdin, os.Stderr, client, command)
+}
+
+// confirmExecution asks whether to run command, reading answers from in.
+// Answering e streams an explanation of the command from the model and
+// asks again, so the user can look before deciding.
+func confirmExecution(ctx context.Context, in io.Reader, w io.Writer, client *ai.Client, command string) bool {
+	yellow := color.New(color.FgYellow)
+	reader := bufio.NewReader(in)
+	for {
+		yellow.Fprint(w, "Execute? [y/N/e=explain] ")
+		line, err := reader.ReadString('\n')
+		switch strings.TrimSpace(strings.ToLower(line)) {
+		case "y", "yes":
+			return true
+		case "e", "explain":
+			explainBeforeConfirm(ctx, w, client, command)
+			if err == nil {
+				continue
+			}
+		}
+		return false
+	}
+}
+
+// explainBeforeConfirm streams an explanation of command to w.
+func explainBeforeConfirm(ctx context.Context, w io.Writer, client *ai.Client, command string) {
+	sp := ui.NewSpinner("Explaining...")
+	sp.Start()
+	stream := client.ExplainStream(ctx, command)
+	sp.Stop()
+	fmt.Fprintln(w)
+	if _, err := ui.RenderStream(w, stream, "  "); err != nil {
+		color.New(color.FgRed).Fprintf(w, "  ✗ explanation failed: %v\n", err)
+	}
+	fmt.Fprintln(w)
 }
 
 // readStdin reads piped input if available.
@@ -228,16 +729,74 @@ func readStdin() string {
 	if (info.Mode() & os.ModeCharDevice) != 0 {
 		return ""
 	}
-	data, err := io.ReadAll(os.Stdin)
+	// Read up to maxPipedBytes. The AI prompt only ever sees the first 4000
+	// chars (the client truncates), but agentic analysis needs the rest on disk.
+	data, err := io.ReadAll(io.LimitReader(os.Stdin, maxPipedBytes))
 	if err != nil {
 		return ""
 	}
-	s := strings.TrimSpace(string(data))
-	// Limit to 4000 chars to keep prompt reasonable.
-	if len(s) > 4000 {
-		s = s[:4000] + "\n... (truncated)"
+	return strings.TrimSpace(string(data))
+}
+
+// maxPipedBytes caps how much piped input xx will hold in memory.
+const maxPipedBytes = 10 << 20
+
+// analyzeAgentic saves the piped data to a temp file and runs the agentic
+// analyze loop, letting the AI run a few read-only commands against the file.
+// The AI package only hands over commands it has checked are a plain read of
+// the file; they run without a shell, and each is shown before it runs. The
+// temp file is removed when the analysis finishes.
+func analyzeAgentic(cmd *cobra.Command, client *ai.Client, prompt, data string) error {
+	dim := color.New(color.FgHiBlack)
+	green := color.New(color.FgGreen)
+
+	f, err := os.CreateTemp("", "xx-analyze-*.txt")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(data); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write temp file: %w", err)
+	}
+	f.Close()
+
+	fmt.Fprintln(os.Stderr)
+	sp := ui.NewSpinner("Analyzing...")
+	runner := func(argv []string) (string, error) {
+		sp.Stop()
+		defer sp.Start()
+		command := strings.Join(argv, " ")
+		dim.Fprintf(os.Stderr, "  $ %s\n", command)
+		if err := checkPolicy(os.Stderr, command); err != nil {
+			return "", err
+		}
+		output, err := runArgs(argv, execOptions())
+		auditExec(prompt, command, "analyze", false, err)
+		runPostExecHook(prompt, command, "analyze", err)
+		return output, err
+	}
+
+	sp.Start()
+	answer, err := client.AnalyzeAgentic(cmd.Context(), prompt, data, f.Name(), runner, ai.DefaultAnalyzeIterations)
+	sp.Stop()
+	if err != nil {
+		return fmt.Errorf("analysis failed: %w", err)
+	}
+
+	green.Fprint(os.Stderr, "\n  ")
+	fmt.Printf("%s\n\n", answer)
+	return nil
+}
+
+// analyzePiped streams the AI's answer about piped-in data to w as tokens
+// arrive, the same way explain and wtf render their output.
+func analyzePiped(ctx context.Context, w io.Writer, client *ai.Client, prompt, data string) error {
+	stream := client.AnalyzeStream(ctx, prompt, data)
+	if _, err := ui.RenderStream(w, stream, "  "); err != nil {
+		return fmt.Errorf("analysis failed: %w", err)
 	}
-	return s
+	return nil
 }
 
 // smartRetry asks the AI to diagnose a failed command and suggest a fix.
@@ -249,6 +808,17 @@ func smartRetry(cmd *cobra.Command, client *ai.Client, prompt, failedCmd, errorO
 	return fix, err
 }
 
+// retryAllowed runs a Smart Retry fix through the risk scanner like any
+// other command: a flagged fix is shown with its warning, and a high-risk
+// one isn't retried unless --force was given.
+func retryAllowed(ctx context.Context, client *ai.Client, command string) bool {
+	if _, err := checkRisk(ctx, os.Stderr, client, command); err != nil {
+		color.New(color.FgRed).Fprintf(os.Stderr, "  ✗ Not retrying: %v\n\n", err)
+		return false
+	}
+	return true
+}
+
 func promptRetry() bool {
 	yellow := color.New(color.FgYellow)
 	yellow.Fprint(os.Stderr, "  Retry? [y/N] ")
@@ -265,7 +835,23 @@ func runWorkflow(cmd *cobra.Command, client *ai.Client, result *ai.Result, promp
 	cyan := color.New(color.FgCyan, color.Bold)
 	dim := color.New(color.FgHiBlack)
 
-	if !yolo {
+	risk := safety.Low
+	for _, step := range result.Steps {
+		if err := checkPolicy(os.Stderr, step.Command); err != nil {
+			return err
+		}
+		level, err := checkRisk(cmd.Context(), os.Stderr, client, step.Command)
+		if err != nil {
+			return err
+		}
+		if level > risk {
+			risk = level
+		}
+		checkPlatform(os.Stderr, step.Command, runtime.GOOS)
+	}
+
+	confirmed := needsConfirmation(risk, true)
+	if confirmed {
 		yellow := color.New(color.FgYellow)
 		yellow.Fprint(os.Stderr, "  Run all? [y/N] ")
 		var response string
@@ -278,45 +864,222 @@ func runWorkflow(cmd *cobra.Command, client *ai.Client, result *ai.Result, promp
 		fmt.Fprintln(os.Stderr)
 	}
 
+	env := envSnapshot(ai.IntentWorkflow)
 	var allOutput strings.Builder
-	for i, step := range result.Steps {
-		label := fmt.Sprintf("Step %d/%d", i+1, len(result.Steps))
-		sp := ui.NewSpinner(label + ": " + step.Command)
+	// Each step runs in its own shell, so a cd step can't change the
+	// directory of the next one. Track it here instead.
+	var dir string
+	workflowStart := time.Now()
+	total := len(result.Steps)
+	for _, batch := range stepBatches(result.Steps, parallel) {
+		var label string
+		if len(batch) == 1 {
+			label = fmt.Sprintf("Step %d/%d: %s", batch[0]+1, total, result.Steps[batch[0]].Command)
+		} else {
+			label = fmt.Sprintf("Steps %d-%d/%d (parallel)", batch[0]+1, batch[len(batch)-1]+1, total)
+		}
+		sp := ui.NewSpinner(label)
 		sp.Start()
-		output, err := executor.Run(step.Command)
+		outcomes := runSteps(result.Steps, batch, dir)
 		sp.Stop()
 
-		_ = history.Save(history.Entry{
-			Prompt:  prompt,
-			Command: step.Command,
-			Output:  output,
-			Success: err == nil,
-		})
+		// Report in step order; a batch fails as a whole if any step failed.
+		failed := 0
+		for j, i := range batch {
+			step, out := result.Steps[i], outcomes[j]
+			auditExec(prompt, step.Command, ai.IntentWorkflow, confirmed, out.err)
+			runPostExecHook(prompt, step.Command, ai.IntentWorkflow, out.err)
 
-		if err != nil {
-			red.Fprintf(os.Stderr, "  ✗ Step %d: %s\n", i+1, step.Command)
-			dim.Fprintf(os.Stderr, "    %v\n", err)
-			if output != "" {
-				dim.Fprintf(os.Stderr, "    %s\n", strings.TrimSpace(output))
+			saveHistory(history.Entry{
+				Prompt:     prompt,
+				Command:    step.Command,
+				Output:     out.output,
+				Success:    out.err == nil,
+				DurationMs: out.duration.Milliseconds(),
+				Dir:        dir,
+				Step:       i + 1,
+				StepLabel:  fmt.Sprintf("Step %d/%d", i+1, total),
+				Intent:     ai.IntentWorkflow,
+				ExitCode:   executor.ExitCode(out.err),
+				Env:        env,
+			})
+
+			if out.err != nil {
+				if failed == 0 {
+					failed = i + 1
+				}
+				red.Fprintf(os.Stderr, "  ✗ Step %d: %s\n", i+1, step.Command)
+				dim.Fprintf(os.Stderr, "    %v\n", out.err)
+				if out.output != "" {
+					dim.Fprintf(os.Stderr, "    %s\n", strings.TrimSpace(out.output))
+				}
+				continue
+			}
+
+			if out.dir != "" {
+				dir = out.dir
 			}
+			cyan.Fprintf(os.Stderr, "  ✓ Step %d: ", i+1)
+			green.Fprintf(os.Stderr, "%s", step.Command)
+			dim.Fprintf(os.Stderr, " (%s)\n", out.duration.Round(time.Millisecond))
+			allOutput.WriteString(out.output)
+
+			// Auto-learn each successful workflow step.
+			spawnAutoLearn(prompt, step.Command, "general")
+		}
+
+		if failed > 0 {
 			fmt.Fprintln(os.Stderr)
-			red.Fprintf(os.Stderr, "  Workflow stopped at step %d.\n\n", i+1)
+			red.Fprintf(os.Stderr, "  Workflow stopped at step %d.\n\n", failed)
 			return nil
 		}
-
-		cyan.Fprintf(os.Stderr, "  ✓ Step %d: ", i+1)
-		green.Fprintf(os.Stderr, "%s\n", step.Command)
-		allOutput.WriteString(output)
-
-		// Auto-learn each successful workflow step.
-		spawnAutoLearn(prompt, step.Command, "general")
 	}
 
 	fmt.Fprintln(os.Stderr)
-	green.Fprintf(os.Stderr, "  ✓ All %d steps completed.\n\n", len(result.Steps))
+	green.Fprintf(os.Stderr, "  ✓ All %d steps completed in %s.\n\n", total, time.Since(workflowStart).Round(time.Millisecond))
+
+	if workflowSummary && client != nil {
+		summarizeWorkflow(cmd.Context(), os.Stdout, client, prompt, result.Steps, allOutput.String())
+	}
 	return nil
 }
 
+// summarizeWorkflow streams a one-line recap of what a finished workflow
+// accomplished, based on the combined output of its steps.
+func summarizeWorkflow(ctx context.Context, w io.Writer, client *ai.Client, prompt string, steps []ai.Step, output string) {
+	commands := make([]string, len(steps))
+	for i, step := range steps {
+		commands[i] = step.Command
+	}
+
+	stream := client.SummarizeStream(ctx, prompt, strings.Join(commands, " && "), output, true)
+	if _, err := ui.RenderStream(w, stream, "  "); err != nil {
+		dim := color.New(color.FgHiBlack)
+		dim.Fprintf(os.Stderr, "  (summary unavailable: %v)\n", err)
+	}
+}
+
+// maxParallelSteps bounds how many workflow steps run at once with --parallel.
+const maxParallelSteps = 4
+
+// stepBatches splits workflow steps into batches of step indexes that run
+// together. Without parallel every step is its own batch; with it, adjacent
+// steps sharing a non-zero ParallelGroup are batched. Batches run in order.
+func stepBatches(steps []ai.Step, parallel bool) [][]int {
+	var batches [][]int
+	for i, step := range steps {
+		n := len(batches)
+		if parallel && step.ParallelGroup != 0 && n > 0 && steps[i-1].ParallelGroup == step.ParallelGroup {
+			batches[n-1] = append(batches[n-1], i)
+			continue
+		}
+		batches = append(batches, []int{i})
+	}
+	return batches
+}
+
+// stepOutcome is the result of running one workflow step.
+type stepOutcome struct {
+	output   string
+	err      error
+	duration time.Duration
+	// dir is the new working directory after a cd step, empty otherwise.
+	dir string
+}
+
+// runSteps runs the given steps concurrently in dir, at most
+// maxParallelSteps at a time, and returns their outcomes in the same order
+// as batch. A cd step isn't run: its outcome carries the directory it
+// changes to.
+func runSteps(steps []ai.Step, batch []int, dir string) []stepOutcome {
+	outcomes := make([]stepOutcome, len(batch))
+	sem := make(chan struct{}, maxParallelSteps)
+	var wg sync.WaitGroup
+	for j, i := range batch {
+		wg.Add(1)
+		go func(j int, command string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			start := time.Now()
+			if target, ok := executor.CdTarget(command); ok {
+				newDir, err := changeDir(dir, target)
+				outcomes[j] = stepOutcome{err: err, duration: time.Since(start), dir: newDir}
+				return
+			}
+			opts := execOptions()
+			opts.Dir = dir
+			output, err := runCommand(command, opts)
+			outcomes[j] = stepOutcome{output: output, err: err, duration: time.Since(start)}
+		}(j, steps[i].Command)
+	}
+	wg.Wait()
+	return outcomes
+}
+
+// changeDir resolves a cd target against dir, or xx's own working
+// directory when dir is empty, and checks it's a directory.
+func changeDir(dir, target string) (string, error) {
+	if !filepath.IsAbs(target) {
+		if dir == "" {
+			wd, err := os.Getwd()
+			if err != nil {
+				return "", err
+			}
+			dir = wd
+		}
+		target = filepath.Join(dir, target)
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("cd: %s: not a directory", target)
+	}
+	return target, nil
+}
+
+// newClient builds the AI client for cfg, honoring --no-context. It's a
+// variable so tests can substitute a fake provider.
+var newClient = func(cfg *config.Config) *ai.Client {
+	if noContext {
+		cfg.NoProjectContext = true
+	}
+	client := ai.NewClient(cfg)
+	if verbose {
+		client.SetVerbose(os.Stderr)
+	}
+	return client
+}
+
+// runCommand executes a shell command. It's a variable so tests can count
+// executions without running anything.
+var runCommand = executor.RunWithOptions
+
+// runArgs executes a program without a shell, for commands the AI picked
+// that must not be interpreted. It's a variable for the same reason.
+var runArgs = executor.RunArgs
+
+// execOptions builds executor options from the root command's flags.
+func execOptions() executor.Options {
+	return executor.Options{MaxOutput: maxOutput, Timeout: execTimeout}
+}
+
+// commandOptions is execOptions for running command on its own: with
+// --interactive, or for a command executor.IsInteractive recognizes, it's
+// attached to the terminal instead of captured. An interactive session
+// isn't timed out; it ends when you end it.
+func commandOptions(command string) executor.Options {
+	opts := execOptions()
+	if interactive || executor.IsInteractive(command) {
+		opts.Interactive = true
+		opts.Timeout = 0
+	}
+	return opts
+}
+
 // spawnAutoLearn forks a detached `xx _learn` subprocess that embeds the
 // prompt+command pair and appends it to the vector store. The subprocess
 // runs independently — the parent process exits immediately without waiting.
@@ -325,12 +1088,25 @@ func runWorkflow(cmd *cobra.Command, client *ai.Client, result *ai.Result, promp
 // fires off a background job and forgets about it. If it fails, nobody
 // notices. If it succeeds, the vector store gets smarter for next time.
 func spawnAutoLearn(prompt, command, category string) {
+	if !persistEnabled() {
+		return
+	}
+	spawnDetached("_learn", prompt, command, category)
+}
+
+// spawnDetached starts our own binary with the given arguments and doesn't
+// wait for it. It's a variable so tests can stub out the fork.
+var spawnDetached = func(args ...string) {
 	exe, err := os.Executable()
 	if err != nil {
 		return // Can't find our own binary — skip silently.
 	}
 
-	cmd := exec.Command(exe, "_learn", prompt, command, category)
+	// The child must use the same config dir as this invocation.
+	if configDir != "" {
+		args = append([]string{"--config", config.Dir()}, args...)
+	}
+	cmd := exec.Command(exe, args...)
 
 	// Detach: no stdin/stdout/stderr, no process group tie to parent.
 	cmd.Stdin = nil
@@ -342,26 +1118,28 @@ func spawnAutoLearn(prompt, command, category string) {
 	_ = cmd.Start()
 }
 
+// spawnLearnFix forks a detached `xx _learn-fix` subprocess that stores a
+// failure→fix pair for future SmartRetry calls. Only the line of output
+// that names the error is passed along, not the whole output.
+func spawnLearnFix(failedCmd, output, fixCmd string) {
+	if !persistEnabled() {
+		return
+	}
+	spawnDetached("_learn-fix", failedCmd, rag.ErrorSummary(output), fixCmd)
+}
+
 // spawnFeedback forks a detached `xx _feedback` subprocess that updates
 // the adaptive relevance score for the most relevant document. This is
 // the reinforcement signal: success boosts a doc's score, failure penalizes it.
 //
 // Same fire-and-forget pattern as spawnAutoLearn.
 func spawnFeedback(prompt string, success bool) {
-	exe, err := os.Executable()
-	if err != nil {
+	if !persistEnabled() {
 		return
 	}
-
 	outcome := "failure"
 	if success {
 		outcome = "success"
 	}
-
-	cmd := exec.Command(exe, "_feedback", prompt, outcome)
-	cmd.Stdin = nil
-	cmd.Stdout = nil
-	cmd.Stderr = nil
-	_ = cmd.Start()
+	spawnDetached("_feedback", prompt, outcome)
 }
-
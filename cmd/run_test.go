@@ -0,0 +1,825 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arin/xx-cli/internal/ai"
+	"github.com/arin/xx-cli/internal/audit"
+	"github.com/arin/xx-cli/internal/config"
+	"github.com/arin/xx-cli/internal/executor"
+	"github.com/arin/xx-cli/internal/history"
+	"github.com/arin/xx-cli/internal/safety"
+)
+
+// mockStreamProvider emits canned tokens through the streaming interface.
+type mockStreamProvider struct {
+	tokens    []string
+	streamErr error
+	lastMsgs  []ai.Message
+}
+
+func (m *mockStreamProvider) Complete(_ context.Context, msgs []ai.Message, _ ai.CompleteOptions) (string, error) {
+	m.lastMsgs = msgs
+	return strings.Join(m.tokens, ""), m.streamErr
+}
+
+func (m *mockStreamProvider) CompleteStream(_ context.Context, msgs []ai.Message, _ ai.CompleteOptions) <-chan ai.StreamDelta {
+	m.lastMsgs = msgs
+	ch := make(chan ai.StreamDelta)
+	go func() {
+		defer close(ch)
+		for _, tok := range m.tokens {
+			ch <- ai.StreamDelta{Token: tok}
+		}
+		if m.streamErr != nil {
+			ch <- ai.StreamDelta{Err: m.streamErr}
+			return
+		}
+		ch <- ai.StreamDelta{Done: true}
+	}()
+	return ch
+}
+
+// offlineProvider translates prompts from a fixed table of display
+// commands, so run() can be tested without a model.
+type offlineProvider struct {
+	commands map[string]string
+}
+
+func (p *offlineProvider) Complete(_ context.Context, msgs []ai.Message, _ ai.CompleteOptions) (string, error) {
+	prompt := msgs[len(msgs)-1].Content
+	command, ok := p.commands[prompt]
+	if !ok {
+		return "", fmt.Errorf("offlineProvider: no translation for %q", prompt)
+	}
+	return fmt.Sprintf(`{"command": %q, "intent": "display"}`, command), nil
+}
+
+// runOffline sets run() up to work without a model or the real home
+// directory: HOME is a temp dir, which it returns, prompts translate through
+// an offlineProvider with commands, stdin is /dev/null so nothing waits for
+// an answer, background learners aren't spawned, and rootCmd has a
+// context. It's all restored when the test ends.
+func runOffline(t *testing.T, commands map[string]string) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	devNull, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	origStdin, origClient, origSpawn, origCtx := os.Stdin, newClient, spawnDetached, rootCmd.Context()
+	t.Cleanup(func() {
+		os.Stdin, newClient, spawnDetached = origStdin, origClient, origSpawn
+		rootCmd.SetContext(origCtx)
+		devNull.Close()
+	})
+	os.Stdin = devNull
+	newClient = func(*config.Config) *ai.Client {
+		return ai.NewClientWithProvider(&offlineProvider{commands: commands})
+	}
+	spawnDetached = func(...string) {}
+	// Cobra sets this when it executes a command; tests call run() directly.
+	rootCmd.SetContext(context.Background())
+	return home
+}
+
+func TestAnalyzePiped_StreamsAnswer(t *testing.T) {
+	mock := &mockStreamProvider{tokens: []string{"3 ", "errors, ", "all timeouts."}}
+	client := ai.NewClientWithProvider(mock)
+
+	var buf bytes.Buffer
+	if err := analyzePiped(context.Background(), &buf, client, "summarize", "ERROR timeout\nERROR timeout\nERROR timeout"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(buf.String(), "  3 errors, all timeouts.") {
+		t.Errorf("expected streamed answer with indent, got %q", buf.String())
+	}
+	if len(mock.lastMsgs) != 2 || !strings.Contains(mock.lastMsgs[1].Content, "ERROR timeout") {
+		t.Errorf("piped data should be sent to the provider, got %+v", mock.lastMsgs)
+	}
+}
+
+func TestAnalyzePiped_StreamError(t *testing.T) {
+	mock := &mockStreamProvider{tokens: []string{"partial"}, streamErr: errors.New("connection reset")}
+	client := ai.NewClientWithProvider(mock)
+
+	var buf bytes.Buffer
+	err := analyzePiped(context.Background(), &buf, client, "what is this", "data")
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if !strings.Contains(err.Error(), "analysis failed") || !strings.Contains(err.Error(), "connection reset") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestAuditExec_RecordsExecutedCommand(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	if err := config.Set("audit_log", "true"); err != nil {
+		t.Fatalf("enable audit log: %v", err)
+	}
+
+	_, execErr := executor.Run("exit 2")
+	auditExec("do the thing", "exit 2", ai.IntentExecute, true, execErr)
+
+	data, err := os.ReadFile(audit.Path())
+	if err != nil {
+		t.Fatalf("audit log not written: %v", err)
+	}
+	var e audit.Entry
+	if err := json.Unmarshal(bytes.TrimSpace(data), &e); err != nil {
+		t.Fatalf("audit line is not JSON: %q", data)
+	}
+	if e.Prompt != "do the thing" || e.Command != "exit 2" || e.Intent != ai.IntentExecute || e.ExitCode != 2 || !e.Confirmed {
+		t.Errorf("unexpected audit entry: %+v", e)
+	}
+}
+
+func TestRun_IncognitoWritesNoHistoryOrStats(t *testing.T) {
+	runOffline(t, map[string]string{"say hello": "echo hello"})
+
+	incognito = true
+	defer func() { incognito = false }()
+
+	if err := run(rootCmd, []string{"say", "hello"}); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+
+	for _, name := range []string{"history.json", "stats.json"} {
+		if _, err := os.Stat(filepath.Join(config.Dir(), name)); !os.IsNotExist(err) {
+			t.Errorf("%s should not be written in incognito mode", name)
+		}
+	}
+}
+
+func TestPersistEnabled_Env(t *testing.T) {
+	t.Setenv(envIncognito, "1")
+	if persistEnabled() {
+		t.Error("XX_INCOGNITO=1 should disable persistence")
+	}
+	t.Setenv(envIncognito, "")
+	if !persistEnabled() {
+		t.Error("persistence should be on by default")
+	}
+}
+
+func TestRunWorkflow_RecordsStepDurations(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	origSpawn := spawnDetached
+	spawnDetached = func(args ...string) {}
+	defer func() { spawnDetached = origSpawn }()
+
+	yolo = true
+	defer func() { yolo = false }()
+
+	result := &ai.Result{
+		Intent: ai.IntentWorkflow,
+		Steps: []ai.Step{
+			{Command: "sleep 0.05"},
+			{Command: "true"},
+		},
+	}
+	if err := runWorkflow(rootCmd, nil, result, "wait then succeed"); err != nil {
+		t.Fatalf("runWorkflow failed: %v", err)
+	}
+
+	entries, err := history.Load(0)
+	if err != nil {
+		t.Fatalf("load history: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 history entries, got %d", len(entries))
+	}
+	for i, e := range entries {
+		if e.Step != i+1 {
+			t.Errorf("entry %d: step = %d, want %d", i, e.Step, i+1)
+		}
+		if want := fmt.Sprintf("Step %d/2", i+1); e.StepLabel != want {
+			t.Errorf("entry %d: label = %q, want %q", i, e.StepLabel, want)
+		}
+	}
+	if entries[0].DurationMs < 50 {
+		t.Errorf("sleep step duration = %dms, want >= 50ms", entries[0].DurationMs)
+	}
+}
+
+func TestRunWorkflow_CdCarriesToLaterSteps(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	origSpawn := spawnDetached
+	spawnDetached = func(args ...string) {}
+	defer func() { spawnDetached = origSpawn }()
+
+	yolo = true
+	defer func() { yolo = false }()
+
+	result := &ai.Result{
+		Intent: ai.IntentWorkflow,
+		Steps: []ai.Step{
+			{Command: "cd /tmp"},
+			{Command: "pwd"},
+		},
+	}
+	if err := runWorkflow(rootCmd, nil, result, "go to tmp and show where"); err != nil {
+		t.Fatalf("runWorkflow failed: %v", err)
+	}
+
+	entries, err := history.Load(0)
+	if err != nil {
+		t.Fatalf("load history: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 history entries, got %d", len(entries))
+	}
+	if !entries[0].Success {
+		t.Errorf("cd step failed: %q", entries[0].Output)
+	}
+	if got := strings.TrimSpace(entries[1].Output); got != "/tmp" {
+		t.Errorf("pwd after cd /tmp = %q, want /tmp", got)
+	}
+	if wd, _ := os.Getwd(); wd == "/tmp" {
+		t.Error("a workflow cd shouldn't change xx's own directory")
+	}
+}
+
+func TestRunWorkflow_CompoundAndQuotedCd(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "My Dir"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	origSpawn := spawnDetached
+	spawnDetached = func(args ...string) {}
+	defer func() { spawnDetached = origSpawn }()
+
+	yolo = true
+	defer func() { yolo = false }()
+
+	result := &ai.Result{
+		Intent: ai.IntentWorkflow,
+		Steps: []ai.Step{
+			{Command: "cd " + dir},
+			{Command: "mkdir frontend"},
+			// A compound step runs in the shell; its cd doesn't carry over.
+			{Command: "cd frontend && pwd"},
+			{Command: "pwd"},
+			{Command: `cd "My Dir"`},
+			{Command: "pwd"},
+		},
+	}
+	if err := runWorkflow(rootCmd, nil, result, "build the frontend"); err != nil {
+		t.Fatalf("runWorkflow failed: %v", err)
+	}
+
+	entries, err := history.Load(0)
+	if err != nil {
+		t.Fatalf("load history: %v", err)
+	}
+	if len(entries) != len(result.Steps) {
+		t.Fatalf("expected %d history entries, got %d", len(result.Steps), len(entries))
+	}
+	want := map[int]string{
+		2: filepath.Join(dir, "frontend"),
+		3: dir,
+		5: filepath.Join(dir, "My Dir"),
+	}
+	for i, path := range want {
+		if got := strings.TrimSpace(entries[i].Output); got != path {
+			t.Errorf("step %d (%s) printed %q, want %q", i+1, result.Steps[i].Command, got, path)
+		}
+	}
+}
+
+func TestChangeDir(t *testing.T) {
+	base := t.TempDir()
+	if err := os.Mkdir(filepath.Join(base, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(base, "file"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := changeDir(base, "sub"); err != nil || got != filepath.Join(base, "sub") {
+		t.Errorf("relative cd = %q, %v", got, err)
+	}
+	if got, err := changeDir(filepath.Join(base, "sub"), ".."); err != nil || got != base {
+		t.Errorf("cd .. = %q, %v", got, err)
+	}
+	if _, err := changeDir(base, "file"); err == nil {
+		t.Error("cd into a file should fail")
+	}
+	if _, err := changeDir(base, "missing"); err == nil {
+		t.Error("cd into a missing directory should fail")
+	}
+}
+
+func TestStepBatches(t *testing.T) {
+	steps := []ai.Step{
+		{Command: "a", ParallelGroup: 1},
+		{Command: "b", ParallelGroup: 1},
+		{Command: "c"},
+		{Command: "d", ParallelGroup: 2},
+		{Command: "e", ParallelGroup: 2},
+		{Command: "f", ParallelGroup: 1},
+	}
+
+	got := fmt.Sprint(stepBatches(steps, true))
+	if want := "[[0 1] [2] [3 4] [5]]"; got != want {
+		t.Errorf("parallel batches = %s, want %s", got, want)
+	}
+	got = fmt.Sprint(stepBatches(steps, false))
+	if want := "[[0] [1] [2] [3] [4] [5]]"; got != want {
+		t.Errorf("sequential batches = %s, want %s", got, want)
+	}
+}
+
+func TestRunWorkflow_ParallelGroups(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+
+	origSpawn := spawnDetached
+	spawnDetached = func(args ...string) {}
+	defer func() { spawnDetached = origSpawn }()
+
+	yolo, parallel = true, true
+	defer func() { yolo, parallel = false, false }()
+
+	// Each group-1 step waits for the other to start, so they only succeed
+	// if they run concurrently. The group-2 step checks both finished first.
+	handshake := func(self, other string) string {
+		return fmt.Sprintf("touch %[1]s/%[2]s.started; for i in $(seq 200); do if [ -f %[1]s/%[3]s.started ]; then touch %[1]s/%[2]s.done; exit 0; fi; sleep 0.01; done; exit 1", dir, self, other)
+	}
+	result := &ai.Result{
+		Intent: ai.IntentWorkflow,
+		Steps: []ai.Step{
+			{Command: handshake("a", "b"), ParallelGroup: 1},
+			{Command: handshake("b", "a"), ParallelGroup: 1},
+			{Command: fmt.Sprintf("test -f %[1]s/a.done && test -f %[1]s/b.done", dir), ParallelGroup: 2},
+		},
+	}
+	if err := runWorkflow(rootCmd, nil, result, "build both then check"); err != nil {
+		t.Fatalf("runWorkflow failed: %v", err)
+	}
+
+	entries, err := history.Load(0)
+	if err != nil {
+		t.Fatalf("load history: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 history entries, got %d", len(entries))
+	}
+	for _, e := range entries {
+		if !e.Success {
+			t.Errorf("step %d (%s) failed", e.Step, e.StepLabel)
+		}
+	}
+}
+
+func TestRunWorkflow_SummaryGetsCombinedOutput(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	origSpawn := spawnDetached
+	spawnDetached = func(args ...string) {}
+	defer func() { spawnDetached = origSpawn }()
+
+	yolo, workflowSummary = true, true
+	defer func() { yolo, workflowSummary = false, false }()
+
+	mock := &mockStreamProvider{tokens: []string{"Built and tested."}}
+	client := ai.NewClientWithProvider(mock)
+	rootCmd.SetContext(context.Background())
+
+	result := &ai.Result{
+		Intent: ai.IntentWorkflow,
+		Steps: []ai.Step{
+			{Command: "echo built-ok"},
+			{Command: "echo tests-ok"},
+		},
+	}
+	if err := runWorkflow(rootCmd, client, result, "build and test"); err != nil {
+		t.Fatalf("runWorkflow failed: %v", err)
+	}
+
+	if len(mock.lastMsgs) != 2 {
+		t.Fatalf("expected a summarize call, got %+v", mock.lastMsgs)
+	}
+	user := mock.lastMsgs[1].Content
+	for _, want := range []string{"built-ok", "tests-ok", "echo built-ok && echo tests-ok"} {
+		if !strings.Contains(user, want) {
+			t.Errorf("summarize prompt missing %q:\n%s", want, user)
+		}
+	}
+}
+
+func TestCheckRisk_MediumExplainsAndStillConfirms(t *testing.T) {
+	mock := &mockStreamProvider{tokens: []string{"Deletes ", "node_modules for good."}}
+	client := ai.NewClientWithProvider(mock)
+
+	var buf bytes.Buffer
+	risk, err := checkRisk(context.Background(), &buf, client, "rm -rf node_modules")
+	if err != nil {
+		t.Fatalf("medium risk should not be refused: %v", err)
+	}
+	if risk != safety.Medium {
+		t.Fatalf("risk = %v, want medium", risk)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "Deletes node_modules for good.") {
+		t.Errorf("expected the AI preview above the prompt, got %q", out)
+	}
+	if len(mock.lastMsgs) != 2 || !strings.Contains(mock.lastMsgs[1].Content, "rm -rf node_modules") {
+		t.Errorf("the command should be sent for explanation, got %+v", mock.lastMsgs)
+	}
+	if !needsConfirmation(risk, false) {
+		t.Error("a medium-risk command should be confirmed even for a non-execute intent")
+	}
+}
+
+func TestCheckRisk_UserRules(t *testing.T) {
+	rulesFile := filepath.Join(t.TempDir(), "risk-rules")
+	origFile := riskRulesFile
+	defer func() { riskRulesFile = origFile }()
+	riskRulesFile = func() string { return rulesFile }
+
+	os.WriteFile(rulesFile, []byte("high /\\bterraform\\s+destroy\\b/ destroys infrastructure\n"), 0o600)
+	var buf bytes.Buffer
+	_, err := checkRisk(context.Background(), &buf, nil, "terraform destroy")
+	if err == nil || !strings.Contains(buf.String(), "destroys infrastructure") {
+		t.Fatalf("expected a user high-risk rule to refuse the command, got %v: %q", err, buf.String())
+	}
+
+	os.WriteFile(rulesFile, []byte("high terraform destroy\n"), 0o600)
+	if _, err := checkRisk(context.Background(), &buf, nil, "ls"); err == nil || !strings.Contains(err.Error(), "risk rules") {
+		t.Errorf("a broken rules file should refuse to run anything, got %v", err)
+	}
+}
+
+func TestCheckRisk_HighRequiresForce(t *testing.T) {
+	mock := &mockStreamProvider{tokens: []string{"Wipes everything."}}
+	client := ai.NewClientWithProvider(mock)
+
+	var buf bytes.Buffer
+	_, err := checkRisk(context.Background(), &buf, client, "rm -rf ~")
+	if err == nil || !strings.Contains(err.Error(), "--force") {
+		t.Fatalf("expected a refusal mentioning --force, got %v", err)
+	}
+	if mock.lastMsgs != nil {
+		t.Error("a refused command shouldn't need an explanation")
+	}
+
+	force = true
+	defer func() { force = false }()
+	buf.Reset()
+	risk, err := checkRisk(context.Background(), &buf, client, "rm -rf ~")
+	if err != nil {
+		t.Fatalf("--force should allow a high-risk command: %v", err)
+	}
+	if !strings.Contains(buf.String(), "Wipes everything.") {
+		t.Errorf("expected an explanation with --force, got %q", buf.String())
+	}
+
+	yolo = true
+	defer func() { yolo = false }()
+	if !needsConfirmation(risk, true) {
+		t.Error("--yolo must not skip confirming a high-risk command")
+	}
+	if needsConfirmation(safety.Low, true) {
+		t.Error("--yolo should still skip confirming a low-risk command")
+	}
+}
+
+func TestRetryAllowed_ChecksRisk(t *testing.T) {
+	if retryAllowed(context.Background(), nil, "rm -rf ~") {
+		t.Error("a high-risk fix shouldn't be retried without --force")
+	}
+	if !retryAllowed(context.Background(), nil, "ls -la") {
+		t.Error("a low-risk fix should be offered for retry")
+	}
+}
+
+func TestRunWorkflow_HighRiskStepRefused(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	yolo = true
+	defer func() { yolo = false }()
+
+	result := &ai.Result{
+		Intent: ai.IntentWorkflow,
+		Steps: []ai.Step{
+			{Command: "true"},
+			{Command: "dd if=/dev/zero of=/dev/sda"},
+		},
+	}
+	err := runWorkflow(rootCmd, nil, result, "wipe the disk")
+	if err == nil || !strings.Contains(err.Error(), "high-risk") {
+		t.Fatalf("expected the workflow to be refused, got %v", err)
+	}
+	if entries, _ := history.Load(0); len(entries) != 0 {
+		t.Errorf("no step should run, got %d history entries", len(entries))
+	}
+}
+
+func TestRun_SafeModeNeverExecutes(t *testing.T) {
+	runOffline(t, nil)
+	if err := config.Set("safe_mode", "true"); err != nil {
+		t.Fatal(err)
+	}
+
+	// --yolo would skip every confirmation, so only safe mode stands
+	// between the generated command and the shell.
+	yolo = true
+	defer func() { yolo = false }()
+
+	marker := filepath.Join(t.TempDir(), "ran")
+	touch := "touch " + marker
+	replies := map[string]string{
+		ai.IntentQuery:    fmt.Sprintf(`{"command": %q, "intent": "query"}`, touch),
+		ai.IntentExecute:  fmt.Sprintf(`{"command": %q, "intent": "execute"}`, touch),
+		ai.IntentDisplay:  fmt.Sprintf(`{"command": %q, "intent": "display"}`, touch),
+		ai.IntentInstall:  fmt.Sprintf(`{"command": %q, "intent": "install", "packages": ["jq"]}`, touch),
+		ai.IntentWorkflow: fmt.Sprintf(`{"intent": "workflow", "steps": [{"command": %q}, {"command": "true"}]}`, touch),
+	}
+	for intent, reply := range replies {
+		newClient = func(*config.Config) *ai.Client {
+			return ai.NewClientWithProvider(&mockStreamProvider{tokens: []string{reply}})
+		}
+		if err := run(rootCmd, []string{"do", "the", "thing"}); err != nil {
+			t.Fatalf("%s: run failed: %v", intent, err)
+		}
+		if _, err := os.Stat(marker); !os.IsNotExist(err) {
+			t.Fatalf("%s: command was executed in safe mode", intent)
+		}
+	}
+
+	if entries, _ := history.Load(0); len(entries) != 0 {
+		t.Errorf("nothing ran, so nothing should be in history, got %d entries", len(entries))
+	}
+}
+
+func TestPickCandidate(t *testing.T) {
+	candidates := []*ai.Result{
+		{Command: "du -sh * | sort -h", Explanation: "sizes here", Intent: ai.IntentDisplay},
+		{Command: "ncdu .", Explanation: "interactive", Intent: ai.IntentDisplay},
+		{Intent: ai.IntentWorkflow, Steps: []ai.Step{{Command: "cd ~"}, {Command: "du -sh *"}}},
+	}
+
+	var out bytes.Buffer
+	got, err := pickCandidate(strings.NewReader("2\n"), &out, candidates)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != candidates[1] {
+		t.Errorf("expected the second candidate, got %+v", got)
+	}
+	for _, want := range []string{"1. du -sh * | sort -h", "2. ncdu .", "3. cd ~ → du -sh *", "interactive", "[1-3"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("menu should contain %q, got:\n%s", want, out.String())
+		}
+	}
+
+	got, err = pickCandidate(strings.NewReader("\n"), &out, candidates)
+	if err != nil || got != nil {
+		t.Errorf("empty input should cancel, got %+v, %v", got, err)
+	}
+
+	for _, input := range []string{"0\n", "4\n", "two\n"} {
+		if _, err := pickCandidate(strings.NewReader(input), &out, candidates); err == nil {
+			t.Errorf("input %q should be rejected", input)
+		}
+	}
+}
+
+func TestPickCandidate_SingleSkipsMenu(t *testing.T) {
+	only := &ai.Result{Command: "df -h", Intent: ai.IntentDisplay}
+	got, err := pickCandidate(strings.NewReader(""), io.Discard, []*ai.Result{only})
+	if err != nil || got != only {
+		t.Errorf("a single candidate should be returned without asking, got %+v, %v", got, err)
+	}
+}
+
+func TestCheckPlatform_WarnsAboutWrongOSTools(t *testing.T) {
+	var buf bytes.Buffer
+	if !checkPlatform(&buf, "free -h", "darwin") {
+		t.Fatal("expected free to be flagged on macOS")
+	}
+	if out := buf.String(); !strings.Contains(out, "'free' isn't available on macOS") || !strings.Contains(out, "vm_stat") {
+		t.Errorf("warning = %q, want it to name free, macOS and the vm_stat alternative", out)
+	}
+
+	buf.Reset()
+	if checkPlatform(&buf, "free -h", "linux") {
+		t.Error("free shouldn't be flagged on Linux")
+	}
+	if buf.Len() != 0 {
+		t.Errorf("expected no output, got %q", buf.String())
+	}
+}
+
+func TestEnvSnapshot_OffByDefault(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	if env := envSnapshot(ai.IntentExecute); env != nil {
+		t.Errorf("snapshot should be off by default, got %+v", env)
+	}
+
+	if err := config.Set("env_snapshot", "true"); err != nil {
+		t.Fatal(err)
+	}
+	if env := envSnapshot(ai.IntentExecute); env == nil || env.Dir == "" {
+		t.Errorf("expected a snapshot with the working directory, got %+v", env)
+	}
+	if env := envSnapshot(ai.IntentWorkflow); env == nil {
+		t.Error("workflows should be snapshotted too")
+	}
+	if env := envSnapshot(ai.IntentQuery); env != nil {
+		t.Errorf("read-only intents shouldn't be snapshotted, got %+v", env)
+	}
+}
+
+func TestRun_RepeatRunsCommandNTimes(t *testing.T) {
+	runOffline(t, map[string]string{"say hello": "echo hello"})
+
+	origRun := runCommand
+	defer func() { runCommand = origRun }()
+	var ran []string
+	runCommand = func(command string, _ executor.Options) (string, error) {
+		ran = append(ran, command)
+		if len(ran) == 2 {
+			return "", errors.New("exit status 1")
+		}
+		return "hello\n", nil
+	}
+
+	repeat, repeatDelay = 3, 0
+	defer func() { repeat, repeatDelay = 1, time.Second }()
+
+	err := run(rootCmd, []string{"say", "hello"})
+	if err == nil || !strings.Contains(err.Error(), "1 of 3 runs failed") {
+		t.Errorf("expected the failed run to be reported, got %v", err)
+	}
+	if len(ran) != 3 {
+		t.Fatalf("expected 3 executions, got %d", len(ran))
+	}
+	for _, c := range ran {
+		if c != "echo hello" {
+			t.Errorf("every run should execute the one translation, got %q", c)
+		}
+	}
+
+	entries, _ := history.Load(0)
+	if len(entries) != 1 || entries[0].Success {
+		t.Errorf("expected one failed history entry for the repeated runs, got %+v", entries)
+	}
+}
+
+func TestRun_RepeatRejectsInteractiveAndCd(t *testing.T) {
+	runOffline(t, map[string]string{"watch processes": "top", "go home": "cd ~"})
+
+	origRun := runCommand
+	defer func() { runCommand = origRun }()
+	ran := 0
+	runCommand = func(string, executor.Options) (string, error) {
+		ran++
+		return "", nil
+	}
+
+	repeat, repeatDelay = 3, 0
+	defer func() { repeat, repeatDelay = 1, time.Second }()
+
+	if err := run(rootCmd, []string{"watch", "processes"}); err == nil || !strings.Contains(err.Error(), "interactive") {
+		t.Errorf("expected --repeat to be rejected for top, got %v", err)
+	}
+	if err := run(rootCmd, []string{"go", "home"}); err == nil || !strings.Contains(err.Error(), "cd") {
+		t.Errorf("expected --repeat to be rejected for cd, got %v", err)
+	}
+	if ran != 0 {
+		t.Errorf("nothing should run, got %d executions", ran)
+	}
+}
+
+func TestRun_PolicyBlocksDeniedCommands(t *testing.T) {
+	runOffline(t, map[string]string{"wipe build": "rm -rf build", "say hi": "echo hi"})
+
+	policy := filepath.Join(t.TempDir(), "xxignore")
+	if err := os.WriteFile(policy, []byte("# locked down\nrm -rf\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	origFiles := policyFiles
+	defer func() { policyFiles = origFiles }()
+	policyFiles = func() []string { return []string{policy} }
+
+	origRun := runCommand
+	defer func() { runCommand = origRun }()
+	var ran []string
+	runCommand = func(command string, _ executor.Options) (string, error) {
+		ran = append(ran, command)
+		return "", nil
+	}
+
+	// Neither flag gets a denied command past the policy.
+	yolo, force = true, true
+	defer func() { yolo, force = false, false }()
+
+	err := run(rootCmd, []string{"wipe", "build"})
+	if err == nil || !strings.Contains(err.Error(), "policy") {
+		t.Errorf("expected the denied command to be refused, got %v", err)
+	}
+	if len(ran) != 0 {
+		t.Fatalf("denied command was executed: %v", ran)
+	}
+
+	if err := run(rootCmd, []string{"say", "hi"}); err != nil {
+		t.Fatalf("allowed command failed: %v", err)
+	}
+	if len(ran) != 1 || ran[0] != "echo hi" {
+		t.Errorf("expected the allowed command to run, got %v", ran)
+	}
+}
+
+func TestRun_InteractiveCommandsGetTheTerminal(t *testing.T) {
+	runOffline(t, map[string]string{"edit notes.txt": "vim notes.txt", "say hi": "echo hi"})
+
+	origRun := runCommand
+	defer func() { runCommand = origRun }()
+	got := map[string]executor.Options{}
+	runCommand = func(command string, opts executor.Options) (string, error) {
+		got[command] = opts
+		if opts.Interactive {
+			return "", nil
+		}
+		return "hi\n", nil
+	}
+	yolo = true
+	defer func() { yolo = false }()
+
+	if err := run(rootCmd, []string{"edit", "notes.txt"}); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if opts := got["vim notes.txt"]; !opts.Interactive || opts.Timeout != 0 {
+		t.Errorf("expected vim attached to the terminal with no timeout, got %+v", opts)
+	}
+	if err := run(rootCmd, []string{"say", "hi"}); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if opts := got["echo hi"]; opts.Interactive || opts.Timeout == 0 {
+		t.Errorf("expected echo captured under the exec timeout, got %+v", opts)
+	}
+
+	entries, _ := history.Load(0)
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 history entries, got %d", len(entries))
+	}
+	for _, e := range entries {
+		if want := e.Command == "vim notes.txt"; e.Interactive != want {
+			t.Errorf("%s: expected Interactive=%v, got %v", e.Command, want, e.Interactive)
+		}
+	}
+
+	interactive = true
+	defer func() { interactive = false }()
+	if err := run(rootCmd, []string{"say", "hi"}); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if !got["echo hi"].Interactive {
+		t.Error("--interactive should attach any command to the terminal")
+	}
+}
+
+func TestConfirmExecution_ExplainThenReprompt(t *testing.T) {
+	client := ai.NewClientWithProvider(&fixedProvider{response: "Deletes the build directory and everything in it."})
+
+	var out bytes.Buffer
+	if !confirmExecution(context.Background(), strings.NewReader("e\ny\n"), &out, client, "rm -rf build") {
+		t.Error("expected y after the explanation to confirm")
+	}
+	if !strings.Contains(out.String(), "Deletes the build directory") {
+		t.Errorf("expected the explanation to be shown, got:\n%s", out.String())
+	}
+	if n := strings.Count(out.String(), "Execute?"); n != 2 {
+		t.Errorf("expected the prompt again after explaining, got %d prompts:\n%s", n, out.String())
+	}
+
+	// Explaining never counts as a yes, even when nothing follows it.
+	out.Reset()
+	if confirmExecution(context.Background(), strings.NewReader("e\n"), &out, client, "rm -rf build") {
+		t.Error("an explanation alone should not confirm")
+	}
+	out.Reset()
+	if confirmExecution(context.Background(), strings.NewReader("e\nn\n"), &out, client, "rm -rf build") {
+		t.Error("n after the explanation should abort")
+	}
+}
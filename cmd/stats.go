@@ -2,23 +2,47 @@ package cmd
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"strings"
 
+	"github.com/arin/xx-cli/internal/config"
 	"github.com/arin/xx-cli/internal/stats"
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 )
 
+var (
+	statsByHour    bool
+	statsFailures  bool
+	statsWeekStart string
+)
+
 var statsCmd = &cobra.Command{
 	Use:   "stats",
 	Short: "Show usage statistics and performance metrics",
 	Long: `Display a dashboard of your xx usage: command counts, success rates,
 AI response times, most-used commands, and intent breakdown.
 
+Use --by-hour to see when you use xx most, as an hour-of-day histogram
+in local time, and --failures to see which kinds of commands fail most,
+grouped by intent and program.
+
+"This week" is the last 7 days by default. Use --week-start monday (or
+sunday) to count the calendar week instead, or make it permanent with
+'xx config set week_start monday'.
+
 Data is collected automatically and stored locally in ~/.xx-cli/stats.json.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		summary, err := stats.Summarize()
+		weekStart := strings.ToLower(statsWeekStart)
+		if weekStart == "" {
+			cfg, err := config.Load()
+			if err != nil {
+				return fmt.Errorf("configuration error: %w", err)
+			}
+			weekStart = cfg.WeekStart
+		}
+		summary, err := stats.SummarizeWithOptions(stats.Options{WeekStart: weekStart})
 		if err != nil {
 			return fmt.Errorf("failed to load stats: %w", err)
 		}
@@ -36,6 +60,33 @@ Data is collected automatically and stored locally in ~/.xx-cli/stats.json.`,
 			return nil
 		}
 
+		if statsFailures {
+			records, err := stats.LoadAll()
+			if err != nil {
+				return fmt.Errorf("failed to load stats: %w", err)
+			}
+			cyan.Fprintln(os.Stderr, "  Top Failures")
+			groups := stats.TopFailures(records, 10)
+			if len(groups) == 0 {
+				green.Fprintln(os.Stderr, "  No failed commands. 🎉")
+			}
+			for _, g := range groups {
+				yellow.Fprintf(os.Stderr, "  %-12s ", g.Program)
+				dim.Fprintf(os.Stderr, "%-9s ", g.Intent)
+				fmt.Fprintf(os.Stderr, "%3d failed", g.Count)
+				dim.Fprintf(os.Stderr, "  e.g. %s\n", truncateCommand(g.Example, 50))
+			}
+			fmt.Fprintln(os.Stderr)
+			return nil
+		}
+
+		if statsByHour {
+			cyan.Fprintln(os.Stderr, "  Activity by Hour")
+			writeHourlyChart(os.Stderr, summary.HourlyDistribution)
+			fmt.Fprintln(os.Stderr)
+			return nil
+		}
+
 		// Overview
 		green.Fprintf(os.Stderr, "  Commands:  ")
 		fmt.Fprintf(os.Stderr, "%d total", summary.TotalCommands)
@@ -55,6 +106,10 @@ Data is collected automatically and stored locally in ~/.xx-cli/stats.json.`,
 			green.Fprintf(os.Stderr, "  Exec time: ")
 			fmt.Fprintf(os.Stderr, "%dms avg\n", summary.AvgExecLatencyMs)
 		}
+		if summary.AvgTokensPerSec > 0 {
+			green.Fprintf(os.Stderr, "  Speed:     ")
+			fmt.Fprintf(os.Stderr, "%.1f tokens/sec avg, %d-token prompts\n", summary.AvgTokensPerSec, summary.AvgPromptTokens)
+		}
 
 		// Intent breakdown
 		if len(summary.IntentBreakdown) > 0 {
@@ -83,12 +138,8 @@ Data is collected automatically and stored locally in ~/.xx-cli/stats.json.`,
 			fmt.Fprintln(os.Stderr)
 			cyan.Fprintln(os.Stderr, "  Top Commands")
 			for i, tc := range summary.TopCommands {
-				cmd := tc.Command
-				if len(cmd) > 50 {
-					cmd = cmd[:50] + "..."
-				}
 				dim.Fprintf(os.Stderr, "  %d. ", i+1)
-				fmt.Fprintf(os.Stderr, "%s ", cmd)
+				fmt.Fprintf(os.Stderr, "%s ", truncateCommand(tc.Command, 50))
 				dim.Fprintf(os.Stderr, "(%dx)\n", tc.Count)
 			}
 		}
@@ -97,3 +148,44 @@ Data is collected automatically and stored locally in ~/.xx-cli/stats.json.`,
 		return nil
 	},
 }
+
+func init() {
+	statsCmd.Flags().BoolVar(&statsByHour, "by-hour", false, "Show an hour-of-day histogram of your activity")
+	statsCmd.Flags().StringVar(&statsWeekStart, "week-start", "", "What counts as this week: rolling (last 7 days), monday or sunday (default from config)")
+	statsCmd.Flags().BoolVar(&statsFailures, "failures", false, "Show which kinds of commands fail most")
+}
+
+// truncateCommand shortens a command to max bytes for one-line display.
+func truncateCommand(cmd string, max int) string {
+	if len(cmd) > max {
+		return cmd[:max] + "..."
+	}
+	return cmd
+}
+
+// hourlyBarWidth is the length of the bar for the busiest hour.
+const hourlyBarWidth = 40
+
+// writeHourlyChart renders one bar per hour of the day, scaled so the
+// busiest hour gets the full width.
+func writeHourlyChart(w io.Writer, dist [24]int) {
+	dim := color.New(color.FgHiBlack)
+	busiest := 0
+	for _, n := range dist {
+		if n > busiest {
+			busiest = n
+		}
+	}
+	for hour, n := range dist {
+		bar := ""
+		if busiest > 0 {
+			bar = strings.Repeat("█", n*hourlyBarWidth/busiest)
+		}
+		dim.Fprintf(w, "  %02d:00 ", hour)
+		if n > 0 {
+			fmt.Fprintf(w, "%s %d\n", bar, n)
+		} else {
+			fmt.Fprintln(w)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/arin/xx-cli/internal/ai"
+	"github.com/arin/xx-cli/internal/config"
+	"github.com/arin/xx-cli/internal/learn"
+	"github.com/spf13/cobra"
+)
+
+var translateJSON bool
+
+var translateCmd = &cobra.Command{
+	Use:   "translate <prompt>",
+	Short: "Print the command for a prompt without running it",
+	Long: `Translates a prompt into a shell command and prints it, and nothing else:
+no spinner, no colours, no confirmation, and nothing is run or recorded.
+It's meant for editor integrations, e.g. in Vim:
+
+  :read !xx translate find go files changed this week
+
+A workflow prints one step per line. With --json, stdout is a single JSON
+object instead:
+
+  {"command": "...", "intent": "...", "explanation": "...", "steps": [...]}
+
+where steps is empty unless the intent is workflow. Errors go to stderr
+with a non-zero exit status, and stdout stays empty.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("configuration error: %w", err)
+		}
+		prompt := strings.Join(args, " ")
+
+		// The same learned templates run() uses, so both agree.
+		var result *ai.Result
+		if tmplCmd, ok := learn.MatchTemplate(prompt); ok {
+			result = &ai.Result{Command: tmplCmd, Explanation: "From a learned template", Intent: ai.IntentDisplay}
+		} else if result, err = newClient(cfg).Translate(cmd.Context(), prompt); err != nil {
+			return fmt.Errorf("AI translation failed: %w", err)
+		}
+		return writeTranslation(os.Stdout, result, translateJSON)
+	},
+}
+
+func init() {
+	translateCmd.Flags().BoolVar(&translateJSON, "json", false, "Print the command, intent, explanation and steps as JSON")
+}
+
+// translation is the JSON contract of `xx translate --json`.
+type translation struct {
+	Command     string    `json:"command"`
+	Intent      string    `json:"intent"`
+	Explanation string    `json:"explanation"`
+	Steps       []ai.Step `json:"steps"`
+}
+
+// writeTranslation writes result to w: the bare command, one line per
+// workflow step, or with asJSON the translation object.
+func writeTranslation(w io.Writer, result *ai.Result, asJSON bool) error {
+	if asJSON {
+		out := translation{
+			Command:     result.Command,
+			Intent:      result.Intent,
+			Explanation: result.Explanation,
+			Steps:       result.Steps,
+		}
+		if out.Steps == nil {
+			out.Steps = []ai.Step{}
+		}
+		return json.NewEncoder(w).Encode(out)
+	}
+	if result.Intent == ai.IntentWorkflow && len(result.Steps) > 0 {
+		for _, s := range result.Steps {
+			fmt.Fprintln(w, s.Command)
+		}
+		return nil
+	}
+	fmt.Fprintln(w, result.Command)
+	return nil
+}
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/arin/xx-cli/internal/ai"
+	"github.com/arin/xx-cli/internal/config"
+)
+
+func TestTranslate_JSONOnlyOnStdout(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	origClient := newClient
+	defer func() { newClient = origClient }()
+	newClient = func(*config.Config) *ai.Client {
+		return ai.NewClientWithProvider(&fixedProvider{response: `{"command": "", "explanation": "stage and commit", "intent": "workflow",
+			"steps": [{"command": "git add -A", "explanation": "stage"}, {"command": "git commit -m wip", "explanation": "commit"}]}`})
+	}
+
+	stdout, err := os.Create(filepath.Join(t.TempDir(), "stdout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdout.Close()
+	origStdout := os.Stdout
+	os.Stdout = stdout
+	defer func() {
+		os.Stdout = origStdout
+		translateJSON = false
+		rootCmd.SetArgs(nil)
+	}()
+
+	rootCmd.SetArgs([]string{"translate", "--json", "commit", "everything"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("xx translate failed: %v", err)
+	}
+	os.Stdout = origStdout
+
+	data, err := os.ReadFile(stdout.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]any
+	dec := json.NewDecoder(strings.NewReader(string(data)))
+	if err := dec.Decode(&got); err != nil {
+		t.Fatalf("stdout isn't JSON: %v\n%s", err, data)
+	}
+	if dec.More() {
+		t.Errorf("stdout should hold a single JSON object, got %q", data)
+	}
+	for _, key := range []string{"command", "intent", "explanation", "steps"} {
+		if _, ok := got[key]; !ok {
+			t.Errorf("missing %q in %s", key, data)
+		}
+	}
+	if got["intent"] != ai.IntentWorkflow {
+		t.Errorf("intent = %v, want workflow", got["intent"])
+	}
+	if steps, _ := got["steps"].([]any); len(steps) != 2 {
+		t.Errorf("expected 2 steps, got %v", got["steps"])
+	}
+	if strings.Contains(string(data), "\x1b[") {
+		t.Errorf("stdout shouldn't contain colour codes: %q", data)
+	}
+}
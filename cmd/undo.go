@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/arin/xx-cli/internal/ai"
+	"github.com/arin/xx-cli/internal/config"
+	"github.com/arin/xx-cli/internal/executor"
+	"github.com/arin/xx-cli/internal/history"
+	"github.com/arin/xx-cli/internal/ui"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var undoCmd = &cobra.Command{
+	Use:   "undo",
+	Short: "Reverse the last command xx ran for you",
+	Long: `Finds the most recent successful execute command in your history and
+asks the AI for the command that reverses it, e.g. mkdir foo → rmdir foo or
+git add . → git reset. The inverse goes through the same policy and safety
+checks as any other command and always asks before running.
+
+The inverse runs in the directory the original command ran in, so
+mkdir foo is undone in the right place wherever you run xx undo from.
+
+Some commands can't be undone (rm, anything sent over the network); xx says
+so instead of guessing.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("configuration error: %w", err)
+		}
+
+		entries, err := history.Load(0)
+		if err != nil {
+			return fmt.Errorf("failed to load history: %w", err)
+		}
+		last, ok := lastExecuted(entries)
+		if !ok {
+			fmt.Println("Nothing to undo: xx hasn't run a command that changed anything yet.")
+			return nil
+		}
+
+		cyan := color.New(color.FgCyan, color.Bold)
+		dim := color.New(color.FgHiBlack)
+		dim.Fprintf(os.Stderr, "\n  Last command (%s):\n", last.Timestamp.Local().Format("2006-01-02 15:04"))
+		cyan.Fprintf(os.Stderr, "  %s\n", last.Command)
+		dir := entryDir(last)
+		if dir != "" {
+			dim.Fprintf(os.Stderr, "  in %s\n", dir)
+			if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+				return fmt.Errorf("can't undo: %s, where it ran, no longer exists", dir)
+			}
+		}
+		fmt.Fprintln(os.Stderr)
+
+		client := newClient(cfg)
+		sp := ui.NewSpinner("Working out the inverse...")
+		sp.Start()
+		undo, err := client.Undo(cmd.Context(), last.Command, last.Output)
+		sp.Stop()
+		if err != nil {
+			return fmt.Errorf("couldn't work out an undo: %w", err)
+		}
+		if undo == "" {
+			color.New(color.FgYellow).Fprintln(os.Stderr, "  xx doesn't know a safe way to undo this one.")
+			return nil
+		}
+
+		cyan.Fprintf(os.Stderr, "  ↩ %s\n\n", undo)
+		if suggestOnly(cfg) {
+			dim.Fprintln(os.Stderr, "  (suggest-only: not running it)")
+			return nil
+		}
+		if err := checkPolicy(os.Stderr, undo); err != nil {
+			return err
+		}
+		if _, err := checkRisk(cmd.Context(), os.Stderr, client, undo); err != nil {
+			return err
+		}
+		// An undo is never run without asking, whatever the risk.
+		if !promptConfirmation(cmd.Context(), client, undo) {
+			fmt.Fprintln(os.Stderr, "Aborted.")
+			return nil
+		}
+
+		opts := executor.Options{MaxOutput: cfg.MaxOutput(), Timeout: cfg.ExecTimeout(), Dir: dir}
+		if executor.IsInteractive(undo) {
+			opts.Interactive, opts.Timeout = true, 0
+		}
+		start := time.Now()
+		output, execErr := runCommand(undo, opts)
+		prompt := last.Prompt + " (undo)"
+		auditExec(prompt, undo, ai.IntentExecute, true, execErr)
+		runPostExecHook(prompt, undo, ai.IntentExecute, execErr)
+		saveHistory(history.Entry{
+			Prompt:      prompt,
+			Command:     undo,
+			Output:      output,
+			Success:     execErr == nil,
+			DurationMs:  time.Since(start).Milliseconds(),
+			Dir:         dir,
+			Intent:      ai.IntentExecute,
+			ExitCode:    executor.ExitCode(execErr),
+			Interactive: opts.Interactive,
+		})
+
+		if execErr != nil {
+			color.New(color.FgRed).Fprintf(os.Stderr, "\n  ✗ Undo failed: %v\n\n", execErr)
+			if output != "" {
+				dim.Fprintf(os.Stderr, "  %s\n", output)
+			}
+			return fmt.Errorf("undo failed: %w", execErr)
+		}
+		color.New(color.FgGreen).Fprintf(os.Stderr, "\n  ✓ Undone.\n\n")
+		return nil
+	},
+}
+
+// entryDir returns the directory e's command ran in. Entries from before
+// it was recorded only have it in their environment snapshot, if at all;
+// without either it's empty, meaning the current directory.
+func entryDir(e history.Entry) string {
+	if e.Dir != "" {
+		return e.Dir
+	}
+	if e.Env != nil {
+		return e.Env.Dir
+	}
+	return ""
+}
+
+// lastExecuted returns the most recent successful execute-intent entry in
+// entries (oldest first, as history.Load returns them). Failed commands
+// are passed over: they usually changed nothing worth reversing.
+func lastExecuted(entries []history.Entry) (history.Entry, bool) {
+	for i := len(entries) - 1; i >= 0; i-- {
+		if e := entries[i]; e.Intent == ai.IntentExecute && e.Success {
+			return e, true
+		}
+	}
+	return history.Entry{}, false
+}
@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/arin/xx-cli/internal/ai"
+	"github.com/arin/xx-cli/internal/config"
+	"github.com/arin/xx-cli/internal/executor"
+	"github.com/arin/xx-cli/internal/history"
+)
+
+func TestUndo_ReversesLastExecutedCommand(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	for _, e := range []history.Entry{
+		{Prompt: "make a foo folder", Command: "mkdir foo", Intent: ai.IntentExecute, Success: true},
+		{Prompt: "make a bar folder", Command: "mkdir /root/bar", Intent: ai.IntentExecute},
+		{Prompt: "list files", Command: "ls", Intent: ai.IntentDisplay, Success: true},
+	} {
+		if err := history.Save(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	answer := filepath.Join(t.TempDir(), "answer")
+	if err := os.WriteFile(answer, []byte("y\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	in, err := os.Open(answer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	origStdin := os.Stdin
+	os.Stdin = in
+	defer func() { os.Stdin = origStdin }()
+
+	origClient, origRun := newClient, runCommand
+	defer func() { newClient, runCommand = origClient, origRun }()
+	newClient = func(*config.Config) *ai.Client {
+		return ai.NewClientWithProvider(&fixedProvider{response: "rmdir foo"})
+	}
+	var ran []string
+	runCommand = func(command string, _ executor.Options) (string, error) {
+		ran = append(ran, command)
+		return "", nil
+	}
+
+	undoCmd.SetContext(context.Background())
+	if err := undoCmd.RunE(undoCmd, nil); err != nil {
+		t.Fatalf("undo failed: %v", err)
+	}
+	if len(ran) != 1 || ran[0] != "rmdir foo" {
+		t.Fatalf("expected the inverse to run once, got %v", ran)
+	}
+
+	entries, _ := history.Load(1)
+	if len(entries) != 1 || entries[0].Prompt != "make a foo folder (undo)" || entries[0].Command != "rmdir foo" || !entries[0].Success {
+		t.Errorf("expected the undo recorded in history, got %+v", entries)
+	}
+}
+
+func TestUndo_NothingToUndo(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	if err := history.Save(history.Entry{Prompt: "list files", Command: "ls", Intent: ai.IntentDisplay, Success: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	origClient, origRun := newClient, runCommand
+	defer func() { newClient, runCommand = origClient, origRun }()
+	newClient = func(*config.Config) *ai.Client {
+		t.Error("the AI shouldn't be asked when there's nothing to undo")
+		return ai.NewClientWithProvider(&fixedProvider{})
+	}
+	runCommand = func(command string, _ executor.Options) (string, error) {
+		t.Errorf("nothing should run, got %q", command)
+		return "", nil
+	}
+
+	undoCmd.SetContext(context.Background())
+	if err := undoCmd.RunE(undoCmd, nil); err != nil {
+		t.Fatalf("undo failed: %v", err)
+	}
+}
+
+func TestUndo_RunsInTheOriginalDirectory(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	if err := history.Save(history.Entry{Prompt: "make a foo folder", Command: "mkdir foo", Dir: dir, Intent: ai.IntentExecute, Success: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	answer := filepath.Join(t.TempDir(), "answer")
+	if err := os.WriteFile(answer, []byte("y\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	in, err := os.Open(answer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	origStdin := os.Stdin
+	os.Stdin = in
+	defer func() { os.Stdin = origStdin }()
+
+	origClient, origRun := newClient, runCommand
+	defer func() { newClient, runCommand = origClient, origRun }()
+	newClient = func(*config.Config) *ai.Client {
+		return ai.NewClientWithProvider(&fixedProvider{response: "rmdir foo"})
+	}
+	var ranIn []string
+	runCommand = func(_ string, opts executor.Options) (string, error) {
+		ranIn = append(ranIn, opts.Dir)
+		return "", nil
+	}
+
+	undoCmd.SetContext(context.Background())
+	if err := undoCmd.RunE(undoCmd, nil); err != nil {
+		t.Fatalf("undo failed: %v", err)
+	}
+	if len(ranIn) != 1 || ranIn[0] != dir {
+		t.Fatalf("expected the inverse to run in %s, got %v", dir, ranIn)
+	}
+
+	// Once that directory is gone there's nowhere safe to run the inverse.
+	if err := history.Save(history.Entry{Prompt: "make a bar folder", Command: "mkdir bar", Dir: filepath.Join(dir, "gone"), Intent: ai.IntentExecute, Success: true}); err != nil {
+		t.Fatal(err)
+	}
+	ranIn = nil
+	if err := undoCmd.RunE(undoCmd, nil); err == nil || len(ranIn) != 0 {
+		t.Errorf("expected undo to refuse a directory that no longer exists, got %v (ran %v)", err, ranIn)
+	}
+}
@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/arin/xx-cli/internal/config"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var uninstallPurge bool
+
+var uninstallCmd = &cobra.Command{
+	Use:   "uninstall",
+	Short: "Remove the shell wrapper (and optionally all xx data)",
+	Long: `Remove the xx shell wrapper block from your rc file.
+
+Only the block between the "# >>> xx-cli wrapper >>>" markers is removed;
+the rest of your rc file is left untouched. Hand-written eval lines from
+before the markers existed have to be removed manually.
+
+Use --purge to also delete ~/.xx-cli (config, history, stats, learned
+corrections, and the vector index). You'll be asked to confirm first.
+
+Examples:
+  xx uninstall
+  xx uninstall --purge`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		green := color.New(color.FgGreen)
+		yellow := color.New(color.FgYellow)
+		dim := color.New(color.FgHiBlack)
+
+		fmt.Fprintln(os.Stderr)
+
+		shell := detectDoctorShell()
+		rcFile, removed, err := removeShellWrapper(shell)
+		switch {
+		case err != nil:
+			return fmt.Errorf("failed to remove shell wrapper: %w", err)
+		case removed:
+			green.Fprintf(os.Stderr, "  ✓ Removed shell wrapper from %s\n", rcFile)
+		case rcFile != "":
+			dim.Fprintf(os.Stderr, "  No wrapper block found in %s\n", rcFile)
+		default:
+			dim.Fprintf(os.Stderr, "  Unknown shell %q — nothing to remove\n", shell)
+		}
+
+		if uninstallPurge {
+			dir := config.Dir()
+			yellow.Fprintf(os.Stderr, "  Delete %s and all xx data? [y/N] ", dir)
+			var response string
+			fmt.Scanln(&response)
+			response = strings.TrimSpace(strings.ToLower(response))
+			if response != "y" && response != "yes" {
+				fmt.Fprintln(os.Stderr, "  Kept your data.")
+			} else {
+				if err := os.RemoveAll(dir); err != nil {
+					return fmt.Errorf("failed to delete %s: %w", dir, err)
+				}
+				green.Fprintf(os.Stderr, "  ✓ Deleted %s\n", dir)
+			}
+		}
+
+		if exe, err := os.Executable(); err == nil {
+			dim.Fprintf(os.Stderr, "\n  To remove the binary: rm %s\n", exe)
+		}
+		fmt.Fprintln(os.Stderr)
+		return nil
+	},
+}
+
+func init() {
+	uninstallCmd.Flags().BoolVar(&uninstallPurge, "purge", false, "Also delete ~/.xx-cli (config, history, stats, index)")
+}
+
+// removeWrapperBlock strips the marker-fenced wrapper block from rc,
+// leaving everything around it intact. If the block sat at the end of the
+// file behind a blank separator line (as upsertWrapperBlock writes it), the
+// separator goes too. Returns false if there was no block.
+func removeWrapperBlock(rc string) (string, bool) {
+	start, end, ok := findWrapperBlock(rc)
+	if !ok {
+		return rc, false
+	}
+	before, after := rc[:start], rc[end:]
+	if after == "" && strings.HasSuffix(before, "\n\n") {
+		before = before[:len(before)-1]
+	}
+	return before + after, true
+}
+
+// removeShellWrapper removes the wrapper block from the rc file for shell.
+// Returns the rc file path (empty for unknown shells) and whether a block
+// was actually removed. A missing rc file is not an error.
+func removeShellWrapper(shell string) (string, bool, error) {
+	rcFile := shellRCFile(shell)
+	if rcFile == "" {
+		return "", false, nil
+	}
+
+	data, err := os.ReadFile(rcFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return rcFile, false, nil
+		}
+		return rcFile, false, err
+	}
+
+	updated, removed := removeWrapperBlock(string(data))
+	if !removed {
+		return rcFile, false, nil
+	}
+	return rcFile, true, os.WriteFile(rcFile, []byte(updated), 0o644)
+}
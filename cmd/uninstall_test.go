@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRemoveWrapperBlock_PreservesSurroundingContent(t *testing.T) {
+	rc := "export PATH=\"$HOME/go/bin:$PATH\"\n" +
+		rcBlock("zsh") +
+		"alias ll='ls -la'\n"
+
+	got, removed := removeWrapperBlock(rc)
+	if !removed {
+		t.Fatal("expected block to be removed")
+	}
+	want := "export PATH=\"$HOME/go/bin:$PATH\"\nalias ll='ls -la'\n"
+	if got != want {
+		t.Errorf("surrounding content not preserved:\nwant %q\ngot  %q", want, got)
+	}
+}
+
+func TestRemoveWrapperBlock_ReversesUpsert(t *testing.T) {
+	rc := "alias ll='ls -la'\n"
+	installed := upsertWrapperBlock(rc, rcBlock("bash"))
+
+	got, removed := removeWrapperBlock(installed)
+	if !removed {
+		t.Fatal("expected block to be removed")
+	}
+	if got != rc {
+		t.Errorf("uninstall should restore the original rc:\nwant %q\ngot  %q", rc, got)
+	}
+}
+
+func TestRemoveWrapperBlock_NoBlock(t *testing.T) {
+	rc := "eval \"$(xx init zsh)\"\n"
+	got, removed := removeWrapperBlock(rc)
+	if removed {
+		t.Error("should not report removal without markers")
+	}
+	if got != rc {
+		t.Errorf("rc should be unchanged, got %q", got)
+	}
+}
+
+func TestRemoveShellWrapper_File(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	rcFile := filepath.Join(home, ".bashrc")
+	os.WriteFile(rcFile, []byte("# my bashrc\n"+rcBlock("bash")+"export EDITOR=vim\n"), 0o644)
+
+	path, removed, err := removeShellWrapper("bash")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !removed || path != rcFile {
+		t.Errorf("expected removal from %s, got removed=%v path=%s", rcFile, removed, path)
+	}
+	data, _ := os.ReadFile(rcFile)
+	if string(data) != "# my bashrc\nexport EDITOR=vim\n" {
+		t.Errorf("unexpected rc after uninstall: %q", data)
+	}
+}
+
+func TestRemoveShellWrapper_MissingFile(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	if _, removed, err := removeShellWrapper("zsh"); err != nil || removed {
+		t.Errorf("missing rc should be a no-op, got removed=%v err=%v", removed, err)
+	}
+}
@@ -9,7 +9,6 @@ import (
 	"syscall"
 	"time"
 
-	"github.com/arin/xx-cli/internal/ai"
 	"github.com/arin/xx-cli/internal/config"
 	"github.com/arin/xx-cli/internal/executor"
 	"github.com/arin/xx-cli/internal/ui"
@@ -36,7 +35,7 @@ Examples:
 		}
 
 		prompt := strings.Join(args, " ")
-		client := ai.NewClient(cfg)
+		client := newClient(cfg)
 		cyan := color.New(color.FgCyan, color.Bold)
 		dim := color.New(color.FgHiBlack)
 		yellow := color.New(color.FgYellow, color.Bold)
@@ -51,6 +50,16 @@ Examples:
 			return fmt.Errorf("failed to translate: %w", err)
 		}
 
+		if suggestOnly(cfg) {
+			cyan.Fprintf(os.Stderr, "\n  → %s\n", result.Command)
+			dim.Fprintf(os.Stderr, "  (safe mode: not watching — this command would run every %ds)\n\n", watchInterval)
+			return nil
+		}
+
+		if err := checkPolicy(os.Stderr, result.Command); err != nil {
+			return err
+		}
+
 		cyan.Fprintf(os.Stderr, "\n  👁 Watching: %s\n", prompt)
 		dim.Fprintf(os.Stderr, "  Command: %s\n", result.Command)
 		dim.Fprintf(os.Stderr, "  Interval: %ds (Ctrl+C to stop)\n\n", watchInterval)
@@ -66,7 +75,7 @@ Examples:
 
 		// Run immediately, then on each tick.
 		runWatch := func() {
-			raw, _ := executor.Run(result.Command)
+			raw, _ := executor.RunWithOptions(result.Command, executor.Options{MaxOutput: cfg.MaxOutput(), Timeout: cfg.ExecTimeout()})
 			output := filterWatchNoise(raw, result.Command)
 			stable := normalizeForComparison(output)
 			now := time.Now().Format("15:04:05")
@@ -6,7 +6,6 @@ import (
 	"os"
 	"strings"
 
-	"github.com/arin/xx-cli/internal/ai"
 	"github.com/arin/xx-cli/internal/config"
 	"github.com/arin/xx-cli/internal/ui"
 	"github.com/fatih/color"
@@ -48,7 +47,7 @@ Examples:
 			errorMsg = errorMsg[:4000] + "\n... (truncated)"
 		}
 
-		client := ai.NewClient(cfg)
+		client := newClient(cfg)
 
 		red := color.New(color.FgRed, color.Bold)
 		red.Fprintf(os.Stderr, "\n  🔍 Diagnosis\n\n")
@@ -0,0 +1,226 @@
+// Package ai — analyze.go implements the agentic analyze loop. Plain
+// Analyze only sees the first 4000 chars of piped data; in agentic mode the
+// full data is saved to a temp file and the model may ask xx to run a few
+// read-only commands against it (grep -c, tail, awk...) before answering.
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultAnalyzeIterations bounds how many follow-up commands the model may
+// request before it has to answer. Each iteration is a full model round-trip.
+const DefaultAnalyzeIterations = 3
+
+// CommandRunner executes a follow-up command requested during agentic
+// analysis and returns its combined output. The command is already split
+// into argv and checked by analyzeArgs; it must be run without a shell.
+type CommandRunner func(argv []string) (string, error)
+
+// analyzeReply is one model turn in the agentic loop: either a command to
+// run against the data file, or the final answer.
+type analyzeReply struct {
+	Command string `json:"command"`
+	Answer  string `json:"answer"`
+}
+
+// AnalyzeAgentic answers a question about piped data, letting the model run
+// up to maxIterations follow-up commands against dataPath (the full data on
+// disk) via run. The loop is:
+//
+//	model → {"command": "grep -c ERROR <file>"} → xx runs it → output fed back
+//	model → {"answer": "..."}                   → done
+//
+// The model's choice of command is steered by the data, which may be
+// hostile, so commands are only run if analyzeArgs accepts them: a single
+// read-only program reading dataPath, with no shell syntax. Anything else is
+// refused and the refusal is fed back. When the iteration budget runs out,
+// the model is told to answer with what it has.
+func (c *Client) AnalyzeAgentic(ctx context.Context, question, data, dataPath string, run CommandRunner, maxIterations int) (string, error) {
+	if maxIterations <= 0 {
+		maxIterations = DefaultAnalyzeIterations
+	}
+
+	messages := []Message{
+		{Role: "system", Content: buildAnalyzeAgentPrompt(dataPath)},
+		{Role: "user", Content: fmt.Sprintf("Question: %s\n\nData (first 4000 chars):\n%s", question, untrusted(truncate(data, 4000)))},
+	}
+
+	for i := 0; i <= maxIterations; i++ {
+		if i == maxIterations {
+			messages = append(messages, Message{Role: "user", Content: "No more commands are allowed. Reply with your final answer now."})
+		}
+
+		raw, err := c.complete(ctx, messages, CompleteOptions{JSONMode: true})
+		if err != nil {
+			return "", err
+		}
+
+		var reply analyzeReply
+		if err := unmarshalLenient(raw, &reply); err != nil {
+			return "", fmt.Errorf("failed to parse AI output: %w\nRaw: %s", err, raw)
+		}
+		if reply.Answer != "" {
+			return strings.TrimSpace(reply.Answer), nil
+		}
+		if reply.Command == "" || i == maxIterations {
+			break
+		}
+
+		messages = append(messages, Message{Role: "assistant", Content: raw})
+
+		var feedback string
+		if argv, err := analyzeArgs(reply.Command, dataPath); err != nil {
+			feedback = fmt.Sprintf("Refused: %v.", err)
+		} else {
+			output, runErr := run(argv)
+			if runErr != nil {
+				feedback = fmt.Sprintf("Command `%s` failed: %v\nOutput:\n%s", reply.Command, runErr, commandOutput(output, 2000))
+			} else {
+				feedback = fmt.Sprintf("Output of `%s`:\n%s", reply.Command, commandOutput(output, 2000))
+			}
+		}
+		messages = append(messages, Message{Role: "user", Content: feedback})
+	}
+
+	return "", fmt.Errorf("AI did not produce an answer")
+}
+
+func buildAnalyzeAgentPrompt(dataPath string) string {
+	return fmt.Sprintf(`You are a helpful assistant that analyzes data and answers questions about it.
+
+The user's full data is saved at: %s
+You are only shown the first 4000 characters. If you need to look at more of it, you may ask to run a single read-only command against that file, e.g. "grep -c ERROR %s" or "tail -n 50 %s".
+
+Reply with JSON only, in one of these forms:
+  {"command": "a single grep, wc, head, tail, awk, sort, uniq or cut command that reads %s"}
+  {"answer": "your final answer"}
+
+Rules:
+- Only request a command if the visible data is not enough to answer.
+- Commands run without a shell: no pipes, redirects, variables or ; & $ `+"`"+` > < characters.
+- Commands must read only the data file and must not modify anything.
+- The final answer should be concise and direct. Don't repeat the input data back. Use plain language.`+dataRule,
+		dataPath, dataPath, dataPath, dataPath)
+}
+
+// analyzePrograms are the read-only programs a follow-up command may run.
+var analyzePrograms = map[string]bool{
+	"grep": true, "wc": true, "head": true, "tail": true,
+	"awk": true, "sort": true, "uniq": true, "cut": true,
+}
+
+// analyzeMetachars may not appear anywhere in a follow-up command. It never
+// reaches a shell, but a command that needs them isn't a plain read.
+const analyzeMetachars = ";|&$`><\n\r"
+
+// analyzeArgs splits a follow-up command requested by the model into argv
+// and checks it's safe to run without asking: an allowlisted program, no
+// shell metacharacters, dataPath as an argument, no other file read, and
+// none of the flags that let those programs write files or run commands.
+func analyzeArgs(command, dataPath string) ([]string, error) {
+	if strings.ContainsAny(command, analyzeMetachars) {
+		return nil, errors.New("commands run without a shell, so pipes, redirects, variables and command separators aren't allowed")
+	}
+	argv, err := splitArgs(command)
+	if err != nil {
+		return nil, err
+	}
+	if len(argv) == 0 {
+		return nil, errors.New("empty command")
+	}
+	name, args := argv[0], argv[1:]
+	if !analyzePrograms[name] {
+		return nil, fmt.Errorf("%s isn't allowed; use grep, wc, head, tail, awk, sort, uniq or cut", name)
+	}
+
+	readsData := false
+	for i, arg := range args {
+		if arg == dataPath {
+			readsData = true
+			if name == "uniq" && i < len(args)-1 {
+				return nil, errors.New("uniq may not write an output file")
+			}
+			continue
+		}
+		if err := checkAnalyzeArg(name, arg); err != nil {
+			return nil, err
+		}
+	}
+	if !readsData {
+		return nil, fmt.Errorf("commands must read the data file %s", dataPath)
+	}
+	return argv, nil
+}
+
+// checkAnalyzeArg rejects an argument, other than the data file, that reads
+// another file or makes program write, run something or never finish.
+func checkAnalyzeArg(program, arg string) error {
+	short := strings.HasPrefix(arg, "-") && !strings.HasPrefix(arg, "--")
+	switch {
+	case program == "sort" && (strings.HasPrefix(arg, "--output") || strings.HasPrefix(arg, "--compress-program") || short && strings.Contains(arg, "o")):
+		return errors.New("sort may not write an output file or run a compressor")
+	case program == "tail" && (strings.HasPrefix(arg, "--follow") || short && strings.ContainsAny(arg, "fF")):
+		return errors.New("tail may not follow the file")
+	case program == "awk" && (strings.Contains(arg, "system") || strings.Contains(arg, "getline") || strings.Contains(arg, "@")):
+		return errors.New("awk programs may not run commands or read other input")
+	}
+
+	value := arg
+	if strings.HasPrefix(arg, "-") {
+		_, v, ok := strings.Cut(arg, "=")
+		if !ok {
+			return nil
+		}
+		value = v
+	}
+	if filepath.IsAbs(value) || strings.HasPrefix(value, "~") || strings.Contains(value, "..") {
+		return fmt.Errorf("commands may only read the data file, not %s", value)
+	}
+	if _, err := os.Stat(value); err == nil {
+		return fmt.Errorf("commands may only read the data file, not %s", value)
+	}
+	return nil
+}
+
+// splitArgs splits a command line into words on whitespace, honoring
+// single and double quotes the way a shell would for plain words.
+func splitArgs(command string) ([]string, error) {
+	var args []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	for _, r := range command {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t':
+			if inWord {
+				args = append(args, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, errors.New("unterminated quote")
+	}
+	if inWord {
+		args = append(args, word.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,91 @@
+package ai
+
+import (
+	"strings"
+
+	"github.com/arin/xx-cli/internal/config"
+)
+
+// MaxChatHistory caps how many history messages a chat request carries,
+// however short they are.
+const MaxChatHistory = 20
+
+// DefaultContextWindow is the context size, in tokens, assumed for models
+// we know nothing about. It's also what Ollama gives every model unless
+// num_ctx says otherwise, whatever the model itself supports.
+const DefaultContextWindow = 4096
+
+// hostedContextWindows maps model name prefixes on OpenAI and Groq to the
+// model's context window, in tokens. More specific prefixes come first.
+var hostedContextWindows = []struct {
+	prefix string
+	tokens int
+}{
+	{"gpt-3.5", 16385},
+	{"gpt-4o", 128000},
+	{"gpt-4.1", 128000},
+	{"gpt-4-turbo", 128000},
+	{"gpt-4", 8192},
+	{"o1", 128000},
+	{"o3", 128000},
+	{"o4", 128000},
+	{"llama-3.1", 128000},
+	{"llama-3.3", 128000},
+	{"mixtral", 32768},
+	{"gemma", 8192},
+}
+
+// contextWindow returns the context size, in tokens, of the model cfg
+// selects.
+func contextWindow(cfg *config.Config) int {
+	if cfg.ActiveProvider() == config.ProviderOllama {
+		return DefaultContextWindow
+	}
+	model := strings.ToLower(cfg.Model)
+	for _, w := range hostedContextWindows {
+		if strings.HasPrefix(model, w.prefix) {
+			return w.tokens
+		}
+	}
+	return DefaultContextWindow
+}
+
+// estimateTokens approximates how many tokens s takes, at about four
+// characters a token for English text and code.
+func estimateTokens(s string) int {
+	return (len(s) + 3) / 4
+}
+
+// chatMessages builds the messages for a chat: the system prompt, then as
+// much of the most recent history as fits in the model's context window
+// next to it and a chatAnswer-sized reply.
+func (c *Client) chatMessages(system string, history []ChatMessage) []Message {
+	window := c.contextWindow
+	if window == 0 {
+		window = DefaultContextWindow
+	}
+	budget := window - estimateTokens(system) - chatAnswer.MaxTokens
+
+	messages := []Message{{Role: "system", Content: system}}
+	for _, m := range trimHistory(history, budget) {
+		messages = append(messages, Message{Role: m.Role, Content: m.Content})
+	}
+	return messages
+}
+
+// trimHistory returns the most recent messages of history whose estimated
+// tokens add up to at most budget, and no more than MaxChatHistory of them.
+// The newest message is always kept, however long, so the model at least
+// sees what it's answering.
+func trimHistory(history []ChatMessage, budget int) []ChatMessage {
+	start, used := len(history), 0
+	for start > 0 && len(history)-start < MaxChatHistory {
+		cost := estimateTokens(history[start-1].Content)
+		if used+cost > budget && start < len(history) {
+			break
+		}
+		used += cost
+		start--
+	}
+	return history[start:]
+}
@@ -0,0 +1,54 @@
+// Package ai — clarify.go handles prompts the model couldn't translate.
+// Instead of failing outright, xx asks the model to either rewrite the
+// request as a clearer instruction or pose one clarifying question.
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrUnclearPrompt is returned by Translate when the model produced no
+// usable command. Callers can match it with errors.Is and fall back to Clarify.
+var ErrUnclearPrompt = errors.New("AI returned an empty command")
+
+// Clarification is the model's take on an unclear prompt. Exactly one of
+// Rephrased or Question is set.
+type Clarification struct {
+	Rephrased string `json:"rephrased"` // A clearer version of the request.
+	Question  string `json:"question"`  // A question to ask the user instead.
+}
+
+// Clarify asks the model to make sense of a prompt that Translate failed
+// on. It returns either a rephrased request ("Did you mean: ...?") or a
+// clarifying question for the user.
+func (c *Client) Clarify(ctx context.Context, prompt string) (*Clarification, error) {
+	messages := []Message{
+		{Role: "system", Content: `You help a terminal assistant understand requests it could not turn into a shell command.
+If you can guess what the user meant, rewrite it as a clear, specific request for a single shell task: {"rephrased": "the clearer request"}
+If the request is too ambiguous to guess, ask ONE short clarifying question: {"question": "your question"}
+Return valid JSON only. No extra text.`},
+		{Role: "user", Content: prompt},
+	}
+	raw, err := c.complete(ctx, messages, CompleteOptions{JSONMode: true})
+	if err != nil {
+		return nil, err
+	}
+
+	var cl Clarification
+	if err := json.Unmarshal([]byte(raw), &cl); err != nil {
+		return nil, fmt.Errorf("failed to parse clarification: %w", err)
+	}
+	cl.Rephrased = strings.TrimSpace(cl.Rephrased)
+	cl.Question = strings.TrimSpace(cl.Question)
+	if cl.Rephrased != "" {
+		cl.Question = ""
+	}
+	if cl.Rephrased == "" && cl.Question == "" {
+		return nil, fmt.Errorf("AI could not clarify the request")
+	}
+	return &cl, nil
+}
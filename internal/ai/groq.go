@@ -0,0 +1,19 @@
+package ai
+
+const (
+	defaultGroqURL   = "https://api.groq.com/openai/v1"
+	defaultGroqModel = "llama-3.1-8b-instant"
+)
+
+// GroqProvider implements Provider, StreamingProvider and ModelLister for
+// Groq's OpenAI-compatible chat API.
+type GroqProvider struct {
+	chatCompletions
+}
+
+// NewGroqProvider creates a provider that talks to Groq with apiKey. Groq
+// doesn't host Ollama's "name:tag" models, so such a model (including
+// xx's default) is replaced with a Groq default.
+func NewGroqProvider(apiKey, model string) *GroqProvider {
+	return &GroqProvider{newChatCompletions("Groq", defaultGroqURL, apiKey, model, defaultGroqModel)}
+}
@@ -0,0 +1,121 @@
+package ai
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestGroqComplete_Success(t *testing.T) {
+	f := newFakeChatAPI(t)
+	f.reply = []string{`  {"command": "df -h"}  `}
+
+	got, err := f.groq("gsk_test").Complete(context.Background(), []Message{{Role: "user", Content: "disk"}}, CompleteOptions{JSONMode: true, MaxTokens: 100})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != `{"command": "df -h"}` {
+		t.Errorf("expected trimmed reply, got %q", got)
+	}
+	if f.auth != "Bearer gsk_test" {
+		t.Errorf("expected bearer auth, got %q", f.auth)
+	}
+	req := f.lastReq
+	if req.Model != "llama-3.3-70b-versatile" || req.Stream || req.MaxTokens != 100 {
+		t.Errorf("unexpected request: %+v", req)
+	}
+	if req.ResponseFormat == nil || req.ResponseFormat.Type != "json_object" {
+		t.Errorf("JSONMode should map to response_format json_object, got %+v", req.ResponseFormat)
+	}
+	if len(req.Messages) != 1 || req.Messages[0].Content != "disk" {
+		t.Errorf("messages not forwarded: %+v", req.Messages)
+	}
+}
+
+func TestGroqComplete_NoResponseFormatWithoutJSONMode(t *testing.T) {
+	f := newFakeChatAPI(t)
+	f.reply = []string{"hello"}
+
+	if _, err := f.groq("gsk_test").Complete(context.Background(), []Message{{Role: "user", Content: "hi"}}, CompleteOptions{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if f.lastReq.ResponseFormat != nil {
+		t.Errorf("response_format should be unset, got %+v", f.lastReq.ResponseFormat)
+	}
+}
+
+func TestGroqComplete_InvalidKey(t *testing.T) {
+	f := newFakeChatAPI(t)
+	f.status = http.StatusUnauthorized
+	f.body = `{"error":{"message":"Invalid API Key","type":"invalid_request_error","code":"invalid_api_key"}}`
+
+	_, err := f.groq("gsk_wrong").Complete(context.Background(), []Message{{Role: "user", Content: "hi"}}, CompleteOptions{})
+	if err == nil || !strings.Contains(err.Error(), "rejected the API key") || !strings.Contains(err.Error(), "xx config set-key") {
+		t.Errorf("expected a clear invalid-key error, got %v", err)
+	}
+	if strings.Contains(err.Error(), "{") {
+		t.Errorf("error shouldn't dump the raw response body: %v", err)
+	}
+}
+
+func TestGroqComplete_MissingKey(t *testing.T) {
+	f := newFakeChatAPI(t)
+
+	_, err := f.groq("  ").Complete(context.Background(), []Message{{Role: "user", Content: "hi"}}, CompleteOptions{})
+	if err == nil || !strings.Contains(err.Error(), "no Groq API key set") {
+		t.Errorf("expected a missing-key error, got %v", err)
+	}
+}
+
+func TestGroqComplete_APIError(t *testing.T) {
+	f := newFakeChatAPI(t)
+	f.status = http.StatusBadRequest
+	f.body = `{"error":{"message":"messages must not be empty"}}`
+
+	_, err := f.groq("gsk_test").Complete(context.Background(), []Message{{Role: "user", Content: "hi"}}, CompleteOptions{})
+	if err == nil || !strings.Contains(err.Error(), "status 400") || !strings.Contains(err.Error(), "messages must not be empty") {
+		t.Errorf("expected the API's error message, got %v", err)
+	}
+}
+
+func TestGroqCompleteStream(t *testing.T) {
+	f := newFakeChatAPI(t)
+	f.reply = []string{"Hello", ", ", "world"}
+
+	got, err := collectStream(f.groq("gsk_test").CompleteStream(context.Background(), []Message{{Role: "user", Content: "hi"}}, CompleteOptions{}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "Hello, world" {
+		t.Errorf("expected streamed reply, got %q", got)
+	}
+	if !f.lastReq.Stream {
+		t.Error("request should have stream enabled")
+	}
+}
+
+func TestGroqCompleteStreamJSON(t *testing.T) {
+	f := newFakeChatAPI(t)
+	f.reply = []string{`{"command": `, `"ls"}`}
+
+	got, err := collectStream(f.groq("gsk_test").CompleteStreamJSON(context.Background(), []Message{{Role: "user", Content: "list"}}, CompleteOptions{}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != `{"command": "ls"}` {
+		t.Errorf("unexpected reply %q", got)
+	}
+	if !f.lastReq.Stream || f.lastReq.ResponseFormat == nil || f.lastReq.ResponseFormat.Type != "json_object" {
+		t.Errorf("expected a streaming JSON-mode request, got %+v", f.lastReq)
+	}
+}
+
+func TestNewGroqProvider_ReplacesOllamaModels(t *testing.T) {
+	if p := NewGroqProvider("gsk_test", "llama3.2:latest"); p.model != defaultGroqModel {
+		t.Errorf("Ollama-style model should fall back to %s, got %s", defaultGroqModel, p.model)
+	}
+	if p := NewGroqProvider("gsk_test", "mixtral-8x7b-32768"); p.model != "mixtral-8x7b-32768" {
+		t.Errorf("Groq model should be kept, got %s", p.model)
+	}
+}
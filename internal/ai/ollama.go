@@ -5,176 +5,362 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
 const (
-	defaultOllamaURL = "http://localhost:11434/api/chat"
-	defaultTimeout   = 60 * time.Second
+	defaultOllamaURL     = "http://localhost:11434/api/chat"
+	defaultTimeout       = 60 * time.Second
+	defaultStreamRetries = 2 // Reconnects allowed per CompleteStream call.
+	defaultTemperature   = 0.1
 )
 
 // OllamaProvider implements Provider for the Ollama local API.
 type OllamaProvider struct {
-	model      string
-	apiURL     string
-	httpClient *http.Client
+	model         string
+	apiURL        string
+	httpClient    *http.Client
+	streamClient  *http.Client
+	streamRetries int         // How many times CompleteStream reconnects after a drop.
+	noSchema      atomic.Bool // The server rejected a JSON schema format; send "json" instead.
 }
 
 // NewOllamaProvider creates a provider that talks to a local Ollama instance.
 func NewOllamaProvider(model string) *OllamaProvider {
-	return &OllamaProvider{
-		model:      model,
-		apiURL:     defaultOllamaURL,
-		httpClient: &http.Client{Timeout: defaultTimeout},
+	o := &OllamaProvider{
+		model:         model,
+		apiURL:        defaultOllamaURL,
+		streamRetries: defaultStreamRetries,
 	}
+	o.SetTimeout(defaultTimeout)
+	return o
+}
+
+// SetTimeout replaces the default 60-second per-request timeout; 0 means
+// no timeout. Streams are only timed until the response starts.
+func (o *OllamaProvider) SetTimeout(d time.Duration) {
+	o.httpClient, o.streamClient = newHTTPClients(d)
+}
+
+// newHTTPClients returns the clients a provider uses for timeout, which is
+// 0 for none: one bounding whole requests, and one for streams bounding
+// only the wait for response headers, since a stream legitimately lasts
+// as long as the model keeps talking. Its cancellation is the context's.
+func newHTTPClients(timeout time.Duration) (request, stream *http.Client) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = timeout
+	return &http.Client{Timeout: timeout}, &http.Client{Transport: transport}
 }
 
 // Complete sends messages to Ollama and returns the response text.
-func (o *OllamaProvider) Complete(ctx context.Context, messages []Message, jsonMode bool) (string, error) {
-	// Convert provider-agnostic messages to Ollama format.
-	ollamaMsgs := make([]ollamaMessage, len(messages))
-	for i, m := range messages {
-		ollamaMsgs[i] = ollamaMessage{Role: m.Role, Content: m.Content}
-	}
+func (o *OllamaProvider) Complete(ctx context.Context, messages []Message, opts CompleteOptions) (string, error) {
+	text, _, err := o.CompleteWithUsage(ctx, messages, opts)
+	return text, err
+}
 
-	reqBody := ollamaRequest{
-		Model:    o.model,
-		Messages: ollamaMsgs,
-		Stream:   false,
-		Options:  ollamaOptions{Temperature: 0.1},
-	}
-	if jsonMode {
-		reqBody.Format = "json"
+// CompleteWithUsage is Complete that also returns Ollama's token counts.
+// This implements the UsageProvider interface.
+func (o *OllamaProvider) CompleteWithUsage(ctx context.Context, messages []Message, opts CompleteOptions) (string, *Usage, error) {
+	text, usage, err := o.completeOnce(ctx, messages, opts)
+	if errors.Is(err, errSchemaRejected) {
+		o.noSchema.Store(true)
+		text, usage, err = o.completeOnce(ctx, messages, opts)
 	}
+	return text, usage, err
+}
+
+// errSchemaRejected marks a 400 response to a request whose format was a
+// JSON schema, which Ollama servers older than 0.5 send since they only
+// understand "json". The request is then retried with "json".
+var errSchemaRejected = errors.New("JSON schema format not supported")
+
+// completeOnce makes one non-streaming request.
+func (o *OllamaProvider) completeOnce(ctx context.Context, messages []Message, opts CompleteOptions) (string, *Usage, error) {
+	reqBody := o.newRequest(messages, false, opts)
 
 	body, err := json.Marshal(reqBody)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %w", err)
+		return "", nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.apiURL, bytes.NewReader(body))
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return "", nil, fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := o.httpClient.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("could not reach Ollama at %s — is it running? (start with: ollama serve)", o.apiURL)
+		return "", nil, fmt.Errorf("could not reach Ollama at %s — is it running? (start with: ollama serve)", o.apiURL)
 	}
 	defer resp.Body.Close()
 
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("failed to read response: %w", err)
+		return "", nil, fmt.Errorf("failed to read response: %w", err)
 	}
 
 	if resp.StatusCode != http.StatusOK {
 		errMsg := string(respBody)
+		if resp.StatusCode == http.StatusBadRequest && o.useSchema(opts) {
+			return "", nil, fmt.Errorf("%w: %s", errSchemaRejected, errMsg)
+		}
 		if strings.Contains(errMsg, "model") && strings.Contains(errMsg, "not found") {
-			return "", fmt.Errorf("model %q not found — run: ollama pull %s", o.model, o.model)
+			return "", nil, fmt.Errorf("model %q not found — run: ollama pull %s", o.model, o.model)
 		}
-		return "", fmt.Errorf("Ollama API error (status %d): %s", resp.StatusCode, errMsg)
+		return "", nil, fmt.Errorf("Ollama API error (status %d): %s", resp.StatusCode, errMsg)
 	}
 
 	var ollamaResp ollamaResponse
 	if err := json.Unmarshal(respBody, &ollamaResp); err != nil {
-		return "", fmt.Errorf("failed to parse response: %w", err)
+		return "", nil, fmt.Errorf("failed to parse response: %w", err)
 	}
 
-	return strings.TrimSpace(ollamaResp.Message.Content), nil
+	return strings.TrimSpace(ollamaResp.Message.Content), ollamaResp.usage(), nil
+}
+
+// newRequest builds the /api/chat request body for messages, mapping opts
+// onto Ollama's fields.
+func (o *OllamaProvider) newRequest(messages []Message, stream bool, opts CompleteOptions) ollamaRequest {
+	ollamaMsgs := make([]ollamaMessage, len(messages))
+	for i, m := range messages {
+		ollamaMsgs[i] = ollamaMessage{Role: m.Role, Content: m.Content}
+	}
+
+	req := ollamaRequest{
+		Model:     o.model,
+		Messages:  ollamaMsgs,
+		Stream:    stream,
+		KeepAlive: opts.KeepAlive,
+		Options: ollamaOptions{
+			Temperature: defaultTemperature,
+			NumPredict:  opts.MaxTokens,
+			Stop:        opts.Stop,
+		},
+	}
+	if opts.Temperature != nil {
+		req.Options.Temperature = *opts.Temperature
+	}
+	switch {
+	case o.useSchema(opts):
+		req.Format = opts.Schema
+	case opts.JSONMode || opts.Schema != nil:
+		req.Format = "json"
+	}
+	return req
+}
+
+// useSchema reports whether requests with opts send their JSON schema as
+// the format, rather than the plain "json" fallback.
+func (o *OllamaProvider) useSchema(opts CompleteOptions) bool {
+	return opts.Schema != nil && !o.noSchema.Load()
+}
+
+// ListModels returns the names of the locally installed models from
+// Ollama's /api/tags. This implements the ModelLister interface.
+func (o *OllamaProvider) ListModels(ctx context.Context) ([]string, error) {
+	tagsURL := strings.TrimSuffix(o.apiURL, "/api/chat") + "/api/tags"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, tagsURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := o.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not reach Ollama at %s — is it running? (start with: ollama serve)", tagsURL)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Ollama API error (status %d)", resp.StatusCode)
+	}
+
+	var tags ollamaTagsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tags); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	names := make([]string, len(tags.Models))
+	for i, m := range tags.Models {
+		names[i] = m.Name
+	}
+	return names, nil
 }
 
 // CompleteStream sends messages to Ollama with streaming enabled and returns
 // a channel that emits tokens as they arrive. The channel is closed when the
 // response is complete. This implements the StreamingProvider interface.
-func (o *OllamaProvider) CompleteStream(ctx context.Context, messages []Message) <-chan StreamDelta {
+//
+// If the connection drops mid-stream, it reconnects up to streamRetries
+// times, re-sending the conversation with the text received so far as an
+// assistant prefix so the model continues where it left off instead of
+// starting over. Tokens already emitted are never repeated.
+func (o *OllamaProvider) CompleteStream(ctx context.Context, messages []Message, opts CompleteOptions) <-chan StreamDelta {
+	return o.stream(ctx, messages, opts)
+}
+
+// CompleteStreamJSON is CompleteStream with Ollama's JSON format enabled.
+// This implements the JSONStreamingProvider interface.
+func (o *OllamaProvider) CompleteStreamJSON(ctx context.Context, messages []Message, opts CompleteOptions) <-chan StreamDelta {
+	opts.JSONMode = true
+	return o.stream(ctx, messages, opts)
+}
+
+// stream runs the reconnecting stream loop shared by CompleteStream and
+// CompleteStreamJSON.
+func (o *OllamaProvider) stream(ctx context.Context, messages []Message, opts CompleteOptions) <-chan StreamDelta {
 	ch := make(chan StreamDelta)
 
 	go func() {
 		defer close(ch)
 
-		ollamaMsgs := make([]ollamaMessage, len(messages))
-		for i, m := range messages {
-			ollamaMsgs[i] = ollamaMessage{Role: m.Role, Content: m.Content}
-		}
-
-		reqBody := ollamaRequest{
-			Model:    o.model,
-			Messages: ollamaMsgs,
-			Stream:   true,
-			Options:  ollamaOptions{Temperature: 0.1},
+		var received strings.Builder
+		emit := func(token string) {
+			received.WriteString(token)
+			ch <- StreamDelta{Token: token}
 		}
+		for attempt := 0; ; attempt++ {
+			msgs := messages
+			if received.Len() > 0 {
+				msgs = append(append([]Message(nil), messages...), Message{Role: "assistant", Content: received.String()})
+			}
 
-		body, err := json.Marshal(reqBody)
-		if err != nil {
-			ch <- StreamDelta{Err: fmt.Errorf("failed to marshal request: %w", err)}
+			usage, err := o.streamOnce(ctx, msgs, opts, emit)
+			if errors.Is(err, errSchemaRejected) {
+				o.noSchema.Store(true)
+				usage, err = o.streamOnce(ctx, msgs, opts, emit)
+			}
+			if err == nil {
+				ch <- StreamDelta{Done: true, Usage: usage}
+				return
+			}
+			if errors.Is(err, errStreamDropped) && attempt < o.streamRetries && ctx.Err() == nil {
+				continue
+			}
+			ch <- StreamDelta{Err: err}
 			return
 		}
+	}()
 
-		// Use a client without timeout — streaming can take a while and
-		// the context handles cancellation.
-		streamClient := &http.Client{}
-		req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.apiURL, bytes.NewReader(body))
-		if err != nil {
-			ch <- StreamDelta{Err: fmt.Errorf("failed to create request: %w", err)}
-			return
-		}
-		req.Header.Set("Content-Type", "application/json")
+	return ch
+}
 
-		resp, err := streamClient.Do(req)
-		if err != nil {
-			ch <- StreamDelta{Err: fmt.Errorf("could not reach Ollama at %s — is it running? (start with: ollama serve)", o.apiURL)}
-			return
+// errStreamDropped marks a stream that ended before Ollama sent done:true —
+// the only failure CompleteStream reconnects on.
+var errStreamDropped = errors.New("stream ended before completion")
+
+// streamOnce makes one streaming request, passing each token to emit. It
+// returns the usage from the final chunk once Ollama reports done, or an
+// error wrapping errStreamDropped if the connection ends first.
+func (o *OllamaProvider) streamOnce(ctx context.Context, messages []Message, opts CompleteOptions, emit func(string)) (*Usage, error) {
+	reqBody := o.newRequest(messages, true, opts)
+
+	body, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.apiURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := o.streamClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not reach Ollama at %s — is it running? (start with: ollama serve)", o.apiURL)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		errMsg := string(respBody)
+		if resp.StatusCode == http.StatusBadRequest && o.useSchema(opts) {
+			return nil, fmt.Errorf("%w: %s", errSchemaRejected, errMsg)
 		}
-		defer resp.Body.Close()
-
-		if resp.StatusCode != http.StatusOK {
-			respBody, _ := io.ReadAll(resp.Body)
-			errMsg := string(respBody)
-			if strings.Contains(errMsg, "model") && strings.Contains(errMsg, "not found") {
-				ch <- StreamDelta{Err: fmt.Errorf("model %q not found — run: ollama pull %s", o.model, o.model)}
-			} else {
-				ch <- StreamDelta{Err: fmt.Errorf("Ollama API error (status %d): %s", resp.StatusCode, errMsg)}
-			}
-			return
+		if strings.Contains(errMsg, "model") && strings.Contains(errMsg, "not found") {
+			return nil, fmt.Errorf("model %q not found — run: ollama pull %s", o.model, o.model)
 		}
+		return nil, fmt.Errorf("Ollama API error (status %d): %s", resp.StatusCode, errMsg)
+	}
 
-		// Ollama streams newline-delimited JSON objects.
-		// Each chunk: {"message":{"role":"assistant","content":"token"},"done":false}
-		scanner := bufio.NewScanner(resp.Body)
-		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	return readOllamaStream(resp.Body, emit)
+}
 
-		for scanner.Scan() {
-			line := scanner.Bytes()
-			if len(line) == 0 {
-				continue
-			}
+const (
+	// maxStreamLine caps one line of a stream; longer lines are skipped.
+	maxStreamLine = 1024 * 1024
+	// maxBadChunks is how many unparseable or oversized lines a stream may
+	// contain before it's given up on as garbage rather than a glitch.
+	maxBadChunks = 5
+)
 
-			var chunk ollamaStreamChunk
-			if err := json.Unmarshal(line, &chunk); err != nil {
-				ch <- StreamDelta{Err: fmt.Errorf("failed to parse stream chunk: %w", err)}
-				return
-			}
+// readOllamaStream reads Ollama's newline-delimited JSON stream from r,
+// passing each token to emit. Each chunk looks like
+// {"message":{"role":"assistant","content":"token"},"done":false}.
+//
+// Blank lines are ignored, and up to maxBadChunks lines that don't parse
+// or exceed maxStreamLine are skipped. It returns the usage from the done
+// chunk, or an error wrapping errStreamDropped if r ends first, including
+// in the middle of a line.
+func readOllamaStream(r io.Reader, emit func(string)) (*Usage, error) {
+	br := bufio.NewReaderSize(r, 64*1024)
+	bad := 0
+	for {
+		line, tooLong, readErr := readStreamLine(br)
+		if readErr != nil && readErr != io.EOF {
+			return nil, fmt.Errorf("stream read error: %w (%w)", readErr, errStreamDropped)
+		}
+		complete := readErr == nil // Ends in a newline, so it wasn't cut off.
 
+		line = bytes.TrimSpace(line)
+		var chunk ollamaStreamChunk
+		switch {
+		case tooLong:
+			bad++
+		case len(line) == 0:
+		case json.Unmarshal(line, &chunk) != nil:
+			if !complete {
+				return nil, errStreamDropped
+			}
+			bad++
+		default:
 			if chunk.Message.Content != "" {
-				ch <- StreamDelta{Token: chunk.Message.Content}
+				emit(chunk.Message.Content)
 			}
-
 			if chunk.Done {
-				ch <- StreamDelta{Done: true}
-				return
+				return chunk.usage(), nil
 			}
 		}
-
-		if err := scanner.Err(); err != nil {
-			ch <- StreamDelta{Err: fmt.Errorf("stream read error: %w", err)}
+		if bad > maxBadChunks {
+			return nil, fmt.Errorf("failed to parse stream chunk: more than %d unreadable lines", maxBadChunks)
 		}
-	}()
+		if !complete {
+			return nil, errStreamDropped
+		}
+	}
+}
 
-	return ch
+// readStreamLine reads one line from br, however long, keeping at most
+// maxStreamLine bytes of it. tooLong reports whether it was longer than
+// that, in which case line is nil. err is io.EOF for a final line without
+// a newline.
+func readStreamLine(br *bufio.Reader) (line []byte, tooLong bool, err error) {
+	for {
+		part, readErr := br.ReadSlice('\n')
+		if !tooLong && len(line)+len(part) <= maxStreamLine {
+			line = append(line, part...)
+		} else {
+			tooLong, line = true, nil
+		}
+		if readErr != bufio.ErrBufferFull {
+			return line, tooLong, readErr
+		}
+	}
 }
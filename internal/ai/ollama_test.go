@@ -0,0 +1,655 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// --- Fake Ollama server ---
+
+// fakeOllama is an httptest server that mimics Ollama's /api/chat. By
+// default it answers with reply: as one JSON object for non-streaming
+// requests, or one NDJSON chunk per token for streaming ones. Set status
+// (and body) to simulate API errors, or streamLines to send raw NDJSON.
+// Set drops to cut the connection after dropAfter tokens on that many
+// streaming requests; the next request resumes from the following token.
+type fakeOllama struct {
+	*httptest.Server
+	reply       []string // Tokens of the assistant reply.
+	status      int      // Non-zero: respond with this status and body.
+	body        string
+	streamLines []string // Non-nil: raw lines to stream instead of reply.
+	drops       int      // Streaming requests left to cut off mid-stream.
+	dropAfter   int      // Tokens sent before each cut.
+	sent        int      // Tokens delivered so far across requests.
+	requests    []ollamaRequest
+	lastReq     ollamaRequest
+	models      []string     // Names listed by GET /api/tags.
+	counts      ollamaCounts // Reported with the finished reply.
+	oldServer   bool         // Reject JSON schema formats like Ollama < 0.5.
+}
+
+func newFakeOllama(t *testing.T) *fakeOllama {
+	t.Helper()
+	f := &fakeOllama{}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.handle))
+	t.Cleanup(f.Close)
+	return f
+}
+
+// provider returns an OllamaProvider pointed at the fake server.
+func (f *fakeOllama) provider() *OllamaProvider {
+	p := NewOllamaProvider("test-model")
+	p.apiURL = f.URL + "/api/chat"
+	return p
+}
+
+func (f *fakeOllama) handle(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/api/tags" && r.Method == http.MethodGet {
+		var tags ollamaTagsResponse
+		for _, name := range f.models {
+			tags.Models = append(tags.Models, ollamaModel{Name: name})
+		}
+		json.NewEncoder(w).Encode(tags)
+		return
+	}
+	if r.URL.Path != "/api/chat" || r.Method != http.MethodPost {
+		http.NotFound(w, r)
+		return
+	}
+	if err := json.NewDecoder(r.Body).Decode(&f.lastReq); err != nil {
+		http.Error(w, "bad request body", http.StatusBadRequest)
+		return
+	}
+	f.requests = append(f.requests, f.lastReq)
+	if _, isSchema := f.lastReq.Format.(map[string]any); isSchema && f.oldServer {
+		http.Error(w, `{"error":"invalid format"}`, http.StatusBadRequest)
+		return
+	}
+	if f.status != 0 {
+		w.WriteHeader(f.status)
+		fmt.Fprint(w, f.body)
+		return
+	}
+
+	if !f.lastReq.Stream {
+		json.NewEncoder(w).Encode(ollamaResponse{
+			Message:      ollamaMessage{Role: "assistant", Content: strings.Join(f.reply, "")},
+			ollamaCounts: f.counts,
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	flusher, _ := w.(http.Flusher)
+	if f.drops > 0 {
+		f.drops--
+		f.dropStream(w, flusher)
+		return
+	}
+	lines := f.streamLines
+	if lines == nil {
+		for _, tok := range f.reply[f.sent:] {
+			b, _ := json.Marshal(ollamaStreamChunk{Message: ollamaMessage{Role: "assistant", Content: tok}})
+			lines = append(lines, string(b))
+		}
+		b, _ := json.Marshal(ollamaStreamChunk{Message: ollamaMessage{Role: "assistant"}, Done: true, ollamaCounts: f.counts})
+		lines = append(lines, string(b))
+	}
+	for _, line := range lines {
+		fmt.Fprintln(w, line)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+// dropStream sends the next dropAfter tokens, then kills the connection
+// without the final done chunk, like a flaky network would.
+func (f *fakeOllama) dropStream(w http.ResponseWriter, flusher http.Flusher) {
+	for i := 0; i < f.dropAfter && f.sent < len(f.reply); i++ {
+		b, _ := json.Marshal(ollamaStreamChunk{Message: ollamaMessage{Role: "assistant", Content: f.reply[f.sent]}})
+		fmt.Fprintln(w, string(b))
+		f.sent++
+	}
+	if flusher != nil {
+		flusher.Flush()
+	}
+	if hj, ok := w.(http.Hijacker); ok {
+		if conn, _, err := hj.Hijack(); err == nil {
+			conn.Close()
+		}
+	}
+}
+
+// --- OllamaProvider.Complete tests ---
+
+func TestOllamaComplete_Success(t *testing.T) {
+	f := newFakeOllama(t)
+	f.reply = []string{"  df -h  "}
+
+	got, err := f.provider().Complete(context.Background(), []Message{{Role: "user", Content: "disk"}}, CompleteOptions{JSONMode: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "df -h" {
+		t.Errorf("expected trimmed reply, got %q", got)
+	}
+	if f.lastReq.Model != "test-model" || f.lastReq.Format != "json" || f.lastReq.Stream {
+		t.Errorf("unexpected request: %+v", f.lastReq)
+	}
+	if len(f.lastReq.Messages) != 1 || f.lastReq.Messages[0].Content != "disk" {
+		t.Errorf("messages not forwarded: %+v", f.lastReq.Messages)
+	}
+}
+
+func TestOllamaCompleteWithUsage_ReportsCounts(t *testing.T) {
+	f := newFakeOllama(t)
+	f.reply = []string{"df -h"}
+	f.counts = ollamaCounts{PromptEvalCount: 812, EvalCount: 40, EvalDuration: int64(500 * time.Millisecond)}
+
+	_, usage, err := f.provider().CompleteWithUsage(context.Background(), []Message{{Role: "user", Content: "disk"}}, CompleteOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if usage == nil || usage.PromptTokens != 812 || usage.OutputTokens != 40 || usage.EvalDuration != 500*time.Millisecond {
+		t.Fatalf("unexpected usage: %+v", usage)
+	}
+	if got := usage.TokensPerSecond(); got != 80 {
+		t.Errorf("expected 80 tokens/sec, got %v", got)
+	}
+
+	f.counts = ollamaCounts{}
+	if _, usage, _ := f.provider().CompleteWithUsage(context.Background(), []Message{{Role: "user", Content: "disk"}}, CompleteOptions{}); usage != nil {
+		t.Errorf("expected no usage when Ollama reports none, got %+v", usage)
+	}
+}
+
+func TestOllamaComplete_OptionsInRequestBody(t *testing.T) {
+	f := newFakeOllama(t)
+	f.reply = []string{"ok"}
+
+	opts := CompleteOptions{Temperature: temperature(0.7), KeepAlive: "10m", MaxTokens: 64, Stop: []string{"\n\n"}}
+	if _, err := f.provider().Complete(context.Background(), []Message{{Role: "user", Content: "hi"}}, opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	req := f.lastReq
+	if req.Options.Temperature != 0.7 {
+		t.Errorf("temperature = %v, want 0.7", req.Options.Temperature)
+	}
+	if req.KeepAlive != "10m" {
+		t.Errorf("keep_alive = %q, want 10m", req.KeepAlive)
+	}
+	if req.Options.NumPredict != 64 {
+		t.Errorf("num_predict = %d, want 64", req.Options.NumPredict)
+	}
+	if len(req.Options.Stop) != 1 || req.Options.Stop[0] != "\n\n" {
+		t.Errorf("stop = %q, want [\\n\\n]", req.Options.Stop)
+	}
+	if req.Format != nil {
+		t.Errorf("format should be unset without JSONMode, got %v", req.Format)
+	}
+}
+
+func TestOllamaNewRequest_MarshalsNumPredict(t *testing.T) {
+	p := NewOllamaProvider("test-model")
+
+	body, err := json.Marshal(p.newRequest([]Message{{Role: "user", Content: "hi"}}, false, CompleteOptions{MaxTokens: 256, Stop: []string{"###"}}))
+	if err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+	if !strings.Contains(string(body), `"num_predict":256`) || !strings.Contains(string(body), `"stop":["###"]`) {
+		t.Errorf("expected num_predict and stop in the request, got %s", body)
+	}
+
+	body, _ = json.Marshal(p.newRequest([]Message{{Role: "user", Content: "hi"}}, false, CompleteOptions{}))
+	if strings.Contains(string(body), "num_predict") || strings.Contains(string(body), "stop") {
+		t.Errorf("unset caps should be omitted, got %s", body)
+	}
+}
+
+func TestOllamaComplete_SendsSchemaAsFormat(t *testing.T) {
+	f := newFakeOllama(t)
+	f.reply = []string{`{"command": "ls"}`}
+	schema := json.RawMessage(`{"type": "object", "required": ["command"]}`)
+
+	if _, err := f.provider().Complete(context.Background(), []Message{{Role: "user", Content: "list"}}, CompleteOptions{JSONMode: true, Schema: schema}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	format, ok := f.lastReq.Format.(map[string]any)
+	if !ok || format["type"] != "object" {
+		t.Errorf("expected the schema as format, got %#v", f.lastReq.Format)
+	}
+}
+
+func TestOllamaComplete_SchemaFallsBackToJSON(t *testing.T) {
+	f := newFakeOllama(t)
+	f.reply = []string{`{"command": "ls"}`}
+	f.oldServer = true
+	p := f.provider()
+	opts := CompleteOptions{JSONMode: true, Schema: json.RawMessage(`{"type": "object"}`)}
+
+	got, err := p.Complete(context.Background(), []Message{{Role: "user", Content: "list"}}, opts)
+	if err != nil || got != `{"command": "ls"}` {
+		t.Fatalf("expected the retry with format json to succeed, got %q (err %v)", got, err)
+	}
+	if len(f.requests) != 2 || f.requests[1].Format != "json" {
+		t.Fatalf("expected a schema request then a json one, got %d requests", len(f.requests))
+	}
+
+	// The provider remembers, so neither plain nor streamed requests try
+	// the schema again.
+	if _, err := p.Complete(context.Background(), []Message{{Role: "user", Content: "list"}}, opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := collectStream(p.CompleteStreamJSON(context.Background(), []Message{{Role: "user", Content: "list"}}, opts)); err != nil {
+		t.Fatalf("unexpected stream error: %v", err)
+	}
+	if len(f.requests) != 4 || f.requests[2].Format != "json" || f.requests[3].Format != "json" {
+		t.Errorf("expected later requests to use format json directly, got %d requests", len(f.requests))
+	}
+}
+
+func TestOllamaCompleteStream_SchemaFallsBackToJSON(t *testing.T) {
+	f := newFakeOllama(t)
+	f.reply = []string{`{"command":`, ` "ls"}`}
+	f.oldServer = true
+
+	got, err := collectStream(f.provider().CompleteStreamJSON(context.Background(), []Message{{Role: "user", Content: "list"}}, CompleteOptions{Schema: json.RawMessage(`{"type": "object"}`)}))
+	if err != nil || got != `{"command": "ls"}` {
+		t.Errorf("unexpected stream result %q (err %v)", got, err)
+	}
+	if len(f.requests) != 2 || f.requests[1].Format != "json" {
+		t.Errorf("expected a schema request then a json one, got %d requests", len(f.requests))
+	}
+}
+
+func TestTranslate_SendsResultSchema(t *testing.T) {
+	f := newFakeOllama(t)
+	f.reply = []string{`{"command": "df -h", "explanation": "disk", "intent": "display"}`}
+
+	if _, err := NewClientWithProvider(f.provider()).Translate(context.Background(), "disk usage"); err != nil {
+		t.Fatalf("Translate: %v", err)
+	}
+	format, ok := f.lastReq.Format.(map[string]any)
+	if !ok {
+		t.Fatalf("expected a JSON schema format, got %#v", f.lastReq.Format)
+	}
+	props := format["properties"].(map[string]any)
+	if cmd := props["command"].(map[string]any); cmd["type"] != "string" {
+		t.Errorf("command should be constrained to a string, got %v", cmd)
+	}
+	var intents []string
+	for _, v := range props["intent"].(map[string]any)["enum"].([]any) {
+		intents = append(intents, v.(string))
+	}
+	for _, want := range []string{IntentQuery, IntentExecute, IntentDisplay, IntentWorkflow, IntentInstall} {
+		if !strings.Contains(strings.Join(intents, ","), want) {
+			t.Errorf("intent enum %v is missing %q", intents, want)
+		}
+	}
+}
+
+func TestOllamaComplete_ZeroOptionsUseDefaults(t *testing.T) {
+	f := newFakeOllama(t)
+	f.reply = []string{"ok"}
+
+	if _, err := f.provider().Complete(context.Background(), []Message{{Role: "user", Content: "hi"}}, CompleteOptions{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	req := f.lastReq
+	if req.Options.Temperature != defaultTemperature {
+		t.Errorf("temperature = %v, want the default %v", req.Options.Temperature, defaultTemperature)
+	}
+	if req.KeepAlive != "" || req.Options.NumPredict != 0 || req.Options.Stop != nil {
+		t.Errorf("unset options should be left out of the request, got %+v", req)
+	}
+}
+
+func TestOllamaComplete_StatusError(t *testing.T) {
+	f := newFakeOllama(t)
+	f.status = http.StatusInternalServerError
+	f.body = `{"error":"out of memory"}`
+
+	_, err := f.provider().Complete(context.Background(), []Message{{Role: "user", Content: "hi"}}, CompleteOptions{})
+	if err == nil || !strings.Contains(err.Error(), "status 500") || !strings.Contains(err.Error(), "out of memory") {
+		t.Errorf("expected status error with body, got %v", err)
+	}
+}
+
+func TestOllamaComplete_ModelNotFound(t *testing.T) {
+	f := newFakeOllama(t)
+	f.status = http.StatusNotFound
+	f.body = `{"error":"model 'test-model' not found, try pulling it first"}`
+
+	_, err := f.provider().Complete(context.Background(), []Message{{Role: "user", Content: "hi"}}, CompleteOptions{})
+	if err == nil || !strings.Contains(err.Error(), "ollama pull test-model") {
+		t.Errorf("expected model-not-found hint, got %v", err)
+	}
+}
+
+func TestOllamaComplete_MalformedResponse(t *testing.T) {
+	f := newFakeOllama(t)
+	f.status = http.StatusOK
+	f.body = `{not json`
+
+	_, err := f.provider().Complete(context.Background(), []Message{{Role: "user", Content: "hi"}}, CompleteOptions{})
+	if err == nil || !strings.Contains(err.Error(), "failed to parse response") {
+		t.Errorf("expected parse error, got %v", err)
+	}
+}
+
+func TestOllamaComplete_Unreachable(t *testing.T) {
+	f := newFakeOllama(t)
+	p := f.provider()
+	f.Close()
+
+	_, err := p.Complete(context.Background(), []Message{{Role: "user", Content: "hi"}}, CompleteOptions{})
+	if err == nil || !strings.Contains(err.Error(), "could not reach Ollama") {
+		t.Errorf("expected unreachable error, got %v", err)
+	}
+}
+
+// --- OllamaProvider.CompleteStream tests ---
+
+func TestOllamaCompleteStream_CleanStream(t *testing.T) {
+	f := newFakeOllama(t)
+	f.reply = []string{"Hello", ", ", "world"}
+
+	var tokens []string
+	var done bool
+	for d := range f.provider().CompleteStream(context.Background(), []Message{{Role: "user", Content: "hi"}}, CompleteOptions{}) {
+		if d.Err != nil {
+			t.Fatalf("unexpected stream error: %v", d.Err)
+		}
+		if d.Token != "" {
+			tokens = append(tokens, d.Token)
+		}
+		if d.Done {
+			done = true
+		}
+	}
+	if strings.Join(tokens, "") != "Hello, world" || len(tokens) != 3 {
+		t.Errorf("unexpected tokens: %q", tokens)
+	}
+	if !done {
+		t.Error("stream should end with a Done delta")
+	}
+	if !f.lastReq.Stream {
+		t.Error("CompleteStream should request streaming")
+	}
+}
+
+func TestOllamaCompleteStream_DoneCarriesUsage(t *testing.T) {
+	f := newFakeOllama(t)
+	f.reply = []string{"Hello"}
+	f.counts = ollamaCounts{PromptEvalCount: 30, EvalCount: 1, EvalDuration: int64(10 * time.Millisecond)}
+
+	var usage *Usage
+	for d := range f.provider().CompleteStream(context.Background(), []Message{{Role: "user", Content: "hi"}}, CompleteOptions{}) {
+		if d.Usage != nil && !d.Done {
+			t.Errorf("usage on a token delta: %+v", d)
+		}
+		if d.Done {
+			usage = d.Usage
+		}
+	}
+	if usage == nil || usage.PromptTokens != 30 || usage.OutputTokens != 1 {
+		t.Errorf("expected the Done delta to carry usage, got %+v", usage)
+	}
+}
+
+func TestTranslate_AttachesUsage(t *testing.T) {
+	f := newFakeOllama(t)
+	f.reply = []string{`{"command": "df -h", "explanation": "disk", "intent": "display"}`}
+	f.counts = ollamaCounts{PromptEvalCount: 900, EvalCount: 20, EvalDuration: int64(time.Second)}
+	client := NewClientWithProvider(f.provider())
+
+	result, err := client.Translate(context.Background(), "disk usage")
+	if err != nil {
+		t.Fatalf("Translate: %v", err)
+	}
+	if result.Usage == nil || result.Usage.PromptTokens != 900 {
+		t.Errorf("Translate should attach usage, got %+v", result.Usage)
+	}
+
+	result, err = client.TranslateStream(context.Background(), "disk usage", nil)
+	if err != nil {
+		t.Fatalf("TranslateStream: %v", err)
+	}
+	if result.Usage == nil || result.Usage.TokensPerSecond() != 20 {
+		t.Errorf("TranslateStream should attach usage, got %+v", result.Usage)
+	}
+}
+
+func TestOllamaCompleteStream_StatusError(t *testing.T) {
+	f := newFakeOllama(t)
+	f.status = http.StatusServiceUnavailable
+	f.body = "loading model"
+
+	_, err := collectStream(f.provider().CompleteStream(context.Background(), []Message{{Role: "user", Content: "hi"}}, CompleteOptions{}))
+	if err == nil || !strings.Contains(err.Error(), "status 503") {
+		t.Errorf("expected status error, got %v", err)
+	}
+}
+
+func TestOllamaCompleteStream_ModelNotFound(t *testing.T) {
+	f := newFakeOllama(t)
+	f.status = http.StatusNotFound
+	f.body = `{"error":"model \"test-model\" not found"}`
+
+	_, err := collectStream(f.provider().CompleteStream(context.Background(), []Message{{Role: "user", Content: "hi"}}, CompleteOptions{}))
+	if err == nil || !strings.Contains(err.Error(), "ollama pull test-model") {
+		t.Errorf("expected model-not-found hint, got %v", err)
+	}
+}
+
+func TestOllamaCompleteStream_SkipsMalformedChunk(t *testing.T) {
+	f := newFakeOllama(t)
+	f.streamLines = []string{
+		`{"message":{"role":"assistant","content":"partial"},"done":false}`,
+		`{"message": broken`,
+		`{"message":{"role":"assistant","content":" rest"},"done":true}`,
+	}
+
+	got, err := collectStream(f.provider().CompleteStream(context.Background(), []Message{{Role: "user", Content: "hi"}}, CompleteOptions{}))
+	if err != nil || got != "partial rest" {
+		t.Errorf("expected the bad chunk to be skipped, got %q (err %v)", got, err)
+	}
+}
+
+func TestOllamaCompleteStream_GivesUpOnGarbage(t *testing.T) {
+	f := newFakeOllama(t)
+	f.streamLines = []string{`{"message":{"role":"assistant","content":"partial"},"done":false}`}
+	for i := 0; i <= maxBadChunks; i++ {
+		f.streamLines = append(f.streamLines, "<html>502 Bad Gateway</html>")
+	}
+
+	got, err := collectStream(f.provider().CompleteStream(context.Background(), []Message{{Role: "user", Content: "hi"}}, CompleteOptions{}))
+	if err == nil || !strings.Contains(err.Error(), "failed to parse stream chunk") {
+		t.Errorf("expected chunk parse error, got %v", err)
+	}
+	if got != "partial" {
+		t.Errorf("tokens before the bad chunks should still arrive, got %q", got)
+	}
+	if len(f.requests) != 1 {
+		t.Errorf("a garbage stream shouldn't be retried, got %d requests", len(f.requests))
+	}
+}
+
+func TestReadOllamaStream_LongLines(t *testing.T) {
+	long, _ := json.Marshal(ollamaStreamChunk{Message: ollamaMessage{Content: strings.Repeat("a", 200*1024)}})
+	huge := `{"message":{"content":"` + strings.Repeat("b", maxStreamLine) + `"}}`
+	stream := string(long) + "\n" + huge + "\n" + `{"message":{"content":"!"},"done":true}` + "\n"
+
+	var got strings.Builder
+	if _, err := readOllamaStream(strings.NewReader(stream), func(tok string) { got.WriteString(tok) }); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.String() != strings.Repeat("a", 200*1024)+"!" {
+		t.Errorf("expected the line over the initial buffer to be read and the oversized one skipped, got %d bytes", got.Len())
+	}
+}
+
+func TestReadOllamaStream_CutOffMidLine(t *testing.T) {
+	stream := `{"message":{"content":"a"}}` + "\n" + `{"message":{"cont`
+	_, err := readOllamaStream(strings.NewReader(stream), func(string) {})
+	if !errors.Is(err, errStreamDropped) {
+		t.Errorf("a stream cut off mid-line should count as dropped, got %v", err)
+	}
+}
+
+func FuzzReadOllamaStream(f *testing.F) {
+	f.Add([]byte(`{"message":{"role":"assistant","content":"hi"},"done":false}` + "\n" + `{"done":true,"eval_count":3}` + "\n"))
+	f.Add([]byte("\n\n{\"message\": broken\n{}\n"))
+	f.Add([]byte(`{"message":{"content":"x"}}`))
+	f.Add([]byte{0xff, 0xfe, '\n', '{', '"'})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		usage, err := readOllamaStream(bytes.NewReader(data), func(tok string) {
+			if tok == "" {
+				t.Error("emitted an empty token")
+			}
+		})
+		if err != nil && usage != nil {
+			t.Errorf("usage %+v returned along with error %v", usage, err)
+		}
+	})
+}
+
+func TestOllamaCompleteStream_SkipsBlankLines(t *testing.T) {
+	f := newFakeOllama(t)
+	f.streamLines = []string{
+		`{"message":{"role":"assistant","content":"a"},"done":false}`,
+		``,
+		`{"message":{"role":"assistant","content":"b"},"done":true}`,
+	}
+
+	got, err := collectStream(f.provider().CompleteStream(context.Background(), []Message{{Role: "user", Content: "hi"}}, CompleteOptions{}))
+	if err != nil || got != "ab" {
+		t.Errorf("expected %q, got %q (err %v)", "ab", got, err)
+	}
+}
+
+func TestOllamaCompleteStream_ResumesAfterDrop(t *testing.T) {
+	f := newFakeOllama(t)
+	f.reply = []string{"The ", "quick ", "brown ", "fox"}
+	f.drops = 1
+	f.dropAfter = 2
+
+	got, err := collectStream(f.provider().CompleteStream(context.Background(), []Message{{Role: "user", Content: "tell me"}}, CompleteOptions{}))
+	if err != nil {
+		t.Fatalf("stream should recover from a dropped connection: %v", err)
+	}
+	if got != "The quick brown fox" {
+		t.Errorf("expected full reply without repeats, got %q", got)
+	}
+	if len(f.requests) != 2 {
+		t.Fatalf("expected 1 reconnect, got %d requests", len(f.requests))
+	}
+	resumed := f.requests[1].Messages
+	last := resumed[len(resumed)-1]
+	if len(resumed) != 2 || last.Role != "assistant" || last.Content != "The quick " {
+		t.Errorf("reconnect should send received text as assistant prefix, got %+v", resumed)
+	}
+}
+
+func TestOllamaCompleteStream_RetriesBounded(t *testing.T) {
+	f := newFakeOllama(t)
+	f.reply = []string{"a", "b", "c", "d", "e"}
+	f.drops = 10
+	f.dropAfter = 1
+
+	got, err := collectStream(f.provider().CompleteStream(context.Background(), []Message{{Role: "user", Content: "hi"}}, CompleteOptions{}))
+	if err == nil {
+		t.Fatal("expected error once retries are exhausted")
+	}
+	if want := 1 + defaultStreamRetries; len(f.requests) != want {
+		t.Errorf("expected %d requests, got %d", want, len(f.requests))
+	}
+	if got != "abc" {
+		t.Errorf("tokens received before giving up should be kept, got %q", got)
+	}
+}
+
+func TestOllamaSetTimeout_StreamOnlyTimesFirstResponse(t *testing.T) {
+	// slow waits before answering at all; steady answers at once, then
+	// keeps talking for longer than the timeout.
+	var slow atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if slow.Load() {
+			time.Sleep(300 * time.Millisecond)
+		}
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		fmt.Fprintln(w, `{"message":{"content":"still "},"done":false}`)
+		w.(http.Flusher).Flush()
+		time.Sleep(300 * time.Millisecond)
+		fmt.Fprintln(w, `{"message":{"content":"here"},"done":true}`)
+	}))
+	defer srv.Close()
+
+	p := NewOllamaProvider("test-model")
+	p.apiURL = srv.URL
+	p.streamRetries = 0
+	p.SetTimeout(100 * time.Millisecond)
+
+	got, err := collectStream(p.CompleteStream(context.Background(), []Message{{Role: "user", Content: "hi"}}, CompleteOptions{}))
+	if err != nil || got != "still here" {
+		t.Errorf("a stream that started in time should finish, got %q, %v", got, err)
+	}
+
+	slow.Store(true)
+	if _, err := collectStream(p.CompleteStream(context.Background(), []Message{{Role: "user", Content: "hi"}}, CompleteOptions{})); err == nil {
+		t.Error("expected an error when the response doesn't start within the timeout")
+	}
+
+	p.SetTimeout(0)
+	if got, err := collectStream(p.CompleteStream(context.Background(), []Message{{Role: "user", Content: "hi"}}, CompleteOptions{})); err != nil || got != "still here" {
+		t.Errorf("0 should mean no timeout, got %q, %v", got, err)
+	}
+}
+
+func TestOllamaCompleteStreamJSON_RequestsJSONFormat(t *testing.T) {
+	f := newFakeOllama(t)
+	f.reply = []string{`{"command":`, ` "ls"}`}
+
+	got, err := collectStream(f.provider().CompleteStreamJSON(context.Background(), []Message{{Role: "user", Content: "list"}}, CompleteOptions{}))
+	if err != nil || got != `{"command": "ls"}` {
+		t.Errorf("unexpected stream result %q (err %v)", got, err)
+	}
+	if f.lastReq.Format != "json" || !f.lastReq.Stream {
+		t.Errorf("expected streaming request with JSON format, got %+v", f.lastReq)
+	}
+}
+
+func TestOllamaListModels(t *testing.T) {
+	f := newFakeOllama(t)
+	f.models = []string{"llama3.2:latest", "qwen2.5-coder:7b"}
+
+	models, err := f.provider().ListModels(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(models, ",") != "llama3.2:latest,qwen2.5-coder:7b" {
+		t.Errorf("unexpected models: %v", models)
+	}
+}
+
+func TestOllamaListModels_Unreachable(t *testing.T) {
+	f := newFakeOllama(t)
+	p := f.provider()
+	f.Close()
+
+	if _, err := p.ListModels(context.Background()); err == nil {
+		t.Fatal("expected an error when Ollama is down")
+	}
+}
@@ -0,0 +1,345 @@
+package ai
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultOpenAIURL   = "https://api.openai.com/v1"
+	defaultOpenAIModel = "gpt-4o-mini"
+
+	// defaultRateLimitRetries is how many times a rate-limited (429)
+	// request is retried before giving up.
+	defaultRateLimitRetries = 3
+	// maxRateLimitWait caps a single wait for a rate limit. The user is
+	// usually sitting at the prompt, so a Retry-After longer than this
+	// fails straight away instead.
+	maxRateLimitWait = 30 * time.Second
+)
+
+// OpenAIProvider implements Provider, StreamingProvider and ModelLister
+// for OpenAI's chat completions API.
+type OpenAIProvider struct {
+	chatCompletions
+}
+
+// NewOpenAIProvider creates a provider that talks to OpenAI with apiKey.
+// Ollama-style "name:tag" models (including xx's default) don't exist on
+// OpenAI and are replaced with an OpenAI default.
+func NewOpenAIProvider(apiKey, model string) *OpenAIProvider {
+	return &OpenAIProvider{newChatCompletions("OpenAI", defaultOpenAIURL, apiKey, model, defaultOpenAIModel)}
+}
+
+// chatCompletions is the client for an OpenAI-compatible /chat/completions
+// API. OpenAIProvider and GroqProvider embed it and differ only in name,
+// endpoint and default model.
+type chatCompletions struct {
+	name         string // Shown in errors, e.g. "OpenAI".
+	apiKey       string
+	model        string
+	baseURL      string
+	httpClient   *http.Client
+	streamClient *http.Client
+
+	rateLimitRetries int                                        // How many times a 429 is retried.
+	sleep            func(context.Context, time.Duration) error // Waits out a rate limit; replaced in tests.
+	verbose          io.Writer                                  // Where retries are reported; nil means nowhere.
+}
+
+// newChatCompletions builds the shared client. An empty or Ollama-style
+// "name:tag" model is replaced with defaultModel.
+func newChatCompletions(name, baseURL, apiKey, model, defaultModel string) chatCompletions {
+	if model == "" || strings.Contains(model, ":") {
+		model = defaultModel
+	}
+	c := chatCompletions{
+		name:             name,
+		apiKey:           strings.TrimSpace(apiKey),
+		model:            model,
+		baseURL:          baseURL,
+		rateLimitRetries: defaultRateLimitRetries,
+		sleep:            sleepContext,
+	}
+	c.SetTimeout(defaultTimeout)
+	return c
+}
+
+// SetTimeout replaces the default 60-second per-request timeout; 0 means
+// no timeout. Streams are only timed until the response starts.
+func (c *chatCompletions) SetTimeout(d time.Duration) {
+	c.httpClient, c.streamClient = newHTTPClients(d)
+}
+
+// SetVerbose makes the provider report what it's doing behind the scenes,
+// such as waiting out a rate limit, to w.
+func (c *chatCompletions) SetVerbose(w io.Writer) {
+	c.verbose = w
+}
+
+// errNoKey is returned when the provider is used without an API key.
+func (c *chatCompletions) errNoKey() error {
+	return fmt.Errorf("no %s API key set — run: xx config set-key <key>", c.name)
+}
+
+// Complete sends messages to the API and returns the response text.
+func (c *chatCompletions) Complete(ctx context.Context, messages []Message, opts CompleteOptions) (string, error) {
+	resp, err := c.post(ctx, c.httpClient, messages, false, opts)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var chatResp chatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&chatResp); err != nil {
+		return "", fmt.Errorf("failed to parse response: %w", err)
+	}
+	if len(chatResp.Choices) == 0 {
+		return "", fmt.Errorf("%s returned no choices", c.name)
+	}
+	return strings.TrimSpace(chatResp.Choices[0].Message.Content), nil
+}
+
+// CompleteStreamJSON is CompleteStream with JSON mode enabled. This
+// implements the JSONStreamingProvider interface.
+func (c *chatCompletions) CompleteStreamJSON(ctx context.Context, messages []Message, opts CompleteOptions) <-chan StreamDelta {
+	opts.JSONMode = true
+	return c.CompleteStream(ctx, messages, opts)
+}
+
+// CompleteStream sends messages with streaming enabled and returns a
+// channel that emits tokens as they arrive. This implements the
+// StreamingProvider interface.
+func (c *chatCompletions) CompleteStream(ctx context.Context, messages []Message, opts CompleteOptions) <-chan StreamDelta {
+	ch := make(chan StreamDelta)
+
+	go func() {
+		defer close(ch)
+
+		resp, err := c.post(ctx, c.streamClient, messages, true, opts)
+		if err != nil {
+			ch <- StreamDelta{Err: err}
+			return
+		}
+		defer resp.Body.Close()
+
+		// The API streams server-sent events: "data: {...}" lines, ending
+		// with "data: [DONE]".
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+			if !ok {
+				continue
+			}
+			if data == "[DONE]" {
+				ch <- StreamDelta{Done: true}
+				return
+			}
+
+			var chunk chatStreamChunk
+			if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+				ch <- StreamDelta{Err: fmt.Errorf("failed to parse stream chunk: %w", err)}
+				return
+			}
+			if len(chunk.Choices) > 0 && chunk.Choices[0].Delta.Content != "" {
+				ch <- StreamDelta{Token: chunk.Choices[0].Delta.Content}
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			ch <- StreamDelta{Err: fmt.Errorf("stream read error: %w", err)}
+			return
+		}
+		ch <- StreamDelta{Err: fmt.Errorf("%s stream ended before completion", c.name)}
+	}()
+
+	return ch
+}
+
+// ListModels returns the models available to the API key from /models.
+// This implements the ModelLister interface.
+func (c *chatCompletions) ListModels(ctx context.Context) ([]string, error) {
+	if c.apiKey == "" {
+		return nil, c.errNoKey()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/models", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not reach %s at %s: %w", c.name, c.baseURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.apiError(resp)
+	}
+
+	var models chatModelsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&models); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	names := make([]string, len(models.Data))
+	for i, m := range models.Data {
+		names[i] = m.ID
+	}
+	return names, nil
+}
+
+// post sends a /chat/completions request and returns the response once
+// it's known to be a 200. The caller closes the body.
+func (c *chatCompletions) post(ctx context.Context, client *http.Client, messages []Message, stream bool, opts CompleteOptions) (*http.Response, error) {
+	if c.apiKey == "" {
+		return nil, c.errNoKey()
+	}
+
+	body, err := json.Marshal(c.newRequest(messages, stream, opts))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/chat/completions", bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("could not reach %s at %s: %w", c.name, c.baseURL, err)
+		}
+		if resp.StatusCode == http.StatusOK {
+			return resp, nil
+		}
+
+		raw, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		wait, retry := c.rateLimitWait(resp, raw, attempt)
+		if !retry {
+			return nil, c.errorFor(resp.StatusCode, raw)
+		}
+		if c.verbose != nil {
+			fmt.Fprintf(c.verbose, "  ⏳ %s rate limited, retrying in %s (%d/%d)\n", c.name, wait, attempt+1, c.rateLimitRetries)
+		}
+		if err := c.sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// rateLimitWait reports whether a failed request should be retried and
+// how long to wait first. Only rate limits (429) are retried, up to
+// rateLimitRetries times, waiting as long as the API's Retry-After header
+// asks, or 1s, 2s, 4s... without one. An exhausted quota also comes back
+// as a 429, but waiting won't fix it, so it isn't retried.
+func (c *chatCompletions) rateLimitWait(resp *http.Response, raw []byte, attempt int) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusTooManyRequests || attempt >= c.rateLimitRetries {
+		return 0, false
+	}
+	var apiErr chatErrorResponse
+	if json.Unmarshal(raw, &apiErr) == nil && apiErr.Error.Code == "insufficient_quota" {
+		return 0, false
+	}
+
+	wait := time.Second << attempt
+	if d, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+		wait = d
+	}
+	if wait > maxRateLimitWait {
+		return 0, false
+	}
+	return wait, true
+}
+
+// parseRetryAfter reads a Retry-After header, which is either a number of
+// seconds or an HTTP date.
+func parseRetryAfter(v string, now time.Time) (time.Duration, bool) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(max(secs, 0)) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(t.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// sleepContext waits for d, or until ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// newRequest builds the request body for messages, mapping opts onto the
+// API's fields. KeepAlive has no equivalent and is ignored.
+func (c *chatCompletions) newRequest(messages []Message, stream bool, opts CompleteOptions) chatRequest {
+	msgs := make([]ollamaMessage, len(messages))
+	for i, m := range messages {
+		msgs[i] = ollamaMessage{Role: m.Role, Content: m.Content}
+	}
+
+	req := chatRequest{
+		Model:       c.model,
+		Messages:    msgs,
+		Stream:      stream,
+		Temperature: defaultTemperature,
+		MaxTokens:   opts.MaxTokens,
+		Stop:        opts.Stop,
+	}
+	if opts.Temperature != nil {
+		req.Temperature = *opts.Temperature
+	}
+	if opts.JSONMode {
+		req.ResponseFormat = &chatResponseFormat{Type: "json_object"}
+	}
+	return req
+}
+
+// apiError turns a non-200 response into an error a user can act on,
+// instead of a raw JSON dump.
+func (c *chatCompletions) apiError(resp *http.Response) error {
+	raw, _ := io.ReadAll(resp.Body)
+	return c.errorFor(resp.StatusCode, raw)
+}
+
+// errorFor is apiError for a response whose body has already been read.
+func (c *chatCompletions) errorFor(status int, raw []byte) error {
+	var apiErr chatErrorResponse
+	_ = json.Unmarshal(raw, &apiErr)
+	msg := apiErr.Error.Message
+	if msg == "" {
+		msg = strings.TrimSpace(string(raw))
+	}
+
+	switch {
+	case status == http.StatusUnauthorized || apiErr.Error.Code == "invalid_api_key":
+		return fmt.Errorf("%s rejected the API key — check it, then run: xx config set-key <key>", c.name)
+	case status == http.StatusNotFound || apiErr.Error.Code == "model_not_found":
+		return fmt.Errorf("model %q not available on %s — run: xx config set-model <model>", c.model, c.name)
+	case apiErr.Error.Code == "insufficient_quota":
+		return fmt.Errorf("%s says the account is out of credit — check your plan and billing", c.name)
+	case status == http.StatusTooManyRequests:
+		return fmt.Errorf("%s rate limit reached — wait a moment and try again, or use a smaller model", c.name)
+	}
+	return fmt.Errorf("%s API error (status %d): %s", c.name, status, msg)
+}
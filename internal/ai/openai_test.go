@@ -0,0 +1,242 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeChatAPI is an httptest server that mimics an OpenAI-compatible
+// /chat/completions endpoint.
+// It answers with reply, as one JSON object or as server-sent events for
+// streaming requests. Set status and body to simulate API errors, and
+// limited to rate-limit that many requests before answering.
+type fakeChatAPI struct {
+	*httptest.Server
+	reply      []string
+	status     int
+	body       string
+	limited    int
+	retryAfter string
+	requests   int
+	waits      []time.Duration // Rate-limit waits, recorded instead of slept.
+	lastReq    chatRequest
+	auth       string
+}
+
+func newFakeChatAPI(t *testing.T) *fakeChatAPI {
+	t.Helper()
+	f := &fakeChatAPI{}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.handle))
+	t.Cleanup(f.Close)
+	return f
+}
+
+// groq returns a GroqProvider pointed at the fake server.
+func (f *fakeChatAPI) groq(key string) *GroqProvider {
+	p := NewGroqProvider(key, "llama-3.3-70b-versatile")
+	p.baseURL, p.sleep = f.URL, f.sleep
+	return p
+}
+
+// openAI returns an OpenAIProvider pointed at the fake server.
+func (f *fakeChatAPI) openAI(key string) *OpenAIProvider {
+	p := NewOpenAIProvider(key, "gpt-4o")
+	p.baseURL, p.sleep = f.URL, f.sleep
+	return p
+}
+
+func (f *fakeChatAPI) sleep(_ context.Context, d time.Duration) error {
+	f.waits = append(f.waits, d)
+	return nil
+}
+
+func (f *fakeChatAPI) handle(w http.ResponseWriter, r *http.Request) {
+	f.auth = r.Header.Get("Authorization")
+	if r.URL.Path != "/chat/completions" || r.Method != http.MethodPost {
+		http.NotFound(w, r)
+		return
+	}
+	if err := json.NewDecoder(r.Body).Decode(&f.lastReq); err != nil {
+		http.Error(w, "bad request body", http.StatusBadRequest)
+		return
+	}
+	f.requests++
+	if f.requests <= f.limited {
+		if f.retryAfter != "" {
+			w.Header().Set("Retry-After", f.retryAfter)
+		}
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprint(w, `{"error":{"message":"Rate limit reached","code":"rate_limit_exceeded"}}`)
+		return
+	}
+	if f.status != 0 {
+		w.WriteHeader(f.status)
+		fmt.Fprint(w, f.body)
+		return
+	}
+
+	if !f.lastReq.Stream {
+		fmt.Fprintf(w, `{"choices":[{"message":{"role":"assistant","content":%q}}]}`, strings.Join(f.reply, ""))
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	for _, tok := range f.reply {
+		fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"content\":%q}}]}\n\n", tok)
+	}
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+func TestOpenAIComplete_JSONMode(t *testing.T) {
+	f := newFakeChatAPI(t)
+	f.reply = []string{`{"command": "ls"}`}
+
+	got, err := f.openAI("sk-test").Complete(context.Background(), []Message{{Role: "user", Content: "list"}}, CompleteOptions{JSONMode: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != `{"command": "ls"}` {
+		t.Errorf("unexpected reply %q", got)
+	}
+	if f.auth != "Bearer sk-test" || f.lastReq.Model != "gpt-4o" {
+		t.Errorf("unexpected request: auth %q, %+v", f.auth, f.lastReq)
+	}
+	if f.lastReq.ResponseFormat == nil || f.lastReq.ResponseFormat.Type != "json_object" {
+		t.Errorf("JSONMode should map to response_format json_object, got %+v", f.lastReq.ResponseFormat)
+	}
+}
+
+func TestOpenAICompleteStream(t *testing.T) {
+	f := newFakeChatAPI(t)
+	f.reply = []string{"It ", "lists ", "files."}
+
+	got, err := collectStream(f.openAI("sk-test").CompleteStream(context.Background(), []Message{{Role: "user", Content: "explain ls"}}, CompleteOptions{MaxTokens: 50}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "It lists files." {
+		t.Errorf("expected streamed reply, got %q", got)
+	}
+	if !f.lastReq.Stream || f.lastReq.MaxTokens != 50 {
+		t.Errorf("expected a streaming request with max_tokens 50, got %+v", f.lastReq)
+	}
+}
+
+func TestOpenAITranslateStream_JSONMode(t *testing.T) {
+	f := newFakeChatAPI(t)
+	f.reply = []string{`{"command": "ls -la", `, `"explanation": "Lists files", "intent": "display"}`}
+
+	result, err := NewClientWithProvider(f.openAI("sk-test")).TranslateStream(context.Background(), "list files", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Command != "ls -la" {
+		t.Errorf("expected ls -la, got %q", result.Command)
+	}
+	if !f.lastReq.Stream {
+		t.Error("translation should be streamed")
+	}
+	if f.lastReq.ResponseFormat == nil || f.lastReq.ResponseFormat.Type != "json_object" {
+		t.Errorf("streamed translation should request response_format json_object, got %+v", f.lastReq.ResponseFormat)
+	}
+}
+
+func TestOpenAIComplete_RateLimited(t *testing.T) {
+	f := newFakeChatAPI(t)
+	f.status = http.StatusTooManyRequests
+	f.body = `{"error":{"message":"Rate limit reached for gpt-4o","type":"requests","code":"rate_limit_exceeded"}}`
+
+	_, err := f.openAI("sk-test").Complete(context.Background(), []Message{{Role: "user", Content: "hi"}}, CompleteOptions{})
+	if err == nil || !strings.Contains(err.Error(), "OpenAI rate limit reached") || !strings.Contains(err.Error(), "try again") {
+		t.Errorf("expected a readable rate-limit error, got %v", err)
+	}
+}
+
+func TestGroqComplete_RetriesAfterRateLimit(t *testing.T) {
+	f := newFakeChatAPI(t)
+	f.reply = []string{"ls -la"}
+	f.limited, f.retryAfter = 2, "3"
+
+	p := f.groq("gsk-test")
+	var log strings.Builder
+	p.SetVerbose(&log)
+	got, err := p.Complete(context.Background(), []Message{{Role: "user", Content: "list"}}, CompleteOptions{})
+	if err != nil {
+		t.Fatalf("expected the request to succeed after the rate limit, got %v", err)
+	}
+	if got != "ls -la" || f.requests != 3 {
+		t.Errorf("expected the reply on the third request, got %q after %d", got, f.requests)
+	}
+	if len(f.waits) != 2 || f.waits[0] != 3*time.Second || f.waits[1] != 3*time.Second {
+		t.Errorf("expected two waits of Retry-After's 3s, got %v", f.waits)
+	}
+	if !strings.Contains(log.String(), "Groq rate limited, retrying in 3s (1/3)") {
+		t.Errorf("expected the retry reported under verbose, got %q", log.String())
+	}
+}
+
+func TestOpenAIComplete_RateLimitBackoff(t *testing.T) {
+	f := newFakeChatAPI(t)
+	f.limited = 10
+
+	_, err := f.openAI("sk-test").Complete(context.Background(), []Message{{Role: "user", Content: "hi"}}, CompleteOptions{})
+	if err == nil || !strings.Contains(err.Error(), "rate limit reached") {
+		t.Errorf("expected a rate-limit error once the retries run out, got %v", err)
+	}
+	if want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}; fmt.Sprint(f.waits) != fmt.Sprint(want) {
+		t.Errorf("expected exponential backoff %v without Retry-After, got %v", want, f.waits)
+	}
+
+	// A wait longer than the cap isn't worth sitting through.
+	f = newFakeChatAPI(t)
+	f.limited, f.retryAfter = 10, "120"
+	if _, err := f.openAI("sk-test").Complete(context.Background(), []Message{{Role: "user", Content: "hi"}}, CompleteOptions{}); err == nil || f.requests != 1 {
+		t.Errorf("expected a long Retry-After to fail at once, got %v after %d requests", err, f.requests)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		header string
+		want   time.Duration
+		ok     bool
+	}{
+		{"5", 5 * time.Second, true},
+		{"0", 0, true},
+		{"Thu, 15 Oct 2026 12:00:07 GMT", 7 * time.Second, true},
+		{"Thu, 15 Oct 2026 11:59:00 GMT", 0, true},
+		{"", 0, false},
+		{"soon", 0, false},
+	} {
+		got, ok := parseRetryAfter(tc.header, now)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("parseRetryAfter(%q) = %v, %v; want %v, %v", tc.header, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestOpenAIComplete_QuotaExhausted(t *testing.T) {
+	f := newFakeChatAPI(t)
+	f.status = http.StatusTooManyRequests
+	f.body = `{"error":{"message":"You exceeded your current quota","type":"insufficient_quota","code":"insufficient_quota"}}`
+
+	_, err := f.openAI("sk-test").Complete(context.Background(), []Message{{Role: "user", Content: "hi"}}, CompleteOptions{})
+	if err == nil || !strings.Contains(err.Error(), "out of credit") {
+		t.Errorf("expected a billing hint, got %v", err)
+	}
+	if f.requests != 1 {
+		t.Errorf("waiting won't refill a quota, so it shouldn't be retried; got %d requests", f.requests)
+	}
+}
+
+func TestNewOpenAIProvider_ReplacesOllamaModels(t *testing.T) {
+	if p := NewOpenAIProvider("sk-test", "llama3.2:latest"); p.model != defaultOpenAIModel {
+		t.Errorf("Ollama-style model should fall back to %s, got %s", defaultOpenAIModel, p.model)
+	}
+}
@@ -1,6 +1,10 @@
 package ai
 
-import "context"
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
 
 // Message is a provider-agnostic chat message.
 type Message struct {
@@ -12,7 +16,68 @@ type Message struct {
 // This abstraction allows swapping between Ollama, OpenAI, Groq, etc.
 // without changing any business logic in Client.
 type Provider interface {
-	// Complete sends a list of messages and returns the assistant's response text.
-	// If jsonMode is true, the provider should request structured JSON output.
-	Complete(ctx context.Context, messages []Message, jsonMode bool) (string, error)
+	// Complete sends a list of messages and returns the assistant's response
+	// text, tuned by opts.
+	Complete(ctx context.Context, messages []Message, opts CompleteOptions) (string, error)
+}
+
+// CompleteOptions tunes a single Complete call. The zero value asks for
+// free text with the provider's defaults; providers ignore options they
+// have no equivalent for.
+type CompleteOptions struct {
+	// JSONMode requests structured JSON output.
+	JSONMode bool
+	// Schema is a JSON schema the output must follow, for providers that
+	// support structured outputs (Ollama 0.5+). Others, and Ollama servers
+	// that reject it, fall back to plain JSONMode, so set both.
+	Schema json.RawMessage
+	// Temperature is the sampling temperature. Nil means the provider's
+	// default; a pointer so that an explicit 0 (greedy decoding) is possible.
+	Temperature *float64
+	// KeepAlive is how long the model stays loaded after the request, as a
+	// duration like "5m" ("0" unloads it right away). Empty means the
+	// provider's default.
+	KeepAlive string
+	// MaxTokens caps the length of the response. Zero means no cap.
+	MaxTokens int
+	// Stop ends the response at the first of these sequences.
+	Stop []string
+}
+
+// temperature returns t as a CompleteOptions.Temperature.
+func temperature(t float64) *float64 {
+	return &t
+}
+
+// Usage is what a provider reports about a response: how big the prompt
+// was, how many tokens it generated, and how long generating them took.
+// Zero fields weren't reported.
+type Usage struct {
+	PromptTokens int
+	OutputTokens int
+	EvalDuration time.Duration
+}
+
+// TokensPerSecond is the generation speed, or 0 if it's unknown.
+func (u Usage) TokensPerSecond() float64 {
+	if u.OutputTokens == 0 || u.EvalDuration <= 0 {
+		return 0
+	}
+	return float64(u.OutputTokens) / u.EvalDuration.Seconds()
+}
+
+// UsageProvider is implemented by providers that report token usage for a
+// completion (Ollama). Translate uses it so stats can compare models by
+// speed rather than wall-clock latency alone.
+type UsageProvider interface {
+	Provider
+	// CompleteWithUsage is Complete that also returns the response's usage,
+	// nil if the backend didn't report it.
+	CompleteWithUsage(ctx context.Context, messages []Message, opts CompleteOptions) (string, *Usage, error)
+}
+
+// ModelLister is implemented by providers that can list the models
+// available to them, e.g. for shell completion of `xx config set-model`.
+type ModelLister interface {
+	ListModels(ctx context.Context) ([]string, error)
 }
@@ -0,0 +1,63 @@
+package ai
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// knownShells are the process names detectShell accepts from the parent
+// process. Anything else (make, sudo, an editor) says nothing about the
+// shell the user types into.
+var knownShells = map[string]bool{
+	"sh": true, "bash": true, "zsh": true, "fish": true, "dash": true,
+	"ksh": true, "mksh": true, "tcsh": true, "csh": true, "nu": true,
+	"elvish": true, "pwsh": true,
+}
+
+// parentProcessName returns the command name of xx's parent process, or ""
+// if it can't be found. It's a variable so tests can fake the parent.
+var parentProcessName = func() string {
+	ppid := os.Getppid()
+	if runtime.GOOS == "linux" {
+		if comm, err := os.ReadFile(fmt.Sprintf("/proc/%d/comm", ppid)); err == nil {
+			return strings.TrimSpace(string(comm))
+		}
+	}
+	out, err := exec.Command("ps", "-o", "comm=", "-p", fmt.Sprint(ppid)).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// detectShell returns the name of the shell the user is typing into, so
+// the model writes syntax for it. That's the parent process when it's a
+// shell (fish started from bash, say); $SHELL is only the login shell, so
+// it's the fallback.
+func detectShell() string {
+	if runtime.GOOS == "windows" {
+		return "powershell"
+	}
+	if name := shellName(parentProcessName()); knownShells[name] {
+		return name
+	}
+	if shell := shellName(os.Getenv("SHELL")); shell != "" {
+		return shell
+	}
+	return "sh"
+}
+
+// shellName reduces a shell path or process name to the shell's name:
+// "/usr/local/bin/fish" and "-zsh" (a login shell, as ps shows it) become
+// "fish" and "zsh".
+func shellName(path string) string {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return ""
+	}
+	return strings.TrimPrefix(filepath.Base(path), "-")
+}
@@ -13,6 +13,9 @@ type StreamDelta struct {
 	Done bool
 	// Err is non-nil if the stream encountered an error.
 	Err error
+	// Usage may be set on the Done delta by providers that report token
+	// usage (see UsageProvider).
+	Usage *Usage
 }
 
 // StreamingProvider extends Provider with token-by-token streaming.
@@ -21,10 +24,20 @@ type StreamDelta struct {
 type StreamingProvider interface {
 	Provider
 	// CompleteStream sends messages and returns a channel that emits tokens
-	// as they arrive. The channel is closed when the response is complete.
-	// If jsonMode is true, the provider should request structured JSON output
-	// (streaming is typically only used for free-text responses).
-	CompleteStream(ctx context.Context, messages []Message) <-chan StreamDelta
+	// as they arrive, tuned by opts like Complete. The channel is closed when
+	// the response is complete.
+	CompleteStream(ctx context.Context, messages []Message, opts CompleteOptions) <-chan StreamDelta
+}
+
+// JSONStreamingProvider is implemented by streaming providers that can
+// constrain the streamed response to valid JSON (Ollama's format: "json",
+// OpenAI and Groq response_format json_object).
+// TranslateStream prefers it over plain CompleteStream when available.
+type JSONStreamingProvider interface {
+	StreamingProvider
+	// CompleteStreamJSON is CompleteStream with JSON output requested on
+	// top of opts.
+	CompleteStreamJSON(ctx context.Context, messages []Message, opts CompleteOptions) <-chan StreamDelta
 }
 
 // collectStream reads all tokens from a stream channel and returns the
@@ -2,12 +2,15 @@
 // Types in this file are shared across the client and provider implementations.
 package ai
 
+import "time"
+
 // Intent constants define how xx should handle the AI's response.
 const (
 	IntentQuery    = "query"    // User is asking a question — auto-run, summarize output.
 	IntentExecute  = "execute"  // User wants an action — confirm before running.
 	IntentDisplay  = "display"  // User wants to see data — auto-run, show raw output.
 	IntentWorkflow = "workflow" // User wants a multi-step pipeline — confirm once, run sequentially.
+	IntentInstall  = "install"  // User wants to install packages — like execute, but always previews the packages.
 )
 
 // Result is the structured response from the AI translation.
@@ -16,13 +19,19 @@ type Result struct {
 	Explanation string   `json:"explanation"`
 	Intent      string   `json:"intent"`
 	Steps       []Step   `json:"steps,omitempty"` // Populated when intent is "workflow".
+	Packages    []string `json:"packages,omitempty"` // Populated when intent is "install".
 	RAGContext  string   `json:"-"`               // Injected RAG knowledge (not from JSON, for debug/verbose output).
+	Usage       *Usage   `json:"-"`               // Token usage, when the provider reports it (not from JSON).
 }
 
 // Step is a single command in a multi-step workflow.
 type Step struct {
 	Command     string `json:"command"`
 	Explanation string `json:"explanation"`
+	// ParallelGroup marks adjacent steps that are independent of each other.
+	// Consecutive steps with the same non-zero group may run concurrently;
+	// zero means the step runs on its own.
+	ParallelGroup int `json:"parallel_group,omitempty"`
 }
 
 // ChatMessage represents a single message in a conversation.
@@ -36,8 +45,10 @@ type ollamaRequest struct {
 	Model    string          `json:"model"`
 	Messages []ollamaMessage `json:"messages"`
 	Stream   bool            `json:"stream"`
-	Format   string          `json:"format,omitempty"`
+	Format   any             `json:"format,omitempty"` // "json", or a JSON schema object.
 	Options  ollamaOptions   `json:"options"`
+	// KeepAlive is a duration string like "5m"; empty uses Ollama's default.
+	KeepAlive string `json:"keep_alive,omitempty"`
 }
 
 // ollamaMessage is a single message in the Ollama chat format.
@@ -48,15 +59,99 @@ type ollamaMessage struct {
 
 // ollamaOptions controls generation parameters.
 type ollamaOptions struct {
-	Temperature float64 `json:"temperature"`
+	Temperature float64  `json:"temperature"`
+	NumPredict  int      `json:"num_predict,omitempty"` // Max tokens to generate.
+	Stop        []string `json:"stop,omitempty"`
+}
+
+// ollamaTagsResponse is the response body from Ollama's /api/tags.
+type ollamaTagsResponse struct {
+	Models []ollamaModel `json:"models"`
+}
+
+// ollamaModel is a single installed model in /api/tags.
+type ollamaModel struct {
+	Name string `json:"name"`
 }
 
 // ollamaResponse is the response body from the Ollama API.
 type ollamaResponse struct {
 	Message ollamaMessage `json:"message"`
+	ollamaCounts
+}
+
+// ollamaCounts are the token counts and timing Ollama reports with a
+// finished response.
+type ollamaCounts struct {
+	PromptEvalCount int   `json:"prompt_eval_count"`
+	EvalCount       int   `json:"eval_count"`
+	EvalDuration    int64 `json:"eval_duration"` // Nanoseconds.
+}
+
+// usage converts the counts to a Usage, or nil if Ollama sent none.
+func (c ollamaCounts) usage() *Usage {
+	if c == (ollamaCounts{}) {
+		return nil
+	}
+	return &Usage{
+		PromptTokens: c.PromptEvalCount,
+		OutputTokens: c.EvalCount,
+		EvalDuration: time.Duration(c.EvalDuration),
+	}
 }
+
 // ollamaStreamChunk is a single line from Ollama's streaming NDJSON response.
 type ollamaStreamChunk struct {
-	Message ollamaMessage `json:"message"`
-	Done    bool          `json:"done"`
+	Message      ollamaMessage `json:"message"`
+	Done         bool          `json:"done"`
+	ollamaCounts               // Set on the final, done chunk.
+}
+
+// chatRequest is the request body sent to an OpenAI-compatible
+// /chat/completions endpoint (OpenAI, Groq).
+type chatRequest struct {
+	Model          string              `json:"model"`
+	Messages       []ollamaMessage     `json:"messages"` // Same role/content shape as Ollama.
+	Stream         bool                `json:"stream"`
+	Temperature    float64             `json:"temperature"`
+	MaxTokens      int                 `json:"max_tokens,omitempty"`
+	Stop           []string            `json:"stop,omitempty"`
+	ResponseFormat *chatResponseFormat `json:"response_format,omitempty"`
+}
+
+// chatResponseFormat requests JSON output: {"type": "json_object"}.
+type chatResponseFormat struct {
+	Type string `json:"type"`
+}
+
+// chatResponse is the response body from /chat/completions.
+type chatResponse struct {
+	Choices []struct {
+		Message ollamaMessage `json:"message"`
+	} `json:"choices"`
+}
+
+// chatStreamChunk is one server-sent event of a streaming response.
+type chatStreamChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+	} `json:"choices"`
+}
+
+// chatErrorResponse is the body sent with a non-200 status.
+type chatErrorResponse struct {
+	Error struct {
+		Message string `json:"message"`
+		Code    string `json:"code"`
+	} `json:"error"`
+}
+
+// chatModelsResponse is the response body from /models.
+type chatModelsResponse struct {
+	Data []struct {
+		ID string `json:"id"`
+	} `json:"data"`
 }
@@ -0,0 +1,74 @@
+// Package audit keeps an append-only record of every command xx executes,
+// for security review. Unlike history, which is trimmed to the last 500
+// entries and rewritten on every save, the audit log is JSON Lines in
+// ~/.xx-cli/audit.log that is only ever appended to.
+//
+// Auditing is off by default; enable it with `xx config set audit_log true`.
+package audit
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/arin/xx-cli/internal/config"
+)
+
+const fileName = "audit.log"
+
+// Entry is one executed command.
+type Entry struct {
+	Timestamp time.Time `json:"timestamp"`
+	Prompt    string    `json:"prompt"`
+	Command   string    `json:"command"`
+	Intent    string    `json:"intent"`
+	Cwd       string    `json:"cwd"`
+	ExitCode  int       `json:"exit_code"` // -1 if the command couldn't be started.
+	Confirmed bool      `json:"confirmed"` // The user answered yes at a confirmation prompt.
+	Yolo      bool      `json:"yolo"`      // Confirmation was skipped with --yolo.
+}
+
+var fileMu sync.Mutex
+
+// Path returns the audit log location.
+func Path() string {
+	return filepath.Join(config.Dir(), fileName)
+}
+
+// Record appends e to the audit log if auditing is enabled. Timestamp and
+// Cwd are filled in when empty.
+func Record(e Entry) error {
+	cfg, _ := config.Load()
+	if !cfg.AuditLog {
+		return nil
+	}
+
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now()
+	}
+	if e.Cwd == "" {
+		e.Cwd, _ = os.Getwd()
+	}
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	fileMu.Lock()
+	defer fileMu.Unlock()
+
+	if err := os.MkdirAll(config.Dir(), 0o700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(Path(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(line)
+	return err
+}
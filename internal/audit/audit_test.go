@@ -0,0 +1,77 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/arin/xx-cli/internal/config"
+	"github.com/arin/xx-cli/internal/executor"
+)
+
+func readEntries(t *testing.T) []Entry {
+	t.Helper()
+	f, err := os.Open(Path())
+	if err != nil {
+		t.Fatalf("open audit log: %v", err)
+	}
+	defer f.Close()
+
+	var entries []Entry
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var e Entry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			t.Fatalf("audit line is not valid JSON: %q", sc.Text())
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func TestRecord_AppendsLineWithFields(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	if err := config.Set("audit_log", "true"); err != nil {
+		t.Fatalf("enable audit log: %v", err)
+	}
+
+	runErr := exec.Command("sh", "-c", "exit 3").Run()
+	if err := Record(Entry{Prompt: "fail on purpose", Command: "exit 3", Intent: "execute", ExitCode: executor.ExitCode(runErr), Confirmed: true}); err != nil {
+		t.Fatalf("Record failed: %v", err)
+	}
+	if err := Record(Entry{Prompt: "list", Command: "ls", Intent: "display", Yolo: true}); err != nil {
+		t.Fatalf("Record failed: %v", err)
+	}
+
+	entries := readEntries(t)
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 audit lines, got %d", len(entries))
+	}
+	first := entries[0]
+	cwd, _ := os.Getwd()
+	if first.Prompt != "fail on purpose" || first.Command != "exit 3" || first.Intent != "execute" {
+		t.Errorf("unexpected entry: %+v", first)
+	}
+	if first.ExitCode != 3 || !first.Confirmed || first.Yolo {
+		t.Errorf("unexpected exit/confirm fields: %+v", first)
+	}
+	if first.Cwd != cwd || first.Timestamp.IsZero() {
+		t.Errorf("cwd and timestamp should be filled in: %+v", first)
+	}
+	if !entries[1].Yolo || entries[1].ExitCode != 0 {
+		t.Errorf("unexpected second entry: %+v", entries[1])
+	}
+}
+
+func TestRecord_DisabledByDefault(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	if err := Record(Entry{Prompt: "list", Command: "ls"}); err != nil {
+		t.Fatalf("Record failed: %v", err)
+	}
+	if _, err := os.Stat(Path()); !os.IsNotExist(err) {
+		t.Error("audit log should not be written unless enabled")
+	}
+}
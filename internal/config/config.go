@@ -4,8 +4,14 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
 const (
@@ -13,20 +19,135 @@ const (
 	fileName     = "config.json"
 	defaultModel = "llama3.2:latest"
 	envKeyModel  = "XX_MODEL"
+
+	// DefaultTimeoutSeconds bounds each AI request when timeout_seconds
+	// isn't set.
+	DefaultTimeoutSeconds = 60
+
+	// DefaultExecTimeoutSeconds bounds each executed command when
+	// exec_timeout_seconds isn't set.
+	DefaultExecTimeoutSeconds = 120
+
+	// DefaultMaxOutputBytes caps the output captured from each stream of an
+	// executed command when max_output_bytes isn't set.
+	DefaultMaxOutputBytes = 64 << 10
+
+	// MaxTemperature is the highest sampling temperature the providers accept.
+	MaxTemperature = 2.0
+
+	// MaxFeedbackTopK caps feedback_top_k; past a handful of documents the
+	// matches have little to do with the command.
+	MaxFeedbackTopK = 20
+
+	// MaxExtraInstructions caps the extra_instructions length so a long
+	// note can't crowd the built-in rules out of a small model's context.
+	MaxExtraInstructions = 500
+)
+
+// Providers accepted by the provider setting.
+const (
+	ProviderOllama = "ollama"
+	ProviderOpenAI = "openai"
+	ProviderGroq   = "groq"
 )
 
 // Config holds the user's configuration.
 type Config struct {
+	// Provider is the AI backend: "ollama", "openai" or "groq". Empty means
+	// Groq when an API key is set and Ollama otherwise, which is how xx
+	// behaved before the setting existed.
+	Provider string `json:"provider,omitempty"`
+	// APIKey authenticates with the hosted provider (OpenAI or Groq).
 	APIKey string `json:"api_key,omitempty"`
 	Model  string `json:"model"`
+	// Temperature, if set, is the sampling temperature for every request,
+	// overriding the defaults (low for commands, higher for chat and
+	// explanations). A pointer so that 0 can be set explicitly.
+	Temperature *float64 `json:"temperature,omitempty"`
+	// TimeoutSeconds bounds each AI request; for streamed answers only the
+	// wait for the first response counts. 0 means no timeout and nil means
+	// DefaultTimeoutSeconds. A pointer so that 0 can be set explicitly.
+	TimeoutSeconds *int `json:"timeout_seconds,omitempty"`
+	// ExecTimeoutSeconds kills a generated command still running after this
+	// long, so `tail -f` can't hang xx. 0 means no timeout and nil means
+	// DefaultExecTimeoutSeconds.
+	ExecTimeoutSeconds *int `json:"exec_timeout_seconds,omitempty"`
+	// MaxOutputBytes caps how much of each of stdout and stderr is kept
+	// from an executed command, and so stored in history and summarized.
+	// Zero means DefaultMaxOutputBytes.
+	MaxOutputBytes int `json:"max_output_bytes,omitempty"`
+	// ExtraInstructions is appended to the system prompt after the built-in
+	// rules, e.g. "always prefer fd over find".
+	ExtraInstructions string `json:"extra_instructions,omitempty"`
+	// AuditLog enables the append-only ~/.xx-cli/audit.log of executed commands.
+	AuditLog bool `json:"audit_log,omitempty"`
+	// LearnDedupThreshold is the cosine similarity above which auto-learning
+	// treats a new command as a duplicate of a stored one and skips it.
+	// Lower is stricter. Zero means the built-in default (0.95).
+	LearnDedupThreshold float64 `json:"learn_dedup_threshold,omitempty"`
+	// FeedbackMinScore is the cosine similarity a stored document needs to
+	// a prompt for the command's success or failure to count toward that
+	// document's score. Lower applies feedback more widely. Zero means the
+	// built-in default (0.5).
+	FeedbackMinScore float64 `json:"feedback_min_score,omitempty"`
+	// FeedbackTopK is how many of the documents most similar to a prompt
+	// share the command's success or failure, with credit decaying by rank.
+	// 1 credits only the best match. Zero means the built-in default (5).
+	FeedbackTopK int `json:"feedback_top_k,omitempty"`
+	// SafeMode makes xx only suggest commands and never run them, like a
+	// permanent --suggest-only.
+	SafeMode bool `json:"safe_mode,omitempty"`
+	// WeekStart is what `xx stats` counts as "this week": "rolling" (the last
+	// 7 days, the default), or the calendar week starting "monday" or "sunday".
+	WeekStart string `json:"week_start,omitempty"`
+	// EnvSnapshot records the working directory, project type, git branch
+	// and a few allowlisted env vars with each executed command's history
+	// entry. Off by default for privacy.
+	EnvSnapshot bool `json:"env_snapshot,omitempty"`
+	// SkipSensitiveHistory keeps history whose prompt mentions passwords,
+	// tokens, secrets or keys out of the knowledge index.
+	SkipSensitiveHistory bool `json:"skip_sensitive_history,omitempty"`
+	// NoProjectContext keeps the working directory and git state out of
+	// prompts; xx then never scans the project or runs git for them.
+	NoProjectContext bool `json:"no_project_context,omitempty"`
+	// PostExecHook is an executable xx starts, without waiting for it,
+	// after every command it runs, with the prompt, command, intent and
+	// exit code. Empty means no hook.
+	PostExecHook string `json:"post_exec_hook,omitempty"`
+	// PagerLines pipes display output longer than this many lines through
+	// $PAGER (less -R if unset) when stdout is a terminal. Zero never pages.
+	PagerLines int `json:"pager_lines,omitempty"`
 }
 
-// Dir returns the configuration directory path.
+// dirOverride replaces ~/.xx-cli when set (see SetDir).
+var dirOverride string
+
+// Dir returns the configuration directory path. Everything xx stores —
+// config, history, stats, learned corrections, the vector store — lives here.
 func Dir() string {
+	if dirOverride != "" {
+		return dirOverride
+	}
 	home, _ := os.UserHomeDir()
 	return filepath.Join(home, dirName)
 }
 
+// SetDir points Dir at dir for the rest of the process, e.g. from the
+// --config flag. Relative paths are made absolute so background
+// subprocesses agree on the location. An empty dir restores the default.
+func SetDir(dir string) error {
+	if dir == "" {
+		dirOverride = ""
+		return nil
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return fmt.Errorf("invalid config dir %q: %w", dir, err)
+	}
+	dirOverride = abs
+	return nil
+}
+
 func configPath() string {
 	return filepath.Join(Dir(), fileName)
 }
@@ -67,28 +188,418 @@ func save(cfg *Config) error {
 	return os.WriteFile(configPath(), data, 0o600)
 }
 
-// SetAPIKey saves the API key to the config file.
-func SetAPIKey(key string) error {
+// loadFile reads the config file without applying environment overrides,
+// so that setters persist only what the user explicitly configured.
+func loadFile() *Config {
 	cfg := &Config{Model: defaultModel}
 
 	data, err := os.ReadFile(configPath())
 	if err == nil {
 		_ = json.Unmarshal(data, cfg)
 	}
+	return cfg
+}
+
+// setters maps the keys accepted by `xx config set` to a function that
+// validates the value and applies it to the config.
+var setters = map[string]func(cfg *Config, value string) error{
+	"model": func(cfg *Config, value string) error {
+		if strings.TrimSpace(value) == "" {
+			return fmt.Errorf("model cannot be empty")
+		}
+		cfg.Model = value
+		return nil
+	},
+	"api_key": func(cfg *Config, value string) error {
+		// Pasted keys often drag a trailing newline or spaces along.
+		value = strings.TrimSpace(value)
+		if value == "" {
+			return fmt.Errorf("api key cannot be empty")
+		}
+		cfg.APIKey = value
+		return nil
+	},
+	"provider": func(cfg *Config, value string) error {
+		value = strings.ToLower(strings.TrimSpace(value))
+		switch value {
+		case ProviderOllama, ProviderOpenAI, ProviderGroq:
+		default:
+			return fmt.Errorf("expected ollama, openai or groq, got %q", value)
+		}
+		cfg.Provider = value
+		return nil
+	},
+	"temperature": func(cfg *Config, value string) error {
+		value = strings.TrimSpace(value)
+		if value == "default" {
+			cfg.Temperature = nil
+			return nil
+		}
+		t, err := strconv.ParseFloat(value, 64)
+		if err != nil || t < 0 || t > MaxTemperature {
+			return fmt.Errorf("expected a number from 0 to %g, or default, got %q", MaxTemperature, value)
+		}
+		cfg.Temperature = &t
+		return nil
+	},
+	"timeout_seconds": func(cfg *Config, value string) error {
+		value = strings.TrimSpace(value)
+		if value == "default" {
+			cfg.TimeoutSeconds = nil
+			return nil
+		}
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds < 0 {
+			return fmt.Errorf("expected a whole number of seconds (0 for no timeout), or default, got %q", value)
+		}
+		cfg.TimeoutSeconds = &seconds
+		return nil
+	},
+	"max_output_bytes": func(cfg *Config, value string) error {
+		value = strings.TrimSpace(value)
+		if value == "default" {
+			cfg.MaxOutputBytes = 0
+			return nil
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return fmt.Errorf("expected a positive number of bytes, or default, got %q", value)
+		}
+		cfg.MaxOutputBytes = n
+		return nil
+	},
+	"exec_timeout_seconds": func(cfg *Config, value string) error {
+		value = strings.TrimSpace(value)
+		if value == "default" {
+			cfg.ExecTimeoutSeconds = nil
+			return nil
+		}
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds < 0 {
+			return fmt.Errorf("expected a whole number of seconds (0 for no timeout), or default, got %q", value)
+		}
+		cfg.ExecTimeoutSeconds = &seconds
+		return nil
+	},
+	"audit_log": func(cfg *Config, value string) error {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("expected true or false, got %q", value)
+		}
+		cfg.AuditLog = enabled
+		return nil
+	},
+	"safe_mode": func(cfg *Config, value string) error {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("expected true or false, got %q", value)
+		}
+		cfg.SafeMode = enabled
+		return nil
+	},
+	"env_snapshot": func(cfg *Config, value string) error {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("expected true or false, got %q", value)
+		}
+		cfg.EnvSnapshot = enabled
+		return nil
+	},
+	"skip_sensitive_history": func(cfg *Config, value string) error {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("expected true or false, got %q", value)
+		}
+		cfg.SkipSensitiveHistory = enabled
+		return nil
+	},
+	"no_project_context": func(cfg *Config, value string) error {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("expected true or false, got %q", value)
+		}
+		cfg.NoProjectContext = enabled
+		return nil
+	},
+	"learn_dedup_threshold": func(cfg *Config, value string) error {
+		value = strings.TrimSpace(value)
+		if value == "default" {
+			cfg.LearnDedupThreshold = 0
+			return nil
+		}
+		threshold, err := strconv.ParseFloat(value, 64)
+		if err != nil || threshold <= 0 || threshold > 1 {
+			return fmt.Errorf("expected a number in (0, 1], or default, got %q", value)
+		}
+		cfg.LearnDedupThreshold = threshold
+		return nil
+	},
+	"feedback_min_score": func(cfg *Config, value string) error {
+		value = strings.TrimSpace(value)
+		if value == "default" {
+			cfg.FeedbackMinScore = 0
+			return nil
+		}
+		score, err := strconv.ParseFloat(value, 64)
+		if err != nil || score <= 0 || score > 1 {
+			return fmt.Errorf("expected a number in (0, 1], or default, got %q", value)
+		}
+		cfg.FeedbackMinScore = score
+		return nil
+	},
+	"feedback_top_k": func(cfg *Config, value string) error {
+		value = strings.TrimSpace(value)
+		if value == "default" {
+			cfg.FeedbackTopK = 0
+			return nil
+		}
+		k, err := strconv.Atoi(value)
+		if err != nil || k < 1 || k > MaxFeedbackTopK {
+			return fmt.Errorf("expected a whole number from 1 to %d, or default, got %q", MaxFeedbackTopK, value)
+		}
+		cfg.FeedbackTopK = k
+		return nil
+	},
+	"week_start": func(cfg *Config, value string) error {
+		value = strings.ToLower(strings.TrimSpace(value))
+		switch value {
+		case "rolling", "monday", "sunday":
+		default:
+			return fmt.Errorf("expected rolling, monday or sunday, got %q", value)
+		}
+		cfg.WeekStart = value
+		return nil
+	},
+	"post_exec_hook": func(cfg *Config, value string) error {
+		value = strings.TrimSpace(value)
+		if value == "" || strings.EqualFold(value, "none") {
+			cfg.PostExecHook = ""
+			return nil
+		}
+		path, err := hookPath(value)
+		if err != nil {
+			return err
+		}
+		cfg.PostExecHook = path
+		return nil
+	},
+	"pager_lines": func(cfg *Config, value string) error {
+		value = strings.TrimSpace(value)
+		if strings.EqualFold(value, "off") {
+			cfg.PagerLines = 0
+			return nil
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return fmt.Errorf("expected a number of lines (0 or off to never page), got %q", value)
+		}
+		cfg.PagerLines = n
+		return nil
+	},
+	"extra_instructions": func(cfg *Config, value string) error {
+		value = strings.TrimSpace(value)
+		if n := len([]rune(value)); n > MaxExtraInstructions {
+			return fmt.Errorf("too long (%d characters, max %d)", n, MaxExtraInstructions)
+		}
+		cfg.ExtraInstructions = value
+		return nil
+	},
+}
+
+// hookPath resolves a post_exec_hook value to an absolute path, expanding
+// a leading ~/, and checks that it's an executable file.
+func hookPath(value string) (string, error) {
+	if rest, ok := strings.CutPrefix(value, "~/"); ok {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		value = filepath.Join(home, rest)
+	}
+	path, err := filepath.Abs(value)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("no such file %q", path)
+	}
+	if info.IsDir() || (runtime.GOOS != "windows" && info.Mode()&0o111 == 0) {
+		return "", fmt.Errorf("%q isn't an executable file (try chmod +x)", path)
+	}
+	return path, nil
+}
 
-	cfg.APIKey = key
+// Keys returns the config keys accepted by Set, sorted alphabetically.
+func Keys() []string {
+	keys := make([]string, 0, len(setters))
+	for k := range setters {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Set validates and persists a single config value by key.
+// Unknown keys are rejected with the list of valid ones.
+func Set(key, value string) error {
+	setter, ok := setters[key]
+	if !ok {
+		return fmt.Errorf("unknown config key %q (valid keys: %s)", key, strings.Join(Keys(), ", "))
+	}
+
+	cfg := loadFile()
+	if err := setter(cfg, value); err != nil {
+		return fmt.Errorf("invalid value for %s: %w", key, err)
+	}
 	return save(cfg)
 }
 
+// SetAPIKey saves the API key to the config file, trimmed of surrounding
+// whitespace. An empty key is rejected.
+func SetAPIKey(key string) error {
+	return Set("api_key", key)
+}
+
+// Bounds for a plausible API key. Provider keys (gsk_..., sk-...) are
+// typically 40-60 characters; anything far outside that is likely a typo.
+const (
+	minAPIKeyLength = 20
+	maxAPIKeyLength = 200
+)
+
+// APIKeyWarning returns a human-readable warning if key looks malformed,
+// or "" if it looks fine. It doesn't reject anything: key formats vary by
+// provider, so a suspicious key is saved anyway.
+func APIKeyWarning(key string) string {
+	key = strings.TrimSpace(key)
+	switch {
+	case key == "":
+		return ""
+	case len(key) < minAPIKeyLength:
+		return fmt.Sprintf("this key is only %d characters; API keys are usually longer. Was it cut off?", len(key))
+	case len(key) > maxAPIKeyLength:
+		return fmt.Sprintf("this key is %d characters; API keys are usually much shorter. Did you paste extra text?", len(key))
+	case strings.ContainsAny(key, " \t\r\n"):
+		return "this key contains whitespace; API keys usually don't. Did you paste extra text?"
+	}
+	return ""
+}
+
 // SetModel saves the model preference to the config file.
 func SetModel(model string) error {
-	cfg := &Config{Model: defaultModel}
+	return Set("model", model)
+}
 
-	data, err := os.ReadFile(configPath())
-	if err == nil {
-		_ = json.Unmarshal(data, cfg)
+// SetTemperature saves the sampling temperature override, a number from 0
+// to MaxTemperature; "default" clears it.
+func SetTemperature(value string) error {
+	return Set("temperature", value)
+}
+
+// SetExtraInstructions saves the extra system prompt instructions.
+// An empty string clears them.
+func SetExtraInstructions(text string) error {
+	return Set("extra_instructions", text)
+}
+
+// View is the shape of `xx config show --json`. The API key is masked so
+// the output is safe to paste into bug reports.
+type View struct {
+	Provider             string   `json:"provider"`
+	Model                string   `json:"model"`
+	Temperature          *float64 `json:"temperature"`
+	TimeoutSeconds       int      `json:"timeout_seconds"`
+	ExecTimeoutSeconds   int      `json:"exec_timeout_seconds"`
+	MaxOutputBytes       int      `json:"max_output_bytes"`
+	APIKey               string   `json:"api_key"`
+	ExtraInstructions    string   `json:"extra_instructions"`
+	AuditLog             bool     `json:"audit_log"`
+	LearnDedupThreshold  float64  `json:"learn_dedup_threshold"`
+	FeedbackMinScore     float64  `json:"feedback_min_score"`
+	FeedbackTopK         int      `json:"feedback_top_k"`
+	SafeMode             bool     `json:"safe_mode"`
+	WeekStart            string   `json:"week_start"`
+	EnvSnapshot          bool     `json:"env_snapshot"`
+	SkipSensitiveHistory bool     `json:"skip_sensitive_history"`
+	NoProjectContext     bool     `json:"no_project_context"`
+	PostExecHook         string   `json:"post_exec_hook"`
+	PagerLines           int      `json:"pager_lines"`
+	ConfigDir            string   `json:"config_dir"`
+}
+
+// View returns the scriptable representation of the config.
+func (c *Config) View() View {
+	return View{
+		Provider:             c.ActiveProvider(),
+		Model:                c.Model,
+		Temperature:          c.Temperature,
+		TimeoutSeconds:       int(c.RequestTimeout() / time.Second),
+		ExecTimeoutSeconds:   int(c.ExecTimeout() / time.Second),
+		MaxOutputBytes:       c.MaxOutput(),
+		APIKey:               MaskAPIKey(c.APIKey),
+		ExtraInstructions:    c.ExtraInstructions,
+		AuditLog:             c.AuditLog,
+		LearnDedupThreshold:  c.LearnDedupThreshold,
+		FeedbackMinScore:     c.FeedbackMinScore,
+		FeedbackTopK:         c.FeedbackTopK,
+		SafeMode:             c.SafeMode,
+		WeekStart:            c.WeekStart,
+		EnvSnapshot:          c.EnvSnapshot,
+		SkipSensitiveHistory: c.SkipSensitiveHistory,
+		NoProjectContext:     c.NoProjectContext,
+		PostExecHook:         c.PostExecHook,
+		PagerLines:           c.PagerLines,
+		ConfigDir:            Dir(),
 	}
+}
 
-	cfg.Model = model
-	return save(cfg)
+// RequestTimeout returns the timeout for each AI request, 0 meaning none.
+func (c *Config) RequestTimeout() time.Duration {
+	if c.TimeoutSeconds == nil {
+		return DefaultTimeoutSeconds * time.Second
+	}
+	return time.Duration(*c.TimeoutSeconds) * time.Second
+}
+
+// ExecTimeout returns the timeout for each executed command, 0 meaning
+// none.
+func (c *Config) ExecTimeout() time.Duration {
+	if c.ExecTimeoutSeconds == nil {
+		return DefaultExecTimeoutSeconds * time.Second
+	}
+	return time.Duration(*c.ExecTimeoutSeconds) * time.Second
+}
+
+// MaxOutput returns the cap, in bytes, on output captured from each stream
+// of an executed command.
+func (c *Config) MaxOutput() int {
+	if c.MaxOutputBytes <= 0 {
+		return DefaultMaxOutputBytes
+	}
+	return c.MaxOutputBytes
+}
+
+// ActiveProvider returns the provider xx will use: the configured one, or
+// for configs without one, Groq if an API key is set and Ollama otherwise.
+func (c *Config) ActiveProvider() string {
+	if c.Provider != "" {
+		return c.Provider
+	}
+	if strings.TrimSpace(c.APIKey) != "" {
+		return ProviderGroq
+	}
+	return ProviderOllama
+}
+
+// MaskAPIKey hides all but the first and last 4 characters of a key.
+// Keys too short to mask meaningfully are fully hidden.
+func MaskAPIKey(key string) string {
+	if key == "" {
+		return ""
+	}
+	if len(key) <= 8 {
+		return strings.Repeat("*", len(key))
+	}
+	return key[:4] + "..." + key[len(key)-4:]
 }
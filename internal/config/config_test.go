@@ -1,10 +1,12 @@
 package config
 
 import (
+	"encoding/json"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestLoad_DefaultModel(t *testing.T) {
@@ -98,6 +100,49 @@ func TestSetAPIKey(t *testing.T) {
 	}
 }
 
+func TestSetAPIKey_TrimsPastedWhitespace(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	if err := SetAPIKey("  gsk_abcdefghijklmnopqrstuvwxyz0123\n"); err != nil {
+		t.Fatalf("SetAPIKey failed: %v", err)
+	}
+	cfg, _ := Load()
+	if cfg.APIKey != "gsk_abcdefghijklmnopqrstuvwxyz0123" {
+		t.Errorf("expected trimmed key, got %q", cfg.APIKey)
+	}
+}
+
+func TestSetAPIKey_RejectsEmpty(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	for _, key := range []string{"", "  \n"} {
+		if err := SetAPIKey(key); err == nil || !strings.Contains(err.Error(), "empty") {
+			t.Errorf("SetAPIKey(%q) = %v, want an empty-key error", key, err)
+		}
+	}
+	if _, err := os.Stat(configPath()); !os.IsNotExist(err) {
+		t.Error("a rejected key should not write the config file")
+	}
+}
+
+func TestAPIKeyWarning(t *testing.T) {
+	tests := []struct {
+		key  string
+		warn bool
+	}{
+		{"gsk_abcdefghijklmnopqrstuvwxyz0123", false},
+		{"gsk_abcdefghijklmnopqrstuvwxyz0123\n", false},
+		{"short", true},
+		{strings.Repeat("k", maxAPIKeyLength+1), true},
+		{"gsk_abcdefghij klmnopqrstuvwxyz0123", true},
+	}
+	for _, tt := range tests {
+		if got := APIKeyWarning(tt.key); (got != "") != tt.warn {
+			t.Errorf("APIKeyWarning(%q) = %q, want warning: %v", tt.key, got, tt.warn)
+		}
+	}
+}
+
 func TestSetModel_PreservesAPIKey(t *testing.T) {
 	origHome := os.Getenv("HOME")
 	tmpDir := t.TempDir()
@@ -150,3 +195,427 @@ func TestLoad_InvalidJSON(t *testing.T) {
 		t.Errorf("expected default model on invalid JSON, got %q", cfg.Model)
 	}
 }
+
+func TestSet_UnknownKey(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	err := Set("colour", "blue")
+	if err == nil {
+		t.Fatal("expected error for unknown key")
+	}
+	if !strings.Contains(err.Error(), "unknown config key") || !strings.Contains(err.Error(), "model") {
+		t.Errorf("error should name the problem and list valid keys, got: %v", err)
+	}
+}
+
+func TestSet_KnownKeys(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	if err := Set("model", "qwen2.5:7b"); err != nil {
+		t.Fatalf("Set model failed: %v", err)
+	}
+	if err := Set("api_key", "sk-test-12345678"); err != nil {
+		t.Fatalf("Set api_key failed: %v", err)
+	}
+
+	cfg, _ := Load()
+	if cfg.Model != "qwen2.5:7b" {
+		t.Errorf("expected model 'qwen2.5:7b', got %q", cfg.Model)
+	}
+	if cfg.APIKey != "sk-test-12345678" {
+		t.Errorf("expected api key to be set, got %q", cfg.APIKey)
+	}
+}
+
+func TestSet_EmptyModelRejected(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	if err := Set("model", " "); err == nil {
+		t.Error("expected error for empty model")
+	}
+}
+
+func TestView_JSONShape(t *testing.T) {
+	cfg := &Config{Model: "llama3.2:latest", APIKey: "sk-abcdefghijkl"}
+
+	data, err := json.Marshal(cfg.View())
+	if err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+
+	var got map[string]any
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("unmarshal failed: %v", err)
+	}
+	for _, key := range []string{"provider", "model", "temperature", "timeout_seconds", "exec_timeout_seconds", "max_output_bytes", "api_key", "extra_instructions", "audit_log", "learn_dedup_threshold", "feedback_min_score", "feedback_top_k", "safe_mode", "week_start", "env_snapshot", "skip_sensitive_history", "no_project_context", "post_exec_hook", "pager_lines", "config_dir"} {
+		if _, ok := got[key]; !ok {
+			t.Errorf("JSON output missing key %q: %s", key, data)
+		}
+	}
+	if got["model"] != "llama3.2:latest" {
+		t.Errorf("unexpected model: %q", got["model"])
+	}
+	if got["api_key"] != "sk-a...ijkl" {
+		t.Errorf("api key should be masked, got %q", got["api_key"])
+	}
+}
+
+func TestMaskAPIKey(t *testing.T) {
+	tests := []struct {
+		key, want string
+	}{
+		{"", ""},
+		{"abc", "***"},
+		{"12345678", "********"},
+		{"sk-1234567890", "sk-1...7890"},
+	}
+	for _, tt := range tests {
+		if got := MaskAPIKey(tt.key); got != tt.want {
+			t.Errorf("MaskAPIKey(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestSetExtraInstructions(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	if err := SetExtraInstructions("  always prefer fd over find  "); err != nil {
+		t.Fatalf("SetExtraInstructions failed: %v", err)
+	}
+	cfg, _ := Load()
+	if cfg.ExtraInstructions != "always prefer fd over find" {
+		t.Errorf("expected trimmed instructions, got %q", cfg.ExtraInstructions)
+	}
+
+	if err := SetExtraInstructions(""); err != nil {
+		t.Fatalf("clearing instructions failed: %v", err)
+	}
+	cfg, _ = Load()
+	if cfg.ExtraInstructions != "" {
+		t.Errorf("expected instructions cleared, got %q", cfg.ExtraInstructions)
+	}
+}
+
+func TestSetExtraInstructions_TooLong(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	err := SetExtraInstructions(strings.Repeat("x", MaxExtraInstructions+1))
+	if err == nil || !strings.Contains(err.Error(), "too long") {
+		t.Errorf("expected length error, got %v", err)
+	}
+	if err := SetExtraInstructions(strings.Repeat("x", MaxExtraInstructions)); err != nil {
+		t.Errorf("instructions at the cap should be accepted: %v", err)
+	}
+}
+
+func TestSet_LearnDedupThreshold(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	if err := Set("learn_dedup_threshold", "0.9"); err != nil {
+		t.Fatalf("Set learn_dedup_threshold failed: %v", err)
+	}
+	cfg, _ := Load()
+	if cfg.LearnDedupThreshold != 0.9 {
+		t.Errorf("expected threshold 0.9, got %v", cfg.LearnDedupThreshold)
+	}
+
+	for _, bad := range []string{"0", "1.5", "-0.2", "high"} {
+		if err := Set("learn_dedup_threshold", bad); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+
+	if err := Set("learn_dedup_threshold", "default"); err != nil {
+		t.Fatalf("Set learn_dedup_threshold default failed: %v", err)
+	}
+	if cfg, _ := Load(); cfg.LearnDedupThreshold != 0 {
+		t.Errorf("default should clear the override, got %v", cfg.LearnDedupThreshold)
+	}
+}
+
+func TestSet_FeedbackMinScore(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	if err := Set("feedback_min_score", "0.4"); err != nil {
+		t.Fatalf("Set feedback_min_score failed: %v", err)
+	}
+	cfg, _ := Load()
+	if cfg.FeedbackMinScore != 0.4 {
+		t.Errorf("expected floor 0.4, got %v", cfg.FeedbackMinScore)
+	}
+
+	for _, bad := range []string{"0", "1.5", "-0.2", "low"} {
+		if err := Set("feedback_min_score", bad); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+
+	if err := Set("feedback_min_score", "default"); err != nil {
+		t.Fatalf("Set feedback_min_score default failed: %v", err)
+	}
+	if cfg, _ := Load(); cfg.FeedbackMinScore != 0 {
+		t.Errorf("default should clear the override, got %v", cfg.FeedbackMinScore)
+	}
+}
+
+func TestSet_FeedbackTopK(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	if err := Set("feedback_top_k", "1"); err != nil {
+		t.Fatalf("Set feedback_top_k failed: %v", err)
+	}
+	cfg, _ := Load()
+	if cfg.FeedbackTopK != 1 {
+		t.Errorf("expected 1, got %d", cfg.FeedbackTopK)
+	}
+
+	for _, bad := range []string{"0", "-3", "21", "2.5", "all"} {
+		if err := Set("feedback_top_k", bad); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestSet_PostExecHook(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	hook := filepath.Join(home, "hook.sh")
+	if err := os.WriteFile(hook, []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Set("post_exec_hook", "~/hook.sh"); err != nil {
+		t.Fatalf("Set post_exec_hook failed: %v", err)
+	}
+	cfg, _ := Load()
+	if cfg.PostExecHook != hook {
+		t.Errorf("expected ~ expanded to %s, got %q", hook, cfg.PostExecHook)
+	}
+
+	if err := Set("post_exec_hook", "none"); err != nil {
+		t.Fatalf("clearing post_exec_hook failed: %v", err)
+	}
+	if cfg, _ := Load(); cfg.PostExecHook != "" {
+		t.Errorf("expected the hook cleared, got %q", cfg.PostExecHook)
+	}
+
+	notExec := filepath.Join(home, "notes.txt")
+	if err := os.WriteFile(notExec, []byte("hi"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, bad := range []string{filepath.Join(home, "missing.sh"), home, notExec} {
+		if err := Set("post_exec_hook", bad); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestSet_PagerLines(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	if err := Set("pager_lines", "40"); err != nil {
+		t.Fatalf("Set pager_lines failed: %v", err)
+	}
+	if cfg, _ := Load(); cfg.PagerLines != 40 {
+		t.Errorf("expected 40, got %d", cfg.PagerLines)
+	}
+	if err := Set("pager_lines", "off"); err != nil {
+		t.Fatalf("Set pager_lines off failed: %v", err)
+	}
+	if cfg, _ := Load(); cfg.PagerLines != 0 {
+		t.Errorf("expected paging off, got %d", cfg.PagerLines)
+	}
+	for _, bad := range []string{"-1", "lots"} {
+		if err := Set("pager_lines", bad); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestSet_WeekStart(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	if err := Set("week_start", " Monday "); err != nil {
+		t.Fatalf("Set week_start failed: %v", err)
+	}
+	cfg, _ := Load()
+	if cfg.WeekStart != "monday" {
+		t.Errorf("expected week_start monday, got %q", cfg.WeekStart)
+	}
+
+	for _, bad := range []string{"", "tuesday", "7"} {
+		if err := Set("week_start", bad); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestSetDir_OverridesAndResets(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	defer SetDir("")
+
+	dir := t.TempDir()
+	if err := SetDir(dir); err != nil {
+		t.Fatalf("SetDir failed: %v", err)
+	}
+	if Dir() != dir {
+		t.Errorf("Dir() = %q, want %q", Dir(), dir)
+	}
+	if err := SetModel("qwen2.5:7b"); err != nil {
+		t.Fatalf("SetModel failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, fileName)); err != nil {
+		t.Errorf("config should be written to the override dir: %v", err)
+	}
+
+	if err := SetDir("relative/dir"); err != nil {
+		t.Fatalf("SetDir failed: %v", err)
+	}
+	if !filepath.IsAbs(Dir()) {
+		t.Errorf("relative dirs should be made absolute, got %q", Dir())
+	}
+
+	_ = SetDir("")
+	if !strings.HasSuffix(Dir(), dirName) {
+		t.Errorf("empty dir should restore the default, got %q", Dir())
+	}
+}
+
+func TestSet_Provider(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	if err := Set("provider", " OpenAI "); err != nil {
+		t.Fatalf("Set provider failed: %v", err)
+	}
+	cfg, _ := Load()
+	if cfg.Provider != ProviderOpenAI {
+		t.Errorf("expected provider openai, got %q", cfg.Provider)
+	}
+	if err := Set("provider", "anthropic"); err == nil {
+		t.Error("expected an error for an unknown provider")
+	}
+}
+
+func TestSetTemperature(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	for _, bad := range []string{"-0.1", "2.5", "warm"} {
+		if err := SetTemperature(bad); err == nil {
+			t.Errorf("expected an error for temperature %q", bad)
+		}
+	}
+
+	if err := SetTemperature("0"); err != nil {
+		t.Fatalf("SetTemperature failed: %v", err)
+	}
+	cfg, _ := Load()
+	if cfg.Temperature == nil || *cfg.Temperature != 0 {
+		t.Fatalf("an explicit 0 should be kept, got %v", cfg.Temperature)
+	}
+
+	if err := SetTemperature("default"); err != nil {
+		t.Fatalf("SetTemperature failed: %v", err)
+	}
+	if cfg, _ := Load(); cfg.Temperature != nil {
+		t.Errorf("default should clear the override, got %v", *cfg.Temperature)
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	cfg, _ := Load()
+	if got := cfg.RequestTimeout(); got != DefaultTimeoutSeconds*time.Second {
+		t.Errorf("unset timeout = %v, want the default", got)
+	}
+
+	if err := Set("timeout_seconds", "-5"); err == nil {
+		t.Error("expected an error for a negative timeout")
+	}
+	if err := Set("timeout_seconds", "120"); err != nil {
+		t.Fatalf("Set timeout_seconds failed: %v", err)
+	}
+	cfg, _ = Load()
+	if got := cfg.RequestTimeout(); got != 2*time.Minute {
+		t.Errorf("timeout = %v, want 2m", got)
+	}
+
+	if err := Set("timeout_seconds", "0"); err != nil {
+		t.Fatalf("Set timeout_seconds failed: %v", err)
+	}
+	cfg, _ = Load()
+	if got := cfg.RequestTimeout(); got != 0 {
+		t.Errorf("0 should mean no timeout, got %v", got)
+	}
+}
+
+func TestExecTimeout(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	cfg, _ := Load()
+	if got := cfg.ExecTimeout(); got != DefaultExecTimeoutSeconds*time.Second {
+		t.Errorf("unset exec timeout = %v, want the default", got)
+	}
+	if err := Set("exec_timeout_seconds", "soon"); err == nil {
+		t.Error("expected an error for a non-number")
+	}
+	if err := Set("exec_timeout_seconds", "0"); err != nil {
+		t.Fatalf("Set exec_timeout_seconds failed: %v", err)
+	}
+	cfg, _ = Load()
+	if got := cfg.ExecTimeout(); got != 0 {
+		t.Errorf("0 should mean no timeout, got %v", got)
+	}
+	if err := Set("exec_timeout_seconds", "default"); err != nil {
+		t.Fatalf("Set exec_timeout_seconds failed: %v", err)
+	}
+	cfg, _ = Load()
+	if cfg.ExecTimeoutSeconds != nil {
+		t.Errorf("default should clear the setting, got %d", *cfg.ExecTimeoutSeconds)
+	}
+}
+
+func TestMaxOutput(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	cfg, _ := Load()
+	if got := cfg.MaxOutput(); got != DefaultMaxOutputBytes {
+		t.Errorf("unset max output = %d, want the default", got)
+	}
+	for _, bad := range []string{"0", "-1", "lots"} {
+		if err := Set("max_output_bytes", bad); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+	if err := Set("max_output_bytes", "4096"); err != nil {
+		t.Fatalf("Set max_output_bytes failed: %v", err)
+	}
+	cfg, _ = Load()
+	if got := cfg.MaxOutput(); got != 4096 {
+		t.Errorf("max output = %d, want 4096", got)
+	}
+	if err := Set("max_output_bytes", "default"); err != nil {
+		t.Fatalf("Set max_output_bytes failed: %v", err)
+	}
+	cfg, _ = Load()
+	if cfg.MaxOutputBytes != 0 {
+		t.Errorf("default should clear the setting, got %d", cfg.MaxOutputBytes)
+	}
+}
+
+func TestActiveProvider(t *testing.T) {
+	tests := []struct {
+		cfg  Config
+		want string
+	}{
+		{Config{}, ProviderOllama},
+		{Config{APIKey: "gsk_test"}, ProviderGroq}, // Configs from before the provider setting.
+		{Config{Provider: ProviderOpenAI, APIKey: "sk-test"}, ProviderOpenAI},
+		{Config{Provider: ProviderOllama, APIKey: "gsk_test"}, ProviderOllama},
+	}
+	for _, tt := range tests {
+		if got := tt.cfg.ActiveProvider(); got != tt.want {
+			t.Errorf("ActiveProvider(%+v) = %q, want %q", tt.cfg, got, tt.want)
+		}
+	}
+}
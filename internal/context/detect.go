@@ -7,6 +7,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 )
 
 // ProjectInfo holds detected project metadata.
@@ -54,10 +55,66 @@ var markers = map[string]string{
 	"main.tf":             "terraform",
 }
 
+// ProjectRoot returns the project a directory belongs to: the nearest
+// ancestor containing .git, or the directory itself if there is none.
+// History entries and indexed knowledge are scoped by this path.
+func ProjectRoot(dir string) string {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return dir
+	}
+	for d := abs; ; {
+		if _, err := os.Stat(filepath.Join(d, ".git")); err == nil {
+			return d
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			return abs
+		}
+		d = parent
+	}
+}
+
+// CurrentProject returns ProjectRoot for the working directory.
+func CurrentProject() string {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	return ProjectRoot(cwd)
+}
+
+// detected caches the last Detect result, for the directory in its Dir.
+var (
+	detectMu sync.Mutex
+	detected *ProjectInfo
+)
+
+// scanDir does the work of Detect for dir. It's a variable so tests can
+// count the scans.
+var scanDir = detect
+
 // Detect analyzes the current directory and returns project info.
+//
+// The result is cached for the life of the process: a translation builds
+// the system prompt more than once, and a chat asks for it every message,
+// and each fresh look reads the directory and runs git three times. A
+// change of working directory starts over. Callers mustn't modify the
+// result.
 func Detect() *ProjectInfo {
 	cwd, _ := os.Getwd()
 
+	detectMu.Lock()
+	defer detectMu.Unlock()
+	if detected != nil && detected.Dir == cwd {
+		return detected
+	}
+	detected = scanDir(cwd)
+	return detected
+}
+
+// detect scans cwd for project markers and git context.
+func detect(cwd string) *ProjectInfo {
 	info := &ProjectInfo{
 		Type:    "unknown",
 		Dir:     cwd,
@@ -0,0 +1,73 @@
+package context
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProjectRoot_FindsGitDir(t *testing.T) {
+	root := t.TempDir()
+	sub := filepath.Join(root, "pkg", "inner")
+	os.MkdirAll(sub, 0o755)
+	os.Mkdir(filepath.Join(root, ".git"), 0o755)
+
+	if got := ProjectRoot(sub); got != root {
+		t.Errorf("ProjectRoot(%s) = %q, want %q", sub, got, root)
+	}
+}
+
+func TestProjectRoot_NoGitReturnsDir(t *testing.T) {
+	dir := t.TempDir()
+	if got := ProjectRoot(dir); got != dir {
+		t.Errorf("ProjectRoot without .git should return the dir itself, got %q", got)
+	}
+}
+
+func TestTakeSnapshot_CapturesDirAndProjectType(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/x\n"), 0o644)
+	t.Chdir(dir)
+	t.Setenv("NODE_ENV", "test")
+	t.Setenv("GITHUB_TOKEN", "secret")
+
+	s := TakeSnapshot()
+	if s.Dir != dir {
+		t.Errorf("Dir = %q, want %q", s.Dir, dir)
+	}
+	if s.ProjectType != "go" {
+		t.Errorf("ProjectType = %q, want go", s.ProjectType)
+	}
+	if s.Env["NODE_ENV"] != "test" {
+		t.Errorf("allowlisted NODE_ENV should be recorded, got %v", s.Env)
+	}
+	if _, ok := s.Env["GITHUB_TOKEN"]; ok {
+		t.Error("env vars outside the allowlist must not be recorded")
+	}
+}
+
+func TestDetect_CachedPerDirectory(t *testing.T) {
+	scans := 0
+	origScan := scanDir
+	scanDir = func(dir string) *ProjectInfo {
+		scans++
+		return detect(dir)
+	}
+	defer func() { scanDir = origScan }()
+
+	goDir, nodeDir := t.TempDir(), t.TempDir()
+	os.WriteFile(filepath.Join(goDir, "go.mod"), []byte("module example.com/x\n"), 0o644)
+	os.WriteFile(filepath.Join(nodeDir, "package.json"), []byte("{}"), 0o644)
+
+	t.Chdir(goDir)
+	first, second := Detect(), Detect()
+	if first.Type != "go" || second != first || scans != 1 {
+		t.Fatalf("expected one scan and the cached go project twice, got %d scans (%+v, %+v)", scans, first, second)
+	}
+
+	// A new working directory is scanned afresh.
+	t.Chdir(nodeDir)
+	if got := Detect(); got.Type != "node" || scans != 2 {
+		t.Errorf("expected a rescan finding node after cd, got %q after %d scans", got.Type, scans)
+	}
+}
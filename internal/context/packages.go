@@ -0,0 +1,95 @@
+package context
+
+import (
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// PackageManagers holds the package managers relevant to an install request:
+// the OS-level one (brew, apt, ...) and the current project's (npm, pip, ...).
+// Either may be empty if nothing was detected.
+type PackageManagers struct {
+	System  string
+	Project string
+}
+
+// systemManagers lists candidate OS package managers in preference order.
+var systemManagers = map[string][]string{
+	"darwin":  {"brew", "port"},
+	"linux":   {"apt", "dnf", "yum", "pacman", "zypper", "apk"},
+	"windows": {"winget", "choco", "scoop"},
+}
+
+// lookPath is a variable so tests can fake which binaries are installed.
+var lookPath = exec.LookPath
+
+// DetectPackageManagers finds the system package manager on PATH and infers
+// the project package manager from the detected project type and lockfiles.
+func DetectPackageManagers(p *ProjectInfo) PackageManagers {
+	var pm PackageManagers
+	for _, name := range systemManagers[runtime.GOOS] {
+		if _, err := lookPath(name); err == nil {
+			pm.System = name
+			break
+		}
+	}
+	if p != nil {
+		pm.Project = projectManager(p)
+	}
+	return pm
+}
+
+// projectManager maps a project to the tool that installs its dependencies.
+func projectManager(p *ProjectInfo) string {
+	has := func(name string) bool {
+		for _, f := range p.ConfigFiles {
+			if f == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch p.Type {
+	case "node":
+		switch {
+		case has("pnpm-lock.yaml"):
+			return "pnpm"
+		case has("yarn.lock"):
+			return "yarn"
+		default:
+			return "npm"
+		}
+	case "python":
+		if has("Pipfile") {
+			return "pipenv"
+		}
+		return "pip"
+	case "go":
+		return "go"
+	case "rust":
+		return "cargo"
+	case "ruby":
+		return "bundler"
+	case "java":
+		return "maven"
+	case "gradle":
+		return "gradle"
+	}
+	return ""
+}
+
+// Summary returns the package manager lines for the AI prompt.
+func (pm PackageManagers) Summary() string {
+	var parts []string
+	if pm.System != "" {
+		parts = append(parts, "System package manager: "+pm.System)
+	} else {
+		parts = append(parts, "System package manager: unknown (none found on PATH)")
+	}
+	if pm.Project != "" {
+		parts = append(parts, "Project package manager: "+pm.Project)
+	}
+	return strings.Join(parts, "\n")
+}
@@ -0,0 +1,59 @@
+package context
+
+import (
+	"errors"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestDetectPackageManagers_System(t *testing.T) {
+	candidates := systemManagers[runtime.GOOS]
+	if len(candidates) == 0 {
+		t.Skip("no package managers defined for " + runtime.GOOS)
+	}
+	want := candidates[len(candidates)-1]
+
+	orig := lookPath
+	lookPath = func(name string) (string, error) {
+		if name == want {
+			return "/usr/bin/" + name, nil
+		}
+		return "", errors.New("not found")
+	}
+	defer func() { lookPath = orig }()
+
+	if got := DetectPackageManagers(nil).System; got != want {
+		t.Errorf("expected system manager %q, got %q", want, got)
+	}
+}
+
+func TestDetectPackageManagers_Project(t *testing.T) {
+	tests := []struct {
+		info *ProjectInfo
+		want string
+	}{
+		{&ProjectInfo{Type: "node", ConfigFiles: []string{"package.json"}}, "npm"},
+		{&ProjectInfo{Type: "node", ConfigFiles: []string{"package.json", "pnpm-lock.yaml"}}, "pnpm"},
+		{&ProjectInfo{Type: "node", ConfigFiles: []string{"package.json", "yarn.lock"}}, "yarn"},
+		{&ProjectInfo{Type: "python", ConfigFiles: []string{"requirements.txt"}}, "pip"},
+		{&ProjectInfo{Type: "python", ConfigFiles: []string{"Pipfile"}}, "pipenv"},
+		{&ProjectInfo{Type: "rust"}, "cargo"},
+		{&ProjectInfo{Type: "unknown"}, ""},
+	}
+	for _, tt := range tests {
+		if got := DetectPackageManagers(tt.info).Project; got != tt.want {
+			t.Errorf("project %s %v: expected %q, got %q", tt.info.Type, tt.info.ConfigFiles, tt.want, got)
+		}
+	}
+}
+
+func TestPackageManagers_Summary(t *testing.T) {
+	s := PackageManagers{System: "brew", Project: "npm"}.Summary()
+	if !strings.Contains(s, "System package manager: brew") || !strings.Contains(s, "Project package manager: npm") {
+		t.Errorf("unexpected summary: %q", s)
+	}
+	if !strings.Contains(PackageManagers{}.Summary(), "unknown") {
+		t.Error("missing system manager should be reported as unknown")
+	}
+}
@@ -0,0 +1,58 @@
+package context
+
+import "os"
+
+// SnapshotEnvVars are the environment variables a Snapshot may record.
+// It's an allowlist on purpose: env vars routinely hold tokens and
+// passwords, so only names that describe the toolchain setup are kept.
+var SnapshotEnvVars = []string{
+	"SHELL",
+	"VIRTUAL_ENV",
+	"CONDA_DEFAULT_ENV",
+	"NODE_ENV",
+	"GOOS",
+	"GOARCH",
+	"GOFLAGS",
+	"JAVA_HOME",
+	"KUBECONFIG",
+	"AWS_PROFILE",
+	"AWS_REGION",
+	"DOCKER_HOST",
+}
+
+// Snapshot is the environment a command ran in, recorded alongside its
+// history entry so an intermittent failure can be compared with a run
+// that worked.
+type Snapshot struct {
+	Dir         string            `json:"dir"`
+	ProjectType string            `json:"project_type,omitempty"`
+	GitBranch   string            `json:"git_branch,omitempty"`
+	Env         map[string]string `json:"env,omitempty"`
+}
+
+// TakeSnapshot captures the working directory, project type, git branch
+// and the set variables from SnapshotEnvVars. Like Detect it's
+// best-effort: anything it can't determine is left empty.
+func TakeSnapshot() *Snapshot {
+	info := Detect()
+	s := &Snapshot{Dir: info.Dir}
+	if info.Type != "unknown" {
+		s.ProjectType = info.Type
+	}
+	if info.Git != nil {
+		s.GitBranch = info.Git.Branch
+	} else if info.Dir != "" {
+		// Detect only looks for .git in the working directory itself.
+		s.GitBranch = gitCmd(info.Dir, "rev-parse", "--abbrev-ref", "HEAD")
+	}
+
+	for _, name := range SnapshotEnvVars {
+		if value, ok := os.LookupEnv(name); ok {
+			if s.Env == nil {
+				s.Env = make(map[string]string)
+			}
+			s.Env[name] = value
+		}
+	}
+	return s
+}
@@ -3,35 +3,135 @@ package executor
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"runtime"
 	"strings"
+	"time"
 )
 
+// DefaultMaxOutput is the default cap on captured output per stream (64KB).
+// Anything beyond it is discarded as it arrives, so a command that prints
+// gigabytes can't exhaust xx's memory or bloat the history file.
+const DefaultMaxOutput = 64 << 10
+
+// TruncationMarker starts the line appended to output that hit the cap. It
+// differs from the "(truncated)" the AI client adds when trimming text for
+// a prompt, so OutputTruncated can tell the data itself is partial.
+const TruncationMarker = "[xx: output truncated"
+
+// Options controls how RunWithOptions executes a command.
+type Options struct {
+	// MaxOutput caps the bytes kept from each of stdout and stderr.
+	// Zero means DefaultMaxOutput.
+	MaxOutput int
+	// Timeout kills the command, and everything it started, if it's still
+	// running after this long. Zero means no timeout.
+	Timeout time.Duration
+	// Interactive attaches the command to xx's own stdin, stdout and
+	// stderr instead of capturing its output, for editors, ssh, REPLs and
+	// anything else that needs the terminal. The returned output is empty.
+	Interactive bool
+	// Dir is the directory to run the command in. Empty means xx's own
+	// working directory.
+	Dir string
+}
+
+// ErrTimedOut is returned, wrapped with the timeout, for a command killed
+// because it ran past Options.Timeout.
+var ErrTimedOut = errors.New("command timed out")
+
+// waitDelay is how long to wait for output after killing a timed-out
+// command, in case something it started escaped and still holds the pipes.
+const waitDelay = 2 * time.Second
+
 // Run executes a shell command and returns its combined output.
 // It uses the system's default shell for proper command interpretation.
 func Run(command string) (string, error) {
+	return RunWithOptions(command, Options{})
+}
+
+// ExitCode extracts the process exit code from an error returned by Run or
+// RunWithOptions: 0 for nil, the status for a command that ran and failed,
+// -1 for one that couldn't be started or was killed by a signal.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+// RunWithOptions is Run with explicit execution options.
+func RunWithOptions(command string, opts Options) (string, error) {
+	// For cd commands, emit a special marker that the shell wrapper can intercept.
+	// If running without the wrapper, it falls back to a helpful hint.
+	// A cd that's part of a larger command runs in the shell like any other.
+	if dir, ok := CdTarget(command); ok {
+		return fmt.Sprintf("__XX_CD__:%s", dir), nil
+	}
+
 	shell, flag := shellAndFlag()
+	return execute(append([]string{shell, flag}, command), opts)
+}
+
+// RunArgs runs a program directly, without a shell, so nothing in argv is
+// interpreted: no pipes, redirects, expansions or command separators. It
+// honors opts like RunWithOptions.
+func RunArgs(argv []string, opts Options) (string, error) {
+	if len(argv) == 0 {
+		return "", errors.New("empty command")
+	}
+	return execute(argv, opts)
+}
 
-	cmd := exec.Command(shell, flag, command)
+// execute runs argv and returns its output, capped or attached to the
+// terminal as opts says.
+func execute(argv []string, opts Options) (string, error) {
+	ctx := context.Background()
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Cancel = func() error { return killTree(cmd.Process.Pid) }
+	cmd.WaitDelay = waitDelay
 	cmd.Env = os.Environ()
 	cmd.Dir, _ = os.Getwd()
+	if opts.Dir != "" {
+		cmd.Dir = opts.Dir
+		cmd.Env = append(cmd.Env, "PWD="+opts.Dir)
+	}
 
-	// For cd commands, emit a special marker that the shell wrapper can intercept.
-	// If running without the wrapper, it falls back to a helpful hint.
-	if isCdCommand(command) {
-		dir := extractCdTarget(command)
-		expanded := expandHome(dir)
-		return fmt.Sprintf("__XX_CD__:%s", expanded), nil
+	if opts.Interactive {
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+		err := cmd.Run()
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("%w after %s", ErrTimedOut, opts.Timeout)
+		}
+		return "", err
 	}
 
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	limit := opts.MaxOutput
+	if limit <= 0 {
+		limit = DefaultMaxOutput
+	}
+	stdout := &cappedBuffer{limit: limit}
+	stderr := &cappedBuffer{limit: limit}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
 
 	err := cmd.Run()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("%w after %s", ErrTimedOut, opts.Timeout)
+	}
 
 	output := stdout.String()
 	if errOut := stderr.String(); errOut != "" {
@@ -44,6 +144,43 @@ func Run(command string) (string, error) {
 	return output, err
 }
 
+// cappedBuffer keeps the first limit bytes written to it and silently
+// discards the rest. It keeps accepting writes (rather than erroring) so the
+// child process isn't killed by SIGPIPE and its exit status stays accurate.
+type cappedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (c *cappedBuffer) Write(p []byte) (int, error) {
+	if room := c.limit - c.buf.Len(); room > 0 {
+		if len(p) > room {
+			c.buf.Write(p[:room])
+			c.truncated = true
+		} else {
+			c.buf.Write(p)
+		}
+	} else if len(p) > 0 {
+		c.truncated = true
+	}
+	return len(p), nil
+}
+
+// String returns the captured output, with a marker if anything was dropped.
+func (c *cappedBuffer) String() string {
+	if !c.truncated {
+		return c.buf.String()
+	}
+	return c.buf.String() + fmt.Sprintf("\n%s at %d bytes, the rest was discarded]", TruncationMarker, c.limit)
+}
+
+// OutputTruncated reports whether output, as returned by RunWithOptions,
+// was cut off at the output cap.
+func OutputTruncated(output string) bool {
+	return strings.Contains(output, TruncationMarker)
+}
+
 func shellAndFlag() (string, string) {
 	if runtime.GOOS == "windows" {
 		return "powershell", "-Command"
@@ -54,25 +191,105 @@ func shellAndFlag() (string, string) {
 	return "/bin/sh", "-c"
 }
 
+// windowsCdCommands are the PowerShell ways to change directory: cd and
+// chdir are aliases of Set-Location, as is sl. Cmdlet names are
+// case-insensitive there, unlike POSIX shells.
+var windowsCdCommands = []string{"cd", "chdir", "sl", "set-location"}
+
 func isCdCommand(command string) bool {
-	trimmed := strings.TrimSpace(command)
-	return trimmed == "cd" || strings.HasPrefix(trimmed, "cd ")
+	_, ok := splitCdCommand(command)
+	return ok
+}
+
+// splitCdCommand reports whether command is a directory change and returns
+// its raw argument.
+func splitCdCommand(command string) (string, bool) {
+	name, arg, _ := strings.Cut(strings.TrimSpace(command), " ")
+	if runtime.GOOS != "windows" {
+		return strings.TrimSpace(arg), name == "cd"
+	}
+	name = strings.ToLower(name)
+	for _, n := range windowsCdCommands {
+		if name == n {
+			return strings.TrimSpace(arg), true
+		}
+	}
+	return "", false
+}
+
+// cdOperators mark a cd that's part of a larger shell command, such as
+// cd frontend && npm run build, rather than a bare directory change.
+const cdOperators = ";|&<>$`()\n"
+
+// CdTarget reports whether command is a bare directory change, cd with at
+// most one argument and no shell operators, and returns its target with
+// quotes stripped and ~ expanded. A relative target is returned as is, for
+// the caller to resolve. Anything more, like cd frontend && make, isn't a
+// bare cd: it has to run in a shell.
+func CdTarget(command string) (string, bool) {
+	arg, ok := splitCdCommand(command)
+	if !ok || strings.ContainsAny(arg, cdOperators) {
+		return "", false
+	}
+	if runtime.GOOS == "windows" {
+		arg = powershellPathArg(arg)
+	} else if len(arg) >= 2 && (arg[0] == '"' || arg[0] == '\'') && arg[len(arg)-1] == arg[0] {
+		arg = arg[1 : len(arg)-1]
+	} else if strings.ContainsAny(arg, " \t'\"") {
+		return "", false
+	}
+	if arg == "" {
+		arg = "~"
+	}
+	return expandHome(arg), true
 }
 
 func extractCdTarget(command string) string {
-	parts := strings.SplitN(strings.TrimSpace(command), " ", 2)
-	if len(parts) < 2 {
+	target, _ := splitCdCommand(command)
+	if runtime.GOOS == "windows" {
+		target = powershellPathArg(target)
+	}
+	if target == "" {
 		return "~"
 	}
-	return strings.TrimSpace(parts[1])
+	return target
+}
+
+// powershellPathArg strips an explicit -Path/-LiteralPath parameter name and
+// surrounding quotes from a Set-Location argument.
+func powershellPathArg(arg string) string {
+	for _, param := range []string{"-path ", "-literalpath "} {
+		if strings.HasPrefix(strings.ToLower(arg), param) {
+			arg = strings.TrimSpace(arg[len(param):])
+			break
+		}
+	}
+	if len(arg) >= 2 && (arg[0] == '"' || arg[0] == '\'') && arg[len(arg)-1] == arg[0] {
+		arg = arg[1 : len(arg)-1]
+	}
+	return arg
 }
 
+// windowsHomePrefixes are the ways a PowerShell or cmd command refers to
+// the user's home directory, matched case-insensitively.
+var windowsHomePrefixes = []string{"$env:userprofile", "%userprofile%", "$home", "~"}
+
 func expandHome(path string) string {
-	if strings.HasPrefix(path, "~") {
-		home, err := os.UserHomeDir()
-		if err == nil {
-			return strings.Replace(path, "~", home, 1)
+	home, err := os.UserHomeDir() // %USERPROFILE% on Windows.
+	if err != nil {
+		return path
+	}
+	if runtime.GOOS == "windows" {
+		lower := strings.ToLower(path)
+		for _, prefix := range windowsHomePrefixes {
+			if strings.HasPrefix(lower, prefix) {
+				return home + path[len(prefix):]
+			}
 		}
+		return path
+	}
+	if strings.HasPrefix(path, "~") {
+		return strings.Replace(path, "~", home, 1)
 	}
 	return path
 }
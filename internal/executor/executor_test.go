@@ -1,8 +1,14 @@
 package executor
 
 import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestRun_SimpleCommand(t *testing.T) {
@@ -15,6 +21,22 @@ func TestRun_SimpleCommand(t *testing.T) {
 	}
 }
 
+func TestRunArgs_NoShell(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses echo from a POSIX system")
+	}
+	output, err := RunArgs([]string{"echo", "a; echo b", "$HOME"}, Options{})
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if got := strings.TrimSpace(output); got != "a; echo b $HOME" {
+		t.Errorf("arguments should be passed through uninterpreted, got %q", got)
+	}
+	if _, err := RunArgs(nil, Options{}); err == nil {
+		t.Error("expected an error for an empty argv")
+	}
+}
+
 func TestRun_FailingCommand(t *testing.T) {
 	_, err := Run("false")
 	if err == nil {
@@ -68,6 +90,33 @@ func TestExtractCdTarget(t *testing.T) {
 	}
 }
 
+func TestCdTarget(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("POSIX cd syntax")
+	}
+	tests := []struct {
+		input string
+		want  string
+		ok    bool
+	}{
+		{"cd /tmp", "/tmp", true},
+		{"cd frontend", "frontend", true},
+		{`cd "My Dir"`, "My Dir", true},
+		{"cd 'My Dir'", "My Dir", true},
+		{"cd frontend && npm run build", "", false},
+		{"cd src; make", "", false},
+		{"cd My Dir", "", false},
+		{"cd $HOME/x", "", false},
+		{"echo cd", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := CdTarget(tt.input)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("CdTarget(%q) = %q, %v, want %q, %v", tt.input, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
 func TestRun_MultiLineOutput(t *testing.T) {
 	output, err := Run("echo -e 'line1\nline2\nline3'")
 	if err != nil {
@@ -100,6 +149,15 @@ func TestRun_ExitCode(t *testing.T) {
 	if err == nil {
 		t.Fatal("expected error for non-zero exit code")
 	}
+	if got := ExitCode(err); got != 42 {
+		t.Errorf("expected exit code 42, got %d", got)
+	}
+	if got := ExitCode(nil); got != 0 {
+		t.Errorf("nil error should be exit 0, got %d", got)
+	}
+	if got := ExitCode(errors.New("could not start")); got != -1 {
+		t.Errorf("non-exit error should be -1, got %d", got)
+	}
 }
 
 func TestExpandHome(t *testing.T) {
@@ -178,3 +236,174 @@ func TestRun_CdWithTilde(t *testing.T) {
 		t.Errorf("expected tilde to be expanded, got: %s", output)
 	}
 }
+
+func TestRunWithOptions_CapsOutput(t *testing.T) {
+	// Produce 10,000 bytes of output with a 100-byte cap.
+	output, err := RunWithOptions("head -c 10000 /dev/zero | tr '\\0' a", Options{MaxOutput: 100})
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if !strings.HasPrefix(output, strings.Repeat("a", 100)+"\n") {
+		t.Errorf("expected first 100 bytes followed by a marker, got %q", output)
+	}
+	if !strings.Contains(output, "output truncated at 100 bytes") {
+		t.Errorf("expected truncation marker, got %q", output)
+	}
+	if len(output) > 200 {
+		t.Errorf("output should be capped, got %d bytes", len(output))
+	}
+}
+
+func TestRunWithOptions_UnderCapNotMarked(t *testing.T) {
+	output, err := RunWithOptions("echo hello", Options{MaxOutput: 100})
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if strings.Contains(output, "truncated") {
+		t.Errorf("output under the cap should not be marked, got %q", output)
+	}
+}
+
+func TestRunWithOptions_CapKeepsExitStatus(t *testing.T) {
+	_, err := RunWithOptions("head -c 5000 /dev/zero; exit 3", Options{MaxOutput: 10})
+	if err == nil || !strings.Contains(err.Error(), "exit status 3") {
+		t.Errorf("truncation should not mask the exit status, got: %v", err)
+	}
+}
+
+func TestRunWithOptions_Timeout(t *testing.T) {
+	start := time.Now()
+	output, err := RunWithOptions("echo started; sleep 30", Options{Timeout: 300 * time.Millisecond})
+	if !errors.Is(err, ErrTimedOut) || !strings.Contains(err.Error(), "command timed out after 300ms") {
+		t.Fatalf("expected a timeout error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("the command should be killed at the timeout, took %s", elapsed)
+	}
+	if !strings.Contains(output, "started") {
+		t.Errorf("output from before the timeout should be kept, got %q", output)
+	}
+
+	if _, err := RunWithOptions("echo quick", Options{Timeout: 10 * time.Second}); err != nil {
+		t.Errorf("a command inside the timeout should succeed, got %v", err)
+	}
+}
+
+func TestRunWithOptions_TimeoutKillsChildren(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses POSIX job control")
+	}
+	output, _ := RunWithOptions("sleep 30 & echo $!; wait", Options{Timeout: 300 * time.Millisecond})
+	pid := strings.TrimSpace(strings.SplitN(output, "\n", 2)[0])
+	if pid == "" {
+		t.Fatalf("expected the background pid, got %q", output)
+	}
+
+	// The killed sleep may linger as a zombie until it's reaped; it just
+	// mustn't still be running.
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		state, _ := exec.Command("ps", "-o", "stat=", "-p", pid).Output()
+		s := strings.TrimSpace(string(state))
+		if s == "" || strings.HasPrefix(s, "Z") {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("background child %s survived the timeout (state %s)", pid, s)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestCappedBuffer_ExactLimit(t *testing.T) {
+	c := &cappedBuffer{limit: 5}
+	c.Write([]byte("hello"))
+	if c.String() != "hello" {
+		t.Errorf("writing exactly the limit should not truncate, got %q", c.String())
+	}
+	c.Write([]byte("!"))
+	if !strings.HasPrefix(c.String(), "hello\n"+TruncationMarker) {
+		t.Errorf("expected truncation after exceeding limit, got %q", c.String())
+	}
+	if !OutputTruncated(c.String()) {
+		t.Error("OutputTruncated should recognize the marker")
+	}
+	if OutputTruncated("hello\n... (truncated)") {
+		t.Error("the AI client's own trimming marker isn't output truncation")
+	}
+}
+
+func TestIsInteractive(t *testing.T) {
+	tests := []struct {
+		command string
+		want    bool
+	}{
+		{"vim main.go", true},
+		{"sudo nano /etc/hosts", true},
+		{"ssh prod-db", true},
+		{"/usr/bin/htop", true},
+		{"git log | less", true},
+		{"cd src && vim main.go", true},
+		{"python3", true},
+		{"python3 script.py", false},
+		{"psql mydb", true},
+		{"psql mydb -c 'select 1'", false},
+		{"docker exec -it web sh", true},
+		{"docker ps -a", false},
+		{"git commit", true},
+		{"git commit --amend", true},
+		{"git commit -am 'fix typo'", false},
+		{"git commit --no-edit --amend", false},
+		{"git rebase -i HEAD~3", true},
+		{"git add -p", true},
+		{"git status", false},
+		{"crontab -e", true},
+		{"crontab -l", false},
+		{"ls -la", false},
+		{"grep -r vim .", false},
+		{"EDITOR=nvim env", false},
+	}
+	for _, tt := range tests {
+		if got := IsInteractive(tt.command); got != tt.want {
+			t.Errorf("IsInteractive(%q) = %v, want %v", tt.command, got, tt.want)
+		}
+	}
+}
+
+func TestRunWithOptions_Interactive(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a POSIX shell")
+	}
+	dir := t.TempDir()
+	in, err := os.Create(filepath.Join(dir, "in"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := in.WriteString("typed answer\n"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := in.Seek(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	out, err := os.Create(filepath.Join(dir, "out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	origIn, origOut := os.Stdin, os.Stdout
+	os.Stdin, os.Stdout = in, out
+	output, runErr := RunWithOptions("read line; echo \"got: $line\"", Options{Interactive: true})
+	os.Stdin, os.Stdout = origIn, origOut
+	in.Close()
+	out.Close()
+
+	if runErr != nil {
+		t.Fatalf("expected no error, got %v", runErr)
+	}
+	if output != "" {
+		t.Errorf("an interactive command's output shouldn't be captured, got %q", output)
+	}
+	written, _ := os.ReadFile(filepath.Join(dir, "out"))
+	if got := strings.TrimSpace(string(written)); got != "got: typed answer" {
+		t.Errorf("expected the command to read stdin and write to stdout, got %q", got)
+	}
+}
@@ -0,0 +1,77 @@
+//go:build windows
+
+package executor
+
+import (
+	"os"
+	"testing"
+)
+
+func TestIsCdCommand_Windows(t *testing.T) {
+	tests := []struct {
+		input string
+		want  bool
+	}{
+		{"cd C:\\Users", true},
+		{"CD C:\\Users", true}, // PowerShell is case-insensitive.
+		{"Set-Location C:\\Users", true},
+		{"set-location -Path C:\\Users", true},
+		{"sl ..", true},
+		{"chdir D:\\", true},
+		{"Get-Location", false},
+		{"echo cd", false},
+	}
+	for _, tt := range tests {
+		if got := isCdCommand(tt.input); got != tt.want {
+			t.Errorf("isCdCommand(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestExtractCdTarget_Windows(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"cd", "~"},
+		{"cd C:\\Users", "C:\\Users"},
+		{"Set-Location -Path C:\\Projects", "C:\\Projects"},
+		{"Set-Location -LiteralPath 'C:\\My Projects'", "C:\\My Projects"},
+		{"cd \"C:\\Program Files\"", "C:\\Program Files"},
+		{"sl $HOME\\Downloads", "$HOME\\Downloads"},
+	}
+	for _, tt := range tests {
+		if got := extractCdTarget(tt.input); got != tt.want {
+			t.Errorf("extractCdTarget(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestExpandHome_Windows(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip("no home directory")
+	}
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"~\\Downloads", home + "\\Downloads"},
+		{"$HOME\\Downloads", home + "\\Downloads"},
+		{"$env:USERPROFILE\\Documents", home + "\\Documents"},
+		{"%USERPROFILE%\\Desktop", home + "\\Desktop"},
+		{"C:\\Windows", "C:\\Windows"},
+	}
+	for _, tt := range tests {
+		if got := expandHome(tt.input); got != tt.want {
+			t.Errorf("expandHome(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestShellAndFlag_Windows(t *testing.T) {
+	shell, flag := shellAndFlag()
+	if shell != "powershell" || flag != "-Command" {
+		t.Errorf("shellAndFlag() = %q, %q; want powershell, -Command", shell, flag)
+	}
+}
@@ -0,0 +1,120 @@
+package executor
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// interactivePrograms take over the terminal whatever their arguments:
+// editors, pagers, full-screen monitors, terminal multiplexers, and ssh,
+// which needs the keyboard for a remote shell or a password prompt.
+var interactivePrograms = map[string]bool{
+	"vi": true, "vim": true, "nvim": true, "nano": true, "emacs": true, "pico": true, "micro": true,
+	"less": true, "more": true, "man": true,
+	"top": true, "htop": true, "btop": true, "atop": true, "watch": true,
+	"tmux": true, "screen": true, "mc": true, "ranger": true,
+	"ssh": true, "mosh": true, "telnet": true, "ftp": true, "sftp": true,
+	"visudo": true, "vipw": true,
+}
+
+// replPrograms start an interactive session when run without arguments,
+// and run a script or one-off command otherwise.
+var replPrograms = map[string]bool{
+	"python": true, "python3": true, "ipython": true, "node": true, "irb": true, "ghci": true, "lua": true,
+	"bash": true, "zsh": true, "sh": true, "fish": true,
+	"sqlite3": true,
+}
+
+// dbClients start an interactive session unless given a query to run.
+var dbClients = map[string]bool{
+	"psql": true, "mysql": true, "mongosh": true, "mongo": true, "redis-cli": true,
+}
+
+// shellSeparators split a command line into its simple commands.
+var shellSeparators = regexp.MustCompile(`\|\||&&|[|;&]`)
+
+// IsInteractive reports whether command needs the terminal: it runs an
+// editor, pager, ssh, a REPL or another program that reads the keyboard,
+// which would hang or fail with its output captured and no stdin. It's a
+// heuristic over the program names in each simple command.
+func IsInteractive(command string) bool {
+	for _, segment := range shellSeparators.Split(command, -1) {
+		if interactiveSegment(strings.Fields(segment)) {
+			return true
+		}
+	}
+	return false
+}
+
+// interactiveSegment reports whether one simple command, split into
+// words, needs the terminal.
+func interactiveSegment(fields []string) bool {
+	for len(fields) > 0 && (fields[0] == "sudo" || fields[0] == "env" || strings.Contains(fields[0], "=")) {
+		fields = fields[1:]
+	}
+	if len(fields) == 0 {
+		return false
+	}
+	name, args := filepath.Base(fields[0]), fields[1:]
+
+	switch {
+	case interactivePrograms[name]:
+		return true
+	case replPrograms[name]:
+		return len(args) == 0
+	case dbClients[name]:
+		return !hasAny(args, "-c", "--command", "-e", "--execute", "--eval", "-f", "--file")
+	}
+
+	switch name {
+	case "docker", "podman", "kubectl":
+		// docker run -it, docker exec -it, kubectl exec -it ...
+		return hasAny(args, "-it", "-ti", "-i", "-t", "--interactive", "--tty", "--stdin")
+	case "crontab":
+		return hasAny(args, "-e")
+	case "git":
+		return interactiveGit(args)
+	}
+	return false
+}
+
+// interactiveGit reports whether a git invocation opens an editor or an
+// interactive prompt.
+func interactiveGit(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	switch args[0] {
+	case "commit":
+		// Without a message, commit opens an editor for one.
+		for _, a := range args[1:] {
+			if a == "--no-edit" || strings.HasPrefix(a, "--message") || strings.HasPrefix(a, "--file") || a == "--fixup" {
+				return false
+			}
+			if strings.HasPrefix(a, "-") && !strings.HasPrefix(a, "--") && strings.ContainsAny(a, "mFC") {
+				return false
+			}
+		}
+		return true
+	case "rebase":
+		return hasAny(args[1:], "-i", "--interactive")
+	case "add", "checkout", "reset", "restore", "stash":
+		return hasAny(args[1:], "-p", "--patch", "-i", "--interactive")
+	case "mergetool":
+		return true
+	}
+	return false
+}
+
+// hasAny reports whether args contains any of want.
+func hasAny(args []string, want ...string) bool {
+	for _, a := range args {
+		for _, w := range want {
+			if a == w {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,52 @@
+//go:build !windows
+
+package executor
+
+import (
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// killTree kills the process pid and all its descendants. The command
+// stays in xx's process group, so Ctrl-C and terminal prompts (sudo) keep
+// working; the tree is found through ps instead. It's snapshotted before
+// anything is killed, since orphans are reparented and lose the link.
+func killTree(pid int) error {
+	for _, child := range descendants(pid) {
+		syscall.Kill(child, syscall.SIGKILL)
+	}
+	return syscall.Kill(pid, syscall.SIGKILL)
+}
+
+// descendants returns the pids of every process below pid, or nil if ps
+// isn't available.
+func descendants(pid int) []int {
+	out, err := exec.Command("ps", "-A", "-o", "pid=", "-o", "ppid=").Output()
+	if err != nil {
+		return nil
+	}
+	children := make(map[int][]int)
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		child, err1 := strconv.Atoi(fields[0])
+		parent, err2 := strconv.Atoi(fields[1])
+		if err1 == nil && err2 == nil {
+			children[parent] = append(children[parent], child)
+		}
+	}
+
+	var found []int
+	queue := children[pid]
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		found = append(found, p)
+		queue = append(queue, children[p]...)
+	}
+	return found
+}
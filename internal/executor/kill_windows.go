@@ -0,0 +1,11 @@
+package executor
+
+import (
+	"os/exec"
+	"strconv"
+)
+
+// killTree kills the process pid and all its descendants.
+func killTree(pid int) error {
+	return exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(pid)).Run()
+}
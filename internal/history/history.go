@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/arin/xx-cli/internal/config"
+	projctx "github.com/arin/xx-cli/internal/context"
 )
 
 const (
@@ -27,6 +28,30 @@ type Entry struct {
 	Command   string    `json:"command"`
 	Output    string    `json:"output,omitempty"`
 	Success   bool      `json:"success"`
+	Project   string    `json:"project,omitempty"` // Project root the command ran in (see context.ProjectRoot).
+	Dir       string    `json:"dir,omitempty"`     // Working directory the command ran in.
+
+	// Intent is how the AI classified the prompt (execute, query, ...).
+	Intent string `json:"intent,omitempty"`
+	// ExitCode is the command's exit status; -1 if it couldn't be started.
+	// Entries recorded before it was tracked have 0 even when they failed.
+	ExitCode int `json:"exit_code,omitempty"`
+	// Interactive is set when the command ran attached to the terminal, so
+	// Output is empty because nothing was captured.
+	Interactive bool `json:"interactive,omitempty"`
+	// RAGContext is the retrieved knowledge injected into the AI prompt.
+	RAGContext string `json:"rag_context,omitempty"`
+
+	// DurationMs is how long the command took to run, in milliseconds.
+	DurationMs int64 `json:"duration_ms,omitempty"`
+	// Step is the 1-based position of a workflow step; 0 for single commands.
+	// StepLabel is its display label, e.g. "Step 2/3".
+	Step      int    `json:"step,omitempty"`
+	StepLabel string `json:"step_label,omitempty"`
+
+	// Env is the environment the command ran in, recorded only when the
+	// env_snapshot setting is on.
+	Env *projctx.Snapshot `json:"env,omitempty"`
 }
 
 func historyPath() string {
@@ -39,6 +64,12 @@ func Save(entry Entry) error {
 	defer fileMu.Unlock()
 
 	entry.Timestamp = time.Now()
+	if entry.Project == "" {
+		entry.Project = projctx.CurrentProject()
+	}
+	if entry.Dir == "" {
+		entry.Dir, _ = os.Getwd()
+	}
 
 	entries, _ := loadAll()
 	entries = append(entries, entry)
@@ -60,6 +91,30 @@ func Save(entry Entry) error {
 	return os.WriteFile(historyPath(), data, 0o600)
 }
 
+// Trim drops the oldest entries beyond the history cap and returns how
+// many it dropped. Save keeps new files under the cap; Trim cleans up files
+// written by older versions or edited by hand. With dryRun the file is left
+// untouched.
+func Trim(dryRun bool) (int, error) {
+	fileMu.Lock()
+	defer fileMu.Unlock()
+
+	entries, err := loadAll()
+	if err != nil || len(entries) <= maxEntries {
+		return 0, err
+	}
+	removed := len(entries) - maxEntries
+	if dryRun {
+		return removed, nil
+	}
+
+	data, err := json.MarshalIndent(entries[removed:], "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	return removed, os.WriteFile(historyPath(), data, 0o600)
+}
+
 // Load returns the most recent n history entries.
 func Load(limit int) ([]Entry, error) {
 	entries, err := loadAll()
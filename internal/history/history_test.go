@@ -1,6 +1,8 @@
 package history
 
 import (
+	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
@@ -43,6 +45,9 @@ func TestSave_SingleEntry(t *testing.T) {
 	if entries[0].Timestamp.IsZero() {
 		t.Error("expected non-zero timestamp")
 	}
+	if wd, _ := os.Getwd(); entries[0].Dir != wd {
+		t.Errorf("expected the working directory %q recorded, got %q", wd, entries[0].Dir)
+	}
 }
 
 func TestSave_MultipleEntries(t *testing.T) {
@@ -157,3 +162,34 @@ func TestLoad_ZeroLimit(t *testing.T) {
 		t.Errorf("expected 10 entries with limit=0, got %d", len(entries))
 	}
 }
+
+func TestTrim(t *testing.T) {
+	cleanup := setupTestDir(t)
+	defer cleanup()
+
+	// Write an oversized file directly, as an older version might have.
+	entries := make([]Entry, maxEntries+25)
+	for i := range entries {
+		entries[i] = Entry{Prompt: "p", Command: fmt.Sprintf("echo %d", i), Success: true}
+	}
+	data, _ := json.Marshal(entries)
+	os.WriteFile(historyPath(), data, 0o600)
+
+	if n, err := Trim(true); err != nil || n != 25 {
+		t.Fatalf("dry run: expected 25, got %d (%v)", n, err)
+	}
+	if all, _ := Load(0); len(all) != maxEntries+25 {
+		t.Errorf("dry run should not change the file, got %d entries", len(all))
+	}
+
+	if n, err := Trim(false); err != nil || n != 25 {
+		t.Fatalf("expected 25 trimmed, got %d (%v)", n, err)
+	}
+	all, _ := Load(0)
+	if len(all) != maxEntries || all[0].Command != "echo 25" {
+		t.Errorf("expected the newest %d entries, got %d starting with %q", maxEntries, len(all), all[0].Command)
+	}
+	if n, _ := Trim(false); n != 0 {
+		t.Errorf("trimming again should be a no-op, got %d", n)
+	}
+}
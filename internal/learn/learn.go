@@ -7,6 +7,8 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"strings"
+	"unicode"
 
 	"github.com/arin/xx-cli/internal/config"
 )
@@ -23,8 +25,12 @@ func learnedPath() string {
 	return filepath.Join(config.Dir(), fileName)
 }
 
-// Save stores a new correction.
+// Save stores a new correction. Templated corrections (see template.go) are
+// rejected if their command uses a placeholder the prompt doesn't define.
 func Save(c Correction) error {
+	if err := c.validateTemplate(); err != nil {
+		return err
+	}
 	corrections, _ := LoadAll()
 
 	// Update existing correction for the same prompt, or append.
@@ -39,7 +45,71 @@ func Save(c Correction) error {
 	if !found {
 		corrections = append(corrections, c)
 	}
+	return saveAll(corrections)
+}
+
+// Forget removes the correction stored for prompt. It reports whether
+// there was one to remove.
+func Forget(prompt string) (bool, error) {
+	corrections, err := LoadAll()
+	if err != nil {
+		return false, err
+	}
+	for i, existing := range corrections {
+		if existing.Prompt == prompt {
+			corrections = append(corrections[:i], corrections[i+1:]...)
+			return true, saveAll(corrections)
+		}
+	}
+	return false, nil
+}
+
+// Dedup removes corrections whose prompt only differs from a later one in
+// case, spacing or punctuation ("Deploy staging" vs "deploy staging!"),
+// keeping the most recent. It returns how many it removed; with dryRun the
+// file is left untouched.
+func Dedup(dryRun bool) (int, error) {
+	corrections, err := LoadAll()
+	if err != nil {
+		return 0, err
+	}
+
+	seen := make(map[string]bool)
+	kept := make([]Correction, 0, len(corrections))
+	for i := len(corrections) - 1; i >= 0; i-- {
+		key := normalizePrompt(corrections[i].Prompt)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		kept = append(kept, corrections[i])
+	}
+	removed := len(corrections) - len(kept)
+	if dryRun || removed == 0 {
+		return removed, nil
+	}
+
+	// kept is newest first; restore the original order.
+	for i, j := 0, len(kept)-1; i < j; i, j = i+1, j-1 {
+		kept[i], kept[j] = kept[j], kept[i]
+	}
+	return removed, saveAll(kept)
+}
+
+// normalizePrompt reduces a prompt to lowercase words, dropping punctuation
+// and extra whitespace. Template placeholders like <host> are kept as-is.
+func normalizePrompt(prompt string) string {
+	clean := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsSpace(r) || r == '<' || r == '>' || r == '_' {
+			return unicode.ToLower(r)
+		}
+		return ' '
+	}, prompt)
+	return strings.Join(strings.Fields(clean), " ")
+}
 
+// saveAll overwrites the corrections file.
+func saveAll(corrections []Correction) error {
 	if err := os.MkdirAll(config.Dir(), 0o700); err != nil {
 		return err
 	}
@@ -180,3 +180,54 @@ func TestFewShotPrompt_SingleCorrection(t *testing.T) {
 		t.Errorf("few-shot prompt should contain the correction: %q", prompt)
 	}
 }
+
+func TestForget(t *testing.T) {
+	_, cleanup := setupTestDir(t)
+	defer cleanup()
+
+	Save(Correction{Prompt: "deploy", Command: "./deploy.sh"})
+	Save(Correction{Prompt: "lint", Command: "golangci-lint run"})
+
+	removed, err := Forget("deploy")
+	if err != nil || !removed {
+		t.Fatalf("Forget(deploy) = %v, %v; want true, nil", removed, err)
+	}
+	corrections, _ := LoadAll()
+	if len(corrections) != 1 || corrections[0].Prompt != "lint" {
+		t.Errorf("expected only 'lint' to remain, got %+v", corrections)
+	}
+
+	removed, err = Forget("deploy")
+	if err != nil || removed {
+		t.Errorf("forgetting twice = %v, %v; want false, nil", removed, err)
+	}
+}
+
+func TestDedup(t *testing.T) {
+	_, cleanup := setupTestDir(t)
+	defer cleanup()
+
+	Save(Correction{Prompt: "Deploy staging", Command: "make deploy-old"})
+	Save(Correction{Prompt: "run tests", Command: "make test"})
+	Save(Correction{Prompt: "deploy   staging!", Command: "make deploy ENV=staging"})
+	Save(Correction{Prompt: "ssh to <host_name>", Command: "ssh <host_name>"})
+
+	if n, err := Dedup(true); err != nil || n != 1 {
+		t.Fatalf("dry run: expected 1 duplicate, got %d (%v)", n, err)
+	}
+	if all, _ := LoadAll(); len(all) != 4 {
+		t.Errorf("dry run should not change the file, got %d corrections", len(all))
+	}
+
+	if n, err := Dedup(false); err != nil || n != 1 {
+		t.Fatalf("expected 1 removed, got %d (%v)", n, err)
+	}
+	all, _ := LoadAll()
+	var got []string
+	for _, c := range all {
+		got = append(got, c.Command)
+	}
+	if strings.Join(got, ",") != "make test,make deploy ENV=staging,ssh <host_name>" {
+		t.Errorf("expected the newest duplicate kept in order, got %v", got)
+	}
+}
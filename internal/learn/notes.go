@@ -0,0 +1,68 @@
+// Package learn — notes.go stores free-form facts the user teaches xx, like
+// "our prod DB is in us-east-1". Unlike corrections, notes don't map a prompt
+// to a command; they're embedded into the knowledge index as retrieval context.
+package learn
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/arin/xx-cli/internal/config"
+)
+
+const notesFileName = "notes.json"
+
+// Note is a fact the user asked xx to remember.
+type Note struct {
+	Text    string    `json:"text"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+func notesPath() string {
+	return filepath.Join(config.Dir(), notesFileName)
+}
+
+// SaveNote appends a note. Notes are kept here as the source of truth so
+// `xx index` can re-embed them when it rebuilds the vector store. Saving
+// the same text twice is a no-op.
+func SaveNote(text string) (Note, error) {
+	note := Note{Text: strings.TrimSpace(text), AddedAt: time.Now()}
+	notes, err := LoadNotes()
+	if err != nil {
+		return note, err
+	}
+	for _, n := range notes {
+		if n.Text == note.Text {
+			return n, nil
+		}
+	}
+	notes = append(notes, note)
+
+	if err := os.MkdirAll(config.Dir(), 0o700); err != nil {
+		return note, err
+	}
+	data, err := json.MarshalIndent(notes, "", "  ")
+	if err != nil {
+		return note, err
+	}
+	return note, os.WriteFile(notesPath(), data, 0o600)
+}
+
+// LoadNotes returns all stored notes, oldest first.
+func LoadNotes() ([]Note, error) {
+	data, err := os.ReadFile(notesPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var notes []Note
+	if err := json.Unmarshal(data, &notes); err != nil {
+		return nil, err
+	}
+	return notes, nil
+}
@@ -0,0 +1,45 @@
+package learn
+
+import "testing"
+
+func TestSaveNote_AppendsAndDedups(t *testing.T) {
+	_, cleanup := setupTestDir(t)
+	defer cleanup()
+
+	if _, err := SaveNote("  our prod DB is in us-east-1 "); err != nil {
+		t.Fatalf("SaveNote failed: %v", err)
+	}
+	if _, err := SaveNote("staging uses the blue cluster"); err != nil {
+		t.Fatalf("SaveNote failed: %v", err)
+	}
+	if _, err := SaveNote("our prod DB is in us-east-1"); err != nil {
+		t.Fatalf("SaveNote failed: %v", err)
+	}
+
+	notes, err := LoadNotes()
+	if err != nil {
+		t.Fatalf("LoadNotes failed: %v", err)
+	}
+	if len(notes) != 2 {
+		t.Fatalf("expected 2 notes, got %d", len(notes))
+	}
+	if notes[0].Text != "our prod DB is in us-east-1" {
+		t.Errorf("note should be trimmed and kept in order, got %q", notes[0].Text)
+	}
+	if notes[0].AddedAt.IsZero() {
+		t.Error("note should record when it was added")
+	}
+}
+
+func TestLoadNotes_Empty(t *testing.T) {
+	_, cleanup := setupTestDir(t)
+	defer cleanup()
+
+	notes, err := LoadNotes()
+	if err != nil {
+		t.Fatalf("LoadNotes failed: %v", err)
+	}
+	if len(notes) != 0 {
+		t.Errorf("expected no notes, got %d", len(notes))
+	}
+}
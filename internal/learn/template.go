@@ -0,0 +1,146 @@
+// Package learn — template.go adds <placeholder> support to corrections.
+// A correction like "ssh to <host>" → "ssh deploy@<host>.internal" matches
+// prompts such as "ssh to web1" and fills the captured value into the command.
+package learn
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// placeholderRe matches a <name> placeholder in a prompt or command.
+var placeholderRe = regexp.MustCompile(`<(\w+)>`)
+
+// Placeholders returns the placeholder names in the correction's prompt, in order.
+func (c Correction) Placeholders() []string {
+	var names []string
+	for _, m := range placeholderRe.FindAllStringSubmatch(c.Prompt, -1) {
+		names = append(names, m[1])
+	}
+	return names
+}
+
+// IsTemplate reports whether the correction's prompt contains placeholders.
+func (c Correction) IsTemplate() bool {
+	return placeholderRe.MatchString(c.Prompt)
+}
+
+// Match checks whether prompt fits the correction's template and returns the
+// captured placeholder values. Matching ignores case and extra whitespace.
+func (c Correction) Match(prompt string) (map[string]string, bool) {
+	if !c.IsTemplate() {
+		return nil, false
+	}
+
+	// Build an anchored regex: literal text is escaped and whitespace-
+	// flexible, each placeholder becomes a lazy capture group.
+	var pattern strings.Builder
+	pattern.WriteString(`(?i)^\s*`)
+	var names []string
+	last := 0
+	for _, loc := range placeholderRe.FindAllStringSubmatchIndex(c.Prompt, -1) {
+		pattern.WriteString(literalPattern(c.Prompt[last:loc[0]]))
+		pattern.WriteString(`(.+?)`)
+		names = append(names, c.Prompt[loc[2]:loc[3]])
+		last = loc[1]
+	}
+	pattern.WriteString(literalPattern(c.Prompt[last:]))
+	pattern.WriteString(`\s*$`)
+
+	re, err := regexp.Compile(pattern.String())
+	if err != nil {
+		return nil, false
+	}
+	m := re.FindStringSubmatch(prompt)
+	if m == nil {
+		return nil, false
+	}
+
+	values := make(map[string]string, len(names))
+	for i, name := range names {
+		v := strings.TrimSpace(m[i+1])
+		if v == "" {
+			return nil, false
+		}
+		values[name] = v
+	}
+	return values, true
+}
+
+// whitespaceRe matches a run of whitespace in template literal text.
+var whitespaceRe = regexp.MustCompile(`\s+`)
+
+// literalPattern escapes text for a regex and lets any run of whitespace
+// match one or more whitespace characters.
+func literalPattern(s string) string {
+	return whitespaceRe.ReplaceAllString(regexp.QuoteMeta(s), `\s+`)
+}
+
+// Substitute replaces every <name> in command with its value. Values are
+// shell-quoted when they contain anything beyond safe characters, so a
+// prompt can't smuggle extra shell syntax into the command. It errors if a
+// placeholder has no value.
+func Substitute(command string, values map[string]string) (string, error) {
+	var missing []string
+	out := placeholderRe.ReplaceAllStringFunc(command, func(ph string) string {
+		name := ph[1 : len(ph)-1]
+		v, ok := values[name]
+		if !ok || v == "" {
+			missing = append(missing, ph)
+			return ph
+		}
+		return shellQuote(v)
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("missing value for placeholder %s", strings.Join(missing, ", "))
+	}
+	return out, nil
+}
+
+// safeValueRe matches values that need no quoting in a shell command.
+var safeValueRe = regexp.MustCompile(`^[\w@%+=:,./-]+$`)
+
+func shellQuote(s string) string {
+	if safeValueRe.MatchString(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// MatchTemplate finds the first templated correction matching prompt and
+// returns its command with the placeholders filled in.
+func MatchTemplate(prompt string) (string, bool) {
+	corrections, err := LoadAll()
+	if err != nil {
+		return "", false
+	}
+	for _, c := range corrections {
+		values, ok := c.Match(prompt)
+		if !ok {
+			continue
+		}
+		if command, err := Substitute(c.Command, values); err == nil {
+			return command, true
+		}
+	}
+	return "", false
+}
+
+// validateTemplate rejects templated corrections whose command uses a
+// placeholder the prompt never captures — it could never be filled in.
+func (c Correction) validateTemplate() error {
+	if !c.IsTemplate() {
+		return nil
+	}
+	captured := make(map[string]bool)
+	for _, name := range c.Placeholders() {
+		captured[name] = true
+	}
+	for _, m := range placeholderRe.FindAllStringSubmatch(c.Command, -1) {
+		if !captured[m[1]] {
+			return fmt.Errorf("command uses <%s> but the prompt has no such placeholder", m[1])
+		}
+	}
+	return nil
+}
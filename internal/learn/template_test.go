@@ -0,0 +1,103 @@
+package learn
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCorrection_Match_ExtractsValues(t *testing.T) {
+	c := Correction{Prompt: "ssh to <host>", Command: "ssh deploy@<host>.internal"}
+
+	values, ok := c.Match("ssh to web1")
+	if !ok {
+		t.Fatal("expected template to match")
+	}
+	if values["host"] != "web1" {
+		t.Errorf("expected host=web1, got %q", values["host"])
+	}
+}
+
+func TestCorrection_Match_MultiplePlaceholders(t *testing.T) {
+	c := Correction{Prompt: "copy <file> to <host>", Command: "scp <file> <host>:~/"}
+
+	values, ok := c.Match("Copy  notes.txt to  backup-box")
+	if !ok {
+		t.Fatal("expected template to match ignoring case and extra spaces")
+	}
+	if values["file"] != "notes.txt" || values["host"] != "backup-box" {
+		t.Errorf("unexpected values: %v", values)
+	}
+}
+
+func TestCorrection_Match_NoMatch(t *testing.T) {
+	c := Correction{Prompt: "ssh to <host>", Command: "ssh deploy@<host>.internal"}
+
+	for _, prompt := range []string{"ssh to", "ssh to  ", "connect to web1", "ssh into web1"} {
+		if _, ok := c.Match(prompt); ok {
+			t.Errorf("prompt %q should not match", prompt)
+		}
+	}
+}
+
+func TestCorrection_Match_NotTemplate(t *testing.T) {
+	c := Correction{Prompt: "run tests", Command: "make test"}
+	if _, ok := c.Match("run tests"); ok {
+		t.Error("plain corrections are not templates and should not match")
+	}
+}
+
+func TestSubstitute(t *testing.T) {
+	got, err := Substitute("ssh deploy@<host>.internal", map[string]string{"host": "web1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "ssh deploy@web1.internal" {
+		t.Errorf("unexpected command: %q", got)
+	}
+}
+
+func TestSubstitute_MissingValue(t *testing.T) {
+	_, err := Substitute("scp <file> <host>:~/", map[string]string{"file": "a.txt"})
+	if err == nil {
+		t.Fatal("expected error for missing placeholder value")
+	}
+	if !strings.Contains(err.Error(), "<host>") {
+		t.Errorf("error should name the missing placeholder, got: %v", err)
+	}
+}
+
+func TestSubstitute_QuotesUnsafeValues(t *testing.T) {
+	got, err := Substitute("echo <msg>", map[string]string{"msg": "hi; rm -rf ~"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "echo 'hi; rm -rf ~'" {
+		t.Errorf("unsafe value should be single-quoted, got %q", got)
+	}
+}
+
+func TestMatchTemplate(t *testing.T) {
+	_, cleanup := setupTestDir(t)
+	defer cleanup()
+
+	Save(Correction{Prompt: "run tests", Command: "make test"})
+	Save(Correction{Prompt: "ssh to <host>", Command: "ssh deploy@<host>.internal"})
+
+	cmd, ok := MatchTemplate("ssh to db2")
+	if !ok || cmd != "ssh deploy@db2.internal" {
+		t.Errorf("expected substituted command, got %q (ok=%v)", cmd, ok)
+	}
+	if _, ok := MatchTemplate("run tests"); ok {
+		t.Error("plain corrections should not match as templates")
+	}
+}
+
+func TestSave_RejectsUndefinedPlaceholder(t *testing.T) {
+	_, cleanup := setupTestDir(t)
+	defer cleanup()
+
+	err := Save(Correction{Prompt: "ssh to <host>", Command: "ssh <user>@<host>"})
+	if err == nil || !strings.Contains(err.Error(), "<user>") {
+		t.Errorf("expected error naming <user>, got %v", err)
+	}
+}
@@ -0,0 +1,122 @@
+// Package metrics collects in-process counters for xx and renders them in
+// the Prometheus text exposition format. The hot paths (translation,
+// retrieval, provider calls) increment the package-level metrics below;
+// Handler serves them at /metrics for a long-running serve mode.
+//
+// Everything is lock-free atomics, so incrementing costs next to nothing
+// for the one-shot CLI where nobody ever scrapes.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Metric names. Kept as constants so dashboards and tests agree on them.
+const (
+	NameTranslations     = "xx_translations_total"
+	NameCacheHits        = "xx_cache_hits_total"
+	NameProviderErrors   = "xx_provider_errors_total"
+	NameRetrievalLatency = "xx_retrieval_latency_seconds"
+)
+
+var (
+	// Translations counts Translate calls (natural language → command).
+	Translations = newCounter(NameTranslations, "Natural language prompts translated into commands.")
+	// CacheHits counts responses served from a cache instead of the model.
+	CacheHits = newCounter(NameCacheHits, "Responses served from cache without calling the model.")
+	// ProviderErrors counts failed requests to the AI provider.
+	ProviderErrors = newCounter(NameProviderErrors, "Requests to the AI provider that returned an error.")
+	// RetrievalLatency tracks how long RAG retrieval (embed + search) takes.
+	RetrievalLatency = newSummary(NameRetrievalLatency, "Time spent retrieving RAG context, in seconds.")
+)
+
+// collectors is every metric in exposition order.
+var collectors = []collector{Translations, CacheHits, ProviderErrors, RetrievalLatency}
+
+type collector interface {
+	write(w io.Writer) error
+}
+
+// Counter is a monotonically increasing count.
+type Counter struct {
+	name, help string
+	value      atomic.Int64
+}
+
+func newCounter(name, help string) *Counter {
+	return &Counter{name: name, help: help}
+}
+
+// Inc adds one to the counter.
+func (c *Counter) Inc() {
+	c.value.Add(1)
+}
+
+// Value returns the current count.
+func (c *Counter) Value() int64 {
+	return c.value.Load()
+}
+
+func (c *Counter) write(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", c.name, c.help, c.name, c.name, c.Value())
+	return err
+}
+
+// Summary tracks the count and total of observed durations, exposed as a
+// Prometheus summary without quantiles (_sum and _count).
+type Summary struct {
+	name, help string
+	count      atomic.Int64
+	sumBits    atomic.Uint64 // float64 seconds, stored as bits for atomic CAS.
+}
+
+func newSummary(name, help string) *Summary {
+	return &Summary{name: name, help: help}
+}
+
+// Observe records one duration.
+func (s *Summary) Observe(d time.Duration) {
+	for {
+		old := s.sumBits.Load()
+		next := math.Float64bits(math.Float64frombits(old) + d.Seconds())
+		if s.sumBits.CompareAndSwap(old, next) {
+			break
+		}
+	}
+	s.count.Add(1)
+}
+
+// Count returns how many durations have been observed.
+func (s *Summary) Count() int64 {
+	return s.count.Load()
+}
+
+func (s *Summary) write(w io.Writer) error {
+	sum := math.Float64frombits(s.sumBits.Load())
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s summary\n%s_sum %g\n%s_count %d\n",
+		s.name, s.help, s.name, s.name, sum, s.name, s.Count())
+	return err
+}
+
+// WriteText writes every metric in the Prometheus text format.
+func WriteText(w io.Writer) error {
+	for _, c := range collectors {
+		if err := c.write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Handler serves the metrics at any path it's mounted on, conventionally /metrics.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = WriteText(w)
+	})
+}
@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandler_ExposesMetricNames(t *testing.T) {
+	Translations.Inc()
+	ProviderErrors.Inc()
+	RetrievalLatency.Observe(250 * time.Millisecond)
+
+	srv := httptest.NewServer(Handler())
+	defer srv.Close()
+
+	resp, err := srv.Client().Get(srv.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("scrape failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	text := string(body)
+
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("unexpected content type %q", ct)
+	}
+	for _, want := range []string{
+		"# TYPE xx_translations_total counter",
+		"# TYPE xx_cache_hits_total counter",
+		"# TYPE xx_provider_errors_total counter",
+		"# TYPE xx_retrieval_latency_seconds summary",
+		"xx_retrieval_latency_seconds_sum ",
+		"xx_retrieval_latency_seconds_count ",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("metrics output missing %q:\n%s", want, text)
+		}
+	}
+}
+
+func TestCounter_Inc(t *testing.T) {
+	c := newCounter("test_total", "test")
+	c.Inc()
+	c.Inc()
+
+	var sb strings.Builder
+	c.write(&sb)
+	if c.Value() != 2 || !strings.Contains(sb.String(), "test_total 2\n") {
+		t.Errorf("expected count 2, got %d:\n%s", c.Value(), sb.String())
+	}
+}
+
+func TestSummary_Observe(t *testing.T) {
+	s := newSummary("test_seconds", "test")
+	s.Observe(500 * time.Millisecond)
+	s.Observe(time.Second)
+
+	var sb strings.Builder
+	s.write(&sb)
+	out := sb.String()
+	if !strings.Contains(out, "test_seconds_sum 1.5\n") || !strings.Contains(out, "test_seconds_count 2\n") {
+		t.Errorf("unexpected summary output:\n%s", out)
+	}
+}
@@ -7,9 +7,11 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"time"
 )
 
@@ -21,11 +23,39 @@ const (
 	embedURL     = "http://localhost:11434/api/embeddings"
 	embedTimeout = 30 * time.Second
 
+	// embedBatchSize is how many texts go in one request to Ollama's batch
+	// endpoint, /api/embed.
+	embedBatchSize = 32
+
 	// cacheMaxSize is the maximum number of embeddings to cache in memory.
 	// 100 entries × 768 floats × 4 bytes = ~300KB — negligible memory cost.
 	cacheMaxSize = 100
 )
 
+// Embedder turns text into a vector. EmbedClient is the real one; the
+// indexer and the retrieval and learning functions take the interface, the
+// way the AI client takes a Provider, so tests and callers can substitute
+// their own.
+type Embedder interface {
+	Embed(ctx context.Context, text string) ([]float32, error)
+}
+
+// BatchEmbedder is an Embedder that can embed many texts in one go. The
+// indexer uses it when it's there, to save a round-trip per document.
+type BatchEmbedder interface {
+	Embedder
+	EmbedBatch(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// orDefault returns e, or a new EmbedClient when e is nil, so functions
+// taking an Embedder treat nil as "the usual Ollama client".
+func orDefault(e Embedder) Embedder {
+	if e == nil {
+		return NewEmbedClient()
+	}
+	return e
+}
+
 // EmbedClient generates vector embeddings via Ollama's local API.
 // It includes an in-memory LRU cache that eliminates redundant API calls
 // for repeated queries (e.g., "is chrome running" asked 5 times).
@@ -35,6 +65,9 @@ type EmbedClient struct {
 	httpClient *http.Client
 	cache      map[string]cachedEmbedding
 	cacheOrder []string // LRU order: oldest at front, newest at back.
+	// noBatch is set once the batch endpoint turns out to be missing (an
+	// Ollama older than 0.2), so EmbedBatch stops trying it.
+	noBatch bool
 }
 
 // cachedEmbedding stores a cached vector with its key for LRU tracking.
@@ -150,12 +183,52 @@ func (e *EmbedClient) putLRU(key string, vec []float32) {
 
 // EmbedBatch embeds multiple texts and returns their vectors in the same order.
 // Used during indexing when we need to embed hundreds of documents.
-// Ollama doesn't have a native batch endpoint, so we call Embed() in sequence.
-// This is fine for our scale (~3-4K docs, one-time indexing operation).
+//
+// Texts already in the cache aren't sent again. The rest go to Ollama's
+// batch endpoint, /api/embed, embedBatchSize at a time — one round-trip
+// instead of 32. An Ollama too old to have that endpoint answers 404, and
+// then we fall back to calling Embed() in sequence.
 func (e *EmbedClient) EmbedBatch(ctx context.Context, texts []string) ([][]float32, error) {
 	vectors := make([][]float32, len(texts))
+	var missing []int // Indexes of the texts that aren't cached.
 	for i, text := range texts {
-		vec, err := e.Embed(ctx, text)
+		if cached, ok := e.cache[text]; ok {
+			e.touchLRU(text)
+			vectors[i] = cached.vector
+			continue
+		}
+		missing = append(missing, i)
+	}
+
+	batchURL := e.batchURL()
+	for start := 0; start < len(missing) && batchURL != "" && !e.noBatch; start += embedBatchSize {
+		chunk := missing[start:min(start+embedBatchSize, len(missing))]
+		inputs := make([]string, len(chunk))
+		for j, i := range chunk {
+			inputs[j] = texts[i]
+		}
+		vecs, err := e.embedChunk(ctx, batchURL, inputs)
+		if errors.Is(err, errNoBatchEndpoint) {
+			e.noBatch = true
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		for j, i := range chunk {
+			vectors[i] = vecs[j]
+			if _, ok := e.cache[texts[i]]; !ok {
+				e.putLRU(texts[i], vecs[j])
+			}
+		}
+	}
+
+	// Whatever the batch endpoint didn't cover, one text at a time.
+	for _, i := range missing {
+		if vectors[i] != nil {
+			continue
+		}
+		vec, err := e.Embed(ctx, texts[i])
 		if err != nil {
 			return nil, fmt.Errorf("failed to embed text %d/%d: %w", i+1, len(texts), err)
 		}
@@ -163,3 +236,76 @@ func (e *EmbedClient) EmbedBatch(ctx context.Context, texts []string) ([][]float
 	}
 	return vectors, nil
 }
+
+// errNoBatchEndpoint means Ollama doesn't have /api/embed.
+var errNoBatchEndpoint = errors.New("batch embedding endpoint not available")
+
+// batchURL returns the batch endpoint of the Ollama that apiURL points at,
+// or "" if apiURL isn't the usual /api/embeddings path and there's no way
+// to tell.
+func (e *EmbedClient) batchURL() string {
+	base, ok := strings.CutSuffix(e.apiURL, "/api/embeddings")
+	if !ok {
+		return ""
+	}
+	return base + "/api/embed"
+}
+
+// embedBatchRequest is the JSON body sent to Ollama's /api/embed endpoint.
+type embedBatchRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+// embedBatchResponse is the JSON body returned by Ollama's /api/embed
+// endpoint: one vector per input, in order.
+type embedBatchResponse struct {
+	Embeddings [][]float32 `json:"embeddings"`
+}
+
+// embedChunk embeds texts with one request to the batch endpoint at url.
+// A 404 is errNoBatchEndpoint.
+func (e *EmbedClient) embedChunk(ctx context.Context, url string, texts []string) ([][]float32, error) {
+	body, err := json.Marshal(embedBatchRequest{Model: e.model, Input: texts})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal embed request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create embed request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not reach Ollama for embeddings — is it running? (start with: ollama serve)")
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read embed response: %w", err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		// Also what a missing model gets; the per-text fallback reports that
+		// with the usual hint.
+		return nil, errNoBatchEndpoint
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("embedding API error (status %d): %s\nHint: run 'ollama pull %s' if the model is missing", resp.StatusCode, string(respBody), e.model)
+	}
+
+	var result embedBatchResponse
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse embed response: %w", err)
+	}
+	if len(result.Embeddings) != len(texts) {
+		return nil, fmt.Errorf("batch embedding returned %d vectors for %d texts", len(result.Embeddings), len(texts))
+	}
+	for _, vec := range result.Embeddings {
+		if len(vec) == 0 {
+			return nil, fmt.Errorf("empty embedding returned — model may not support embeddings")
+		}
+	}
+	return result.Embeddings, nil
+}
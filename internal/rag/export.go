@@ -0,0 +1,100 @@
+package rag
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// exportFormatVersion is the version of the JSON ExportJSON writes.
+const exportFormatVersion = 1
+
+// exportFile is the JSON form of a store: every document with its vector
+// and scoring counts, so adaptive ranking survives a move to another
+// machine.
+type exportFile struct {
+	Version   int           `json:"version"`
+	Dim       int           `json:"dim"`
+	Documents []exportedDoc `json:"documents"`
+}
+
+type exportedDoc struct {
+	Text         string    `json:"text"`
+	Source       string    `json:"source"`
+	Category     string    `json:"category"`
+	Project      string    `json:"project,omitempty"`
+	Vector       []float32 `json:"vector"`
+	SuccessCount int32     `json:"success_count"`
+	FailureCount int32     `json:"failure_count"`
+}
+
+// ExportJSON writes every document in the store to w as JSON, in the
+// format ImportJSON reads.
+func (s *Store) ExportJSON(w io.Writer) error {
+	out := exportFile{Version: exportFormatVersion, Dim: s.Dim(), Documents: make([]exportedDoc, len(s.docs))}
+	for i, doc := range s.docs {
+		out.Documents[i] = exportedDoc{
+			Text:         doc.Text,
+			Source:       doc.Source,
+			Category:     doc.Category,
+			Project:      doc.Project,
+			Vector:       doc.Vector,
+			SuccessCount: doc.SuccessCount,
+			FailureCount: doc.FailureCount,
+		}
+	}
+	return json.NewEncoder(w).Encode(out)
+}
+
+// ImportJSON reads documents that ExportJSON wrote and returns how many it
+// added. With replace, they take the place of everything in the store;
+// otherwise they're merged in, skipping any more similar than dedup to a
+// document already there. Every vector must have the same dimension, and
+// a merge into a non-empty store must match its dimension too, or it fails
+// with ErrDimensionMismatch and leaves the store as it was. Like Add, it
+// only changes the store in memory — call Save to persist.
+func (s *Store) ImportJSON(r io.Reader, replace bool, dedup float32) (int, error) {
+	var in exportFile
+	if err := json.NewDecoder(r).Decode(&in); err != nil {
+		return 0, fmt.Errorf("invalid index export: %w", err)
+	}
+	if in.Version < 1 || in.Version > exportFormatVersion {
+		return 0, fmt.Errorf("unsupported index export version %d", in.Version)
+	}
+
+	// The documents set the dimension when they replace the store or fill
+	// an empty one; the header's dim is only informational.
+	dim := s.Dim()
+	if (replace || dim == 0) && len(in.Documents) > 0 {
+		dim = len(in.Documents[0].Vector)
+	}
+	for i, doc := range in.Documents {
+		if doc.Text == "" || len(doc.Vector) == 0 {
+			return 0, fmt.Errorf("invalid index export: document %d has no text or vector", i+1)
+		}
+		if len(doc.Vector) != dim {
+			return 0, fmt.Errorf("%w (document %d is %d-dim, expected %d)", ErrDimensionMismatch, i+1, len(doc.Vector), dim)
+		}
+	}
+
+	if replace {
+		s.docs = nil
+	}
+	added := 0
+	for _, d := range in.Documents {
+		if !replace && s.HasNearDuplicate(d.Vector, dedup) {
+			continue
+		}
+		s.docs = append(s.docs, Document{
+			Text:         d.Text,
+			Source:       d.Source,
+			Category:     d.Category,
+			Project:      d.Project,
+			Vector:       d.Vector,
+			SuccessCount: d.SuccessCount,
+			FailureCount: d.FailureCount,
+		})
+		added++
+	}
+	return added, nil
+}
@@ -0,0 +1,161 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/arin/xx-cli/internal/history"
+)
+
+const (
+	// fixSource is the source and category of failure→fix documents. They're
+	// their own doc type so SmartRetry can search only past fixes.
+	fixSource = "fix"
+
+	// MaxFixes is how many past fixes SmartRetry gets to see.
+	MaxFixes = 3
+
+	// FixMinScore is the minimum similarity for a past fix to be shown to
+	// SmartRetry. It's well above MinScore: a fix for a different error is
+	// worse than no hint at all.
+	FixMinScore = 0.6
+
+	// maxErrorSummary caps how much of the error output goes into a fix doc.
+	maxErrorSummary = 200
+
+	// retrySuffix marks the history entry of a SmartRetry fix; run.go saves
+	// it as "<prompt> (retry)" right after the failed attempt.
+	retrySuffix = " (retry)"
+)
+
+// failureText describes a failed command the same way in fix documents and
+// in SmartRetry's query, so both embed into the same semantic space.
+func failureText(failedCmd, errorOutput string) string {
+	return fmt.Sprintf("'%s' failed with: %s", failedCmd, ErrorSummary(errorOutput))
+}
+
+// fixDocument builds the document for a failure that fixCmd resolved.
+// LearnFix and the indexer share it so re-indexed fixes embed identically.
+func fixDocument(failedCmd, errorOutput, fixCmd string) Document {
+	return Document{
+		Text:     failureText(failedCmd, errorOutput) + " — fixed by running: " + fixCmd,
+		Source:   fixSource,
+		Category: fixSource,
+	}
+}
+
+// ErrorSummary reduces command output to the line that most likely names
+// the error: the first one mentioning "error", "denied" or "not found",
+// else the last non-empty line. The result is at most 200 bytes.
+func ErrorSummary(output string) string {
+	var last string
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		lower := strings.ToLower(line)
+		if strings.Contains(lower, "error") || strings.Contains(lower, "denied") || strings.Contains(lower, "not found") {
+			last = line
+			break
+		}
+		last = line
+	}
+	if len(last) > maxErrorSummary {
+		last = last[:maxErrorSummary]
+	}
+	return last
+}
+
+// LearnFix embeds a failure→fix pair and appends it to the vector store, so
+// the next SmartRetry on a similar error can reuse the fix. It's called
+// from the detached `xx _learn-fix` subprocess after a retry succeeds and,
+// like LearnFromSuccess, fails silently within a 5-second budget. A nil
+// embedder means NewEmbedClient().
+func LearnFix(ctx context.Context, embedder Embedder, failedCmd, errorOutput, fixCmd string) {
+	release, ok := queueLearner(learnerJob("fix", failedCmd, errorOutput, fixCmd))
+	if !ok {
+		return
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	doc := fixDocument(failedCmd, errorOutput, fixCmd)
+	vec, err := orDefault(embedder).Embed(ctx, doc.Text)
+	if err != nil {
+		return
+	}
+	doc.Vector = vec
+	_, _ = appendUnlessDuplicate(doc, learnDedupThreshold())
+}
+
+// RetrieveFixes returns up to MaxFixes past fixes for failures similar to
+// this one. Like RetrieveResults it degrades to no results when there's no
+// index or the embedder is unreachable. A nil embedder means NewEmbedClient().
+func RetrieveFixes(ctx context.Context, embedder Embedder, failedCmd, errorOutput string) ([]SearchResult, error) {
+	store := NewStore()
+	if err := store.Load(); err != nil {
+		return nil, nil
+	}
+
+	vec, err := orDefault(embedder).Embed(ctx, failureText(failedCmd, errorOutput))
+	if err != nil {
+		return nil, nil
+	}
+
+	var fixes []SearchResult
+	for _, r := range store.Search(vec, MaxFixes, fixSource) {
+		if r.Score >= FixMinScore {
+			fixes = append(fixes, r)
+		}
+	}
+	return fixes, nil
+}
+
+// FormatFixes renders past fixes for the SmartRetry prompt.
+func FormatFixes(results []SearchResult) string {
+	if len(results) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("\n\nPast fixes for similar failures on this machine (reuse one if the same cause applies):\n")
+	for _, r := range results {
+		sb.WriteString("- " + r.Doc.Text + "\n")
+	}
+	return sb.String()
+}
+
+// fixDocs rebuilds failure→fix documents from history: a failed entry
+// followed directly by a successful "<prompt> (retry)" entry.
+func fixDocs(opts IndexOptions) ([]Document, error) {
+	entries, err := history.Load(0)
+	if err != nil {
+		return nil, err
+	}
+
+	var docs []Document
+	seen := make(map[string]bool)
+	for i := 1; i < len(entries); i++ {
+		failed, retry := entries[i-1], entries[i]
+		if failed.Success || !retry.Success || retry.Prompt != failed.Prompt+retrySuffix {
+			continue
+		}
+		if opts.Project != "" && failed.Project != opts.Project {
+			continue
+		}
+		if !opts.Since.IsZero() && failed.Timestamp.Before(opts.Since) {
+			continue
+		}
+		key := failed.Command + "|" + retry.Command
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		docs = append(docs, fixDocument(failed.Command, failed.Output, retry.Command))
+	}
+	return docs, nil
+}
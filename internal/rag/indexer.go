@@ -2,38 +2,108 @@ package rag
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"regexp"
 	"runtime"
 	"strings"
+	"time"
 
+	"github.com/arin/xx-cli/internal/config"
 	"github.com/arin/xx-cli/internal/history"
 	"github.com/arin/xx-cli/internal/learn"
 )
 
 // Indexer builds the vector store by embedding documents from all knowledge sources.
 type Indexer struct {
-	embedder *EmbedClient
+	embedder Embedder
 	store    *Store
+	opts     IndexOptions
+
+	// known holds the vectors of the store being replaced, by text, so
+	// unchanged documents aren't embedded again, and knownDim their
+	// dimension.
+	known    map[string][]float32
+	knownDim int
+	// fresh holds vectors embedded ahead of time by prefetch, by text.
+	fresh map[string][]float32
+	// unsaved counts documents added since the last checkpoint.
+	unsaved int
+	// skipped counts documents left out because they failed to embed, and
+	// failures how many embeddings in a row have failed.
+	skipped  int
+	failures int
+}
+
+// maxEmbedFailures is how many embeddings in a row may fail before IndexAll
+// gives up. A doc or two the model can't embed is skipped, but a run of
+// failures means Ollama itself is gone, and skipping the rest would only
+// leave an empty index behind.
+const maxEmbedFailures = 3
+
+// checkpointEvery is how many documents IndexAll adds between saves, so
+// an interrupted run leaves a usable store and the next run picks up
+// where it stopped. It's a variable so tests can lower it.
+var checkpointEvery = 100
+
+// IndexOptions narrows which command history gets indexed. The zero value
+// indexes the most recent history across all projects.
+type IndexOptions struct {
+	// Project, if set, keeps only history recorded in this project root.
+	Project string
+	// Since, if set, keeps only history recorded at or after this time.
+	Since time.Time
+	// HistoryLimit caps how many recent history entries get indexed. Zero
+	// means DefaultHistoryLimit.
+	HistoryLimit int
+	// SkipHistory leaves command history out of the index entirely, for
+	// when it's too noisy to help.
+	SkipHistory bool
 }
 
 // NewIndexer creates an indexer with the given embedding client.
-func NewIndexer(embedder *EmbedClient) *Indexer {
+func NewIndexer(embedder Embedder) *Indexer {
+	return NewIndexerWithOptions(embedder, IndexOptions{})
+}
+
+// NewIndexerWithOptions creates an indexer that filters history by opts.
+func NewIndexerWithOptions(embedder Embedder, opts IndexOptions) *Indexer {
 	return &Indexer{
 		embedder: embedder,
 		store:    NewStore(),
+		opts:     opts,
 	}
 }
 
 // IndexAll embeds all knowledge sources and saves the vector store.
 // It calls the progress callback with status messages so the CLI can show progress.
+//
+// The store is saved every checkpointEvery documents, and vectors already
+// in the store (from a previous or interrupted run) are reused rather than
+// embedded again, so re-running after an interruption only embeds what's
+// missing. Use Flush first to re-embed everything.
+//
+// A document that fails to embed is logged and skipped, and the final
+// report counts them; it gets another try on the next run. Only a run of
+// maxEmbedFailures failures in a row stops the index.
 func (idx *Indexer) IndexAll(ctx context.Context, progress func(msg string)) error {
+	previous := NewStore()
+	if err := previous.Load(); err == nil && previous.Len() > 0 {
+		idx.known = make(map[string][]float32, previous.Len())
+		for _, d := range previous.Docs() {
+			idx.known[d.Text] = d.Vector
+		}
+		idx.knownDim = previous.Dim()
+		progress(fmt.Sprintf("Reusing embeddings from the existing index (%d documents)", previous.Len()))
+	}
+
 	// 1. Index built-in OS command knowledge.
 	progress("Indexing OS command knowledge...")
-	osDocs := osCommandDocs()
-	if err := idx.embedDocs(ctx, osDocs, progress); err != nil {
+	added, err := idx.embedDocs(ctx, osCommandDocs(), progress)
+	if err != nil {
 		return fmt.Errorf("failed to index OS docs: %w", err)
 	}
-	progress(fmt.Sprintf("  ✓ %d OS command entries", len(osDocs)))
+	progress(fmt.Sprintf("  ✓ %d OS command entries", added))
 
 	// 2. Index learned corrections.
 	progress("Indexing learned corrections...")
@@ -41,76 +111,225 @@ func (idx *Indexer) IndexAll(ctx context.Context, progress func(msg string)) err
 	if err != nil {
 		progress(fmt.Sprintf("  ⚠ skipping learned corrections: %v", err))
 	} else if len(learnDocs) > 0 {
-		if err := idx.embedDocs(ctx, learnDocs, progress); err != nil {
+		added, err := idx.embedDocs(ctx, learnDocs, progress)
+		if err != nil {
 			return fmt.Errorf("failed to index learned docs: %w", err)
 		}
-		progress(fmt.Sprintf("  ✓ %d learned corrections", len(learnDocs)))
+		progress(fmt.Sprintf("  ✓ %d learned corrections", added))
 	} else {
 		progress("  ✓ no learned corrections yet")
 	}
 
-	// 3. Index command history (successful commands only).
-	// History entries are deduped against builtins and learned corrections:
+	// 3. Index user notes.
+	progress("Indexing notes...")
+	notes, err := noteDocs()
+	if err != nil {
+		progress(fmt.Sprintf("  ⚠ skipping notes: %v", err))
+	} else if len(notes) > 0 {
+		added, err := idx.embedDocs(ctx, notes, progress)
+		if err != nil {
+			return fmt.Errorf("failed to index notes: %w", err)
+		}
+		progress(fmt.Sprintf("  ✓ %d notes", added))
+	} else {
+		progress("  ✓ no notes yet")
+	}
+
+	// 4. Index command history (successful commands only).
+	// History entries are deduped against builtins, learned corrections and notes:
 	// if a history entry is semantically similar to an already-indexed entry,
 	// we skip it. This prevents auto-learned garbage from competing with
 	// curated knowledge — the core fix for RAG poisoning.
 	progress("Indexing command history...")
-	histDocs, err := historyDocs()
-	if err != nil {
+	histDocs, err := historyDocs(idx.opts)
+	if idx.opts.SkipHistory {
+		progress("  ✓ history skipped")
+	} else if err != nil {
 		progress(fmt.Sprintf("  ⚠ skipping history: %v", err))
 	} else if len(histDocs) > 0 {
-		var added int
+		var added, embedded int
 		for i := range histDocs {
-			vec, err := idx.embedder.Embed(ctx, histDocs[i].Text)
+			idx.prefetch(ctx, histDocs, i)
+			ok, err := idx.embedDoc(ctx, &histDocs[i], progress)
 			if err != nil {
 				return fmt.Errorf("failed to embed history doc: %w", err)
 			}
-			histDocs[i].Vector = vec
+			if !ok {
+				continue
+			}
+			embedded++
 
 			// Skip if this history entry overlaps with a builtin or learned entry.
 			// 0.7 threshold catches entries that cover the same topic as a builtin,
 			// even if the wording differs (e.g. "top processes by RAM" vs
 			// "ps aux | awk '{print $4}'"). Builtins are curated — they always win.
-			if idx.store.HasNearDuplicate(vec, 0.7) {
+			if idx.store.HasNearDuplicate(histDocs[i].Vector, 0.7) {
 				continue
 			}
-			idx.store.Add(histDocs[i])
+			if err := idx.add(histDocs[i]); err != nil {
+				return err
+			}
 			added++
 
 			if (added)%50 == 0 {
 				progress(fmt.Sprintf("  embedded %d...", added))
 			}
 		}
-		progress(fmt.Sprintf("  ✓ %d history entries (%d skipped as duplicates)", added, len(histDocs)-added))
+		progress(fmt.Sprintf("  ✓ %d history entries (%d skipped as duplicates)", added, embedded-added))
 	} else {
 		progress("  ✓ no command history yet")
 	}
 
+	// 5. Index past fixes (a failed command followed by a successful retry),
+	// so SmartRetry can find them again after a rebuild.
+	progress("Indexing past fixes...")
+	fixes, err := fixDocs(idx.opts)
+	if err != nil {
+		progress(fmt.Sprintf("  ⚠ skipping past fixes: %v", err))
+	} else if len(fixes) > 0 {
+		added, err := idx.embedDocs(ctx, fixes, progress)
+		if err != nil {
+			return fmt.Errorf("failed to index past fixes: %w", err)
+		}
+		progress(fmt.Sprintf("  ✓ %d past fixes", added))
+	} else {
+		progress("  ✓ no past fixes yet")
+	}
+
 	// Save to disk.
 	progress("Saving vector store...")
 	if err := idx.store.Save(); err != nil {
 		return fmt.Errorf("failed to save vector store: %w", err)
 	}
-	progress(fmt.Sprintf("✓ Indexed %d documents total", idx.store.Len()))
+	if idx.skipped > 0 {
+		progress(fmt.Sprintf("✓ Indexed %d documents total (%d skipped: failed to embed)", idx.store.Len(), idx.skipped))
+	} else {
+		progress(fmt.Sprintf("✓ Indexed %d documents total", idx.store.Len()))
+	}
 
 	return nil
 }
 
-// embedDocs embeds a batch of documents and adds them to the store.
-func (idx *Indexer) embedDocs(ctx context.Context, docs []Document, progress func(string)) error {
+// embedDocs embeds a batch of documents and adds them to the store. It
+// returns how many were added; the rest failed to embed and were skipped.
+func (idx *Indexer) embedDocs(ctx context.Context, docs []Document, progress func(string)) (int, error) {
+	var added int
 	for i := range docs {
-		vec, err := idx.embedder.Embed(ctx, docs[i].Text)
+		idx.prefetch(ctx, docs, i)
+		ok, err := idx.embedDoc(ctx, &docs[i], progress)
 		if err != nil {
-			return err
+			return added, err
+		}
+		if ok {
+			if err := idx.add(docs[i]); err != nil {
+				return added, err
+			}
+			added++
 		}
-		docs[i].Vector = vec
-		idx.store.Add(docs[i])
 
 		// Show progress every 50 docs (embedding can be slow).
 		if (i+1)%50 == 0 {
 			progress(fmt.Sprintf("  embedded %d/%d...", i+1, len(docs)))
 		}
 	}
+	return added, nil
+}
+
+// embedDoc sets doc's vector and reports whether it could. A doc that
+// fails to embed is logged, counted and skipped; it's only an error when
+// ctx is done, the embedding model has changed since the last index, or
+// the last maxEmbedFailures embeddings all failed.
+func (idx *Indexer) embedDoc(ctx context.Context, doc *Document, progress func(string)) (bool, error) {
+	vec, err := idx.embed(ctx, doc.Text)
+	if err == nil {
+		idx.failures = 0
+		doc.Vector = vec
+		return true, nil
+	}
+	if ctx.Err() != nil {
+		return false, ctx.Err()
+	}
+	if errors.Is(err, ErrDimensionMismatch) {
+		return false, err
+	}
+	idx.failures++
+	if idx.failures >= maxEmbedFailures {
+		return false, fmt.Errorf("%d embeddings failed in a row: %w", idx.failures, err)
+	}
+	idx.skipped++
+	progress(fmt.Sprintf("  ⚠ skipping %q: %v", shortText(doc.Text, 60), err))
+	return false, nil
+}
+
+// prefetch, when the embedder can batch and i starts a batch of docs,
+// embeds the next embedBatchSize docs that need it in one request, for
+// embed to pick up. A failed batch is dropped: each doc is then embedded
+// on its own, so one the model can't handle is skipped as usual.
+func (idx *Indexer) prefetch(ctx context.Context, docs []Document, i int) {
+	batcher, ok := idx.embedder.(BatchEmbedder)
+	if !ok || i%embedBatchSize != 0 {
+		return
+	}
+	var texts []string
+	for _, doc := range docs[i:min(i+embedBatchSize, len(docs))] {
+		if _, ok := idx.known[doc.Text]; !ok {
+			texts = append(texts, doc.Text)
+		}
+	}
+	idx.fresh = nil
+	if len(texts) == 0 {
+		return
+	}
+	vecs, err := batcher.EmbedBatch(ctx, texts)
+	if err != nil {
+		return
+	}
+	idx.fresh = make(map[string][]float32, len(texts))
+	for j, text := range texts {
+		idx.fresh[text] = vecs[j]
+	}
+}
+
+// shortText cuts s to at most n runes for progress messages.
+func shortText(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n]) + "..."
+}
+
+// embed returns the vector for text, reusing the existing index's vector
+// when it has one, or the one prefetch just embedded. A new vector whose dimension differs from the existing
+// index's means the embedding model has changed, and the reused vectors
+// can't be mixed with it: that's ErrDimensionMismatch.
+func (idx *Indexer) embed(ctx context.Context, text string) ([]float32, error) {
+	if vec, ok := idx.known[text]; ok {
+		return vec, nil
+	}
+	vec, ok := idx.fresh[text]
+	var err error
+	if !ok {
+		vec, err = idx.embedder.Embed(ctx, text)
+	}
+	if err == nil && idx.knownDim != 0 && len(vec) != idx.knownDim {
+		return nil, fmt.Errorf("%w (the model now embeds to %d dimensions, the index has %d)", ErrDimensionMismatch, len(vec), idx.knownDim)
+	}
+	return vec, err
+}
+
+// add adds doc to the store, saving a checkpoint every checkpointEvery
+// documents.
+func (idx *Indexer) add(doc Document) error {
+	idx.store.Add(doc)
+	idx.unsaved++
+	if idx.unsaved < checkpointEvery {
+		return nil
+	}
+	idx.unsaved = 0
+	if err := idx.store.Save(); err != nil {
+		return fmt.Errorf("failed to save checkpoint: %w", err)
+	}
 	return nil
 }
 
@@ -251,42 +470,143 @@ func learnedDocs() ([]Document, error) {
 
 	docs := make([]Document, len(corrections))
 	for i, c := range corrections {
-		docs[i] = Document{
-			Text:     fmt.Sprintf("user correction: when asked '%s', the correct command is '%s'", c.Prompt, c.Command),
-			Source:   "learned",
-			Category: "learned",
-		}
+		docs[i] = correctionDocument(c.Prompt, c.Command)
+	}
+	return docs, nil
+}
+
+// noteDocs converts the user's notes from notes.json into documents.
+func noteDocs() ([]Document, error) {
+	notes, err := learn.LoadNotes()
+	if err != nil {
+		return nil, err
+	}
+
+	docs := make([]Document, len(notes))
+	for i, n := range notes {
+		docs[i] = noteDocument(n.Text)
 	}
 	return docs, nil
 }
 
+// DefaultHistoryLimit is how many recent history entries get indexed when
+// IndexOptions doesn't say otherwise.
+const DefaultHistoryLimit = 200
+
+// historyText is the text embedded for a successful prompt+command pair,
+// shared by historyDocs and LearnFromSuccess so both land in the same
+// semantic space. It deliberately takes nothing else: command output can
+// hold secrets and must never reach the vector store.
+func historyText(prompt, command string) string {
+	return historyPrefix(prompt) + command
+}
+
+// historyPrefix is the start of every history document for prompt, used to
+// find the ones a correction of that prompt contradicts.
+func historyPrefix(prompt string) string {
+	return fmt.Sprintf("'%s' was successfully executed as: ", prompt)
+}
+
+// correctedCommands maps each prompt the user has taught a command for
+// with `xx learn` to that command. It's empty if there are none or they
+// can't be read.
+func correctedCommands() map[string]string {
+	corrections, _ := learn.LoadAll()
+	corrected := make(map[string]string, len(corrections))
+	for _, c := range corrections {
+		corrected[c.Prompt] = c.Command
+	}
+	return corrected
+}
+
+// contradictsCorrection reports whether running command for prompt goes
+// against the command the user taught for it. Such a run still succeeded,
+// but learning it would put a wrong history doc in competition with the
+// right learned one.
+func contradictsCorrection(corrected map[string]string, prompt, command string) bool {
+	taught, ok := corrected[prompt]
+	return ok && taught != command
+}
+
+// sensitivePrompt matches prompts that likely involve credentials.
+var sensitivePrompt = regexp.MustCompile(`(?i)passw(or)?d|passphrase|token|secret|credential|api[ _-]?key|private[ _-]?key`)
+
+// skipHistory reports whether a prompt+command pair should stay out of the
+// index because skip_sensitive_history is on and the prompt looks like it
+// involves credentials.
+func skipHistory(cfg *config.Config, prompt string) bool {
+	return cfg.SkipSensitiveHistory && sensitivePrompt.MatchString(prompt)
+}
+
 // historyDocs converts successful command history into documents.
 // Past successes are great retrieval targets — if "check disk space" → "df -h"
 // worked before, it should be suggested again for similar queries.
-func historyDocs() ([]Document, error) {
-	entries, err := history.Load(200) // Last 200 successful commands.
+// Entries outside opts' project or time window are skipped before the cap
+// is applied, so a scoped index still gets up to opts.HistoryLimit entries.
+func historyDocs(opts IndexOptions) ([]Document, error) {
+	if opts.SkipHistory {
+		return nil, nil
+	}
+	limit := opts.HistoryLimit
+	if limit <= 0 {
+		limit = DefaultHistoryLimit
+	}
+
+	all, err := history.Load(0)
 	if err != nil {
 		return nil, err
 	}
+	cfg, _ := config.Load()
+	corrected := correctedCommands()
+
+	var entries []history.Entry
+	for _, e := range all {
+		if opts.Project != "" && e.Project != opts.Project {
+			continue
+		}
+		if !opts.Since.IsZero() && e.Timestamp.Before(opts.Since) {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	if len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
 
 	var docs []Document
-	seen := make(map[string]bool) // Deduplicate by prompt+command.
+	var runs []int                // Successful runs per doc.
+	index := make(map[string]int) // Deduplicate by prompt+command.
 	for _, e := range entries {
-		if !e.Success || e.Prompt == "" || e.Command == "" {
+		if !e.Success || e.Prompt == "" || e.Command == "" || skipHistory(cfg, e.Prompt) {
 			continue
 		}
+		if contradictsCorrection(corrected, e.Prompt, e.Command) {
+			continue // The user corrected this prompt since.
+		}
 		key := e.Prompt + "|" + e.Command
-		if seen[key] {
+		if i, ok := index[key]; ok {
+			runs[i]++
 			continue
 		}
-		seen[key] = true
+		index[key] = len(docs)
+		runs = append(runs, 1)
 
 		docs = append(docs, Document{
-			Text:     fmt.Sprintf("'%s' was successfully executed as: %s", e.Prompt, e.Command),
+			Text:     historyText(e.Prompt, e.Command),
 			Source:   "history",
 			Category: categorizeCommand(e.Command),
+			Project:  e.Project,
 		})
 	}
+
+	// A command that worked once says little; one that keeps working is worth
+	// boosting. Repeated pairs start with their run count as successes, so
+	// adaptive scoring favours them from the start, while one-offs stay neutral.
+	for i, n := range runs {
+		if n > 1 {
+			docs[i].SuccessCount = int32(n)
+		}
+	}
 	return docs, nil
 }
 
@@ -0,0 +1,179 @@
+package rag
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arin/xx-cli/internal/config"
+)
+
+const learnerLockFileName = "learner.lock"
+
+// staleLockAge is how old a learner lock must be before we assume its owner
+// died without cleaning up. Learners give up after 5s, so anything much
+// older than that was left behind by a crash or a kill.
+const staleLockAge = 30 * time.Second
+
+// learnerLockPath returns the path of the background learner's pidfile.
+// It's a variable so tests can override it.
+var learnerLockPath = func() string {
+	return filepath.Join(config.Dir(), learnerLockFileName)
+}
+
+// acquireLearnerLock makes sure only one learner touches the vector store
+// at a time. Running many commands in quick succession spawns a `_learn`
+// and a `_feedback` for each; without this they'd all load and rewrite
+// vectors.bin at once, and the last writer would win anyway.
+//
+// The lock is a pidfile created with O_EXCL, so acquiring it is atomic on
+// every platform. It returns false at once if someone else holds it, for
+// commands like `xx index --compact` that tell the user to try again;
+// background learners use queueLearner to wait their turn instead.
+// On success, the returned func releases the lock.
+func acquireLearnerLock() (func(), bool) {
+	path := learnerLockPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, false
+	}
+
+	for attempt := 0; attempt < 2; attempt++ {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err == nil {
+			_, _ = f.WriteString(strconv.Itoa(os.Getpid()))
+			f.Close()
+			return func() { os.Remove(path) }, true
+		}
+		if !os.IsExist(err) {
+			return nil, false
+		}
+		// Someone holds it. Break the lock only if its owner is long gone.
+		info, statErr := os.Stat(path)
+		if statErr != nil || time.Since(info.ModTime()) < staleLockAge {
+			return nil, false
+		}
+		_ = os.Remove(path)
+	}
+	return nil, false
+}
+
+// learnerLockWait is how long a background learner waits for the learner
+// lock. Each holder gives up on its own work after 5s, so this covers a few
+// learners ahead in the queue. It's below staleLockAge, so a queue marker
+// that old was left by a learner that died waiting.
+const learnerLockWait = 20 * time.Second
+
+// learnerLockPoll is how often a queued learner retries the learner lock.
+const learnerLockPoll = 10 * time.Millisecond
+
+// queueLearner waits for the learner lock on behalf of a background job,
+// identified by job (its kind and arguments). A `_learn` and a `_feedback`
+// spawned together, or the `_learn` of every step of a workflow, would
+// otherwise race for the lock and all but one would be dropped.
+//
+// The only job skipped is a duplicate: while a learner waits, it holds a
+// queue marker named after a hash of job, and an identical job that finds
+// the marker exits, since the one already queued will do the same work.
+// It also gives up after learnerLockWait. On success, the returned func
+// releases the lock.
+func queueLearner(job string) (func(), bool) {
+	sum := sha256.Sum256([]byte(job))
+	marker := filepath.Join(filepath.Dir(learnerLockPath()), "learner-"+hex.EncodeToString(sum[:8])+".queued")
+	if err := os.MkdirAll(filepath.Dir(marker), 0o700); err != nil {
+		return nil, false
+	}
+
+	queued := false
+	for attempt := 0; attempt < 2 && !queued; attempt++ {
+		f, err := os.OpenFile(marker, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err == nil {
+			_, _ = f.WriteString(strconv.Itoa(os.Getpid()))
+			f.Close()
+			queued = true
+			break
+		}
+		info, statErr := os.Stat(marker)
+		if !os.IsExist(err) || statErr != nil || time.Since(info.ModTime()) < staleLockAge {
+			return nil, false // The same job is already waiting.
+		}
+		_ = os.Remove(marker)
+	}
+	if !queued {
+		return nil, false
+	}
+	// Once this job holds the lock, an identical one may queue behind it:
+	// it would see the store as this job leaves it.
+	defer os.Remove(marker)
+
+	deadline := time.Now().Add(learnerLockWait)
+	for {
+		if release, ok := acquireLearnerLock(); ok {
+			return release, true
+		}
+		if time.Now().After(deadline) {
+			return nil, false
+		}
+		time.Sleep(learnerLockPoll)
+	}
+}
+
+// learnerJob identifies a background learner's work for queueLearner.
+func learnerJob(kind string, args ...string) string {
+	return kind + "\x00" + strings.Join(args, "\x00")
+}
+
+// storeLockWait is how long a writer waits for the store lock before
+// giving up. Writes take milliseconds, so this only runs out when a lock
+// was left behind, and staleLockAge has to be reached to break it.
+const storeLockWait = staleLockAge + 5*time.Second
+
+// storeLockPoll is how often a waiting writer retries the store lock.
+const storeLockPoll = 5 * time.Millisecond
+
+// storeLockPath returns the path of the lock held while vectors.bin is
+// written. It sits next to the store so tests that move the store get
+// their own lock too.
+func storeLockPath() string {
+	return storePath() + ".lock"
+}
+
+// acquireStoreLock serializes writes to the vector store file. Unlike the
+// learner lock, which a learner gives up on, it waits its turn: Save and
+// Append take it for the few milliseconds of the write itself, so two
+// processes can't interleave a header update with a rewrite and leave a
+// count that doesn't match the documents.
+//
+// It's the same O_EXCL pidfile as the learner lock, broken once it's
+// older than staleLockAge. On success, the returned func releases it.
+func acquireStoreLock() (func(), error) {
+	path := storeLockPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(storeLockWait)
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err == nil {
+			_, _ = f.WriteString(strconv.Itoa(os.Getpid()))
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("failed to lock vector store: %w", err)
+		}
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > staleLockAge {
+			_ = os.Remove(path)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("vector store is locked by another process (%s)", path)
+		}
+		time.Sleep(storeLockPoll)
+	}
+}
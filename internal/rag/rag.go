@@ -3,8 +3,15 @@ package rag
 import (
 	"context"
 	"fmt"
+	"io"
+	"os"
+	"strconv"
 	"strings"
 	"time"
+
+	"github.com/arin/xx-cli/internal/config"
+	projctx "github.com/arin/xx-cli/internal/context"
+	"github.com/arin/xx-cli/internal/metrics"
 )
 
 const (
@@ -22,20 +29,39 @@ const (
 // into the system prompt.
 //
 // This is the main entry point for RAG — called before every AI translation.
-func Retrieve(ctx context.Context, query string) (string, error) {
+// A nil embedder means NewEmbedClient().
+func Retrieve(ctx context.Context, embedder Embedder, query string) (string, error) {
+	results, err := RetrieveResults(ctx, embedder, query)
+	if err != nil || len(results) == 0 {
+		return "", err
+	}
+	return formatContext(results), nil
+}
+
+// RetrieveResults does the retrieval half of Retrieve without formatting:
+// embed the query, search the store, drop low-relevance hits, and dedup.
+// Callers that need more than one rendering of the same results (e.g. the
+// prompt block plus a verbose debug block) use this to embed only once.
+func RetrieveResults(ctx context.Context, embedder Embedder, query string) ([]SearchResult, error) {
+	defer func(start time.Time) { metrics.RetrievalLatency.Observe(time.Since(start)) }(time.Now())
+
 	// Load the vector store from disk.
 	store := NewStore()
 	if err := store.Load(); err != nil {
 		// If no index exists, return empty context (graceful degradation).
-		return "", nil
+		return nil, nil
 	}
+	store.FilterProject(projctx.CurrentProject())
 
 	// Embed the user's query into a vector.
-	embedder := NewEmbedClient()
-	queryVec, err := embedder.Embed(ctx, query)
+	queryVec, err := orDefault(embedder).Embed(ctx, query)
 	if err != nil {
 		// If embedding fails, continue without RAG context.
-		return "", nil
+		return nil, nil
+	}
+	if err := checkQueryDim(store, queryVec); err != nil {
+		// Every similarity would be 0; say why instead of returning noise.
+		return nil, err
 	}
 
 	// Search for the most relevant documents (no category filter — search everything).
@@ -49,12 +75,53 @@ func Retrieve(ctx context.Context, query string) (string, error) {
 		}
 	}
 
-	if len(relevant) == 0 {
-		return "", nil
+	// Drop near-identical docs from different sources so the same knowledge
+	// doesn't take up prompt space twice.
+	return dedupResults(relevant, NearDuplicateThreshold), nil
+}
+
+// Search is RetrieveResults for debugging: it returns the raw top-K hits,
+// optionally pre-filtered to one category, without dropping low scores or
+// near-duplicates, and reports a missing index or a failed embedding as an
+// error instead of degrading to no context. A nil embedder means
+// NewEmbedClient().
+func Search(ctx context.Context, embedder Embedder, query string, topK int, category string) ([]SearchResult, error) {
+	store := NewStore()
+	if err := store.Load(); err != nil {
+		return nil, fmt.Errorf("failed to load knowledge index: %w", err)
+	}
+	store.FilterProject(projctx.CurrentProject())
+
+	queryVec, err := orDefault(embedder).Embed(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed query: %w", err)
+	}
+	if err := checkQueryDim(store, queryVec); err != nil {
+		return nil, err
+	}
+	return store.Search(queryVec, topK, category), nil
+}
+
+// checkQueryDim returns ErrDimensionMismatch if queryVec came from a
+// different embedding model than the one the store was built with.
+func checkQueryDim(store *Store, queryVec []float32) error {
+	if dim := store.Dim(); dim != 0 && dim != len(queryVec) {
+		return fmt.Errorf("%w (the query embeds to %d dimensions, the index has %d)", ErrDimensionMismatch, len(queryVec), dim)
 	}
+	return nil
+}
 
-	// Format results into a context block for the system prompt.
-	return formatContext(relevant), nil
+// FormatContext renders search results for the system prompt. The lean
+// format is what production prompts use; verbose adds each doc's category
+// and retrieval score so you can see why it was picked (--verbose output).
+func FormatContext(results []SearchResult, verbose bool) string {
+	if len(results) == 0 {
+		return ""
+	}
+	if verbose {
+		return formatContextVerbose(results)
+	}
+	return formatContext(results)
 }
 
 // formatContext turns search results into a string that gets injected
@@ -69,9 +136,172 @@ func formatContext(results []SearchResult) string {
 	return sb.String()
 }
 
+// formatContextVerbose is formatContext plus the category and final score
+// of each document. It costs extra prompt tokens, so it's only for debugging.
+func formatContextVerbose(results []SearchResult) string {
+	var sb strings.Builder
+	sb.WriteString("\nRelevant knowledge (ALWAYS prefer [builtin] over [history] entries):\n")
+	for _, r := range results {
+		sb.WriteString(fmt.Sprintf("- [%s] (%s, score %.2f) %s\n", r.Doc.Source, r.Doc.Category, r.Score, r.Doc.Text))
+	}
+	return sb.String()
+}
+
+// sourceRank orders document sources by authority. Builtins are curated,
+// learned entries were taught explicitly, notes are facts the user taught,
+// history entries and past fixes are auto-learned.
+var sourceRank = map[string]int{
+	"builtin": 4,
+	"learned": 3,
+	"note":    2,
+	"history": 1,
+	"fix":     1,
+}
+
+// dedupResults collapses results whose vectors are near-duplicates of each
+// other (cosine similarity above threshold). From each group of duplicates
+// the most authoritative source wins; ties go to the higher score.
+//
+// Results are expected to be sorted by score descending (as Search returns
+// them), and the output preserves that order.
+func dedupResults(results []SearchResult, threshold float32) []SearchResult {
+	var kept []SearchResult
+	for _, r := range results {
+		dup := -1
+		for i, k := range kept {
+			if cosineSimilarity(r.Doc.Vector, k.Doc.Vector) > threshold {
+				dup = i
+				break
+			}
+		}
+		if dup < 0 {
+			kept = append(kept, r)
+			continue
+		}
+		// Replace the kept doc only if this one is more authoritative.
+		// Scores are descending, so an equal-rank duplicate always loses.
+		if sourceRank[r.Doc.Source] > sourceRank[kept[dup].Doc.Source] {
+			kept[dup] = r
+		}
+	}
+	return kept
+}
+
+// AddNote embeds a user note and appends it to the vector store with
+// source "note", so it surfaces as context for related queries. Unlike
+// LearnFromSuccess this runs in the foreground and reports errors: the user
+// asked for it explicitly and should know if it didn't stick.
+func AddNote(ctx context.Context, embedder Embedder, text string) error {
+	doc := noteDocument(text)
+	vec, err := orDefault(embedder).Embed(ctx, doc.Text)
+	if err != nil {
+		return fmt.Errorf("failed to embed note: %w", err)
+	}
+	doc.Vector = vec
+
+	// Wait out any background learner: one that loaded the store before
+	// this Append would save over the note.
+	release, ok := queueLearner(learnerJob("note", text))
+	if !ok {
+		return fmt.Errorf("a background learner is updating the knowledge index, try again in a few seconds")
+	}
+	defer release()
+
+	// Load first so Append's full-Save fallback (missing or old-format
+	// file) doesn't drop what's already there.
+	store := NewStore()
+	_ = store.Load()
+	if store.HasNearDuplicate(vec, NearDuplicateThreshold) {
+		return nil // Already known — e.g. the same note added twice.
+	}
+	return store.Append(doc)
+}
+
+// noteDocument builds the document for a user note. AddNote and the
+// indexer share it so a re-indexed note embeds exactly like a new one.
+func noteDocument(text string) Document {
+	return Document{
+		Text:     "user note: " + text,
+		Source:   "note",
+		Category: "note",
+	}
+}
+
+// correctionDocument builds the document for a learned correction. The
+// indexer and LearnCorrection share it so both embed the same text.
+func correctionDocument(prompt, command string) Document {
+	return Document{
+		Text:     correctionPrefix(prompt) + fmt.Sprintf(" the correct command is '%s'", command),
+		Source:   "learned",
+		Category: "learned",
+	}
+}
+
+// correctionPrefix is the start of every correction document for prompt,
+// used to find the stale one when a correction is re-taught.
+func correctionPrefix(prompt string) string {
+	return fmt.Sprintf("user correction: when asked '%s',", prompt)
+}
+
+// LearnCorrection embeds a correction the user just taught with `xx learn`
+// and adds it to the vector store, so RAG can use it without waiting for
+// the next `xx index`. Like LearnFromSuccess it runs in a detached
+// subprocess with a 5-second budget, queues for the learner lock, and fails
+// silently. A nil embedder means NewEmbedClient().
+func LearnCorrection(ctx context.Context, embedder Embedder, prompt, command string) {
+	release, ok := queueLearner(learnerJob("correction", prompt, command))
+	if !ok {
+		return
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	_ = addCorrection(ctx, embedder, prompt, command)
+}
+
+// addCorrection stores the correction document for prompt, replacing the
+// one from an earlier `xx learn` of the same prompt, and drops history docs
+// that ran a different command for it: the user just said that command
+// was wrong. A missing store is left alone — the user hasn't run 'xx index'.
+func addCorrection(ctx context.Context, embedder Embedder, prompt, command string) error {
+	doc := correctionDocument(prompt, command)
+	vec, err := orDefault(embedder).Embed(ctx, doc.Text)
+	if err != nil {
+		return err
+	}
+	doc.Vector = vec
+
+	store := NewStore()
+	if err := store.Load(); err != nil {
+		return err
+	}
+
+	// Re-teaching a prompt replaces its old command, and auto-learned
+	// history for it goes unless it agrees with the correction. That needs
+	// a full rewrite; a new prompt is a cheap append.
+	prefix, histPrefix, agreed := correctionPrefix(prompt), historyPrefix(prompt), historyText(prompt, command)
+	kept := store.docs[:0]
+	for _, d := range store.docs {
+		if d.Source == "learned" && strings.HasPrefix(d.Text, prefix) {
+			continue
+		}
+		if d.Source == "history" && strings.HasPrefix(d.Text, histPrefix) && d.Text != agreed {
+			continue
+		}
+		kept = append(kept, d)
+	}
+	if len(kept) < len(store.docs) {
+		store.docs = append(kept, doc)
+		return store.Save()
+	}
+	return store.Append(doc)
+}
+
 // NearDuplicateThreshold is the cosine similarity above which two vectors
 // are considered "the same knowledge". 0.95 is high enough to catch
 // "check disk space" vs "show disk usage" but won't merge unrelated commands.
+// Auto-learning uses learn_dedup_threshold from the config instead, if set.
 const NearDuplicateThreshold float32 = 0.95
 
 // LearnFromSuccess embeds a successful prompt+command pair and appends it
@@ -86,59 +316,256 @@ const NearDuplicateThreshold float32 = 0.95
 // opportunity — the user never waits.
 //
 // Errors are silently ignored — this must never degrade the user experience.
-func LearnFromSuccess(ctx context.Context, prompt, command, category string) {
+// If another background learner is running, it waits its turn; it only
+// returns early if the same learning is already queued (see queueLearner).
+// A nil embedder means NewEmbedClient().
+func LearnFromSuccess(ctx context.Context, embedder Embedder, prompt, command, category string) {
+	release, ok := queueLearner(learnerJob("learn", prompt, command, category))
+	if !ok {
+		return // The same learning is already queued, or the queue is stuck.
+	}
+	defer release()
+
 	// Hard timeout: if the whole operation (embed + load + dedup + append)
 	// takes longer than 5s, bail. Typical time is ~300ms.
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
+	if cfg, err := config.Load(); err == nil && skipHistory(cfg, prompt) {
+		return // The user opted out of indexing credential-related prompts.
+	}
+	if contradictsCorrection(correctedCommands(), prompt, command) {
+		return // The user already taught a different command for this prompt.
+	}
+
 	// Compose the text exactly like historyDocs() does, so the embeddings
 	// are in the same semantic space and dedup works correctly.
-	text := fmt.Sprintf("'%s' was successfully executed as: %s", prompt, command)
+	text := historyText(prompt, command)
 
 	// Embed the text.
-	embedder := NewEmbedClient()
-	vec, err := embedder.Embed(ctx, text)
+	vec, err := orDefault(embedder).Embed(ctx, text)
 	if err != nil {
 		return // Silent failure — user never sees this.
 	}
 
-	// Load the current store to check for duplicates.
+	doc := Document{
+		Text:     text,
+		Source:   "history",
+		Category: category,
+		Project:  projctx.CurrentProject(),
+	}
+	doc.Vector = vec
+	_, _ = appendUnlessDuplicate(doc, learnDedupThreshold()) // Silent failure.
+}
+
+// appendUnlessDuplicate appends doc to the vector store unless a stored
+// vector is more similar to it than threshold. It reports whether doc was
+// stored. A missing store is left alone — the user hasn't run 'xx index'.
+func appendUnlessDuplicate(doc Document, threshold float32) (bool, error) {
 	store := NewStore()
 	if err := store.Load(); err != nil {
-		return // No store yet — skip (user hasn't run 'xx index').
+		return false, err
 	}
 
 	// Semantic dedup: if a very similar vector already exists, skip.
-	if store.HasNearDuplicate(vec, NearDuplicateThreshold) {
-		return
+	if store.HasNearDuplicate(doc.Vector, threshold) {
+		return false, nil
 	}
 
 	// Append the new document (O(1) write).
-	doc := Document{
-		Text:     text,
-		Source:   "history",
-		Category: category,
+	return true, store.Append(doc)
+}
+
+// learnDedupThreshold returns the near-duplicate threshold for
+// auto-learning: the learn_dedup_threshold config value if set, otherwise
+// NearDuplicateThreshold. Users with repetitive workflows lower it to keep
+// fewer near-identical entries.
+func learnDedupThreshold() float32 {
+	cfg, err := config.Load()
+	if err != nil || cfg.LearnDedupThreshold <= 0 {
+		return NearDuplicateThreshold
 	}
-	doc.Vector = vec
-	_ = store.Append(doc) // Silent failure.
+	return float32(cfg.LearnDedupThreshold)
+}
+
+// DefaultFeedbackMinScore is the cosine similarity a document needs to a
+// prompt before RecordFeedback credits it with the command's outcome.
+// The feedback_min_score config value overrides it.
+const DefaultFeedbackMinScore float32 = 0.5
+
+// feedbackMinScore returns the relevance floor for adaptive scoring: the
+// feedback_min_score config value if set, otherwise DefaultFeedbackMinScore.
+func feedbackMinScore() float32 {
+	cfg, err := config.Load()
+	if err != nil || cfg.FeedbackMinScore <= 0 {
+		return DefaultFeedbackMinScore
+	}
+	return float32(cfg.FeedbackMinScore)
+}
+
+// feedbackTopK returns how many documents share each piece of feedback:
+// the feedback_top_k config value if set, otherwise DefaultTopK, the same
+// number retrieval puts in the prompt.
+func feedbackTopK() int {
+	cfg, err := config.Load()
+	if err != nil || cfg.FeedbackTopK <= 0 {
+		return DefaultTopK
+	}
+	return cfg.FeedbackTopK
+}
+
+// Compact removes near-duplicate documents from the vector store, using
+// the same threshold as auto-learning, and rewrites the file. With dryRun it
+// only reports how many documents it would remove. It takes the learner
+// lock so it can't race a background learner's append.
+func Compact(dryRun bool) (int, error) {
+	release, ok := acquireLearnerLock()
+	if !ok {
+		return 0, fmt.Errorf("a background learner is updating the knowledge index, try again in a few seconds")
+	}
+	defer release()
+
+	if _, err := os.Stat(storePath()); os.IsNotExist(err) {
+		return 0, nil // No index yet, nothing to compact.
+	}
+	store := NewStore()
+	if err := store.Load(); err != nil {
+		return 0, err
+	}
+	removed := store.Compact(learnDedupThreshold())
+	if dryRun || removed == 0 {
+		return removed, nil
+	}
+	return removed, store.Save()
+}
+
+// PruneMinFailures is how many failures, without a single success, get an
+// auto-learned history document pruned.
+const PruneMinFailures = 2
+
+// Prune drops stale auto-learned history documents from the index on disk:
+// those that have failed PruneMinFailures times without ever succeeding,
+// and near-duplicates (at the auto-learning threshold) of better-scoring
+// docs. It returns how many it removed and how many bytes the store file
+// shrank by. Like Compact, it holds the learner lock while it rewrites.
+func Prune() (removed int, reclaimed int64, err error) {
+	release, ok := acquireLearnerLock()
+	if !ok {
+		return 0, 0, fmt.Errorf("a background learner is updating the knowledge index, try again in a few seconds")
+	}
+	defer release()
+
+	before, err := os.Stat(storePath())
+	if os.IsNotExist(err) {
+		return 0, 0, nil // No index yet, nothing to prune.
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	store := NewStore()
+	if err := store.Load(); err != nil {
+		return 0, 0, err
+	}
+	removed = store.Prune(PruneOptions{MinFailures: PruneMinFailures, DupThreshold: learnDedupThreshold()})
+	if removed == 0 {
+		return 0, 0, nil
+	}
+	if err := store.Save(); err != nil {
+		return 0, 0, err
+	}
+	after, err := os.Stat(storePath())
+	if err != nil {
+		return removed, 0, err
+	}
+	return removed, before.Size() - after.Size(), nil
+}
+
+// ExportIndex writes the index on disk to w as JSON (see Store.ExportJSON)
+// and returns how many documents it wrote.
+func ExportIndex(w io.Writer) (int, error) {
+	store := NewStore()
+	if err := store.Load(); err != nil {
+		return 0, err
+	}
+	return store.Len(), store.ExportJSON(w)
 }
 
-// RecordFeedback updates the adaptive relevance score for the document
-// most similar to the user's query. Called after command execution to
-// provide a reinforcement signal — success boosts the doc, failure penalizes it.
+// ImportIndex reads an ExportIndex export from r into the index on disk,
+// replacing it or merging with it (see Store.ImportJSON, deduplicating at
+// the auto-learning threshold), and returns how many documents it added
+// and how many the index now holds. It holds the learner lock while it
+// rewrites the store, like Compact.
+func ImportIndex(r io.Reader, replace bool) (added, total int, err error) {
+	release, ok := acquireLearnerLock()
+	if !ok {
+		return 0, 0, fmt.Errorf("a background learner is updating the knowledge index, try again in a few seconds")
+	}
+	defer release()
+
+	// A replace doesn't need the old store, and mustn't fail on it.
+	store := NewStore()
+	if _, err := os.Stat(storePath()); err == nil && !replace {
+		if err := store.Load(); err != nil {
+			return 0, 0, err
+		}
+	}
+	added, err = store.ImportJSON(r, replace, learnDedupThreshold())
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := store.Save(); err != nil {
+		return 0, 0, err
+	}
+	return added, store.Len(), nil
+}
+
+// PruneSource removes every document from source ("history", "fix",
+// "learned", "note" or "builtin") from the index on disk, and returns how
+// many it removed and how many are left. It takes the learner lock, like
+// Compact, so a background learner can't write in between.
+func PruneSource(source string) (removed, left int, err error) {
+	if _, ok := sourceRank[source]; !ok {
+		return 0, 0, fmt.Errorf("unknown source %q (use builtin, learned, note, history or fix)", source)
+	}
+	release, ok := acquireLearnerLock()
+	if !ok {
+		return 0, 0, fmt.Errorf("a background learner is updating the knowledge index, try again in a few seconds")
+	}
+	defer release()
+
+	store := NewStore()
+	if err := store.Load(); err != nil {
+		return 0, 0, err
+	}
+	removed = store.DeleteBySource(source)
+	if removed > 0 {
+		err = store.Save()
+	}
+	return removed, store.Len(), err
+}
+
+// RecordFeedback updates the adaptive relevance scores of the documents
+// most similar to the user's query, with rank-decayed credit (see
+// Store.UpdateTopScores). Called after command execution to provide a
+// reinforcement signal — success boosts the docs, failure penalizes them.
 //
 // This is the feedback loop that makes retrieval quality improve over time:
 //   query → retrieve docs → execute command → success/failure → update scores
 //
 // Like LearnFromSuccess, this runs in a background subprocess with a 5s timeout.
-// Errors are silently ignored.
-func RecordFeedback(ctx context.Context, prompt string, success bool) {
+// Errors are silently ignored, and it queues for LearnFromSuccess's lock. A
+// nil embedder means NewEmbedClient().
+func RecordFeedback(ctx context.Context, embedder Embedder, prompt string, success bool) {
+	release, ok := queueLearner(learnerJob("feedback", prompt, strconv.FormatBool(success)))
+	if !ok {
+		return
+	}
+	defer release()
+
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
 	// Embed the original prompt to find which doc was most relevant.
-	embedder := NewEmbedClient()
-	vec, err := embedder.Embed(ctx, prompt)
+	vec, err := orDefault(embedder).Embed(ctx, prompt)
 	if err != nil {
 		return
 	}
@@ -149,7 +576,7 @@ func RecordFeedback(ctx context.Context, prompt string, success bool) {
 	}
 
 	// Update the score of the best-matching document.
-	if !store.UpdateScore(vec, success) {
+	if store.UpdateTopScores(vec, success, feedbackMinScore(), feedbackTopK()) == 0 {
 		return // No relevant doc found.
 	}
 
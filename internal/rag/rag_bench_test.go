@@ -76,7 +76,7 @@ func TestUpdateScore_Success(t *testing.T) {
 	s.Add(Document{Text: "check disk", Vector: []float32{0.0, 0.1, 0.9}})
 
 	// Query close to "check memory".
-	updated := s.UpdateScore([]float32{0.8, 0.2, 0.0}, true)
+	updated := s.UpdateScore([]float32{0.8, 0.2, 0.0}, true, DefaultFeedbackMinScore)
 	if !updated {
 		t.Fatal("UpdateScore should return true when a match is found")
 	}
@@ -92,7 +92,7 @@ func TestUpdateScore_Failure(t *testing.T) {
 	s := NewStore()
 	s.Add(Document{Text: "check memory", Vector: []float32{0.9, 0.1, 0.0}})
 
-	updated := s.UpdateScore([]float32{0.8, 0.2, 0.0}, false)
+	updated := s.UpdateScore([]float32{0.8, 0.2, 0.0}, false, DefaultFeedbackMinScore)
 	if !updated {
 		t.Fatal("UpdateScore should return true")
 	}
@@ -103,7 +103,7 @@ func TestUpdateScore_Failure(t *testing.T) {
 
 func TestUpdateScore_EmptyStore(t *testing.T) {
 	s := NewStore()
-	updated := s.UpdateScore([]float32{1, 2, 3}, true)
+	updated := s.UpdateScore([]float32{1, 2, 3}, true, DefaultFeedbackMinScore)
 	if updated {
 		t.Error("empty store should return false")
 	}
@@ -114,21 +114,86 @@ func TestUpdateScore_LowSimilarity(t *testing.T) {
 	// Orthogonal vectors — similarity < 0.5 threshold.
 	s.Add(Document{Text: "a", Vector: []float32{1, 0, 0}})
 
-	updated := s.UpdateScore([]float32{0, 1, 0}, true)
+	updated := s.UpdateScore([]float32{0, 1, 0}, true, DefaultFeedbackMinScore)
 	if updated {
 		t.Error("should not update when best match is below 0.5 threshold")
 	}
 }
 
+func TestUpdateScore_LowerFloor(t *testing.T) {
+	s := NewStore()
+	s.Add(Document{Text: "a", Vector: []float32{1, 0}})
+	query := []float32{0.45, 0.893} // Cosine similarity ~0.45 to the doc.
+
+	if s.UpdateScore(query, true, DefaultFeedbackMinScore) {
+		t.Fatal("a 0.45 match should be below the default floor")
+	}
+	if !s.UpdateScore(query, true, 0.4) {
+		t.Fatal("a 0.45 match should get feedback with the floor at 0.4")
+	}
+	if s.docs[0].SuccessCount != 1 {
+		t.Errorf("expected SuccessCount=1, got %d", s.docs[0].SuccessCount)
+	}
+}
+
+func TestUpdateTopScores_RankDecayedCredit(t *testing.T) {
+	s := NewStore()
+	s.Add(Document{Text: "best", Vector: []float32{1, 0, 0}})
+	s.Add(Document{Text: "second", Vector: []float32{0.9, 0.3, 0}})
+	s.Add(Document{Text: "third", Vector: []float32{0.8, 0.6, 0}})
+	s.Add(Document{Text: "fourth", Vector: []float32{0.7, 0.7, 0.1}})
+	s.Add(Document{Text: "unrelated", Vector: []float32{0, 0, 1}})
+
+	// Draw evenly spread chances so the proportions come out exact.
+	const runs = 600
+	orig := feedbackChance
+	defer func() { feedbackChance = orig }()
+	draw := 0
+	feedbackChance = func() float64 {
+		draw++
+		return (float64(draw%runs) + 0.5) / runs
+	}
+
+	for i := 0; i < runs; i++ {
+		if n := s.UpdateTopScores([]float32{1, 0, 0}, true, DefaultFeedbackMinScore, 3); n < 1 || n > 3 {
+			t.Fatalf("expected 1 to 3 docs updated, got %d", n)
+		}
+	}
+
+	want := map[string]int32{"best": runs, "second": runs / 2, "third": runs / 3}
+	for _, d := range s.docs {
+		if got := d.SuccessCount; got < want[d.Text]-runs/50 || got > want[d.Text]+runs/50 {
+			t.Errorf("%s: expected about %d successes, got %d", d.Text, want[d.Text], got)
+		}
+	}
+}
+
+func TestUpdateTopScores_RespectsFloor(t *testing.T) {
+	s := NewStore()
+	s.Add(Document{Text: "match", Vector: []float32{1, 0}})
+	s.Add(Document{Text: "unrelated", Vector: []float32{0, 1}})
+
+	orig := feedbackChance
+	defer func() { feedbackChance = orig }()
+	feedbackChance = func() float64 { return 0 } // Always credit lower ranks.
+
+	if n := s.UpdateTopScores([]float32{1, 0}, false, DefaultFeedbackMinScore, 5); n != 1 {
+		t.Fatalf("only the doc above the floor should be updated, got %d", n)
+	}
+	if s.docs[0].FailureCount != 1 || s.docs[1].FailureCount != 0 {
+		t.Errorf("expected only the match penalized, got %d and %d", s.docs[0].FailureCount, s.docs[1].FailureCount)
+	}
+}
+
 func TestUpdateScore_MultipleUpdates(t *testing.T) {
 	s := NewStore()
 	s.Add(Document{Text: "check memory", Vector: []float32{0.9, 0.1}})
 
 	for i := 0; i < 5; i++ {
-		s.UpdateScore([]float32{0.9, 0.1}, true)
+		s.UpdateScore([]float32{0.9, 0.1}, true, DefaultFeedbackMinScore)
 	}
 	for i := 0; i < 3; i++ {
-		s.UpdateScore([]float32{0.9, 0.1}, false)
+		s.UpdateScore([]float32{0.9, 0.1}, false, DefaultFeedbackMinScore)
 	}
 
 	if s.docs[0].SuccessCount != 5 {
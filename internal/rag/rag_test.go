@@ -1,9 +1,27 @@
 package rag
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/arin/xx-cli/internal/config"
+	"github.com/arin/xx-cli/internal/history"
+	"github.com/arin/xx-cli/internal/learn"
 )
 
 // --- Cosine Similarity Tests ---
@@ -685,6 +703,87 @@ func TestFormatContext_MultipleSourceTypes(t *testing.T) {
 	}
 }
 
+func TestFormatContext_LeanOmitsScore(t *testing.T) {
+	results := []SearchResult{
+		{Doc: Document{Text: "use vm_stat", Source: "builtin", Category: "memory"}, Score: 0.87},
+	}
+	output := FormatContext(results, false)
+	if output != formatContext(results) {
+		t.Error("lean FormatContext should match formatContext")
+	}
+	if contains(output, "0.87") || contains(output, "memory") {
+		t.Errorf("lean format should not include score or category, got %q", output)
+	}
+}
+
+func TestFormatContext_VerboseIncludesScoreAndCategory(t *testing.T) {
+	results := []SearchResult{
+		{Doc: Document{Text: "use vm_stat", Source: "builtin", Category: "memory"}, Score: 0.87},
+		{Doc: Document{Text: "use df -h", Source: "history", Category: "disk"}, Score: 0.5},
+	}
+	output := FormatContext(results, true)
+	for _, want := range []string{"[builtin] (memory, score 0.87) use vm_stat", "[history] (disk, score 0.50) use df -h"} {
+		if !contains(output, want) {
+			t.Errorf("verbose format should contain %q, got %q", want, output)
+		}
+	}
+}
+
+func TestFormatContext_EmptyResults(t *testing.T) {
+	if got := FormatContext(nil, true); got != "" {
+		t.Errorf("expected empty string for no results, got %q", got)
+	}
+}
+
+// --- Dedup Tests ---
+
+func TestDedupResults_OverlappingBuiltinAndHistory(t *testing.T) {
+	results := []SearchResult{
+		{Doc: Document{Text: "'check ram' was successfully executed as: vm_stat", Source: "history", Vector: []float32{1, 0, 0.01}}, Score: 0.9},
+		{Doc: Document{Text: "check memory usage on macOS: use 'vm_stat'", Source: "builtin", Vector: []float32{1, 0, 0}}, Score: 0.85},
+		{Doc: Document{Text: "disk usage: use 'df -h'", Source: "builtin", Vector: []float32{0, 1, 0}}, Score: 0.6},
+	}
+
+	deduped := dedupResults(results, NearDuplicateThreshold)
+	if len(deduped) != 2 {
+		t.Fatalf("expected 2 results after dedup, got %d", len(deduped))
+	}
+
+	output := formatContext(deduped)
+	if contains(output, "- [history]") {
+		t.Error("history duplicate of a builtin doc should have been dropped")
+	}
+	if !contains(output, "check memory usage on macOS") {
+		t.Error("builtin doc should win over its history duplicate")
+	}
+	if !contains(output, "df -h") {
+		t.Error("unrelated doc should be kept")
+	}
+}
+
+func TestDedupResults_SameSourceKeepsHigherScore(t *testing.T) {
+	results := []SearchResult{
+		{Doc: Document{Text: "first", Source: "history", Vector: []float32{1, 0}}, Score: 0.9},
+		{Doc: Document{Text: "second", Source: "history", Vector: []float32{1, 0.001}}, Score: 0.8},
+	}
+	deduped := dedupResults(results, NearDuplicateThreshold)
+	if len(deduped) != 1 || deduped[0].Doc.Text != "first" {
+		t.Errorf("expected only the higher-scored doc, got %+v", deduped)
+	}
+}
+
+func TestDedupResults_NoDuplicates(t *testing.T) {
+	results := []SearchResult{
+		{Doc: Document{Text: "a", Source: "builtin", Vector: []float32{1, 0, 0}}, Score: 0.9},
+		{Doc: Document{Text: "b", Source: "history", Vector: []float32{0, 1, 0}}, Score: 0.8},
+		{Doc: Document{Text: "c", Source: "learned", Vector: []float32{0, 0, 1}}, Score: 0.7},
+	}
+	deduped := dedupResults(results, NearDuplicateThreshold)
+	if len(deduped) != 3 {
+		t.Errorf("expected all 3 results kept, got %d", len(deduped))
+	}
+}
+
 // --- Indexer Doc Count Tests ---
 
 func TestMacosCommandDocs_Count(t *testing.T) {
@@ -713,3 +812,1510 @@ func TestOsCommandDocs_AllHaveCategories(t *testing.T) {
 		}
 	}
 }
+
+// --- Feedback ranking tests ---
+
+func TestStore_RankByFeedback(t *testing.T) {
+	tmpDir := t.TempDir()
+	origStorePath := storePath
+	storePath = func() string { return filepath.Join(tmpDir, "vectors.bin") }
+	defer func() { storePath = origStorePath }()
+
+	s := NewStore()
+	vec := []float32{1, 0, 0}
+	s.Add(Document{Text: "ok", Source: "history", Vector: vec, SuccessCount: 3, FailureCount: 1})
+	s.Add(Document{Text: "best", Source: "history", Vector: vec, SuccessCount: 9, FailureCount: 0})
+	s.Add(Document{Text: "worst", Source: "history", Vector: vec, SuccessCount: 0, FailureCount: 4})
+	s.Add(Document{Text: "tie-more-successes", Source: "learned", Vector: vec, SuccessCount: 5, FailureCount: 3})
+	s.Add(Document{Text: "untouched", Source: "history", Vector: vec})
+	s.Add(Document{Text: "builtin", Source: "builtin", Vector: vec, SuccessCount: 20})
+	if err := s.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	loaded := NewStore()
+	if err := loaded.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	ranked := loaded.RankByFeedback("history", "learned")
+	var got []string
+	for _, d := range ranked {
+		got = append(got, d.Text)
+	}
+	want := []string{"best", "tie-more-successes", "ok", "worst"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("ranking = %v, want %v", got, want)
+	}
+
+	if all := loaded.RankByFeedback(); len(all) != 5 || all[0].Text != "builtin" {
+		t.Errorf("no sources should rank every doc with feedback, got %d docs", len(all))
+	}
+}
+
+func TestStore_Compact(t *testing.T) {
+	s := NewStore()
+	s.Add(Document{Text: "history dup of builtin", Source: "history", Vector: []float32{1, 0, 0}})
+	s.Add(Document{Text: "builtin", Source: "builtin", Vector: []float32{1, 0, 0.01}})
+	s.Add(Document{Text: "builtin twin", Source: "builtin", Vector: []float32{1, 0, 0.02}})
+	s.Add(Document{Text: "bad history", Source: "history", Vector: []float32{0, 1, 0}, FailureCount: 3})
+	s.Add(Document{Text: "good history", Source: "history", Vector: []float32{0, 1, 0.01}, SuccessCount: 2})
+	s.Add(Document{Text: "unrelated", Source: "history", Vector: []float32{0, 0, 1}})
+
+	if removed := s.Compact(NearDuplicateThreshold); removed != 2 {
+		t.Errorf("expected 2 removed, got %d", removed)
+	}
+	var got []string
+	for _, d := range s.Docs() {
+		got = append(got, d.Text)
+	}
+	if strings.Join(got, ",") != "builtin,builtin twin,good history,unrelated" {
+		t.Errorf("unexpected docs after compact: %v", got)
+	}
+}
+
+func TestStore_SuspectBuiltins(t *testing.T) {
+	s := NewStore()
+	vec := []float32{1, 0, 0}
+	s.Add(Document{Text: "check memory: vm_stat", Source: "builtin", Vector: vec, SuccessCount: 1, FailureCount: 6})
+	s.Add(Document{Text: "ports: lsof -i", Source: "builtin", Vector: vec, FailureCount: 3})
+	s.Add(Document{Text: "mostly fine", Source: "builtin", Vector: vec, SuccessCount: 10, FailureCount: 4})
+	s.Add(Document{Text: "one bad run", Source: "builtin", Vector: vec, FailureCount: 1})
+	s.Add(Document{Text: "failing history", Source: "history", Vector: vec, FailureCount: 9})
+
+	// Feed failures through UpdateScore, like real _feedback runs do.
+	s.Add(Document{Text: "disk: diskutil list", Source: "builtin", Vector: []float32{0, 1, 0}})
+	for i := 0; i < 4; i++ {
+		if !s.UpdateScore([]float32{0, 1, 0}, false, DefaultFeedbackMinScore) {
+			t.Fatal("UpdateScore should match the builtin")
+		}
+	}
+
+	var got []string
+	for _, d := range s.SuspectBuiltins() {
+		got = append(got, d.Text)
+	}
+	want := []string{"check memory: vm_stat", "disk: diskutil list", "ports: lsof -i"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("SuspectBuiltins = %v, want %v", got, want)
+	}
+}
+
+func TestStore_Docs_ReturnsCopy(t *testing.T) {
+	s := NewStore()
+	s.Add(Document{Text: "original"})
+
+	docs := s.Docs()
+	docs[0].Text = "changed"
+	if s.docs[0].Text != "original" {
+		t.Error("Docs should return a copy, not the backing slice")
+	}
+}
+
+// --- Project scoping tests ---
+
+func TestHistoryDocs_ProjectScoped(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	history.Save(history.Entry{Prompt: "run tests", Command: "go test ./...", Success: true, Project: "/work/api"})
+	history.Save(history.Entry{Prompt: "start dev server", Command: "npm run dev", Success: true, Project: "/work/web"})
+	history.Save(history.Entry{Prompt: "lint", Command: "golangci-lint run", Success: true, Project: "/work/api"})
+
+	docs, err := historyDocs(IndexOptions{Project: "/work/api"})
+	if err != nil {
+		t.Fatalf("historyDocs failed: %v", err)
+	}
+	if len(docs) != 2 {
+		t.Fatalf("expected 2 docs from /work/api, got %d", len(docs))
+	}
+	for _, d := range docs {
+		if strings.Contains(d.Text, "npm run dev") {
+			t.Errorf("project-scoped index should exclude other projects, got %q", d.Text)
+		}
+		if d.Project != "/work/api" {
+			t.Errorf("doc should carry its project, got %q", d.Project)
+		}
+	}
+
+	all, _ := historyDocs(IndexOptions{})
+	if len(all) != 3 {
+		t.Errorf("unscoped index should include every project, got %d", len(all))
+	}
+}
+
+func TestHistoryDocs_Since(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	history.Save(history.Entry{Prompt: "old", Command: "ls", Success: true})
+	if docs, _ := historyDocs(IndexOptions{Since: time.Now().Add(time.Hour)}); len(docs) != 0 {
+		t.Errorf("entries before --since should be skipped, got %d", len(docs))
+	}
+	if docs, _ := historyDocs(IndexOptions{Since: time.Now().Add(-time.Hour)}); len(docs) != 1 {
+		t.Errorf("entries after --since should be kept, got %d", len(docs))
+	}
+}
+
+func TestHistoryDocs_NeverIncludeOutput(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	history.Save(history.Entry{Prompt: "show env", Command: "env", Output: "AWS_SECRET_ACCESS_KEY=hunter2", Success: true})
+
+	docs, err := historyDocs(IndexOptions{})
+	if err != nil {
+		t.Fatalf("historyDocs failed: %v", err)
+	}
+	if len(docs) != 1 {
+		t.Fatalf("expected 1 doc, got %d", len(docs))
+	}
+	if want := historyText("show env", "env"); docs[0].Text != want {
+		t.Errorf("doc text = %q, want only prompt and command %q", docs[0].Text, want)
+	}
+	if strings.Contains(docs[0].Text, "hunter2") {
+		t.Errorf("command output leaked into the index: %q", docs[0].Text)
+	}
+}
+
+func TestHistoryDocs_SkipSensitive(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	history.Save(history.Entry{Prompt: "reset my database password", Command: "psql -c 'alter user app password ...'", Success: true})
+	history.Save(history.Entry{Prompt: "print the GitHub token", Command: "gh auth token", Success: true})
+	history.Save(history.Entry{Prompt: "list files", Command: "ls", Success: true})
+
+	if docs, _ := historyDocs(IndexOptions{}); len(docs) != 3 {
+		t.Fatalf("sensitive prompts should be indexed by default, got %d docs", len(docs))
+	}
+
+	if err := config.Set("skip_sensitive_history", "true"); err != nil {
+		t.Fatalf("config.Set failed: %v", err)
+	}
+	docs, err := historyDocs(IndexOptions{})
+	if err != nil {
+		t.Fatalf("historyDocs failed: %v", err)
+	}
+	if len(docs) != 1 || !strings.Contains(docs[0].Text, "list files") {
+		t.Errorf("expected only the non-sensitive entry, got %+v", docs)
+	}
+}
+
+func TestStore_FilterProject(t *testing.T) {
+	s := NewStore()
+	s.Add(Document{Text: "builtin"})
+	s.Add(Document{Text: "api history", Project: "/work/api"})
+	s.Add(Document{Text: "web history", Project: "/work/web"})
+
+	s.FilterProject("/work/api")
+	var got []string
+	for _, d := range s.Docs() {
+		got = append(got, d.Text)
+	}
+	if strings.Join(got, ",") != "builtin,api history" {
+		t.Errorf("unexpected docs after filter: %v", got)
+	}
+}
+
+func TestStore_SaveAndLoad_Project(t *testing.T) {
+	tmpDir := t.TempDir()
+	origStorePath := storePath
+	storePath = func() string { return filepath.Join(tmpDir, "vectors.bin") }
+	defer func() { storePath = origStorePath }()
+
+	s := NewStore()
+	s.Add(Document{Text: "a", Vector: []float32{1}, Project: "/work/api"})
+	if err := s.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if err := s.Append(Document{Text: "b", Vector: []float32{1}, Project: "/work/web"}); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+
+	loaded := NewStore()
+	if err := loaded.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if loaded.Len() != 2 || loaded.docs[0].Project != "/work/api" || loaded.docs[1].Project != "/work/web" {
+		t.Errorf("project should round-trip through Save and Append, got %+v", loaded.docs)
+	}
+}
+
+func TestStore_Load_V2Format(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "vectors.bin")
+	origStorePath := storePath
+	storePath = func() string { return path }
+	defer func() { storePath = origStorePath }()
+
+	// Hand-write a v2 store: no project field after the scoring counts.
+	var buf bytes.Buffer
+	w := func(v any) { binary.Write(&buf, binary.LittleEndian, v) }
+	str := func(s string) { w(uint32(len(s))); buf.WriteString(s) }
+	w(uint32(2))
+	w(uint32(1))
+	str("old doc")
+	str("history")
+	str("general")
+	w(uint32(2))
+	w([]float32{0.5, 0.5})
+	w(int32(3))
+	w(int32(1))
+	os.WriteFile(path, buf.Bytes(), 0o644)
+
+	s := NewStore()
+	if err := s.Load(); err != nil {
+		t.Fatalf("Load of v2 store failed: %v", err)
+	}
+	if s.Len() != 1 || s.docs[0].Text != "old doc" || s.docs[0].SuccessCount != 3 || s.docs[0].Project != "" {
+		t.Errorf("unexpected v2 doc: %+v", s.docs)
+	}
+
+	// Appending to a v2 file rewrites it in the current format.
+	if err := s.Append(Document{Text: "new doc", Vector: []float32{1, 0}, Project: "/work/api"}); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	reloaded := NewStore()
+	if err := reloaded.Load(); err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	if reloaded.Len() != 2 || reloaded.docs[1].Project != "/work/api" {
+		t.Errorf("append to v2 store should upgrade it, got %+v", reloaded.docs)
+	}
+}
+
+func TestStore_DimensionInHeader(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "vectors.bin")
+	origStorePath := storePath
+	storePath = func() string { return path }
+	defer func() { storePath = origStorePath }()
+
+	s := NewStore()
+	s.Add(Document{Text: "a", Vector: []float32{1, 0, 0}})
+	if err := s.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	raw, _ := os.ReadFile(path)
+	var header [3]uint32
+	binary.Read(bytes.NewReader(raw), binary.LittleEndian, &header)
+	if header != [3]uint32{storeFormatVersion, 1, 3} {
+		t.Errorf("expected header [version 1 doc, 3 dims], got %v", header)
+	}
+
+	// A vector from another embedding model is refused, not mixed in.
+	err := s.Append(Document{Text: "b", Vector: []float32{1, 0}})
+	if !errors.Is(err, ErrDimensionMismatch) {
+		t.Errorf("expected Append to refuse a 2-dim vector, got %v", err)
+	}
+	s.Add(Document{Text: "c", Vector: []float32{1, 0}})
+	if err := s.Save(); !errors.Is(err, ErrDimensionMismatch) {
+		t.Errorf("expected Save to refuse mixed dimensions, got %v", err)
+	}
+
+	loaded := NewStore()
+	if err := loaded.Load(); err != nil || loaded.Len() != 1 || loaded.Dim() != 3 {
+		t.Errorf("the store should be untouched, got %d docs of %d dims (%v)", loaded.Len(), loaded.Dim(), err)
+	}
+}
+
+func TestStore_Load_RejectsMixedDimensions(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "vectors.bin")
+	origStorePath := storePath
+	storePath = func() string { return path }
+	defer func() { storePath = origStorePath }()
+
+	// Hand-write a v3 store (no dimension header) that a model switch
+	// left with vectors of two sizes.
+	var buf bytes.Buffer
+	w := func(v any) { binary.Write(&buf, binary.LittleEndian, v) }
+	str := func(s string) { w(uint32(len(s))); buf.WriteString(s) }
+	w(uint32(3))
+	w(uint32(2))
+	for _, vec := range [][]float32{{0.5, 0.5}, {1, 0, 0}} {
+		str("doc")
+		str("history")
+		str("general")
+		w(uint32(len(vec)))
+		w(vec)
+		w(int32(0))
+		w(int32(0))
+		str("")
+	}
+	os.WriteFile(path, buf.Bytes(), 0o644)
+
+	err := NewStore().Load()
+	if !errors.Is(err, ErrDimensionMismatch) || !strings.Contains(err.Error(), "xx index --flush") {
+		t.Errorf("expected a dimension mismatch telling you to flush, got %v", err)
+	}
+}
+
+func TestRetrieveResults_DimensionMismatch(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	s := NewStore()
+	s.Add(Document{Text: "check memory: free -h", Source: "builtin", Category: "memory", Vector: []float32{1, 0, 0}})
+	if err := s.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	embedder := &mapEmbedder{vectors: map[string][]float32{"how much RAM": {0.9, 0.1}}}
+	if _, err := RetrieveResults(context.Background(), embedder, "how much RAM"); !errors.Is(err, ErrDimensionMismatch) {
+		t.Errorf("expected a dimension mismatch, got %v", err)
+	}
+}
+
+func TestIndexAll_StopsWhenEmbeddingModelChanged(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	if err := NewIndexer(failingEmbedder{}).IndexAll(context.Background(), func(string) {}); err != nil {
+		t.Fatalf("first index failed: %v", err)
+	}
+	if err := learn.Save(learn.Correction{Prompt: "deploy", Command: "make deploy"}); err != nil {
+		t.Fatalf("learn.Save failed: %v", err)
+	}
+
+	// The new model embeds to 3 dimensions; the index has 2.
+	embedder := &mapEmbedder{vectors: map[string][]float32{correctionDocument("deploy", "make deploy").Text: {1, 0, 0}}}
+	err := NewIndexer(embedder).IndexAll(context.Background(), func(string) {})
+	if !errors.Is(err, ErrDimensionMismatch) {
+		t.Fatalf("expected the index to stop on a dimension mismatch, got %v", err)
+	}
+	store := NewStore()
+	if err := store.Load(); err != nil || store.Dim() != 2 {
+		t.Errorf("the old index should still load, got %d dims (%v)", store.Dim(), err)
+	}
+}
+
+// --- Learner Lock Tests ---
+
+func TestLearners_QueueForTheLock(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	tmpDir := t.TempDir()
+	origStorePath, origLockPath := storePath, learnerLockPath
+	storePath = func() string { return filepath.Join(tmpDir, "vectors.bin") }
+	learnerLockPath = func() string { return filepath.Join(tmpDir, "learner.lock") }
+	defer func() { storePath, learnerLockPath = origStorePath, origLockPath }()
+
+	s := NewStore()
+	s.Add(Document{Text: "existing", Source: "builtin", Category: "files", Vector: []float32{1, 0}})
+	if err := s.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	before, err := os.ReadFile(storePath())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The learn and the feedback are spawned together after a successful
+	// run, while something else holds the lock. Both must take effect.
+	release, ok := acquireLearnerLock()
+	if !ok {
+		t.Fatal("first learner should get the lock")
+	}
+	embedder := &mapEmbedder{vectors: map[string][]float32{
+		historyText("list files", "ls"): {0, 1},
+		"list files":                    {1, 0},
+	}}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() { defer wg.Done(); LearnFromSuccess(context.Background(), embedder, "list files", "ls", "files") }()
+	go func() { defer wg.Done(); RecordFeedback(context.Background(), embedder, "list files", true) }()
+
+	time.Sleep(50 * time.Millisecond)
+	after, err := os.ReadFile(storePath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Error("store was modified while another learner held the lock")
+	}
+	release()
+	wg.Wait()
+
+	store := NewStore()
+	if err := store.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if store.Len() != 2 {
+		t.Errorf("the queued learn should have added its document, got %d docs", store.Len())
+	}
+	if store.docs[0].SuccessCount != 1 {
+		t.Errorf("the queued feedback should have scored the existing doc, got %d successes", store.docs[0].SuccessCount)
+	}
+}
+
+func TestQueueLearner_SkipsDuplicateJob(t *testing.T) {
+	tmpDir := t.TempDir()
+	origLockPath := learnerLockPath
+	learnerLockPath = func() string { return filepath.Join(tmpDir, "learner.lock") }
+	defer func() { learnerLockPath = origLockPath }()
+
+	release, ok := acquireLearnerLock()
+	if !ok {
+		t.Fatal("expected to acquire a free lock")
+	}
+
+	job := learnerJob("learn", "list files", "ls", "files")
+	got := make(chan bool)
+	go func() {
+		r, ok := queueLearner(job)
+		if ok {
+			r()
+		}
+		got <- ok
+	}()
+
+	// Wait for the first job to queue, then send an identical one.
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		matches, _ := filepath.Glob(filepath.Join(tmpDir, "learner-*.queued"))
+		if len(matches) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the first job never queued")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if _, ok := queueLearner(job); ok {
+		t.Error("an identical job should be skipped while one is queued")
+	}
+
+	release()
+	if !<-got {
+		t.Error("the queued job should get the lock once it's released")
+	}
+	if matches, _ := filepath.Glob(filepath.Join(tmpDir, "learner-*.queued")); len(matches) != 0 {
+		t.Errorf("queue markers should be cleaned up, found %v", matches)
+	}
+}
+
+func TestAcquireLearnerLock_ReleaseAllowsNext(t *testing.T) {
+	tmpDir := t.TempDir()
+	origLockPath := learnerLockPath
+	learnerLockPath = func() string { return filepath.Join(tmpDir, "learner.lock") }
+	defer func() { learnerLockPath = origLockPath }()
+
+	release, ok := acquireLearnerLock()
+	if !ok {
+		t.Fatal("expected to acquire a free lock")
+	}
+	if _, ok := acquireLearnerLock(); ok {
+		t.Fatal("second acquire should fail while the lock is held")
+	}
+	release()
+	release2, ok := acquireLearnerLock()
+	if !ok {
+		t.Fatal("expected to acquire the lock after release")
+	}
+	release2()
+}
+
+func TestAcquireLearnerLock_BreaksStaleLock(t *testing.T) {
+	tmpDir := t.TempDir()
+	origLockPath := learnerLockPath
+	learnerLockPath = func() string { return filepath.Join(tmpDir, "learner.lock") }
+	defer func() { learnerLockPath = origLockPath }()
+
+	if err := os.WriteFile(learnerLockPath(), []byte("99999"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * staleLockAge)
+	if err := os.Chtimes(learnerLockPath(), old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	release, ok := acquireLearnerLock()
+	if !ok {
+		t.Fatal("a stale lock from a dead learner should be taken over")
+	}
+	release()
+}
+
+// --- Note Tests ---
+
+func TestAddNote_EmbeddedAndRetrievable(t *testing.T) {
+	tmpDir := t.TempDir()
+	origStorePath, origLockPath := storePath, learnerLockPath
+	storePath = func() string { return filepath.Join(tmpDir, "vectors.bin") }
+	learnerLockPath = func() string { return filepath.Join(tmpDir, "learner.lock") }
+	defer func() { storePath, learnerLockPath = origStorePath, origLockPath }()
+
+	// Fake Ollama: the note embeds along the first axis.
+	var embedded []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req embedRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		embedded = append(embedded, req.Prompt)
+		_ = json.NewEncoder(w).Encode(embedResponse{Embedding: []float32{1, 0, 0}})
+	}))
+	defer srv.Close()
+	embedder := NewEmbedClient()
+	embedder.apiURL = srv.URL
+
+	existing := NewStore()
+	existing.Add(Document{Text: "kill a process", Source: "builtin", Category: "process", Vector: []float32{0, 1, 0}})
+	if err := existing.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	if err := AddNote(context.Background(), embedder, "our prod DB is in us-east-1"); err != nil {
+		t.Fatalf("AddNote failed: %v", err)
+	}
+	if len(embedded) != 1 || !strings.Contains(embedded[0], "our prod DB is in us-east-1") {
+		t.Fatalf("expected the note to be embedded once, got %q", embedded)
+	}
+
+	s := NewStore()
+	if err := s.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if s.Len() != 2 {
+		t.Fatalf("expected the note appended to the existing doc, got %d docs", s.Len())
+	}
+	results := s.Search([]float32{0.9, 0.1, 0}, 1, "")
+	if len(results) != 1 || results[0].Doc.Source != "note" {
+		t.Fatalf("expected the note as the top result, got %+v", results)
+	}
+
+	// Adding the same note again doesn't duplicate it.
+	if err := AddNote(context.Background(), embedder, "our prod DB is in us-east-1"); err != nil {
+		t.Fatalf("second AddNote failed: %v", err)
+	}
+	s2 := NewStore()
+	_ = s2.Load()
+	if s2.Len() != 2 {
+		t.Errorf("duplicate note should be skipped, got %d docs", s2.Len())
+	}
+}
+
+func TestAddNote_WaitsForLearner(t *testing.T) {
+	tmpDir := t.TempDir()
+	origStorePath, origLockPath := storePath, learnerLockPath
+	storePath = func() string { return filepath.Join(tmpDir, "vectors.bin") }
+	learnerLockPath = func() string { return filepath.Join(tmpDir, "learner.lock") }
+	defer func() { storePath, learnerLockPath = origStorePath, origLockPath }()
+
+	s := NewStore()
+	s.Add(Document{Text: "existing", Source: "builtin", Category: "files", Vector: []float32{0, 1}})
+	if err := s.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	// A `_feedback` has loaded the store and is about to save it back
+	// when the user adds a note.
+	release, ok := acquireLearnerLock()
+	if !ok {
+		t.Fatal("learner should get the lock")
+	}
+	learner := NewStore()
+	if err := learner.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	learner.docs[0].SuccessCount++
+
+	embedder := &mapEmbedder{vectors: map[string][]float32{"user note: staging is eu-west-1": {1, 0}}}
+	done := make(chan error, 1)
+	go func() { done <- AddNote(context.Background(), embedder, "staging is eu-west-1") }()
+
+	time.Sleep(50 * time.Millisecond)
+	if err := learner.Save(); err != nil {
+		t.Fatalf("learner Save failed: %v", err)
+	}
+	release()
+	if err := <-done; err != nil {
+		t.Fatalf("AddNote failed: %v", err)
+	}
+
+	store := NewStore()
+	if err := store.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if store.Len() != 2 || store.docs[1].Source != "note" {
+		t.Fatalf("the note should survive the learner's save, got %+v", store.docs)
+	}
+	if store.docs[0].SuccessCount != 1 {
+		t.Errorf("the learner's feedback should be kept, got %d successes", store.docs[0].SuccessCount)
+	}
+}
+
+func TestAddCorrection_AppendsLearnedDoc(t *testing.T) {
+	tmpDir := t.TempDir()
+	origStorePath := storePath
+	storePath = func() string { return filepath.Join(tmpDir, "vectors.bin") }
+	defer func() { storePath = origStorePath }()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(embedResponse{Embedding: []float32{1, 0, 0}})
+	}))
+	defer srv.Close()
+	embedder := NewEmbedClient()
+	embedder.apiURL = srv.URL
+
+	existing := NewStore()
+	existing.Add(Document{Text: "kill a process", Source: "builtin", Category: "process", Vector: []float32{0, 1, 0}})
+	if err := existing.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	if err := addCorrection(context.Background(), embedder, "run tests", "make test"); err != nil {
+		t.Fatalf("addCorrection failed: %v", err)
+	}
+	s := NewStore()
+	_ = s.Load()
+	docs := s.Docs()
+	if len(docs) != 2 {
+		t.Fatalf("expected the correction appended, got %d docs", len(docs))
+	}
+	if docs[1].Source != "learned" || docs[1].Text != "user correction: when asked 'run tests', the correct command is 'make test'" {
+		t.Errorf("unexpected learned doc: %+v", docs[1])
+	}
+
+	// Re-teaching the prompt replaces the old command instead of piling up.
+	if err := addCorrection(context.Background(), embedder, "run tests", "go test ./..."); err != nil {
+		t.Fatalf("second addCorrection failed: %v", err)
+	}
+	s2 := NewStore()
+	_ = s2.Load()
+	docs = s2.Docs()
+	if len(docs) != 2 || !strings.HasSuffix(docs[1].Text, "'go test ./...'") {
+		t.Errorf("expected the correction to be replaced, got %+v", docs)
+	}
+}
+
+func TestSearch_NoteBoostBetweenLearnedAndHistory(t *testing.T) {
+	s := NewStore()
+	vec := []float32{1, 0}
+	for _, src := range []string{"history", "note", "learned"} {
+		s.Add(Document{Text: src, Source: src, Vector: vec})
+	}
+	results := s.Search(vec, 3, "")
+	var order []string
+	for _, r := range results {
+		order = append(order, r.Doc.Source)
+	}
+	if strings.Join(order, ",") != "learned,note,history" {
+		t.Errorf("expected learned > note > history, got %v", order)
+	}
+}
+
+// --- Learn Dedup Threshold Tests ---
+
+func TestAppendUnlessDuplicate_LowerThresholdSkipsNearDuplicate(t *testing.T) {
+	tmpDir := t.TempDir()
+	origStorePath := storePath
+	storePath = func() string { return filepath.Join(tmpDir, "vectors.bin") }
+	defer func() { storePath = origStorePath }()
+
+	s := NewStore()
+	s.Add(Document{Text: "check disk space", Source: "history", Vector: []float32{1, 0, 0}})
+	if err := s.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	// Cosine similarity with the stored vector is ~0.90: a near-duplicate
+	// under a 0.85 threshold, but distinct enough to store under 0.95.
+	doc := Document{Text: "show disk usage", Source: "history", Vector: []float32{0.9, 0.44, 0}}
+	if sim := cosineSimilarity(doc.Vector, []float32{1, 0, 0}); sim < 0.85 || sim > 0.95 {
+		t.Fatalf("test vector similarity %.3f is outside (0.85, 0.95)", sim)
+	}
+
+	stored, err := appendUnlessDuplicate(doc, 0.85)
+	if err != nil {
+		t.Fatalf("appendUnlessDuplicate failed: %v", err)
+	}
+	if stored {
+		t.Error("a stricter threshold should skip the near-duplicate")
+	}
+
+	stored, err = appendUnlessDuplicate(doc, NearDuplicateThreshold)
+	if err != nil {
+		t.Fatalf("appendUnlessDuplicate failed: %v", err)
+	}
+	if !stored {
+		t.Error("the default threshold should store the doc")
+	}
+
+	loaded := NewStore()
+	_ = loaded.Load()
+	if loaded.Len() != 2 {
+		t.Errorf("expected 2 docs after one append, got %d", loaded.Len())
+	}
+}
+
+func TestLearnDedupThreshold_FromConfig(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	if got := learnDedupThreshold(); got != NearDuplicateThreshold {
+		t.Errorf("unset config should use the default, got %v", got)
+	}
+	if err := config.Set("learn_dedup_threshold", "0.85"); err != nil {
+		t.Fatalf("config.Set failed: %v", err)
+	}
+	if got := learnDedupThreshold(); got != 0.85 {
+		t.Errorf("expected configured threshold 0.85, got %v", got)
+	}
+}
+
+func TestErrorSummary(t *testing.T) {
+	tests := []struct {
+		output string
+		want   string
+	}{
+		{"Collecting foo\nERROR: No matching distribution found for foo\nmore noise\n", "ERROR: No matching distribution found for foo"},
+		{"zsh: command not found: lss", "zsh: command not found: lss"},
+		{"line one\nlast line\n\n", "last line"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := ErrorSummary(tt.output); got != tt.want {
+			t.Errorf("ErrorSummary(%q) = %q, want %q", tt.output, got, tt.want)
+		}
+	}
+	if got := ErrorSummary(strings.Repeat("x", 500)); len(got) != maxErrorSummary {
+		t.Errorf("summary should be capped at %d bytes, got %d", maxErrorSummary, len(got))
+	}
+}
+
+func TestFixDocs_PairsFailureWithRetry(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	history.Save(history.Entry{Prompt: "install jq", Command: "apt install jq", Output: "E: Permission denied", Success: false})
+	history.Save(history.Entry{Prompt: "install jq (retry)", Command: "sudo apt install jq", Success: true})
+	history.Save(history.Entry{Prompt: "list files", Command: "lss", Output: "command not found", Success: false})
+	history.Save(history.Entry{Prompt: "list files (retry)", Command: "ls -la", Success: false})
+	history.Save(history.Entry{Prompt: "show disk", Command: "df -h", Success: true})
+
+	docs, err := fixDocs(IndexOptions{})
+	if err != nil {
+		t.Fatalf("fixDocs failed: %v", err)
+	}
+	if len(docs) != 1 {
+		t.Fatalf("only the successful retry should become a fix, got %d: %+v", len(docs), docs)
+	}
+	want := "'apt install jq' failed with: E: Permission denied — fixed by running: sudo apt install jq"
+	if docs[0].Text != want || docs[0].Source != "fix" || docs[0].Category != "fix" {
+		t.Errorf("unexpected fix doc: %+v", docs[0])
+	}
+}
+
+func TestFormatFixes(t *testing.T) {
+	if FormatFixes(nil) != "" {
+		t.Error("no fixes should format to an empty string")
+	}
+	got := FormatFixes([]SearchResult{{Doc: fixDocument("lss", "command not found: lss", "ls")}})
+	if !strings.Contains(got, "Past fixes") || !strings.Contains(got, "- 'lss' failed with: command not found: lss — fixed by running: ls") {
+		t.Errorf("unexpected format: %q", got)
+	}
+}
+
+func TestHistoryDocs_Limit(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	for i := 0; i < 5; i++ {
+		history.Save(history.Entry{Prompt: fmt.Sprintf("task %d", i), Command: fmt.Sprintf("echo %d", i), Success: true})
+	}
+
+	docs, err := historyDocs(IndexOptions{HistoryLimit: 2})
+	if err != nil {
+		t.Fatalf("historyDocs failed: %v", err)
+	}
+	if len(docs) != 2 {
+		t.Fatalf("expected 2 docs with a limit of 2, got %d", len(docs))
+	}
+	if !strings.Contains(docs[0].Text, "task 3") || !strings.Contains(docs[1].Text, "task 4") {
+		t.Errorf("the limit should keep the most recent entries, got %q and %q", docs[0].Text, docs[1].Text)
+	}
+
+	if docs, _ := historyDocs(IndexOptions{SkipHistory: true}); len(docs) != 0 {
+		t.Errorf("SkipHistory should index no history, got %d docs", len(docs))
+	}
+	if docs, _ := historyDocs(IndexOptions{}); len(docs) != 5 {
+		t.Errorf("the default limit should keep all 5 entries, got %d", len(docs))
+	}
+}
+
+func TestHistoryDocs_SeedsSuccessCountFromRepeats(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	for i := 0; i < 5; i++ {
+		history.Save(history.Entry{Prompt: "run tests", Command: "go test ./...", Success: true})
+	}
+	history.Save(history.Entry{Prompt: "run tests", Command: "go test ./...", Success: false})
+	history.Save(history.Entry{Prompt: "list files", Command: "ls -la", Success: true})
+
+	docs, err := historyDocs(IndexOptions{})
+	if err != nil {
+		t.Fatalf("historyDocs failed: %v", err)
+	}
+	if len(docs) != 2 {
+		t.Fatalf("expected 2 deduplicated docs, got %d", len(docs))
+	}
+	for _, d := range docs {
+		switch {
+		case strings.Contains(d.Text, "go test"):
+			if d.SuccessCount != 5 {
+				t.Errorf("command run 5 times should start with SuccessCount 5, got %d", d.SuccessCount)
+			}
+		case strings.Contains(d.Text, "ls -la"):
+			if d.SuccessCount != 0 {
+				t.Errorf("one-off command should start neutral, got SuccessCount %d", d.SuccessCount)
+			}
+		}
+	}
+}
+
+func TestIndexAll_CheckpointsAndResumes(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	origEvery := checkpointEvery
+	checkpointEvery = 4
+	defer func() { checkpointEvery = origEvery }()
+
+	for i := 0; i < 10; i++ {
+		if err := learn.Save(learn.Correction{Prompt: fmt.Sprintf("task %d", i), Command: fmt.Sprintf("make task%d", i)}); err != nil {
+			t.Fatalf("learn.Save failed: %v", err)
+		}
+	}
+	total := len(osCommandDocs()) + 10
+
+	// The embedder dies partway through, like Ollama being stopped mid-index.
+	failAfter := total - 3
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests > failAfter {
+			http.Error(w, "gone", http.StatusServiceUnavailable)
+			return
+		}
+		var req embedRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		_ = json.NewEncoder(w).Encode(embedResponse{Embedding: []float32{float32(len(req.Prompt)), 1}})
+	}))
+	defer srv.Close()
+
+	embedder := NewEmbedClient()
+	embedder.apiURL = srv.URL
+	if err := NewIndexer(embedder).IndexAll(context.Background(), func(string) {}); err == nil {
+		t.Fatal("expected the interrupted index to fail")
+	}
+
+	partial := NewStore()
+	if err := partial.Load(); err != nil {
+		t.Fatalf("the checkpointed store should load, got %v", err)
+	}
+	saved := partial.Len()
+	if saved == 0 || saved >= total || saved%checkpointEvery != 0 {
+		t.Fatalf("expected a partial store saved at a checkpoint, got %d of %d docs", saved, total)
+	}
+
+	// Re-running only embeds what the checkpoint didn't cover.
+	requests, failAfter = 0, total
+	embedder = NewEmbedClient()
+	embedder.apiURL = srv.URL
+	if err := NewIndexer(embedder).IndexAll(context.Background(), func(string) {}); err != nil {
+		t.Fatalf("resumed index failed: %v", err)
+	}
+	if requests != total-saved {
+		t.Errorf("expected %d embeddings on resume, got %d", total-saved, requests)
+	}
+	full := NewStore()
+	if err := full.Load(); err != nil || full.Len() != total {
+		t.Errorf("expected the full store of %d docs, got %d (%v)", total, full.Len(), err)
+	}
+}
+
+// failingEmbedder embeds every text as a fixed vector, except that it
+// fails for any text containing one of fail.
+type failingEmbedder struct {
+	fail []string
+}
+
+func (e failingEmbedder) Embed(_ context.Context, text string) ([]float32, error) {
+	for _, f := range e.fail {
+		if strings.Contains(text, f) {
+			return nil, fmt.Errorf("empty embedding returned — model may not support embeddings")
+		}
+	}
+	return []float32{float32(len(text)), 1}, nil
+}
+
+func TestIndexAll_SkipsDocsThatFailToEmbed(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	for i := 0; i < 3; i++ {
+		if err := learn.Save(learn.Correction{Prompt: fmt.Sprintf("task %d", i), Command: fmt.Sprintf("make task%d", i)}); err != nil {
+			t.Fatalf("learn.Save failed: %v", err)
+		}
+	}
+	total := len(osCommandDocs()) + 3
+
+	var report []string
+	err := NewIndexer(failingEmbedder{fail: []string{"make task1"}}).IndexAll(context.Background(), func(msg string) {
+		report = append(report, msg)
+	})
+	if err != nil {
+		t.Fatalf("one failing doc shouldn't abort the index, got %v", err)
+	}
+
+	store := NewStore()
+	if err := store.Load(); err != nil || store.Len() != total-1 {
+		t.Fatalf("expected %d docs in the store, got %d (%v)", total-1, store.Len(), err)
+	}
+	for _, d := range store.Docs() {
+		if strings.Contains(d.Text, "make task1") {
+			t.Error("the doc that failed to embed shouldn't be in the store")
+		}
+	}
+	out := strings.Join(report, "\n")
+	if !strings.Contains(out, "(1 skipped: failed to embed)") {
+		t.Errorf("expected the final report to count the skipped doc, got:\n%s", out)
+	}
+	if !strings.Contains(out, "✓ 2 learned corrections") {
+		t.Errorf("expected the section count to leave out the skipped doc, got:\n%s", out)
+	}
+}
+
+func TestIndexAll_GivesUpWhenEmbeddingKeepsFailing(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	err := NewIndexer(failingEmbedder{fail: []string{""}}).IndexAll(context.Background(), func(string) {})
+	if err == nil || !strings.Contains(err.Error(), "in a row") {
+		t.Fatalf("expected the index to stop after repeated failures, got %v", err)
+	}
+}
+
+// mapEmbedder embeds each text as the vector it's mapped to, and records
+// what it was asked to embed.
+type mapEmbedder struct {
+	vectors  map[string][]float32
+	embedded []string
+}
+
+func (e *mapEmbedder) Embed(_ context.Context, text string) ([]float32, error) {
+	e.embedded = append(e.embedded, text)
+	vec, ok := e.vectors[text]
+	if !ok {
+		return nil, fmt.Errorf("no vector for %q", text)
+	}
+	return vec, nil
+}
+
+func TestRetrieve_UsesGivenEmbedder(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	s := NewStore()
+	s.Add(Document{Text: "check memory: free -h", Source: "builtin", Category: "memory", Vector: []float32{1, 0, 0}})
+	s.Add(Document{Text: "current branch: git branch --show-current", Source: "builtin", Category: "git", Vector: []float32{0, 1, 0}})
+	if err := s.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	embedder := &mapEmbedder{vectors: map[string][]float32{"how much RAM": {0.9, 0.1, 0}}}
+	got, err := Retrieve(context.Background(), embedder, "how much RAM")
+	if err != nil {
+		t.Fatalf("Retrieve failed: %v", err)
+	}
+	if len(embedder.embedded) != 1 || embedder.embedded[0] != "how much RAM" {
+		t.Errorf("expected the query embedded once, got %q", embedder.embedded)
+	}
+	if !strings.Contains(got, "free -h") || strings.Contains(got, "git branch") {
+		t.Errorf("expected only the memory doc in the context, got:\n%s", got)
+	}
+
+	// An embedder failure degrades to no context, not an error.
+	got, err = Retrieve(context.Background(), embedder, "unknown query")
+	if err != nil || got != "" {
+		t.Errorf("expected empty context on embed failure, got %q, %v", got, err)
+	}
+}
+
+func TestRecordFeedback_UsesGivenEmbedder(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	s := NewStore()
+	s.Add(Document{Text: "check memory: free -h", Source: "builtin", Category: "memory", Vector: []float32{1, 0}})
+	s.Add(Document{Text: "current branch: git branch --show-current", Source: "builtin", Category: "git", Vector: []float32{0, 1}})
+	if err := s.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	embedder := &mapEmbedder{vectors: map[string][]float32{"which branch am I on": {0.1, 0.9}}}
+	RecordFeedback(context.Background(), embedder, "which branch am I on", true)
+	RecordFeedback(context.Background(), embedder, "which branch am I on", false)
+
+	loaded := NewStore()
+	if err := loaded.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	for _, d := range loaded.Docs() {
+		want := [2]int32{0, 0}
+		if d.Category == "git" {
+			want = [2]int32{1, 1}
+		}
+		if got := [2]int32{d.SuccessCount, d.FailureCount}; got != want {
+			t.Errorf("%s: expected success/failure counts %v, got %v", d.Category, want, got)
+		}
+	}
+}
+
+func TestRecordFeedback_UsesConfiguredFloor(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	s := NewStore()
+	s.Add(Document{Text: "check memory: free -h", Source: "builtin", Category: "memory", Vector: []float32{1, 0}})
+	if err := s.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	embedder := &mapEmbedder{vectors: map[string][]float32{"is my box low on RAM": {0.45, 0.893}}}
+
+	successes := func() int32 {
+		loaded := NewStore()
+		if err := loaded.Load(); err != nil {
+			t.Fatalf("Load failed: %v", err)
+		}
+		return loaded.Docs()[0].SuccessCount
+	}
+
+	RecordFeedback(context.Background(), embedder, "is my box low on RAM", true)
+	if n := successes(); n != 0 {
+		t.Fatalf("a 0.45 match shouldn't get feedback by default, got %d successes", n)
+	}
+
+	if err := config.Set("feedback_min_score", "0.4"); err != nil {
+		t.Fatal(err)
+	}
+	RecordFeedback(context.Background(), embedder, "is my box low on RAM", true)
+	if n := successes(); n != 1 {
+		t.Errorf("expected the lowered floor to let the 0.45 match get feedback, got %d successes", n)
+	}
+}
+
+func TestAddCorrection_RemovesContradictedHistory(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	s := NewStore()
+	s.Add(Document{Text: historyText("run tests", "npm test"), Source: "history", Vector: []float32{1, 0, 0}})
+	s.Add(Document{Text: historyText("run tests", "make test"), Source: "history", Vector: []float32{0.9, 0.1, 0}})
+	s.Add(Document{Text: historyText("run tests fast", "npm test -- --bail"), Source: "history", Vector: []float32{0, 1, 0}})
+	if err := s.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	doc := correctionDocument("run tests", "make test")
+	embedder := &mapEmbedder{vectors: map[string][]float32{doc.Text: {0, 0, 1}}}
+	if err := addCorrection(context.Background(), embedder, "run tests", "make test"); err != nil {
+		t.Fatalf("addCorrection failed: %v", err)
+	}
+
+	loaded := NewStore()
+	if err := loaded.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	kept := map[string]bool{}
+	for _, d := range loaded.Docs() {
+		kept[d.Text] = true
+	}
+	if kept[historyText("run tests", "npm test")] {
+		t.Error("the history doc the correction contradicts should be gone")
+	}
+	for _, want := range []string{historyText("run tests", "make test"), historyText("run tests fast", "npm test -- --bail"), doc.Text} {
+		if !kept[want] {
+			t.Errorf("expected %q to be kept, got %v", want, kept)
+		}
+	}
+}
+
+func TestCorrectedPromptsStayOutOfHistory(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	if err := learn.Save(learn.Correction{Prompt: "run tests", Command: "make test"}); err != nil {
+		t.Fatal(err)
+	}
+	s := NewStore()
+	s.Add(Document{Text: "builtin", Source: "builtin", Vector: []float32{0, 1}})
+	if err := s.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	// A run of the corrected-away command isn't auto-learned...
+	embedder := &mapEmbedder{vectors: map[string][]float32{historyText("run tests", "npm test"): {1, 0}}}
+	LearnFromSuccess(context.Background(), embedder, "run tests", "npm test", "general")
+	if len(embedder.embedded) != 0 {
+		t.Errorf("a command the user corrected away shouldn't be learned, embedded %q", embedder.embedded)
+	}
+
+	// ...and isn't indexed from history either.
+	for _, e := range []history.Entry{
+		{Prompt: "run tests", Command: "npm test", Success: true},
+		{Prompt: "run tests", Command: "make test", Success: true},
+	} {
+		if err := history.Save(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	docs, err := historyDocs(IndexOptions{})
+	if err != nil {
+		t.Fatalf("historyDocs failed: %v", err)
+	}
+	if len(docs) != 1 || docs[0].Text != historyText("run tests", "make test") {
+		t.Errorf("expected only the run agreeing with the correction, got %+v", docs)
+	}
+}
+
+func TestSearch_BreaksDownScores(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	s := NewStore()
+	s.Add(Document{Text: "check memory: free -h", Source: "builtin", Category: "memory", Vector: []float32{1, 0}})
+	s.Add(Document{Text: "memory hog: ps aux --sort=-%mem", Source: "history", Category: "memory", Vector: []float32{0.8, 0.6}, SuccessCount: 3})
+	s.Add(Document{Text: "current branch: git branch --show-current", Source: "builtin", Category: "git", Vector: []float32{0, 1}})
+	if err := s.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	embedder := &mapEmbedder{vectors: map[string][]float32{"how much RAM": {1, 0}}}
+	results, err := Search(context.Background(), embedder, "how much RAM", 5, "memory")
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected the 2 memory docs, got %d", len(results))
+	}
+	for _, r := range results {
+		if r.Doc.Category != "memory" {
+			t.Errorf("category filter let through %q", r.Doc.Text)
+		}
+		if got := r.Cosine * r.Feedback * r.Boost; math.Abs(float64(got-r.Score)) > 1e-6 {
+			t.Errorf("%s: breakdown %v × %v × %v doesn't multiply to score %v", r.Doc.Text, r.Cosine, r.Feedback, r.Boost, r.Score)
+		}
+	}
+	// The history doc's successes outweigh the builtin's source boost.
+	if r := results[0]; r.Doc.Source != "history" || r.Boost != 1 || r.Feedback <= 1 {
+		t.Errorf("expected the history doc first, boosted only by its successes, got %+v", r)
+	}
+	if r := results[1]; r.Doc.Source != "builtin" || r.Boost != 1.20 || r.Feedback != 1 {
+		t.Errorf("expected the builtin second, with a 1.2 boost and neutral feedback, got %+v", r)
+	}
+
+	if _, err := Search(context.Background(), embedder, "unknown query", 5, ""); err == nil {
+		t.Error("expected an embedding failure to be reported")
+	}
+}
+
+func TestStore_DeleteBySource(t *testing.T) {
+	s := NewStore()
+	s.Add(Document{Text: "a", Source: "builtin", Vector: []float32{1, 0}})
+	s.Add(Document{Text: "b", Source: "history", Vector: []float32{0, 1}})
+	s.Add(Document{Text: "c", Source: "learned", Vector: []float32{1, 1}})
+	s.Add(Document{Text: "d", Source: "history", Vector: []float32{1, 0}})
+
+	if n := s.DeleteBySource("history"); n != 2 {
+		t.Errorf("DeleteBySource removed %d, want 2", n)
+	}
+	if s.Len() != 2 || s.docs[0].Text != "a" || s.docs[1].Text != "c" {
+		t.Errorf("left %+v, want a and c in order", s.docs)
+	}
+	if n := s.Delete(func(d Document) bool { return false }); n != 0 {
+		t.Errorf("Delete with no matches removed %d", n)
+	}
+}
+
+func TestPruneSource(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("HOME", tmpDir)
+	origStorePath := storePath
+	storePath = func() string { return filepath.Join(tmpDir, "vectors.bin") }
+	defer func() { storePath = origStorePath }()
+
+	s := NewStore()
+	s.Add(Document{Text: "a", Source: "builtin", Vector: []float32{1, 0}})
+	s.Add(Document{Text: "b", Source: "history", Vector: []float32{0, 1}})
+	s.Add(Document{Text: "c", Source: "history", Vector: []float32{1, 1}})
+	if err := s.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, left, err := PruneSource("history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 2 || left != 1 {
+		t.Errorf("PruneSource = %d removed, %d left; want 2, 1", removed, left)
+	}
+	loaded := NewStore()
+	if err := loaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Len() != 1 || loaded.docs[0].Source != "builtin" {
+		t.Errorf("store on disk has %+v, want only the builtin", loaded.docs)
+	}
+
+	if _, _, err := PruneSource("histroy"); err == nil {
+		t.Error("expected an error for an unknown source")
+	}
+}
+
+func TestStore_Prune(t *testing.T) {
+	s := NewStore()
+	s.Add(Document{Text: "builtin", Source: "builtin", Vector: []float32{1, 0, 0}, FailureCount: 5})
+	s.Add(Document{Text: "failing", Source: "history", Vector: []float32{0, 1, 0}, FailureCount: 2})
+	s.Add(Document{Text: "mixed", Source: "history", Vector: []float32{0, 0, 1}, SuccessCount: 1, FailureCount: 3})
+	s.Add(Document{Text: "dup of builtin", Source: "history", Vector: []float32{0.99, 0.05, 0}})
+	s.Add(Document{Text: "learned dup", Source: "learned", Vector: []float32{0.98, 0.1, 0}})
+	s.Add(Document{Text: "better dup", Source: "history", Vector: []float32{0, 0.05, 0.99}, SuccessCount: 4})
+
+	removed := s.Prune(PruneOptions{MinFailures: 2, DupThreshold: 0.95})
+	if removed != 3 {
+		t.Errorf("Prune removed %d, want 3", removed)
+	}
+	var left []string
+	for _, d := range s.docs {
+		left = append(left, d.Text)
+	}
+	// "mixed" loses to "better dup", which has the better score; the
+	// builtin and learned docs survive whatever their scores.
+	want := []string{"builtin", "learned dup", "better dup"}
+	if strings.Join(left, ",") != strings.Join(want, ",") {
+		t.Errorf("left %v, want %v", left, want)
+	}
+}
+
+func TestPrune_ReportsReclaimedBytes(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("HOME", tmpDir)
+	origStorePath := storePath
+	storePath = func() string { return filepath.Join(tmpDir, "vectors.bin") }
+	defer func() { storePath = origStorePath }()
+
+	s := NewStore()
+	s.Add(Document{Text: "keep", Source: "builtin", Vector: []float32{1, 0}})
+	s.Add(Document{Text: "stale", Source: "history", Vector: []float32{0, 1}, FailureCount: PruneMinFailures})
+	if err := s.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, reclaimed, err := Prune()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 1 || reclaimed <= 0 {
+		t.Errorf("Prune = %d removed, %d bytes reclaimed; want 1 and some bytes", removed, reclaimed)
+	}
+}
+
+func TestStore_ConcurrentAppends(t *testing.T) {
+	// Re-run as a child process: append one doc to the given store and exit.
+	if n := os.Getenv("XX_TEST_APPEND_DOC"); n != "" {
+		storePath = func() string { return os.Getenv("XX_TEST_STORE") }
+		i, _ := strconv.Atoi(n)
+		doc := Document{Text: "doc " + n, Source: "history", Vector: []float32{float32(i), 1, 2}}
+		if err := NewStore().Append(doc); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "vectors.bin")
+	origStorePath := storePath
+	storePath = func() string { return path }
+	defer func() { storePath = origStorePath }()
+
+	seed := NewStore()
+	seed.Add(Document{Text: "seed", Source: "builtin", Vector: []float32{1, 0, 0}})
+	if err := seed.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Separate processes, as the _learn and _feedback subprocesses are.
+	const writers = 20
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			child := exec.Command(os.Args[0], "-test.run=^TestStore_ConcurrentAppends$")
+			child.Env = append(os.Environ(), "XX_TEST_STORE="+path, "XX_TEST_APPEND_DOC="+strconv.Itoa(i))
+			if out, err := child.CombinedOutput(); err != nil {
+				t.Errorf("append %d: %v\n%s", i, err, out)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	s := NewStore()
+	if err := s.Load(); err != nil {
+		t.Fatalf("store corrupted by concurrent appends: %v", err)
+	}
+	if s.Len() != writers+1 {
+		t.Fatalf("expected %d docs, got %d", writers+1, s.Len())
+	}
+	for i := 0; i < writers; i++ {
+		want := fmt.Sprintf("doc %d", i)
+		found := false
+		for _, d := range s.docs {
+			if d.Text == want {
+				found = true
+				if len(d.Vector) != 3 || d.Vector[0] != float32(i) {
+					t.Errorf("%s: vector %v didn't round-trip", want, d.Vector)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("%s was lost", want)
+		}
+	}
+}
+
+func TestStore_ExportImportJSON(t *testing.T) {
+	src := NewStore()
+	src.Add(Document{Text: "check memory", Source: "builtin", Category: "memory", Vector: []float32{1, 0, 0}, SuccessCount: 7, FailureCount: 1})
+	src.Add(Document{Text: "list pods", Source: "history", Category: "general", Vector: []float32{0, 1, 0}, Project: "/work/app", FailureCount: 2})
+
+	var buf bytes.Buffer
+	if err := src.ExportJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// Replace: an exact round-trip, scores and all.
+	dst := NewStore()
+	dst.Add(Document{Text: "old", Source: "note", Vector: []float32{0, 0, 1}})
+	added, err := dst.ImportJSON(bytes.NewReader(buf.Bytes()), true, NearDuplicateThreshold)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added != 2 || dst.Len() != 2 {
+		t.Fatalf("replace: added %d, store has %d; want 2 and 2", added, dst.Len())
+	}
+	for i, want := range src.docs {
+		got := dst.docs[i]
+		if got.Text != want.Text || got.Source != want.Source || got.Category != want.Category || got.Project != want.Project ||
+			got.SuccessCount != want.SuccessCount || got.FailureCount != want.FailureCount || len(got.Vector) != 3 || got.Vector[1] != want.Vector[1] {
+			t.Errorf("doc %d: got %+v, want %+v", i, got, want)
+		}
+	}
+
+	// Merge: near-duplicates of what's there are skipped.
+	merged := NewStore()
+	merged.Add(Document{Text: "memory usage", Source: "learned", Vector: []float32{0.99, 0.01, 0}})
+	added, err = merged.ImportJSON(bytes.NewReader(buf.Bytes()), false, NearDuplicateThreshold)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added != 1 || merged.Len() != 2 || merged.docs[1].Text != "list pods" {
+		t.Errorf("merge: added %d, docs %+v; want only list pods added", added, merged.docs)
+	}
+
+	// A merge from another embedding model is refused, untouched.
+	other := NewStore()
+	other.Add(Document{Text: "x", Source: "note", Vector: []float32{1, 0}})
+	if _, err := other.ImportJSON(bytes.NewReader(buf.Bytes()), false, NearDuplicateThreshold); !errors.Is(err, ErrDimensionMismatch) {
+		t.Errorf("expected ErrDimensionMismatch, got %v", err)
+	}
+	if other.Len() != 1 {
+		t.Errorf("a refused import shouldn't change the store, got %d docs", other.Len())
+	}
+}
+
+// fakeBatchOllama serves /api/embed and /api/embeddings, embedding "doc N"
+// as {N, 1}, and counts the requests to each. With noBatch, /api/embed
+// answers 404 like an old Ollama.
+type fakeBatchOllama struct {
+	noBatch      bool
+	batchSizes   []int
+	singleCounts int
+}
+
+func (f *fakeBatchOllama) vector(text string) []float32 {
+	var n int
+	_, _ = fmt.Sscanf(text, "doc %d", &n)
+	return []float32{float32(n), 1}
+}
+
+func (f *fakeBatchOllama) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/api/embed":
+		if f.noBatch {
+			http.NotFound(w, r)
+			return
+		}
+		var req embedBatchRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		f.batchSizes = append(f.batchSizes, len(req.Input))
+		var resp embedBatchResponse
+		for _, text := range req.Input {
+			resp.Embeddings = append(resp.Embeddings, f.vector(text))
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	case "/api/embeddings":
+		var req embedRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		f.singleCounts++
+		_ = json.NewEncoder(w).Encode(embedResponse{Embedding: f.vector(req.Prompt)})
+	}
+}
+
+func TestEmbedBatch_ChunksAndKeepsOrder(t *testing.T) {
+	fake := &fakeBatchOllama{}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	embedder := NewEmbedClient()
+	embedder.apiURL = srv.URL + "/api/embeddings"
+
+	var texts []string
+	for i := 0; i < 70; i++ {
+		texts = append(texts, fmt.Sprintf("doc %d", i))
+	}
+	// A cached text isn't sent again.
+	if _, err := embedder.Embed(context.Background(), "doc 5"); err != nil {
+		t.Fatal(err)
+	}
+
+	vecs, err := embedder.EmbedBatch(context.Background(), texts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, vec := range vecs {
+		if len(vec) != 2 || vec[0] != float32(i) {
+			t.Fatalf("vector %d = %v, out of order", i, vec)
+		}
+	}
+	if fmt.Sprint(fake.batchSizes) != "[32 32 5]" || fake.singleCounts != 1 {
+		t.Errorf("expected batches of [32 32 5] after 1 single request, got %v and %d", fake.batchSizes, fake.singleCounts)
+	}
+}
+
+func TestEmbedBatch_FallsBackWithoutBatchEndpoint(t *testing.T) {
+	fake := &fakeBatchOllama{noBatch: true}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	embedder := NewEmbedClient()
+	embedder.apiURL = srv.URL + "/api/embeddings"
+
+	for _, texts := range [][]string{{"doc 1", "doc 2"}, {"doc 3"}} {
+		vecs, err := embedder.EmbedBatch(context.Background(), texts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(vecs) != len(texts) || vecs[0][0] != fake.vector(texts[0])[0] {
+			t.Errorf("unexpected vectors %v for %v", vecs, texts)
+		}
+	}
+	if fake.singleCounts != 3 || !embedder.noBatch {
+		t.Errorf("expected 3 single requests after one 404, got %d (noBatch %v)", fake.singleCounts, embedder.noBatch)
+	}
+}
+
+func TestIndexAll_UsesBatchEndpoint(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("HOME", tmpDir)
+	origStorePath := storePath
+	storePath = func() string { return filepath.Join(tmpDir, "vectors.bin") }
+	defer func() { storePath = origStorePath }()
+
+	fake := &fakeBatchOllama{}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	embedder := NewEmbedClient()
+	embedder.apiURL = srv.URL + "/api/embeddings"
+
+	if err := NewIndexer(embedder).IndexAll(context.Background(), func(string) {}); err != nil {
+		t.Fatal(err)
+	}
+	if fake.singleCounts != 0 || len(fake.batchSizes) == 0 {
+		t.Errorf("expected only batch requests, got %d single and %v batches", fake.singleCounts, fake.batchSizes)
+	}
+	store := NewStore()
+	if err := store.Load(); err != nil || store.Len() != len(osCommandDocs()) {
+		t.Errorf("expected %d docs indexed, got %d (%v)", len(osCommandDocs()), store.Len(), err)
+	}
+}
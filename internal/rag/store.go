@@ -2,8 +2,10 @@ package rag
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"math"
+	"math/rand/v2"
 	"os"
 	"path/filepath"
 	"sort"
@@ -12,6 +14,14 @@ import (
 )
 
 const storeFileName = "vectors.bin"
+
+// ErrDimensionMismatch means the vectors in the store, or a vector being
+// added to or searched against it, don't all have the same dimension:
+// the embedding model was changed after the index was built. Cosine
+// similarity between vectors of different sizes is meaningless, so the
+// index has to be rebuilt.
+var ErrDimensionMismatch = errors.New("index built with a different embedding model — run 'xx index --flush'")
+
 // Flush deletes the vector store file from disk. This is the nuclear option
 // for fixing a poisoned index — wipe everything and rebuild from scratch
 // with `xx index`. Returns nil if the file doesn't exist (already clean).
@@ -29,7 +39,7 @@ func (s *Store) Flush() error {
 type Document struct {
 	// Text is the original content (e.g. "vm_stat — show virtual memory statistics").
 	Text string
-	// Source identifies where this doc came from: "tldr", "learned", "history".
+	// Source identifies where this doc came from: "tldr", "learned", "note", "history".
 	Source string
 	// Category groups docs for pre-filtering: "memory", "network", "git", "files", etc.
 	Category string
@@ -41,12 +51,22 @@ type Document struct {
 	// FailureCount tracks how many times this doc led to a failed command.
 	// Used by adaptive relevance scoring to penalize unreliable docs.
 	FailureCount int32
+	// Project is the project root a history doc was learned in. Empty means
+	// the doc applies everywhere (builtins, learned corrections, old indexes).
+	Project string
 }
 
 // SearchResult is a document matched by similarity search, with its score.
 type SearchResult struct {
 	Doc   Document
 	Score float32 // Cosine similarity: 1.0 = identical, 0.0 = unrelated.
+	// Cosine, Feedback and Boost break Score down for debugging:
+	// Score = Cosine * Feedback * Boost, where Feedback is the adaptive
+	// multiplier from the doc's successes and failures, and Boost the
+	// weight of its source.
+	Cosine   float32
+	Feedback float32
+	Boost    float32
 }
 
 // Store is an in-memory vector store backed by a binary file on disk.
@@ -71,6 +91,109 @@ func (s *Store) Len() int {
 	return len(s.docs)
 }
 
+// Dim returns the dimension of the store's vectors, or 0 if it's empty.
+func (s *Store) Dim() int {
+	if len(s.docs) == 0 {
+		return 0
+	}
+	return len(s.docs[0].Vector)
+}
+
+// Docs returns a copy of every document in the store.
+func (s *Store) Docs() []Document {
+	docs := make([]Document, len(s.docs))
+	copy(docs, s.docs)
+	return docs
+}
+
+// NetScore is the document's feedback balance: successes minus failures.
+func (d Document) NetScore() int32 {
+	return d.SuccessCount - d.FailureCount
+}
+
+// RankByFeedback returns the documents from the given sources that have
+// received any feedback, best first: highest NetScore, then most successes.
+// Remaining ties are broken by text so the order is stable. With no sources,
+// every document is considered.
+func (s *Store) RankByFeedback(sources ...string) []Document {
+	var ranked []Document
+	for _, doc := range s.docs {
+		if doc.SuccessCount == 0 && doc.FailureCount == 0 {
+			continue
+		}
+		if len(sources) > 0 && !containsString(sources, doc.Source) {
+			continue
+		}
+		ranked = append(ranked, doc)
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		a, b := ranked[i], ranked[j]
+		if a.NetScore() != b.NetScore() {
+			return a.NetScore() > b.NetScore()
+		}
+		if a.SuccessCount != b.SuccessCount {
+			return a.SuccessCount > b.SuccessCount
+		}
+		return a.Text < b.Text
+	})
+	return ranked
+}
+
+// Thresholds for SuspectBuiltins: a builtin needs at least this many
+// failures, making up at least this share of its feedback, to be flagged.
+// One bad run is noise; repeated failures mean the doc doesn't fit here.
+const (
+	SuspectMinFailures  int32   = 3
+	SuspectFailureRatio float64 = 0.5
+)
+
+// SuspectBuiltins returns builtin documents that are frequently followed by
+// failed commands on this machine — OS knowledge that's likely wrong for the
+// user's environment (a missing tool, a different flag set). Most failures
+// come first.
+func (s *Store) SuspectBuiltins() []Document {
+	var suspects []Document
+	for _, doc := range s.docs {
+		if doc.Source != "builtin" || doc.FailureCount < SuspectMinFailures {
+			continue
+		}
+		ratio := float64(doc.FailureCount) / float64(doc.FailureCount+doc.SuccessCount)
+		if ratio >= SuspectFailureRatio {
+			suspects = append(suspects, doc)
+		}
+	}
+	sort.SliceStable(suspects, func(i, j int) bool {
+		a, b := suspects[i], suspects[j]
+		if a.FailureCount != b.FailureCount {
+			return a.FailureCount > b.FailureCount
+		}
+		return a.Text < b.Text
+	})
+	return suspects
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// FilterProject drops history docs learned in a different project, so
+// commands from one repo don't leak into suggestions for another. Docs with
+// no project (builtins, learned corrections) are always kept.
+func (s *Store) FilterProject(project string) {
+	kept := s.docs[:0]
+	for _, doc := range s.docs {
+		if doc.Project == "" || doc.Project == project {
+			kept = append(kept, doc)
+		}
+	}
+	s.docs = kept
+}
+
 // storePath returns the full path to the binary vector file.
 // It's a variable so tests can override it.
 var storePath = func() string {
@@ -80,13 +203,18 @@ var storePath = func() string {
 // storeFormatVersion is the current binary format version.
 // v1: original format (no version header, no scoring fields)
 // v2: added version header + SuccessCount/FailureCount per document
-const storeFormatVersion uint32 = 2
+// v3: added Project per document
+// v4: added the vector dimension to the header
+const storeFormatVersion uint32 = 4
 
-// Save writes all documents to disk in a compact binary format.
+// Save writes all documents to disk in a compact binary format. Every
+// vector must have the same dimension, or it fails with
+// ErrDimensionMismatch.
 //
-// Binary format v2 (all little-endian):
-//   [4 bytes] format version (uint32) — always 2
+// Binary format v4 (all little-endian):
+//   [4 bytes] format version (uint32) — always 4
 //   [4 bytes] number of documents (uint32)
+//   [4 bytes] vector dimension (uint32) — 0 for an empty store
 //   For each document:
 //     [4 bytes] text length (uint32)
 //     [N bytes] text (UTF-8)
@@ -98,29 +226,62 @@ const storeFormatVersion uint32 = 2
 //     [dim*4 bytes] vector (float32 array)
 //     [4 bytes] success count (int32)
 //     [4 bytes] failure count (int32)
+//     [4 bytes] project length (uint32)
+//     [N bytes] project (UTF-8)
 //
 // Why binary instead of JSON? A 768-dim float32 vector is 3KB in binary
 // but ~6KB in JSON (decimal text). For 4K docs that's 12MB vs 24MB.
 // Binary is also faster to parse — no string→float conversion.
+//
+// Save and Append hold the store lock (see acquireStoreLock) while they
+// write, so writers in different processes take turns instead of
+// interleaving.
 func (s *Store) Save() error {
-	if err := os.MkdirAll(filepath.Dir(storePath()), 0o700); err != nil {
+	release, err := acquireStoreLock()
+	if err != nil {
 		return err
 	}
+	defer release()
+	return s.save()
+}
+
+// save is Save for a caller that already holds the store lock.
+func (s *Store) save() error {
+	path := storePath()
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	// Write to a temp file and rename it into place, so an interrupted save
+	// (or a reader mid-save) never sees a half-written store.
+	tmp := path + ".tmp"
+	if err := s.writeFile(tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
 
-	f, err := os.Create(storePath())
+// writeFile writes the store to path in the format Save documents.
+func (s *Store) writeFile(path string) error {
+	f, err := os.Create(path)
 	if err != nil {
 		return fmt.Errorf("failed to create vector store: %w", err)
 	}
 	defer f.Close()
 
-	// Write format version.
-	if err := binary.Write(f, binary.LittleEndian, storeFormatVersion); err != nil {
-		return err
+	dim := s.Dim()
+	for _, doc := range s.docs {
+		if len(doc.Vector) != dim {
+			return fmt.Errorf("%w (%d-dim and %d-dim vectors in one index)", ErrDimensionMismatch, dim, len(doc.Vector))
+		}
 	}
 
-	// Write document count.
-	if err := binary.Write(f, binary.LittleEndian, uint32(len(s.docs))); err != nil {
-		return err
+	// Write format version, document count and vector dimension.
+	for _, word := range []uint32{storeFormatVersion, uint32(len(s.docs)), uint32(dim)} {
+		if err := binary.Write(f, binary.LittleEndian, word); err != nil {
+			return err
+		}
 	}
 
 	for _, doc := range s.docs {
@@ -129,11 +290,13 @@ func (s *Store) Save() error {
 		}
 	}
 
-	return nil
+	return f.Close()
 }
 
 // Load reads the binary vector store from disk into memory.
-// Supports both v1 (legacy, no version header) and v2 (with scoring fields).
+// Supports v1 (legacy, no version header), v2 (with scoring fields), v3
+// (with project) and v4 (with the vector dimension). A store whose vectors
+// don't all have the same dimension fails with ErrDimensionMismatch.
 func (s *Store) Load() error {
 	f, err := os.Open(storePath())
 	if err != nil {
@@ -152,13 +315,22 @@ func (s *Store) Load() error {
 
 	var count uint32
 	version := uint32(1) // Default: legacy format.
+	wantDim := -1        // The dimension every vector must have; -1 until known.
 
-	if firstWord == storeFormatVersion {
-		// v2 format: first word is version, second word is doc count.
+	if firstWord >= 2 && firstWord <= storeFormatVersion {
+		// v2+ format: first word is version, second word is doc count.
 		version = firstWord
 		if err := binary.Read(f, binary.LittleEndian, &count); err != nil {
 			return fmt.Errorf("failed to read document count: %w", err)
 		}
+		// v4: third word is the vector dimension.
+		if version >= 4 {
+			var dim uint32
+			if err := binary.Read(f, binary.LittleEndian, &dim); err != nil {
+				return fmt.Errorf("failed to read vector dimension: %w", err)
+			}
+			wantDim = int(dim)
+		}
 	} else {
 		// v1 format: first word IS the doc count (no version header).
 		count = firstWord
@@ -183,6 +355,12 @@ func (s *Store) Load() error {
 		if err := binary.Read(f, binary.LittleEndian, &dim); err != nil {
 			return err
 		}
+		if wantDim == -1 {
+			wantDim = int(dim)
+		}
+		if int(dim) != wantDim {
+			return fmt.Errorf("%w (%d-dim and %d-dim vectors in one index)", ErrDimensionMismatch, wantDim, dim)
+		}
 		vec := make([]float32, dim)
 		if err := binary.Read(f, binary.LittleEndian, vec); err != nil {
 			return err
@@ -205,6 +383,13 @@ func (s *Store) Load() error {
 			}
 		}
 
+		// v3: read project.
+		if version >= 3 {
+			if doc.Project, err = readString(f); err != nil {
+				return err
+			}
+		}
+
 		s.docs[i] = doc
 	}
 
@@ -239,19 +424,11 @@ func (s *Store) Search(queryVec []float32, topK int, category string) []SearchRe
 		}
 
 		cosine := cosineSimilarity(queryVec, doc.Vector)
-		score := adaptiveScore(cosine, doc.SuccessCount, doc.FailureCount)
-
-		// Source boost: builtin entries are curated, high-quality knowledge.
-		// Give them a 20% edge so auto-learned garbage doesn't drown them out.
-		// Learned corrections get a 10% boost since the user explicitly taught them.
-		switch doc.Source {
-		case "builtin":
-			score *= 1.20
-		case "learned":
-			score *= 1.10
-		}
+		feedback := feedbackMultiplier(doc.SuccessCount, doc.FailureCount)
+		boost := sourceBoost(doc.Source)
+		score := cosine * feedback * boost
 
-		results = append(results, SearchResult{Doc: doc, Score: score})
+		results = append(results, SearchResult{Doc: doc, Score: score, Cosine: cosine, Feedback: feedback, Boost: boost})
 	}
 
 	// Sort by score descending (highest similarity first).
@@ -281,11 +458,34 @@ func (s *Store) Search(queryVec []float32, topK int, category string) []SearchRe
 //   - Cold-start: new docs start at 1.0 multiplier (neutral)
 //   - Same principle as Reddit's ranking and HN's story scoring
 func adaptiveScore(cosine float32, successes, failures int32) float32 {
+	return cosine * feedbackMultiplier(successes, failures)
+}
+
+// feedbackMultiplier is the factor adaptiveScore scales a cosine by.
+func feedbackMultiplier(successes, failures int32) float32 {
 	multiplier := 1.0 + math.Log(1.0+float64(successes)) - 0.5*math.Log(1.0+float64(failures))
 	if multiplier < 0.01 {
 		multiplier = 0.01 // Floor: never fully zero out a doc.
 	}
-	return cosine * float32(multiplier)
+	return float32(multiplier)
+}
+
+// sourceBoost is the weight Search gives a doc for where it came from.
+// Builtin entries are curated, high-quality knowledge, so they get a 20%
+// edge and auto-learned garbage doesn't drown them out. Learned corrections
+// get 10% since the user explicitly taught them. Notes were taught
+// explicitly too, but they're facts rather than commands, so they sit
+// halfway between learned and history.
+func sourceBoost(source string) float32 {
+	switch source {
+	case "builtin":
+		return 1.20
+	case "learned":
+		return 1.10
+	case "note":
+		return 1.05
+	}
+	return 1
 }
 
 // cosineSimilarity computes the cosine of the angle between two vectors.
@@ -332,7 +532,7 @@ func writeString(f *os.File, s string) error {
 	return err
 }
 
-// writeDoc writes a single document in v2 binary format.
+// writeDoc writes a single document in the current (v4) binary format.
 func writeDoc(f *os.File, doc Document) error {
 	if err := writeString(f, doc.Text); err != nil {
 		return err
@@ -355,7 +555,7 @@ func writeDoc(f *os.File, doc Document) error {
 	if err := binary.Write(f, binary.LittleEndian, doc.FailureCount); err != nil {
 		return err
 	}
-	return nil
+	return writeString(f, doc.Project)
 }
 
 // readString reads a length-prefixed UTF-8 string from a binary file.
@@ -374,21 +574,30 @@ func readString(f *os.File) (string, error) {
 // Append writes a single document to the end of the binary store file
 // and updates the document count header — O(1) instead of O(n) full rewrite.
 //
-// Binary layout (v2):
+// Binary layout (v4):
 //   [4 bytes] format version (uint32)
 //   [4 bytes] doc count (uint32)  ← we update this in-place
+//   [4 bytes] vector dimension (uint32)  ← set here if the store was empty
 //   [... existing docs ...]
 //   [new doc appended here]
 //
 // This is the write-behind pattern: the user's command finishes instantly,
 // and we persist the new knowledge in the background.
+//
+// A doc whose vector doesn't match the store's dimension isn't added and
+// the error wraps ErrDimensionMismatch.
 func (s *Store) Append(doc Document) error {
+	release, err := acquireStoreLock()
+	if err != nil {
+		return err
+	}
+	defer release()
 	path := storePath()
 
 	// If the file doesn't exist yet, fall back to a full Save.
 	if _, err := os.Stat(path); os.IsNotExist(err) {
 		s.docs = append(s.docs, doc)
-		return s.Save()
+		return s.save()
 	}
 
 	f, err := os.OpenFile(path, os.O_RDWR, 0o644)
@@ -397,34 +606,55 @@ func (s *Store) Append(doc Document) error {
 	}
 	defer f.Close()
 
-	// Read version and count. The count is at byte 4 in v2 (after version header)
-	// or byte 0 in v1 (no version header).
+	// Read version and count. The count is at byte 4 in the current format
+	// (after the version header). Older formats are rewritten in full.
 	var firstWord uint32
 	if err := binary.Read(f, binary.LittleEndian, &firstWord); err != nil {
 		return fmt.Errorf("failed to read store header: %w", err)
 	}
 
-	var count uint32
+	var count, dim uint32
 	countOffset := int64(0) // Where the count lives in the file.
 
 	if firstWord == storeFormatVersion {
-		// v2: version at byte 0, count at byte 4.
+		// Current format: version at byte 0, count at byte 4, dimension
+		// at byte 8.
 		countOffset = 4
 		if err := binary.Read(f, binary.LittleEndian, &count); err != nil {
 			return fmt.Errorf("failed to read document count: %w", err)
 		}
+		if err := binary.Read(f, binary.LittleEndian, &dim); err != nil {
+			return fmt.Errorf("failed to read vector dimension: %w", err)
+		}
 	} else {
-		// v1: count at byte 0. We can't append v2 docs to a v1 file cleanly,
-		// so fall back to a full rewrite in v2 format.
+		// v1-v3: we can't append current-format docs to an older file
+		// cleanly, so fall back to a full rewrite in the current format.
 		s.docs = append(s.docs, doc)
-		// Reload existing docs from the v1 file first.
+		// Reload existing docs from the old file first.
 		f.Close()
 		old := NewStore()
-		if err := old.Load(); err == nil {
+		err := old.Load()
+		if errors.Is(err, ErrDimensionMismatch) {
+			return err
+		}
+		if err == nil {
 			// Merge: old docs + new doc (already appended to s.docs).
 			s.docs = append(old.docs, doc)
 		}
-		return s.Save()
+		return s.save()
+	}
+
+	if count > 0 && int(dim) != len(doc.Vector) {
+		return fmt.Errorf("%w (a %d-dim vector for a %d-dim index)", ErrDimensionMismatch, len(doc.Vector), dim)
+	}
+	if count == 0 {
+		// The first doc sets the store's dimension.
+		if _, err := f.Seek(countOffset+4, 0); err != nil {
+			return fmt.Errorf("failed to seek to header: %w", err)
+		}
+		if err := binary.Write(f, binary.LittleEndian, uint32(len(doc.Vector))); err != nil {
+			return fmt.Errorf("failed to update vector dimension: %w", err)
+		}
 	}
 
 	// Seek to end of file to append the new document.
@@ -432,7 +662,7 @@ func (s *Store) Append(doc Document) error {
 		return fmt.Errorf("failed to seek to end: %w", err)
 	}
 
-	// Write the document in v2 binary format.
+	// Write the document in the current binary format.
 	if err := writeDoc(f, doc); err != nil {
 		return err
 	}
@@ -466,6 +696,142 @@ func (s *Store) HasNearDuplicate(vec []float32, threshold float32) bool {
 	return false
 }
 
+// Delete removes every document pred matches and returns how many it
+// removed. Order is otherwise preserved. Like Add, it only changes the
+// store in memory — call Save to persist.
+func (s *Store) Delete(pred func(Document) bool) int {
+	docs := s.docs[:0]
+	for _, doc := range s.docs {
+		if !pred(doc) {
+			docs = append(docs, doc)
+		}
+	}
+	removed := len(s.docs) - len(docs)
+	s.docs = docs
+	return removed
+}
+
+// DeleteBySource removes every document from source, e.g. "history", and
+// returns how many it removed.
+func (s *Store) DeleteBySource(source string) int {
+	return s.Delete(func(d Document) bool { return d.Source == source })
+}
+
+// PruneOptions chooses which auto-learned history documents Store.Prune
+// drops. A zero field disables that check.
+type PruneOptions struct {
+	// MinFailures drops history docs that never led to a success and
+	// failed at least this many times.
+	MinFailures int32
+	// DupThreshold drops history docs more similar than this (cosine) to a
+	// doc with a better NetScore.
+	DupThreshold float32
+}
+
+// Prune drops stale history documents, as opts describes, and returns how
+// many it removed. Builtin, learned, note and fix docs are never pruned,
+// though a history doc can be dropped as a near-duplicate of one of them.
+// Among equally scored near-duplicates the more authoritative source wins,
+// then the older doc.
+func (s *Store) Prune(opts PruneOptions) int {
+	drop := make([]bool, len(s.docs))
+	for i, doc := range s.docs {
+		if doc.Source == "history" && opts.MinFailures > 0 && doc.SuccessCount == 0 && doc.FailureCount >= opts.MinFailures {
+			drop[i] = true
+		}
+	}
+
+	if opts.DupThreshold > 0 {
+		order := make([]int, 0, len(s.docs))
+		for i := range s.docs {
+			if !drop[i] {
+				order = append(order, i)
+			}
+		}
+		sort.SliceStable(order, func(i, j int) bool {
+			a, b := s.docs[order[i]], s.docs[order[j]]
+			if a.NetScore() != b.NetScore() {
+				return a.NetScore() > b.NetScore()
+			}
+			return sourceRank[a.Source] > sourceRank[b.Source]
+		})
+		var kept []int
+		for _, i := range order {
+			if s.docs[i].Source == "history" {
+				for _, k := range kept {
+					if cosineSimilarity(s.docs[i].Vector, s.docs[k].Vector) > opts.DupThreshold {
+						drop[i] = true
+						break
+					}
+				}
+			}
+			if !drop[i] {
+				kept = append(kept, i)
+			}
+		}
+	}
+
+	docs := s.docs[:0]
+	for i, doc := range s.docs {
+		if !drop[i] {
+			docs = append(docs, doc)
+		}
+	}
+	removed := len(s.docs) - len(docs)
+	s.docs = docs
+	return removed
+}
+
+// Compact drops documents that are near-duplicates (cosine similarity above
+// threshold) of a more authoritative one, and returns how many it removed.
+// Within a group the higher source rank wins, then the better NetScore, then
+// the older doc. Builtins are never removed. Order is otherwise preserved.
+func (s *Store) Compact(threshold float32) int {
+	order := make([]int, len(s.docs))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := s.docs[order[i]], s.docs[order[j]]
+		if sourceRank[a.Source] != sourceRank[b.Source] {
+			return sourceRank[a.Source] > sourceRank[b.Source]
+		}
+		return a.NetScore() > b.NetScore()
+	})
+
+	var kept []int
+	drop := make([]bool, len(s.docs))
+	for _, i := range order {
+		doc := s.docs[i]
+		dup := false
+		if doc.Source != "builtin" {
+			for _, k := range kept {
+				if cosineSimilarity(doc.Vector, s.docs[k].Vector) > threshold {
+					dup = true
+					break
+				}
+			}
+		}
+		if dup {
+			drop[i] = true
+			continue
+		}
+		kept = append(kept, i)
+	}
+
+	docs := s.docs[:0]
+	removed := 0
+	for i, doc := range s.docs {
+		if drop[i] {
+			removed++
+			continue
+		}
+		docs = append(docs, doc)
+	}
+	s.docs = docs
+	return removed
+}
+
 // UpdateScore finds the document most similar to the given vector and
 // increments its success or failure count. This is the reinforcement signal
 // that makes adaptive scoring work over time.
@@ -474,34 +840,61 @@ func (s *Store) HasNearDuplicate(vec []float32, threshold float32) bool {
 // This is O(n) for the search + O(n) for the save, but it only runs in
 // background subprocesses so the user never waits.
 //
-// Returns true if a matching document was found and updated.
-func (s *Store) UpdateScore(vec []float32, success bool) bool {
-	if len(s.docs) == 0 {
-		return false
-	}
+// Only a document at least minScore similar to vec counts as the match;
+// below that the feedback is dropped rather than credited to an unrelated
+// doc. Returns true if a matching document was found and updated.
+func (s *Store) UpdateScore(vec []float32, success bool, minScore float32) bool {
+	return s.UpdateTopScores(vec, success, minScore, 1) > 0
+}
 
-	// Find the most similar document.
-	bestIdx := -1
-	bestScore := float32(-1)
+// UpdateTopScores is UpdateScore spread over the k documents most similar
+// to vec, since the command may have been shaped by everything retrieved
+// for it, not just the best match. Credit decays with rank: the best match
+// always gets the outcome, and the match at rank r (counting from 1) gets
+// it with probability 1/r. Counts are whole numbers on disk, so partial
+// credit is given as a chance of full credit, which adds up to the right
+// proportions over many runs. No document gains more than one count per
+// call, so scores can't inflate faster than with single-doc feedback.
+//
+// It returns how many documents were updated.
+func (s *Store) UpdateTopScores(vec []float32, success bool, minScore float32, k int) int {
+	type match struct {
+		idx   int
+		score float32
+	}
+	var matches []match
 	for i, doc := range s.docs {
-		score := cosineSimilarity(vec, doc.Vector)
-		if score > bestScore {
-			bestScore = score
-			bestIdx = i
+		if score := cosineSimilarity(vec, doc.Vector); score >= minScore {
+			matches = append(matches, match{i, score})
 		}
 	}
-
-	// Only update if the match is reasonably relevant (> 0.5).
-	if bestIdx < 0 || bestScore < 0.5 {
-		return false
+	sort.SliceStable(matches, func(a, b int) bool { return matches[a].score > matches[b].score })
+	if len(matches) > k {
+		matches = matches[:k]
 	}
 
-	if success {
-		s.docs[bestIdx].SuccessCount++
-	} else {
-		s.docs[bestIdx].FailureCount++
+	updated := 0
+	for rank, m := range matches {
+		if rank > 0 && feedbackChance() >= rankWeight(rank) {
+			continue
+		}
+		if success {
+			s.docs[m.idx].SuccessCount++
+		} else {
+			s.docs[m.idx].FailureCount++
+		}
+		updated++
 	}
+	return updated
+}
 
-	return true
+// rankWeight is the share of feedback credit the match at 0-based rank
+// gets.
+func rankWeight(rank int) float64 {
+	return 1 / float64(rank+1)
 }
 
+// feedbackChance draws the number deciding whether a lower-ranked match
+// gets credit. It's a variable so tests can make it deterministic.
+var feedbackChance = rand.Float64
+
@@ -0,0 +1,81 @@
+package safety
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Mismatch is a program in a command that doesn't exist on the target OS.
+type Mismatch struct {
+	Program string
+	// Suggestion is what to use instead on this OS.
+	Suggestion string
+}
+
+// wrongPrograms maps a GOOS to programs the model commonly reaches for
+// there even though they belong to another platform. The builtin docs
+// already tell the model not to use them; this catches it when it does.
+var wrongPrograms = map[string]map[string]string{
+	"darwin": {
+		"free":        "vm_stat or sysctl hw.memsize",
+		"xdg-open":    "open",
+		"apt":         "brew",
+		"apt-get":     "brew",
+		"yum":         "brew",
+		"dnf":         "brew",
+		"systemctl":   "launchctl or brew services",
+		"ip":          "ifconfig",
+		"lsblk":       "diskutil list",
+		"nproc":       "sysctl -n hw.ncpu",
+		"xclip":       "pbcopy / pbpaste",
+		"lsb_release": "sw_vers",
+	},
+	"linux": {
+		"pbcopy":    "xclip -selection clipboard (or wl-copy)",
+		"pbpaste":   "xclip -selection clipboard -o (or wl-paste)",
+		"vm_stat":   "free -h",
+		"launchctl": "systemctl",
+		"diskutil":  "lsblk",
+		"sw_vers":   "cat /etc/os-release",
+		"brew":      "your distro's package manager (apt, dnf, pacman)",
+	},
+}
+
+// segmentSep splits a command line into the simple commands it runs.
+var segmentSep = regexp.MustCompile(`\|\||&&|[|;&()]|` + "`")
+
+// CheckPlatform returns the programs in command that don't belong on goos
+// (a runtime.GOOS value), in the order they appear. Each program is
+// reported once; an OS without rules never mismatches.
+func CheckPlatform(command, goos string) []Mismatch {
+	wrong := wrongPrograms[goos]
+	if len(wrong) == 0 {
+		return nil
+	}
+
+	var found []Mismatch
+	seen := make(map[string]bool)
+	for _, segment := range segmentSep.Split(command, -1) {
+		program := segmentProgram(segment)
+		suggestion, ok := wrong[program]
+		if !ok || seen[program] {
+			continue
+		}
+		seen[program] = true
+		found = append(found, Mismatch{Program: program, Suggestion: suggestion})
+	}
+	return found
+}
+
+// segmentProgram returns the program a simple command runs, skipping sudo,
+// env and leading VAR=value assignments.
+func segmentProgram(segment string) string {
+	for _, field := range strings.Fields(segment) {
+		if field == "sudo" || field == "env" || strings.Contains(field, "=") {
+			continue
+		}
+		return filepath.Base(field)
+	}
+	return ""
+}
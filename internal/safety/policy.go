@@ -0,0 +1,168 @@
+package safety
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Policy is a denylist, and optionally an allowlist, of commands xx may
+// never run, read from .xxignore-style files. Unlike the risk scanner it's
+// absolute: --yolo and --force don't get past it.
+//
+// Each non-empty line that isn't a # comment is a rule:
+//
+//	rm -rf          deny any command starting with "rm -rf"
+//	/curl.*\|\s*sh/ deny any command line matching the regex
+//	!git            allow commands starting with "git"
+//
+// A plain rule matches each simple command in a pipeline or && chain by
+// its leading words, ignoring sudo, env and VAR=value, so "rm" blocks
+// "ls && sudo rm x" but not "rmdir x". A /regex/ rule matches the whole
+// command line. Deny rules always win; once there's any allow rule, every
+// simple command has to match one.
+type Policy struct {
+	deny  []policyRule
+	allow []policyRule
+}
+
+type policyRule struct {
+	text   string         // The rule as written, for messages.
+	prefix string         // Leading words to match, for plain rules.
+	re     *regexp.Regexp // The regex, for /regex/ rules.
+}
+
+// LoadPolicy reads and combines the policy files at paths. Missing files
+// are skipped, so with none present the policy allows everything.
+func LoadPolicy(paths ...string) (*Policy, error) {
+	p := &Policy{}
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		err = p.parse(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return p, nil
+}
+
+// ParsePolicy reads a single policy from r.
+func ParsePolicy(r io.Reader) (*Policy, error) {
+	p := &Policy{}
+	if err := p.parse(r); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// parse adds the rules in r to p.
+func (p *Policy) parse(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		allow := strings.HasPrefix(line, "!")
+		if allow {
+			line = strings.TrimSpace(line[1:])
+		}
+
+		rule := policyRule{text: line}
+		if len(line) > 2 && strings.HasPrefix(line, "/") && strings.HasSuffix(line, "/") {
+			re, err := regexp.Compile(line[1 : len(line)-1])
+			if err != nil {
+				return fmt.Errorf("line %d: invalid regex: %w", n, err)
+			}
+			rule.re = re
+		} else {
+			rule.prefix = strings.Join(strings.Fields(line), " ")
+			if rule.prefix == "" {
+				continue
+			}
+		}
+
+		if allow {
+			p.allow = append(p.allow, rule)
+		} else {
+			p.deny = append(p.deny, rule)
+		}
+	}
+	return scanner.Err()
+}
+
+// Check returns an error naming the rule that forbids command, or nil if
+// the policy lets it run.
+func (p *Policy) Check(command string) error {
+	var segments []string
+	for _, segment := range segmentSep.Split(command, -1) {
+		if s := segmentCommand(segment); s != "" {
+			segments = append(segments, s)
+		}
+	}
+
+	for _, rule := range p.deny {
+		if rule.matches(command, segments) {
+			return fmt.Errorf("matches the deny rule %q", rule.text)
+		}
+	}
+	if len(p.allow) == 0 {
+		return nil
+	}
+	for _, segment := range segments {
+		if !p.allowed(command, segment) {
+			return fmt.Errorf("'%s' doesn't match any allow rule", segment)
+		}
+	}
+	return nil
+}
+
+// allowed reports whether an allow rule covers segment of command.
+func (p *Policy) allowed(command, segment string) bool {
+	for _, rule := range p.allow {
+		if rule.matches(command, []string{segment}) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches reports whether the rule matches the command line or any of its
+// simple commands.
+func (r policyRule) matches(command string, segments []string) bool {
+	if r.re != nil {
+		return r.re.MatchString(command)
+	}
+	for _, s := range segments {
+		if s == r.prefix || strings.HasPrefix(s, r.prefix+" ") {
+			return true
+		}
+	}
+	return false
+}
+
+// segmentCommand normalizes a simple command for prefix matching: sudo,
+// env and leading VAR=value assignments are dropped, the program is
+// reduced to its base name and words are single-spaced.
+func segmentCommand(segment string) string {
+	fields := strings.Fields(segment)
+	for len(fields) > 0 && (fields[0] == "sudo" || fields[0] == "env" || strings.Contains(fields[0], "=")) {
+		fields = fields[1:]
+	}
+	if len(fields) == 0 {
+		return ""
+	}
+	fields[0] = filepath.Base(fields[0])
+	return strings.Join(fields, " ")
+}
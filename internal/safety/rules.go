@@ -0,0 +1,118 @@
+package safety
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Rules is an ordered list of risk rules: the first one a command matches
+// decides its level.
+type Rules []rule
+
+// LoadRules returns the rules in the file at path followed by the builtin
+// ones. User rules come first, so they win: a high rule adds a footgun of
+// your own, and a low rule vouches for a command the builtins would flag.
+// A missing file just gives the builtins.
+//
+// Each non-empty line that isn't a # comment is a level, a /regex/, and
+// an optional reason shown when the rule matches:
+//
+//	high   /\bterraform\s+destroy\b/   destroys infrastructure
+//	medium /\bkubectl\s+delete\b/      deletes cluster resources
+//	low    /^sudo apt (update|upgrade)\b/
+//
+// The regex ends at the first / followed by a space or the end of the
+// line; write a slash followed by a space inside it as \/.
+func LoadRules(path string) (Rules, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return rules, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	user, err := ParseRules(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return append(user, rules...), nil
+}
+
+// ParseRules reads risk rules, in the format LoadRules describes, from r.
+// The builtin rules aren't included.
+func ParseRules(r io.Reader) (Rules, error) {
+	var parsed Rules
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rl, err := parseRule(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		parsed = append(parsed, rl)
+	}
+	return parsed, scanner.Err()
+}
+
+// parseRule parses one "level /regex/ reason" line.
+func parseRule(line string) (rule, error) {
+	word, rest := line, ""
+	if i := strings.IndexAny(line, " \t"); i >= 0 {
+		word, rest = line[:i], line[i:]
+	}
+	var level Level
+	switch strings.ToLower(word) {
+	case "high":
+		level = High
+	case "medium":
+		level = Medium
+	case "low":
+		level = Low
+	default:
+		return rule{}, fmt.Errorf("unknown level %q (use high, medium or low)", word)
+	}
+
+	rest = strings.TrimSpace(rest)
+	end := -1
+	for i := 1; i < len(rest); i++ {
+		if rest[i] == '/' && (i == len(rest)-1 || rest[i+1] == ' ' || rest[i+1] == '\t') {
+			end = i
+			break
+		}
+	}
+	if !strings.HasPrefix(rest, "/") || end < 2 {
+		return rule{}, fmt.Errorf("expected a /regex/ after the level")
+	}
+	pattern, err := regexp.Compile(rest[1:end])
+	if err != nil {
+		return rule{}, fmt.Errorf("invalid regex: %w", err)
+	}
+
+	reason := strings.TrimSpace(rest[end+1:])
+	if reason == "" {
+		reason = "matches your risk rule " + rest[:end+1]
+	}
+	return rule{level: level, pattern: pattern, reason: reason}, nil
+}
+
+// Assess scans command and returns the level of the first rule it matches.
+func (rs Rules) Assess(command string) Assessment {
+	for _, r := range rs {
+		if r.pattern.MatchString(command) {
+			if r.level == Low {
+				return Assessment{Level: Low}
+			}
+			return Assessment{Level: r.level, Reason: r.reason}
+		}
+	}
+	return Assessment{Level: Low}
+}
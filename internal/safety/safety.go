@@ -0,0 +1,78 @@
+// Package safety flags shell commands that can destroy data or take down
+// the machine, so xx can slow down before running them. It's a pattern
+// scanner, not a sandbox: it catches the common footguns an AI might
+// produce, and everything it doesn't recognise is treated as low risk.
+package safety
+
+import "regexp"
+
+// Level is how dangerous a command is.
+type Level int
+
+const (
+	// Low is the default: nothing known-dangerous was found.
+	Low Level = iota
+	// Medium commands change or delete things in ways that are hard to undo
+	// (recursive deletes, force pushes, killing processes). xx explains
+	// them before asking for confirmation.
+	Medium
+	// High commands can wipe a disk, the home directory, or the whole
+	// system. xx refuses them unless --force is given.
+	High
+)
+
+// String returns the level's name as shown to the user.
+func (l Level) String() string {
+	switch l {
+	case High:
+		return "high"
+	case Medium:
+		return "medium"
+	default:
+		return "low"
+	}
+}
+
+// Assessment is the scanner's verdict on a command.
+type Assessment struct {
+	Level Level
+	// Reason says what made the command risky. Empty for Low.
+	Reason string
+}
+
+// rule flags commands matching pattern at the given level.
+type rule struct {
+	level   Level
+	pattern *regexp.Regexp
+	reason  string
+}
+
+// rules are the builtin rules, checked in order; High rules come first so
+// the most severe match wins.
+var rules = Rules{
+	{High, regexp.MustCompile(`\brm\s+(-\w+\s+)*-\w*[rR]\w*\s+(-\w+\s+)*(/|/\*|~|~/|~/\*|\$HOME/?|\*|\.{1,2}/?)(\s|;|&|\||$)`), "recursively deletes /, your home directory, or everything here"},
+	{High, regexp.MustCompile(`\bmkfs(\.\w+)?\b`), "formats a filesystem"},
+	{High, regexp.MustCompile(`\bdd\b.*\bof=/dev/`), "writes raw data to a device"},
+	{High, regexp.MustCompile(`>\s*/dev/(sd|disk|nvme|hd)`), "overwrites a disk device"},
+	{High, regexp.MustCompile(`:\(\)\s*\{\s*:\s*\|\s*:\s*&\s*\}\s*;\s*:`), "is a fork bomb"},
+	{High, regexp.MustCompile(`\bdiskutil\s+(eraseDisk|eraseVolume|zeroDisk|secureErase)\b`), "erases a disk"},
+	{High, regexp.MustCompile(`\bchmod\s+(-\w+\s+)*-\w*R\w*\s+(-\w+\s+)*\d*7{3}\s+/(\s|$)`), "makes the whole filesystem world-writable"},
+	{High, regexp.MustCompile(`(?i)\bdrop\s+(database|schema)\b`), "drops a database"},
+
+	{Medium, regexp.MustCompile(`\brm\s+(-\w+\s+)*-\w*[rRf]`), "deletes files recursively or without asking"},
+	{Medium, regexp.MustCompile(`\bgit\s+push\b.*(--force\b|-f\b|--force-with-lease\b)`), "force-pushes, rewriting remote history"},
+	{Medium, regexp.MustCompile(`\bgit\s+reset\s+.*--hard\b`), "discards uncommitted changes"},
+	{Medium, regexp.MustCompile(`\bgit\s+clean\s+(-\w+\s+)*-\w*f`), "deletes untracked files"},
+	{Medium, regexp.MustCompile(`\b(kill\s+-(9|KILL)|killall|pkill)\b`), "kills processes"},
+	{Medium, regexp.MustCompile(`\b(shutdown|reboot|halt|poweroff)\b`), "shuts down or restarts the machine"},
+	{Medium, regexp.MustCompile(`\b(chmod|chown)\s+(-\w+\s+)*-\w*R`), "changes permissions recursively"},
+	{Medium, regexp.MustCompile(`\b(curl|wget)\b[^|]*\|\s*(sudo\s+)?(ba|z|fi)?sh\b`), "runs a script straight from the internet"},
+	{Medium, regexp.MustCompile(`(?i)\b(drop\s+table|truncate\s+table)\b`), "deletes table data"},
+	{Medium, regexp.MustCompile(`\bsudo\b`), "runs with root privileges"},
+}
+
+// Assess scans command with the builtin rules and returns the most severe
+// risk it matches. Use LoadRules to add your own.
+func Assess(command string) Assessment {
+	return Rules(rules).Assess(command)
+}
@@ -0,0 +1,235 @@
+package safety
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAssess(t *testing.T) {
+	tests := []struct {
+		command string
+		want    Level
+	}{
+		{"ls -la", Low},
+		{"rm notes.txt", Low},
+		{"rm file.txt", Low},
+		{"git push origin main", Low},
+		{"df -h", Low},
+
+		{"rm -rf node_modules", Medium},
+		{"rm -f *.log", Medium},
+		{"rm -rf ~/Downloads/old", Medium},
+		{"rm -rf /tmp/build", Medium},
+		{"rm -rf ./dist", Medium},
+		{"git push --force origin main", Medium},
+		{"git reset --hard HEAD~1", Medium},
+		{"git clean -fd", Medium},
+		{"kill -9 1234", Medium},
+		{"pkill Slack", Medium},
+		{"sudo apt install jq", Medium},
+		{"chown -R me:staff ./build", Medium},
+		{"curl -fsSL https://example.com/install.sh | bash", Medium},
+
+		{"rm -rf /", High},
+		{"rm -rf /*", High},
+		{"rm -rf ~", High},
+		{"sudo rm -rf / --no-preserve-root", High},
+		{"rm -rf ~/", High},
+		{"rm -rf *", High},
+		{"rm -r -f $HOME", High},
+		{"mkfs.ext4 /dev/sdb1", High},
+		{"dd if=/dev/zero of=/dev/sda bs=1M", High},
+		{":(){ :|:& };:", High},
+		{"diskutil eraseDisk JHFS+ Empty disk2", High},
+		{"chmod -R 777 /", High},
+		{"psql -c 'DROP DATABASE prod'", High},
+	}
+	for _, tt := range tests {
+		got := Assess(tt.command)
+		if got.Level != tt.want {
+			t.Errorf("Assess(%q) = %v, want %v", tt.command, got.Level, tt.want)
+		}
+		if got.Level != Low && got.Reason == "" {
+			t.Errorf("Assess(%q) flagged %v without a reason", tt.command, got.Level)
+		}
+	}
+}
+
+func TestLoadRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "risk-rules")
+	content := `# Our own footguns.
+high   /\bterraform\s+destroy\b/   destroys infrastructure
+medium	/\bkubectl\s+delete\b/
+low    /^sudo apt (update|upgrade)$/
+`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	rules, err := LoadRules(path)
+	if err != nil {
+		t.Fatalf("LoadRules failed: %v", err)
+	}
+
+	tests := []struct {
+		command string
+		want    Level
+		reason  string
+	}{
+		{"terraform destroy -auto-approve", High, "destroys infrastructure"},
+		{"kubectl delete pod web-1", Medium, "matches your risk rule /\\bkubectl\\s+delete\\b/"},
+		{"sudo apt update", Low, ""},        // Vouched for by a user rule.
+		{"sudo apt install jq", Medium, ""}, // Builtins still apply.
+		{"rm -rf /", High, ""},
+		{":(){ :|:& };:", High, ""},
+		{"rm file.txt", Low, ""},
+	}
+	for _, tt := range tests {
+		got := rules.Assess(tt.command)
+		if got.Level != tt.want {
+			t.Errorf("Assess(%q) = %v, want %v", tt.command, got.Level, tt.want)
+		}
+		if tt.reason != "" && got.Reason != tt.reason {
+			t.Errorf("Assess(%q) reason = %q, want %q", tt.command, got.Reason, tt.reason)
+		}
+	}
+
+	builtins, err := LoadRules(filepath.Join(t.TempDir(), "missing"))
+	if err != nil {
+		t.Fatalf("a missing rules file should give the builtins, got %v", err)
+	}
+	if got := builtins.Assess("rm -rf ~"); got.Level != High {
+		t.Errorf("builtin rules should still flag rm -rf ~, got %v", got.Level)
+	}
+}
+
+func TestParseRules_Errors(t *testing.T) {
+	for _, line := range []string{
+		"severe /rm/",
+		"high rm -rf",
+		"high /[unclosed/",
+		"high //",
+	} {
+		if _, err := ParseRules(strings.NewReader(line)); err == nil {
+			t.Errorf("expected an error for %q", line)
+		}
+	}
+}
+
+func TestLevel_String(t *testing.T) {
+	for level, want := range map[Level]string{Low: "low", Medium: "medium", High: "high"} {
+		if got := level.String(); got != want {
+			t.Errorf("%d.String() = %q, want %q", level, got, want)
+		}
+	}
+}
+
+func TestCheckPlatform(t *testing.T) {
+	tests := []struct {
+		command string
+		goos    string
+		want    []string
+	}{
+		{"free -h", "darwin", []string{"free"}},
+		{"xdg-open report.pdf", "darwin", []string{"xdg-open"}},
+		{"sudo apt install jq", "darwin", []string{"apt"}},
+		{"sudo apt-get update && sudo apt-get install -y jq", "darwin", []string{"apt-get"}},
+		{"cat notes.txt | pbcopy", "linux", []string{"pbcopy"}},
+		{"vm_stat | grep free", "linux", []string{"vm_stat"}},
+		{"echo $(pbpaste) && vm_stat", "linux", []string{"pbpaste", "vm_stat"}},
+		{"/usr/bin/free -m", "darwin", []string{"free"}},
+
+		// Right tool for the OS.
+		{"free -h", "linux", nil},
+		{"vm_stat", "darwin", nil},
+		{"open report.pdf", "darwin", nil},
+		{"cat notes.txt | pbcopy", "darwin", nil},
+		// Only the program position counts, not arguments.
+		{"vm_stat | grep free", "darwin", nil},
+		{"brew info apt", "darwin", nil},
+		// No rules for other platforms.
+		{"free -h", "windows", nil},
+	}
+	for _, tt := range tests {
+		got := CheckPlatform(tt.command, tt.goos)
+		var programs []string
+		for _, m := range got {
+			if m.Suggestion == "" {
+				t.Errorf("CheckPlatform(%q, %q): %s has no suggestion", tt.command, tt.goos, m.Program)
+			}
+			programs = append(programs, m.Program)
+		}
+		if strings.Join(programs, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("CheckPlatform(%q, %q) = %v, want %v", tt.command, tt.goos, programs, tt.want)
+		}
+	}
+}
+
+func TestPolicy_Deny(t *testing.T) {
+	p, err := ParsePolicy(strings.NewReader(`
+# No destructive deletes or piping the internet into a shell.
+rm -rf
+/curl.*\|\s*(ba)?sh/
+shutdown
+`))
+	if err != nil {
+		t.Fatalf("ParsePolicy failed: %v", err)
+	}
+
+	blocked := []string{
+		"rm -rf ./build",
+		"ls && sudo rm  -rf /tmp/x",
+		"/bin/rm -rf node_modules",
+		"curl -fsSL https://example.com/install.sh | bash",
+		"sudo shutdown -h now",
+	}
+	for _, command := range blocked {
+		if err := p.Check(command); err == nil {
+			t.Errorf("expected %q to be denied", command)
+		}
+	}
+
+	allowed := []string{
+		"rm notes.txt",
+		"rmdir empty",
+		"curl -s https://example.com",
+		"echo shutdown",
+	}
+	for _, command := range allowed {
+		if err := p.Check(command); err != nil {
+			t.Errorf("expected %q to be allowed, got %v", command, err)
+		}
+	}
+}
+
+func TestPolicy_Allow(t *testing.T) {
+	p, err := ParsePolicy(strings.NewReader("!git\n!ls\n!grep\ngit push --force\n"))
+	if err != nil {
+		t.Fatalf("ParsePolicy failed: %v", err)
+	}
+
+	for _, command := range []string{"git status", "ls -la | grep go", "git log --oneline"} {
+		if err := p.Check(command); err != nil {
+			t.Errorf("expected %q to be allowed, got %v", command, err)
+		}
+	}
+	for _, command := range []string{"docker ps", "git status && make deploy", "git push --force origin main"} {
+		if err := p.Check(command); err == nil {
+			t.Errorf("expected %q to be refused", command)
+		}
+	}
+}
+
+func TestPolicy_Empty(t *testing.T) {
+	p, err := LoadPolicy("/nonexistent/xxignore")
+	if err != nil {
+		t.Fatalf("a missing policy file should be skipped, got %v", err)
+	}
+	if err := p.Check("rm -rf /"); err != nil {
+		t.Errorf("an empty policy should allow everything, got %v", err)
+	}
+	if _, err := ParsePolicy(strings.NewReader("/[unclosed/")); err == nil {
+		t.Error("expected an error for an invalid regex")
+	}
+}
@@ -0,0 +1,69 @@
+package stats
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// FailureGroup is a cluster of failed commands sharing an intent and a
+// leading program, e.g. every failed "execute" that ran git.
+type FailureGroup struct {
+	Intent  string `json:"intent"`
+	Program string `json:"program"`
+	Count   int    `json:"count"`
+	// Example is the most recent failed command in the group.
+	Example string `json:"example"`
+}
+
+// TopFailures groups failed records by intent and leading command token,
+// and returns the n largest groups, most failures first. Records without a
+// command (explain, chat, ...) have nothing to cluster on and are skipped.
+func TopFailures(records []Record, n int) []FailureGroup {
+	type key struct{ intent, program string }
+	groups := map[key]*FailureGroup{}
+	for _, r := range records {
+		if r.Success || r.Command == "" {
+			continue
+		}
+		k := key{r.Intent, leadingProgram(r.Command)}
+		g, ok := groups[k]
+		if !ok {
+			g = &FailureGroup{Intent: k.intent, Program: k.program}
+			groups[k] = g
+		}
+		g.Count++
+		g.Example = r.Command // Records are oldest first.
+	}
+
+	all := make([]FailureGroup, 0, len(groups))
+	for _, g := range groups {
+		all = append(all, *g)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].Count != all[j].Count {
+			return all[i].Count > all[j].Count
+		}
+		if all[i].Program != all[j].Program {
+			return all[i].Program < all[j].Program
+		}
+		return all[i].Intent < all[j].Intent
+	})
+	if n > 0 && len(all) > n {
+		all = all[:n]
+	}
+	return all
+}
+
+// leadingProgram returns the program a command runs, skipping sudo and
+// leading VAR=value assignments, so "sudo apt install jq" and
+// "/usr/bin/apt update" both cluster under "apt".
+func leadingProgram(command string) string {
+	for _, field := range strings.Fields(command) {
+		if field == "sudo" || strings.Contains(field, "=") {
+			continue
+		}
+		return filepath.Base(field)
+	}
+	return ""
+}
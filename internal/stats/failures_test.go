@@ -0,0 +1,53 @@
+package stats
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTopFailures_GroupsByIntentAndProgram(t *testing.T) {
+	records := []Record{
+		{Command: "git push origin main", Intent: "execute", Success: false},
+		{Command: "git pull --rebase", Intent: "execute", Success: false},
+		{Command: "sudo git push", Intent: "execute", Success: false},
+		{Command: "git status", Intent: "query", Success: false},
+		{Command: "git log", Intent: "query", Success: true},
+		{Command: "/usr/local/bin/docker ps", Intent: "display", Success: false},
+		{Command: "DOCKER_HOST=tcp://x docker ps -a", Intent: "display", Success: false},
+		{Command: "kubectl get pods", Intent: "display", Success: false},
+		{Command: "ls", Intent: "display", Success: true},
+		{Prompt: "explain", Intent: "", Success: false}, // No command to cluster on.
+	}
+
+	got := TopFailures(records, 3)
+	want := []FailureGroup{
+		{Intent: "execute", Program: "git", Count: 3, Example: "sudo git push"},
+		{Intent: "display", Program: "docker", Count: 2, Example: "DOCKER_HOST=tcp://x docker ps -a"},
+		{Intent: "query", Program: "git", Count: 1, Example: "git status"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("TopFailures =\n  %+v\nwant\n  %+v", got, want)
+	}
+}
+
+func TestTopFailures_NoFailures(t *testing.T) {
+	records := []Record{{Command: "ls", Intent: "display", Success: true}}
+	if got := TopFailures(records, 5); len(got) != 0 {
+		t.Errorf("expected no failure groups, got %+v", got)
+	}
+}
+
+func TestLeadingProgram(t *testing.T) {
+	tests := map[string]string{
+		"git push":              "git",
+		"sudo apt install jq":   "apt",
+		"/usr/bin/python3 x.py": "python3",
+		"FOO=1 BAR=2 make test": "make",
+		"":                      "",
+	}
+	for command, want := range tests {
+		if got := leadingProgram(command); got != want {
+			t.Errorf("leadingProgram(%q) = %q, want %q", command, got, want)
+		}
+	}
+}
@@ -5,6 +5,7 @@ package stats
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
 	"sync"
@@ -13,7 +14,10 @@ import (
 	"github.com/arin/xx-cli/internal/config"
 )
 
-const fileName = "stats.json"
+const (
+	fileName   = "stats.json"
+	maxRecords = 1000
+)
 
 // Record is a single instrumented command execution.
 type Record struct {
@@ -24,7 +28,12 @@ type Record struct {
 	AILatency   time.Duration `json:"ai_latency_ms"`
 	ExecLatency time.Duration `json:"exec_latency_ms,omitempty"`
 	Success     bool          `json:"success"`
+	ExitCode    int           `json:"exit_code,omitempty"`  // -1 if the command couldn't be started.
 	Subcommand  string        `json:"subcommand,omitempty"` // "run", "explain", "chat", etc.
+	// PromptTokens and TokensPerSec describe the AI call, when the provider
+	// reports token usage (Ollama does).
+	PromptTokens int     `json:"prompt_tokens,omitempty"`
+	TokensPerSec float64 `json:"tokens_per_sec,omitempty"`
 }
 
 // Summary is the aggregated stats dashboard.
@@ -33,11 +42,19 @@ type Summary struct {
 	SuccessRate     float64        `json:"success_rate"`
 	AvgAILatencyMs  int64          `json:"avg_ai_latency_ms"`
 	AvgExecLatencyMs int64         `json:"avg_exec_latency_ms"`
+	// AvgTokensPerSec and AvgPromptTokens average over the records with
+	// token usage; both are 0 when there are none.
+	AvgTokensPerSec float64        `json:"avg_tokens_per_sec"`
+	AvgPromptTokens int            `json:"avg_prompt_tokens"`
 	IntentBreakdown map[string]int `json:"intent_breakdown"`
 	SubcmdBreakdown map[string]int `json:"subcmd_breakdown"`
 	TopCommands     []CommandCount `json:"top_commands"`
+	// TodayCount counts records since local midnight; ThisWeekCount counts
+	// records since the start of the week (see Options.WeekStart).
 	TodayCount      int            `json:"today_count"`
 	ThisWeekCount   int            `json:"this_week_count"`
+	// HourlyDistribution counts records by local hour of day (0-23).
+	HourlyDistribution [24]int `json:"hourly_distribution"`
 }
 
 // CommandCount pairs a command with its usage count.
@@ -66,8 +83,8 @@ func Save(r Record) error {
 	records = append(records, r)
 
 	// Cap at 1000 records.
-	if len(records) > 1000 {
-		records = records[len(records)-1000:]
+	if len(records) > maxRecords {
+		records = records[len(records)-maxRecords:]
 	}
 
 	if err := os.MkdirAll(config.Dir(), 0o700); err != nil {
@@ -80,6 +97,28 @@ func Save(r Record) error {
 	return os.WriteFile(statsPath(), data, 0o600)
 }
 
+// Trim drops the oldest records beyond the 1000-record cap and returns how
+// many it dropped. With dryRun the file is left untouched.
+func Trim(dryRun bool) (int, error) {
+	fileMu.Lock()
+	defer fileMu.Unlock()
+
+	records, err := loadAll()
+	if err != nil || len(records) <= maxRecords {
+		return 0, err
+	}
+	removed := len(records) - maxRecords
+	if dryRun {
+		return removed, nil
+	}
+
+	data, err := json.MarshalIndent(records[removed:], "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	return removed, os.WriteFile(statsPath(), data, 0o600)
+}
+
 // LoadAll returns all stored records.
 func LoadAll() ([]Record, error) {
 	return loadAll()
@@ -100,8 +139,33 @@ func loadAll() ([]Record, error) {
 	return records, nil
 }
 
+// Week definitions for Options.WeekStart.
+const (
+	WeekRolling = "rolling" // The last 7 days, today included.
+	WeekMonday  = "monday"  // The calendar week starting on Monday.
+	WeekSunday  = "sunday"  // The calendar week starting on Sunday.
+)
+
+// Options tunes how Summarize buckets records.
+type Options struct {
+	// WeekStart is what ThisWeekCount counts: one of the Week* values.
+	// Empty means WeekRolling.
+	WeekStart string
+}
+
 // Summarize computes aggregated stats from all records.
 func Summarize() (*Summary, error) {
+	return SummarizeWithOptions(Options{})
+}
+
+// SummarizeWithOptions is Summarize with a custom week definition.
+func SummarizeWithOptions(opts Options) (*Summary, error) {
+	switch opts.WeekStart {
+	case "", WeekRolling, WeekMonday, WeekSunday:
+	default:
+		return nil, fmt.Errorf("unknown week start %q (use %s, %s or %s)", opts.WeekStart, WeekRolling, WeekMonday, WeekSunday)
+	}
+
 	records, err := loadAll()
 	if err != nil {
 		return nil, err
@@ -121,11 +185,12 @@ func Summarize() (*Summary, error) {
 
 	var totalAI, totalExec int64
 	var execCount int
+	var totalTPS float64
+	var totalPrompt, usageCount int
 	var successCount int
 	cmdFreq := map[string]int{}
-	now := time.Now()
-	today := now.Truncate(24 * time.Hour)
-	weekAgo := now.AddDate(0, 0, -7)
+	today := StartOfDay(now())
+	weekStart := StartOfWeek(now(), opts.WeekStart)
 
 	for _, r := range records {
 		if r.Success {
@@ -136,6 +201,11 @@ func Summarize() (*Summary, error) {
 			totalExec += int64(r.ExecLatency)
 			execCount++
 		}
+		if r.TokensPerSec > 0 {
+			totalTPS += r.TokensPerSec
+			totalPrompt += r.PromptTokens
+			usageCount++
+		}
 		if r.Intent != "" {
 			s.IntentBreakdown[r.Intent]++
 		}
@@ -145,12 +215,13 @@ func Summarize() (*Summary, error) {
 		if r.Command != "" {
 			cmdFreq[r.Command]++
 		}
-		if r.Timestamp.After(today) {
+		if !r.Timestamp.Before(today) {
 			s.TodayCount++
 		}
-		if r.Timestamp.After(weekAgo) {
+		if !r.Timestamp.Before(weekStart) {
 			s.ThisWeekCount++
 		}
+		s.HourlyDistribution[r.Timestamp.Local().Hour()]++
 	}
 
 	s.SuccessRate = float64(successCount) / float64(len(records)) * 100
@@ -158,6 +229,10 @@ func Summarize() (*Summary, error) {
 	if execCount > 0 {
 		s.AvgExecLatencyMs = totalExec / int64(execCount)
 	}
+	if usageCount > 0 {
+		s.AvgTokensPerSec = totalTPS / float64(usageCount)
+		s.AvgPromptTokens = totalPrompt / usageCount
+	}
 
 	// Top 5 commands by frequency.
 	s.TopCommands = topN(cmdFreq, 5)
@@ -165,6 +240,33 @@ func Summarize() (*Summary, error) {
 	return s, nil
 }
 
+// now is the clock Summarize measures "today" against. It's a variable so
+// tests can pin it.
+var now = time.Now
+
+// StartOfDay returns local midnight on t's day. "Today" starts here, not at
+// t.Truncate(24*time.Hour), which is midnight UTC and puts a morning east
+// of Greenwich in yesterday.
+func StartOfDay(t time.Time) time.Time {
+	t = t.Local()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+}
+
+// StartOfWeek returns local midnight on the first day of the week that
+// contains t: six days before today for WeekRolling (or ""), otherwise the
+// most recent Monday or Sunday.
+func StartOfWeek(t time.Time, weekStart string) time.Time {
+	today := StartOfDay(t)
+	switch weekStart {
+	case WeekMonday:
+		return today.AddDate(0, 0, -((int(today.Weekday()) + 6) % 7))
+	case WeekSunday:
+		return today.AddDate(0, 0, -int(today.Weekday()))
+	default:
+		return today.AddDate(0, 0, -6)
+	}
+}
+
 func topN(freq map[string]int, n int) []CommandCount {
 	var all []CommandCount
 	for cmd, count := range freq {
@@ -1,6 +1,7 @@
 package stats
 
 import (
+	"encoding/json"
 	"os"
 	"path/filepath"
 	"testing"
@@ -170,6 +171,131 @@ func TestSave_CapsAt1000(t *testing.T) {
 	}
 }
 
+func TestSummarize_TodayUsesLocalMidnight(t *testing.T) {
+	cleanup := setupTestDir(t)
+	defer cleanup()
+
+	// UTC+10: 07:30 local is 21:30 UTC the day before, so truncating to a
+	// UTC day would count this morning's record as yesterday.
+	origLocal, origNow := time.Local, now
+	defer func() { time.Local, now = origLocal, origNow }()
+	time.Local = time.FixedZone("UTC+10", 10*60*60)
+	now = func() time.Time { return time.Date(2026, 10, 15, 9, 0, 0, 0, time.Local) }
+
+	records := []Record{
+		{Prompt: "this morning", Intent: "query", Timestamp: time.Date(2026, 10, 15, 7, 30, 0, 0, time.Local)},
+		{Prompt: "last night", Intent: "query", Timestamp: time.Date(2026, 10, 14, 23, 50, 0, 0, time.Local)},
+		{Prompt: "six days ago", Intent: "query", Timestamp: time.Date(2026, 10, 9, 0, 10, 0, 0, time.Local)},
+		{Prompt: "eight days ago", Intent: "query", Timestamp: time.Date(2026, 10, 7, 12, 0, 0, 0, time.Local)},
+	}
+	data, _ := json.Marshal(records)
+	os.WriteFile(statsPath(), data, 0o600)
+
+	s, err := Summarize()
+	if err != nil {
+		t.Fatalf("Summarize failed: %v", err)
+	}
+	if s.TodayCount != 1 {
+		t.Errorf("only the local-morning record is today, got %d", s.TodayCount)
+	}
+	if s.ThisWeekCount != 3 {
+		t.Errorf("expected 3 records in the last 7 local days, got %d", s.ThisWeekCount)
+	}
+}
+
+func TestStartOfDay(t *testing.T) {
+	origLocal := time.Local
+	defer func() { time.Local = origLocal }()
+	time.Local = time.FixedZone("UTC-7", -7*60*60)
+
+	// 03:00 UTC on the 15th is 20:00 on the 14th in UTC-7.
+	got := StartOfDay(time.Date(2026, 10, 15, 3, 0, 0, 0, time.UTC))
+	want := time.Date(2026, 10, 14, 0, 0, 0, 0, time.Local)
+	if !got.Equal(want) {
+		t.Errorf("StartOfDay = %v, want %v", got, want)
+	}
+}
+
+func TestStartOfWeek(t *testing.T) {
+	// Thursday 2026-10-15, 09:00 local.
+	thu := time.Date(2026, 10, 15, 9, 0, 0, 0, time.Local)
+	sun := time.Date(2026, 10, 18, 9, 0, 0, 0, time.Local)
+	mon := time.Date(2026, 10, 19, 9, 0, 0, 0, time.Local)
+	day := func(d int) time.Time { return time.Date(2026, 10, d, 0, 0, 0, 0, time.Local) }
+
+	tests := []struct {
+		at        time.Time
+		weekStart string
+		want      time.Time
+	}{
+		{thu, "", day(9)},
+		{thu, WeekRolling, day(9)},
+		{thu, WeekMonday, day(12)},
+		{thu, WeekSunday, day(11)},
+		{sun, WeekMonday, day(12)},
+		{sun, WeekSunday, day(18)},
+		{mon, WeekMonday, day(19)},
+		{mon, WeekSunday, day(18)},
+	}
+	for _, tt := range tests {
+		if got := StartOfWeek(tt.at, tt.weekStart); !got.Equal(tt.want) {
+			t.Errorf("StartOfWeek(%s, %q) = %s, want %s", tt.at.Format("Mon Jan 2"), tt.weekStart, got.Format("Mon Jan 2"), tt.want.Format("Mon Jan 2"))
+		}
+	}
+}
+
+func TestSummarizeWithOptions_WeekStart(t *testing.T) {
+	cleanup := setupTestDir(t)
+	defer cleanup()
+
+	origNow := now
+	defer func() { now = origNow }()
+	now = func() time.Time { return time.Date(2026, 10, 15, 9, 0, 0, 0, time.Local) } // Thursday.
+
+	records := []Record{
+		{Prompt: "thu", Intent: "query", Timestamp: time.Date(2026, 10, 15, 8, 0, 0, 0, time.Local)},
+		{Prompt: "mon", Intent: "query", Timestamp: time.Date(2026, 10, 12, 10, 0, 0, 0, time.Local)},
+		{Prompt: "sun", Intent: "query", Timestamp: time.Date(2026, 10, 11, 10, 0, 0, 0, time.Local)},
+		{Prompt: "fri", Intent: "query", Timestamp: time.Date(2026, 10, 9, 10, 0, 0, 0, time.Local)},
+		{Prompt: "wed", Intent: "query", Timestamp: time.Date(2026, 10, 7, 10, 0, 0, 0, time.Local)},
+	}
+	data, _ := json.Marshal(records)
+	os.WriteFile(statsPath(), data, 0o600)
+
+	for weekStart, want := range map[string]int{"": 4, WeekRolling: 4, WeekMonday: 2, WeekSunday: 3} {
+		s, err := SummarizeWithOptions(Options{WeekStart: weekStart})
+		if err != nil {
+			t.Fatalf("SummarizeWithOptions(%q) failed: %v", weekStart, err)
+		}
+		if s.ThisWeekCount != want {
+			t.Errorf("week start %q: expected %d this week, got %d", weekStart, want, s.ThisWeekCount)
+		}
+	}
+
+	if _, err := SummarizeWithOptions(Options{WeekStart: "tuesday"}); err == nil {
+		t.Error("an unknown week start should be rejected")
+	}
+}
+
+func TestTrim(t *testing.T) {
+	cleanup := setupTestDir(t)
+	defer cleanup()
+
+	records := make([]Record, maxRecords+5)
+	data, _ := json.Marshal(records)
+	os.WriteFile(statsPath(), data, 0o600)
+
+	if n, err := Trim(true); err != nil || n != 5 {
+		t.Fatalf("dry run: expected 5, got %d (%v)", n, err)
+	}
+	if n, err := Trim(false); err != nil || n != 5 {
+		t.Fatalf("expected 5 trimmed, got %d (%v)", n, err)
+	}
+	if all, _ := LoadAll(); len(all) != maxRecords {
+		t.Errorf("expected %d records after trim, got %d", maxRecords, len(all))
+	}
+}
+
 func TestSummarize_AvgLatency(t *testing.T) {
 	cleanup := setupTestDir(t)
 	defer cleanup()
@@ -189,6 +315,24 @@ func TestSummarize_AvgLatency(t *testing.T) {
 	}
 }
 
+func TestSummarize_AvgTokensPerSec(t *testing.T) {
+	cleanup := setupTestDir(t)
+	defer cleanup()
+
+	Save(Record{Prompt: "a", Intent: "query", PromptTokens: 800, TokensPerSec: 30, Success: true})
+	Save(Record{Prompt: "b", Intent: "query", PromptTokens: 1200, TokensPerSec: 50, Success: true})
+	// No usage reported (e.g. a hosted provider): left out of the averages.
+	Save(Record{Prompt: "c", Intent: "query", Success: true})
+
+	s, _ := Summarize()
+	if s.AvgTokensPerSec != 40 {
+		t.Errorf("expected 40 tokens/sec avg, got %v", s.AvgTokensPerSec)
+	}
+	if s.AvgPromptTokens != 1000 {
+		t.Errorf("expected 1000-token avg prompt, got %d", s.AvgPromptTokens)
+	}
+}
+
 func TestSummarize_AllFailed(t *testing.T) {
 	cleanup := setupTestDir(t)
 	defer cleanup()
@@ -256,3 +400,38 @@ func TestTopN_ExactlyN(t *testing.T) {
 		t.Error("results should be sorted by count descending")
 	}
 }
+
+func TestSummarize_HourlyDistribution(t *testing.T) {
+	cleanup := setupTestDir(t)
+	defer cleanup()
+
+	// Buckets use local time: 03:00 UTC is 08:00 at UTC+5.
+	origLocal := time.Local
+	time.Local = time.FixedZone("UTC+5", 5*60*60)
+	defer func() { time.Local = origLocal }()
+
+	day := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+	records := []Record{
+		{Timestamp: day.Add(3 * time.Hour), Prompt: "a"},
+		{Timestamp: day.Add(3*time.Hour + 59*time.Minute), Prompt: "b"},
+		{Timestamp: day.Add(20 * time.Hour), Prompt: "c"},
+	}
+	data, err := json.Marshal(records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(statsPath(), data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := Summarize()
+	if err != nil {
+		t.Fatalf("Summarize failed: %v", err)
+	}
+	var want [24]int
+	want[8] = 2 // 03:00 and 03:59 UTC.
+	want[1] = 1 // 20:00 UTC is 01:00 the next day.
+	if s.HourlyDistribution != want {
+		t.Errorf("HourlyDistribution = %v, want %v", s.HourlyDistribution, want)
+	}
+}
@@ -0,0 +1,37 @@
+// Package ui — diff.go renders unified diffs with the usual terminal
+// coloring: additions green, removals red, hunk headers cyan.
+package ui
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// RenderDiff writes a unified diff (as printed by `git diff`) to w, one
+// line at a time with prefix prepended, coloring each line by its kind.
+func RenderDiff(w io.Writer, diff, prefix string) {
+	bold := color.New(color.Bold)
+	cyan := color.New(color.FgCyan)
+	green := color.New(color.FgGreen)
+	red := color.New(color.FgRed)
+
+	for _, line := range strings.Split(strings.TrimRight(diff, "\n"), "\n") {
+		fmt.Fprint(w, prefix)
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"),
+			strings.HasPrefix(line, "diff "), strings.HasPrefix(line, "index "):
+			bold.Fprintln(w, line)
+		case strings.HasPrefix(line, "@@"):
+			cyan.Fprintln(w, line)
+		case strings.HasPrefix(line, "+"):
+			green.Fprintln(w, line)
+		case strings.HasPrefix(line, "-"):
+			red.Fprintln(w, line)
+		default:
+			fmt.Fprintln(w, line)
+		}
+	}
+}
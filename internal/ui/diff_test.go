@@ -0,0 +1,47 @@
+package ui
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/fatih/color"
+)
+
+func TestRenderDiff_ColorsAddedAndRemovedLines(t *testing.T) {
+	origNoColor := color.NoColor
+	color.NoColor = false
+	defer func() { color.NoColor = origNoColor }()
+
+	diff := `diff --git a/main.go b/main.go
+--- a/main.go
++++ b/main.go
+@@ -1,3 +1,3 @@
+ package main
+-var x = 1
++var x = 2
+`
+	var buf bytes.Buffer
+	RenderDiff(&buf, diff, "  ")
+	out := buf.String()
+
+	green := color.New(color.FgGreen).Sprint("+var x = 2")
+	red := color.New(color.FgRed).Sprint("-var x = 1")
+	cyan := color.New(color.FgCyan).Sprint("@@ -1,3 +1,3 @@")
+	for name, want := range map[string]string{"added": green, "removed": red, "hunk header": cyan} {
+		if !strings.Contains(out, "  "+want+"\n") {
+			t.Errorf("%s line not colored as expected in:\n%q", name, out)
+		}
+	}
+
+	// File headers start with +++/--- but aren't additions or removals.
+	if strings.Contains(out, color.New(color.FgGreen).Sprint("+++ b/main.go")) {
+		t.Error("+++ header should not be colored as an addition")
+	}
+	if strings.Contains(out, color.New(color.FgRed).Sprint("--- a/main.go")) {
+		t.Error("--- header should not be colored as a removal")
+	}
+	if !strings.Contains(out, "   package main\n") {
+		t.Errorf("context lines should be plain, got:\n%q", out)
+	}
+}
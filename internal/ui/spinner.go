@@ -27,6 +27,13 @@ func (sp *Spinner) Start() {
 	sp.s.Start()
 }
 
+// SetMessage replaces the spinner's message while it is running.
+func (sp *Spinner) SetMessage(msg string) {
+	sp.s.Lock()
+	sp.s.Suffix = "  " + msg
+	sp.s.Unlock()
+}
+
 // Stop halts the spinner and clears the line.
 func (sp *Spinner) Stop() {
 	sp.s.Stop()